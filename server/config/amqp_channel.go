@@ -0,0 +1,51 @@
+package config
+
+import (
+	"context"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// IAMQPChannel is the part of *amqp091.Channel that the publisher and the consumer use.
+// The real channel satisfies it as-is; a fake that does too lets them run without a broker.
+type IAMQPChannel interface {
+	amqp091.Acknowledger // Ack, Nack and Reject, by delivery tag
+
+	// Publishing
+	PublishWithDeferredConfirmWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp091.Publishing) (*amqp091.DeferredConfirmation, error)
+	Confirm(noWait bool) error
+	NotifyReturn(returns chan amqp091.Return) chan amqp091.Return
+	ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp091.Table) error
+
+	// Consuming
+	Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp091.Table) (<-chan amqp091.Delivery, error)
+	Qos(prefetchCount, prefetchSize int, global bool) error
+	Cancel(consumer string, noWait bool) error
+
+	// Queues
+	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp091.Table) (amqp091.Queue, error)
+	QueueDeclarePassive(name string, durable, autoDelete, exclusive, noWait bool, args amqp091.Table) (amqp091.Queue, error)
+	QueuePurge(name string, noWait bool) (int, error)
+
+	// Lifecycle
+	NotifyClose(closed chan *amqp091.Error) chan *amqp091.Error
+	Close() error
+	IsClosed() bool
+}
+
+// IRabbitMQConnection is what the publisher and the consumer need from their connection.
+// RabbitMQConection is the real one.
+type IRabbitMQConnection interface {
+	GetChannel() (IAMQPChannel, error)
+	IsConnected() bool
+	DeclareQueue(queueName string) error
+	InspectQueue(queueName string) (amqp091.Queue, error)
+	PurgeQueue(queueName string) (int, error)
+	Close()
+}
+
+// Compile-time checks: the real types keep satisfying the interfaces.
+var (
+	_ IAMQPChannel        = (*amqp091.Channel)(nil)
+	_ IRabbitMQConnection = (*RabbitMQConection)(nil)
+)
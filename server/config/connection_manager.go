@@ -0,0 +1,44 @@
+package config
+
+import "sync"
+
+// ConnectionManager hands out the app's RabbitMQ connections, one per role, so the
+// publisher and every consumer (the kitchen's and the DLQ's) share them instead of
+// each dialing its own. It is built once in main.go and passed to the services.
+// By default publishing and consuming keep separate connections, so the broker
+// throttling a busy publisher never stalls the consumers' acks.
+// RABBIT_MQ_SHARED_CONNECTION=true puts everything on a single connection.
+type ConnectionManager struct {
+	connections map[string]*RabbitMQConection // Role ("publisher", "consumer") -> its connection
+	shared      bool                          // Every role gets the same connection
+	mutex       sync.Mutex                    // Guards 'connections'
+}
+
+// Connection returns the connection for a role, dialing it on first use.
+// Every caller is a user: the connection closes when the last of them calls Close.
+func (cm *ConnectionManager) Connection(role string) IRabbitMQConnection {
+	if cm.shared {
+		role = "shared"
+	}
+
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	conn, ok := cm.connections[role]
+	if !ok {
+		conn = GetNewRabbitMQConnection(role)
+		cm.connections[role] = conn
+	}
+	conn.mutex.Lock()
+	conn.users++
+	conn.mutex.Unlock()
+	return conn
+}
+
+// GetConnectionManager is the Constructor. Nothing is dialed until a role is asked for.
+func GetConnectionManager() *ConnectionManager {
+	return &ConnectionManager{
+		connections: make(map[string]*RabbitMQConection),
+		shared:      GetEnvPropertyAsBool("rabbit_mq_shared_connection", false),
+	}
+}
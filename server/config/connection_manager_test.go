@@ -0,0 +1,76 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// countDials swaps dialRabbitMQ for one that records the connection names it was asked for.
+func countDials(t *testing.T) *[]any {
+	t.Helper()
+
+	var names []any
+	realDial := dialRabbitMQ
+	dialRabbitMQ = func(url string, config amqp091.Config) (*amqp091.Connection, error) {
+		names = append(names, config.Properties["connection_name"])
+		return nil, nil
+	}
+	t.Cleanup(func() { dialRabbitMQ = realDial })
+	return &names
+}
+
+func TestConsumersShareOneConnection(t *testing.T) {
+	withEnv(t, map[string]string{"RABBIT_MQ_PORT": "5672", "RABBIT_MQ_SHARED_CONNECTION": ""})
+	dials := countDials(t)
+
+	cm := GetConnectionManager()
+	publisher := cm.Connection("publisher")
+	kitchen := cm.Connection("consumer")
+	dlq := cm.Connection("consumer")
+
+	if kitchen != dlq {
+		t.Error("the kitchen and DLQ consumers got different connections")
+	}
+	if publisher == kitchen {
+		t.Error("publishing shares the consumers' connection without RABBIT_MQ_SHARED_CONNECTION")
+	}
+	if len(*dials) != 2 {
+		t.Errorf("dialed %v, want one publisher and one consumer connection", *dials)
+	}
+}
+
+func TestSharedConnectionServesEveryRole(t *testing.T) {
+	withEnv(t, map[string]string{"RABBIT_MQ_PORT": "5672", "RABBIT_MQ_SHARED_CONNECTION": "true"})
+	dials := countDials(t)
+
+	cm := GetConnectionManager()
+	publisher := cm.Connection("publisher")
+	consumer := cm.Connection("consumer")
+
+	if publisher != consumer {
+		t.Error("the publisher and the consumer got different connections")
+	}
+	if len(*dials) != 1 || (*dials)[0] != "pizza-shop-shared" {
+		t.Errorf("dialed %v, want the single shared connection", *dials)
+	}
+}
+
+func TestSharedConnectionClosesWithItsLastUser(t *testing.T) {
+	withEnv(t, map[string]string{"RABBIT_MQ_PORT": "5672", "RABBIT_MQ_SHARED_CONNECTION": "true"})
+	countDials(t)
+
+	cm := GetConnectionManager()
+	cm.Connection("publisher")
+	cm.Connection("consumer").Close()
+
+	shared := cm.connections["shared"]
+	if shared.users != 1 {
+		t.Errorf("after one Close: %d user(s), want the publisher still holding it", shared.users)
+	}
+	cm.Connection("publisher").Close()
+	shared.Close()
+	if shared.users != 0 {
+		t.Errorf("after every Close: %d user(s), want 0", shared.users)
+	}
+}
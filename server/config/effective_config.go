@@ -0,0 +1,80 @@
+package config
+
+import (
+    "fmt"
+    "reflect"
+    "strings"
+    "sync"
+
+    "github.com/everestp/pizza-shop/logger"
+)
+
+// 11. Startup Self-Check
+// LogEffectiveConfig prints what the app actually runs with, so operators can check
+// it without guessing which env file, flag or default won. Secrets are shown as "***".
+var (
+    defaultsUsed  = map[string]any{}
+    defaultsMutex sync.Mutex
+)
+
+// rememberDefault notes the fallback a typed getter returned for an unset field.
+func rememberDefault(propertyKey string, fallback any) {
+    defaultsMutex.Lock()
+    defer defaultsMutex.Unlock()
+
+    defaultsUsed[propertyKey] = fallback
+}
+
+// isSecret is true for fields whose value must never reach the logs.
+func isSecret(propertyKey string) bool {
+    for _, word := range []string{"password", "secret", "token"} {
+        if strings.Contains(propertyKey, word) {
+            return true
+        }
+    }
+    return false
+}
+
+// EffectiveConfig lists every setting that has a value as "key=value", in ConfigDto order.
+// Unset fields show the default the app fell back to (marked "(default)"); fields that
+// are unset and have no default yet are left out.
+func EffectiveConfig() []string {
+    if env.port == "" {
+        ConfigEnv()
+    }
+    defaultsMutex.Lock()
+    defer defaultsMutex.Unlock()
+
+    t := reflect.TypeOf(env)
+    settings := make([]string, 0, t.NumField())
+    for i := 0; i < t.NumField(); i++ {
+        key := t.Field(i).Name
+        val, overridden := flagOverride(key)
+        if !overridden {
+            var err error
+            if val, err = fieldString(reflect.ValueOf(env).Field(i)); err != nil {
+                val = fmt.Sprintf("<%v>", err)
+            }
+        }
+
+        switch {
+        case val != "" && isSecret(key):
+            settings = append(settings, key+"=***")
+        case val != "" && overridden:
+            settings = append(settings, fmt.Sprintf("%s=%s (flag)", key, val))
+        case val != "":
+            settings = append(settings, fmt.Sprintf("%s=%s", key, val))
+        default:
+            if fallback, ok := defaultsUsed[key]; ok {
+                settings = append(settings, fmt.Sprintf("%s=%v (default)", key, fallback))
+            }
+        }
+    }
+    return settings
+}
+
+// LogEffectiveConfig logs EffectiveConfig as one line. Call it once everything is wired up,
+// so the defaults picked along the way are included.
+func LogEffectiveConfig() {
+    logger.Log(fmt.Sprintf("Effective config: %s", strings.Join(EffectiveConfig(), " ")))
+}
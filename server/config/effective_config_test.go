@@ -0,0 +1,41 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEffectiveConfigHidesSecrets(t *testing.T) {
+	withEnv(t, map[string]string{
+		"PORT":               "9090",
+		"ADMIN_TOKEN":        "admin-tok",
+		"JWT_SECRET":         "jwt-secret",
+		"RABBIT_MQ_PASSWORD": "rabbit-pw",
+	})
+
+	settings := strings.Join(EffectiveConfig(), " ")
+	for _, want := range []string{"port=9090", "admin_token=***", "jwt_secret=***", "rabbit_mq_password=***"} {
+		if !strings.Contains(settings, want) {
+			t.Errorf("missing %q in %s", want, settings)
+		}
+	}
+	for _, secret := range []string{"admin-tok", "jwt-secret", "rabbit-pw"} {
+		if strings.Contains(settings, secret) {
+			t.Errorf("secret %q reached the effective config: %s", secret, settings)
+		}
+	}
+}
+
+func TestEffectiveConfigShowsDefaultsUsed(t *testing.T) {
+	withEnv(t, map[string]string{"CHANNEL_OPEN_RETRIES": ""})
+
+	GetEnvPropertyAsInt("channel_open_retries", 3)
+	settings := EffectiveConfig()
+	found := false
+	for _, setting := range settings {
+		found = found || setting == "channel_open_retries=3 (default)"
+	}
+	if !found {
+		t.Errorf("the default is not shown: %v", settings)
+	}
+}
@@ -4,6 +4,7 @@ import (
     "fmt"
     "os"
     "reflect"
+    "strconv"
 
     "github.com/everestp/pizza-shop/logger"
     "github.com/joho/godotenv"
@@ -24,6 +25,95 @@ type ConfigDto struct {
     rabbit_mq_password      string
     rabbit_mq_port          string
     rabbit_mq_default_queue string
+    shutdown_timeout        string
+    jwt_secret              string
+    ws_batch_window         string
+    stats_push_interval     string
+    rabbit_mq_heartbeat     string
+    rabbit_mq_conn_timeout  string
+    event_log_file          string
+    event_log_capacity      string
+    tax_rate                string
+    consumer_concurrency    string
+    max_consumer_concurrency string
+    admin_token             string
+    pending_notification_ttl string
+    consumer_auto_ack       string
+    max_order_body_bytes    string
+    kitchen_queue_max_length string
+    kitchen_queue_overflow  string
+    kitchen_regions         string
+    consumer_regions        string
+    message_broker          string
+    memory_queue_capacity   string
+    order_slas              string
+    sla_check_interval      string
+    ws_write_timeout        string
+    ws_send_retry_window    string
+    ws_send_queue_size      string
+    consumer_ack_batch_size string
+    consumer_ack_batch_window string
+    seed_orders             string
+    seed_orders_rate        string
+    publish_exchange_type   string
+    kitchen_dlq_enabled     string
+    dlq_reprocess_delay     string
+    dlq_max_attempts        string
+    otel_traces_exporter    string
+    max_retry_count         string
+    ws_ping_interval        string
+    order_webhook_url       string
+    order_webhook_secret    string
+    order_webhook_timeout   string
+    order_webhook_max_attempts string
+    request_timeout         string
+    ws_pretty_json          string
+    message_processing_timeout string
+    processing_timeout_requeue string
+    ws_welcome_mode         string
+    ws_welcome_message      string
+    order_number_strategy   string
+    order_number_prefix     string
+    order_number_state_file string
+    purge_queue_on_start    string
+    channel_open_retries    string
+    channel_open_backoff    string
+    max_order_notes_length  string
+    per_order_concurrency   string
+    ws_max_frame_bytes      string
+    http_gzip_level         string
+    order_max_age_seconds   string
+    order_eviction_interval string
+    serve_demo_ui           string
+    ws_reap_interval        string
+    consumer_rate_log_interval string
+    rabbit_mq_connection_name string
+    publish_mandatory       string
+    order_tags              string
+    replay_max_minutes      string
+    replay_max_events       string
+    queue_name_prefix       string
+    kitchen_max_in_flight   string
+    ws_subprotocols         string
+    ws_subprotocol_policy   string
+    max_order_items         string
+    rabbit_mq_shared_connection string
+    consumer_breaker_threshold string
+    consumer_breaker_cooldown string
+    health_probe_timeout    string
+    health_probe_retries    string
+    log_output              string
+    log_sample_rate         string
+    app_version             string
+    nack_policy             string
+    ws_delivery_receipts    string
+    ws_receipt_window       string
+    ws_receipt_max_pending  string
+    order_status_labels     string
+    ws_frame_type           string
+    ws_length_prefix        string
+    message_dedup_window    string
+    message_dedup_max_ids   string
 }
 
 // 3. The Loader
@@ -37,6 +127,95 @@ func ConfigEnv() {
         rabbit_mq_password:      os.Getenv("RABBIT_MQ_PASSWORD"),
         rabbit_mq_port:          os.Getenv("RABBIT_MQ_PORT"),
         rabbit_mq_default_queue: os.Getenv("RABBIT_MQ_DEFAULT_QUEUE"),
+        shutdown_timeout:        os.Getenv("SHUTDOWN_TIMEOUT_SECONDS"),
+        jwt_secret:              os.Getenv("JWT_SECRET"),
+        ws_batch_window:         os.Getenv("WS_BATCH_WINDOW_MS"),
+        stats_push_interval:     os.Getenv("STATS_PUSH_INTERVAL_SECONDS"),
+        rabbit_mq_heartbeat:     os.Getenv("RABBIT_MQ_HEARTBEAT_SECONDS"),
+        rabbit_mq_conn_timeout:  os.Getenv("RABBIT_MQ_CONNECTION_TIMEOUT_SECONDS"),
+        event_log_file:          os.Getenv("EVENT_LOG_FILE"),
+        event_log_capacity:      os.Getenv("EVENT_LOG_CAPACITY"),
+        tax_rate:                os.Getenv("TAX_RATE"),
+        consumer_concurrency:    os.Getenv("CONSUMER_CONCURRENCY"),
+        max_consumer_concurrency: os.Getenv("MAX_CONSUMER_CONCURRENCY"),
+        admin_token:             os.Getenv("ADMIN_TOKEN"),
+        pending_notification_ttl: os.Getenv("PENDING_NOTIFICATION_TTL_SECONDS"),
+        consumer_auto_ack:       os.Getenv("CONSUMER_AUTO_ACK"),
+        max_order_body_bytes:    os.Getenv("MAX_ORDER_BODY_BYTES"),
+        kitchen_queue_max_length: os.Getenv("KITCHEN_QUEUE_MAX_LENGTH"),
+        kitchen_queue_overflow:  os.Getenv("KITCHEN_QUEUE_OVERFLOW"),
+        kitchen_regions:         os.Getenv("KITCHEN_REGIONS"),
+        consumer_regions:        os.Getenv("CONSUMER_REGIONS"),
+        message_broker:          os.Getenv("MESSAGE_BROKER"),
+        memory_queue_capacity:   os.Getenv("MEMORY_QUEUE_CAPACITY"),
+        order_slas:              os.Getenv("ORDER_SLAS"),
+        sla_check_interval:      os.Getenv("SLA_CHECK_INTERVAL_SECONDS"),
+        ws_write_timeout:        os.Getenv("WS_WRITE_TIMEOUT_MS"),
+        ws_send_retry_window:    os.Getenv("WS_SEND_RETRY_WINDOW_MS"),
+        ws_send_queue_size:      os.Getenv("WS_SEND_QUEUE_SIZE"),
+        consumer_ack_batch_size: os.Getenv("CONSUMER_ACK_BATCH_SIZE"),
+        consumer_ack_batch_window: os.Getenv("CONSUMER_ACK_BATCH_WINDOW_MS"),
+        seed_orders:             os.Getenv("SEED_ORDERS"),
+        seed_orders_rate:        os.Getenv("SEED_ORDERS_PER_SECOND"),
+        publish_exchange_type:   os.Getenv("PUBLISH_EXCHANGE_TYPE"),
+        kitchen_dlq_enabled:     os.Getenv("KITCHEN_DLQ_ENABLED"),
+        dlq_reprocess_delay:     os.Getenv("DLQ_REPROCESS_DELAY_SECONDS"),
+        dlq_max_attempts:        os.Getenv("DLQ_MAX_ATTEMPTS"),
+        otel_traces_exporter:    os.Getenv("OTEL_TRACES_EXPORTER"),
+        max_retry_count:         os.Getenv("MAX_RETRY_COUNT"),
+        ws_ping_interval:        os.Getenv("WS_PING_INTERVAL_SECONDS"),
+        order_webhook_url:       os.Getenv("ORDER_WEBHOOK_URL"),
+        order_webhook_secret:    os.Getenv("ORDER_WEBHOOK_SECRET"),
+        order_webhook_timeout:   os.Getenv("ORDER_WEBHOOK_TIMEOUT_MS"),
+        order_webhook_max_attempts: os.Getenv("ORDER_WEBHOOK_MAX_ATTEMPTS"),
+        request_timeout:         os.Getenv("REQUEST_TIMEOUT_MS"),
+        ws_pretty_json:          os.Getenv("WS_PRETTY_JSON"),
+        message_processing_timeout: os.Getenv("MESSAGE_PROCESSING_TIMEOUT_MS"),
+        processing_timeout_requeue: os.Getenv("PROCESSING_TIMEOUT_REQUEUE"),
+        ws_welcome_mode:         os.Getenv("WS_WELCOME_MODE"),
+        ws_welcome_message:      os.Getenv("WS_WELCOME_MESSAGE"),
+        order_number_strategy:   os.Getenv("ORDER_NUMBER_STRATEGY"),
+        order_number_prefix:     os.Getenv("ORDER_NUMBER_PREFIX"),
+        order_number_state_file: os.Getenv("ORDER_NUMBER_STATE_FILE"),
+        purge_queue_on_start:    os.Getenv("PURGE_QUEUE_ON_START"),
+        channel_open_retries:    os.Getenv("CHANNEL_OPEN_RETRIES"),
+        channel_open_backoff:    os.Getenv("CHANNEL_OPEN_BACKOFF_MS"),
+        max_order_notes_length:  os.Getenv("MAX_ORDER_NOTES_LENGTH"),
+        per_order_concurrency:   os.Getenv("PER_ORDER_CONCURRENCY"),
+        ws_max_frame_bytes:      os.Getenv("WS_MAX_FRAME_BYTES"),
+        http_gzip_level:         os.Getenv("HTTP_GZIP_LEVEL"),
+        order_max_age_seconds:   os.Getenv("ORDER_MAX_AGE_SECONDS"),
+        order_eviction_interval: os.Getenv("ORDER_EVICTION_INTERVAL"),
+        serve_demo_ui:           os.Getenv("SERVE_DEMO_UI"),
+        ws_reap_interval:        os.Getenv("WS_REAP_INTERVAL"),
+        consumer_rate_log_interval: os.Getenv("CONSUMER_RATE_LOG_INTERVAL"),
+        rabbit_mq_connection_name: os.Getenv("RABBIT_MQ_CONNECTION_NAME"),
+        publish_mandatory:       os.Getenv("PUBLISH_MANDATORY"),
+        order_tags:              os.Getenv("ORDER_TAGS"),
+        replay_max_minutes:      os.Getenv("REPLAY_MAX_MINUTES"),
+        replay_max_events:       os.Getenv("REPLAY_MAX_EVENTS"),
+        queue_name_prefix:       os.Getenv("QUEUE_NAME_PREFIX"),
+        kitchen_max_in_flight:   os.Getenv("KITCHEN_MAX_IN_FLIGHT"),
+        ws_subprotocols:         os.Getenv("WS_SUBPROTOCOLS"),
+        ws_subprotocol_policy:   os.Getenv("WS_SUBPROTOCOL_POLICY"),
+        max_order_items:         os.Getenv("MAX_ORDER_ITEMS"),
+        rabbit_mq_shared_connection: os.Getenv("RABBIT_MQ_SHARED_CONNECTION"),
+        consumer_breaker_threshold: os.Getenv("CONSUMER_BREAKER_THRESHOLD"),
+        consumer_breaker_cooldown: os.Getenv("CONSUMER_BREAKER_COOLDOWN_SECONDS"),
+        health_probe_timeout:    os.Getenv("HEALTH_PROBE_TIMEOUT_MS"),
+        health_probe_retries:    os.Getenv("HEALTH_PROBE_RETRIES"),
+        log_output:              os.Getenv("LOG_OUTPUT"),
+        log_sample_rate:         os.Getenv("LOG_SAMPLE_RATE"),
+        app_version:             os.Getenv("APP_VERSION"),
+        nack_policy:             os.Getenv("NACK_POLICY"),
+        ws_delivery_receipts:    os.Getenv("WS_DELIVERY_RECEIPTS"),
+        ws_receipt_window:       os.Getenv("WS_RECEIPT_WINDOW_MS"),
+        ws_receipt_max_pending:  os.Getenv("WS_RECEIPT_MAX_PENDING"),
+        order_status_labels:     os.Getenv("ORDER_STATUS_LABELS"),
+        ws_frame_type:           os.Getenv("WS_FRAME_TYPE"),
+        ws_length_prefix:        os.Getenv("WS_LENGTH_PREFIX"),
+        message_dedup_window:    os.Getenv("MESSAGE_DEDUP_WINDOW_SECONDS"),
+        message_dedup_max_ids:   os.Getenv("MESSAGE_DEDUP_MAX_IDS"),
     }
 }
 
@@ -67,8 +246,27 @@ func accessField(key string) (string, error) {
     }
 
     // Return the string value of that field
-    f := v.FieldByName(key)
-    return f.String(), nil
+    return fieldString(v.FieldByName(key))
+}
+
+// fieldString formats a config field as the text it would have in the environment.
+// Every field is a string today, but f.String() on e.g. an int returns "<int Value>",
+// so numbers and bools are formatted by kind instead.
+func fieldString(f reflect.Value) (string, error) {
+    switch f.Kind() {
+    case reflect.String:
+        return f.String(), nil
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+        return strconv.FormatInt(f.Int(), 10), nil
+    case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+        return strconv.FormatUint(f.Uint(), 10), nil
+    case reflect.Float32, reflect.Float64:
+        return strconv.FormatFloat(f.Float(), 'g', -1, f.Type().Bits()), nil
+    case reflect.Bool:
+        return strconv.FormatBool(f.Bool()), nil
+    default:
+        return "", fmt.Errorf("unsupported config field type: %s", f.Kind())
+    }
 }
 
 // 6. Dotenv Loader
@@ -94,9 +292,65 @@ func GetEnvProperty(propertyKey string) string {
         ConfigEnv()
     }
     
+    // Command-line flags win over env vars (see ApplyFlagOverrides).
+    if val, ok := flagOverride(propertyKey); ok {
+        return val
+    }
+
     val, err := accessField(propertyKey)
     if err != nil {
         logger.Log(fmt.Sprintf("Error accessing config field: %v", propertyKey))
     }
     return val
-}
\ No newline at end of file
+}
+
+// 8. Typed Helpers
+// Most of our settings are plain strings, but some (timeouts, limits) are numbers.
+// This parses the property as an int and falls back to a default when it's unset or broken.
+// Usage: config.GetEnvPropertyAsInt("shutdown_timeout", 30)
+func GetEnvPropertyAsInt(propertyKey string, fallback int) int {
+    val := GetEnvProperty(propertyKey)
+    if val == "" {
+        rememberDefault(propertyKey, fallback)
+        return fallback
+    }
+
+    parsed, err := strconv.Atoi(val)
+    if err != nil {
+        logger.Log(fmt.Sprintf("Invalid number for config field %v: %v (using %d)", propertyKey, val, fallback))
+        return fallback
+    }
+    return parsed
+}
+
+// GetEnvPropertyAsFloat is the decimal version (e.g. TAX_RATE=0.13).
+func GetEnvPropertyAsFloat(propertyKey string, fallback float64) float64 {
+    val := GetEnvProperty(propertyKey)
+    if val == "" {
+        rememberDefault(propertyKey, fallback)
+        return fallback
+    }
+
+    parsed, err := strconv.ParseFloat(val, 64)
+    if err != nil {
+        logger.Log(fmt.Sprintf("Invalid number for config field %v: %v (using %v)", propertyKey, val, fallback))
+        return fallback
+    }
+    return parsed
+}
+
+// GetEnvPropertyAsBool reads flags like CONSUMER_AUTO_ACK=true (also accepts 1/0, t/f).
+func GetEnvPropertyAsBool(propertyKey string, fallback bool) bool {
+    val := GetEnvProperty(propertyKey)
+    if val == "" {
+        rememberDefault(propertyKey, fallback)
+        return fallback
+    }
+
+    parsed, err := strconv.ParseBool(val)
+    if err != nil {
+        logger.Log(fmt.Sprintf("Invalid boolean for config field %v: %v (using %t)", propertyKey, val, fallback))
+        return fallback
+    }
+    return parsed
+}
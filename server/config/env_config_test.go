@@ -0,0 +1,44 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFieldStringFormatsEachKind(t *testing.T) {
+	// A config struct with every kind a field could be, unexported like ConfigDto's.
+	mixed := struct {
+		host     string
+		port     int
+		workers  int8
+		maxBytes uint64
+		rate     float64
+		ratio    float32
+		enabled  bool
+		queues   []string
+	}{"localhost", 5672, -3, 1 << 20, 0.13, 0.5, true, []string{"kitchen"}}
+
+	value := reflect.ValueOf(mixed)
+	want := map[string]string{
+		"host":     "localhost",
+		"port":     "5672",
+		"workers":  "-3",
+		"maxBytes": "1048576",
+		"rate":     "0.13",
+		"ratio":    "0.5",
+		"enabled":  "true",
+	}
+	for i := 0; i < value.NumField(); i++ {
+		name := value.Type().Field(i).Name
+		got, err := fieldString(value.Field(i))
+		if name == "queues" {
+			if err == nil {
+				t.Errorf("queues: got %q, want an unsupported type error", got)
+			}
+			continue
+		}
+		if err != nil || got != want[name] {
+			t.Errorf("%s: got %q, %v; want %q", name, got, err, want[name])
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+    "fmt"
+    "os"
+    "strconv"
+    "strings"
+    "sync"
+
+    "github.com/everestp/pizza-shop/logger"
+)
+
+// 9. Feature Flags
+// New behaviors are switched on and off per environment with FEATURE_<NAME> variables
+// (e.g. FEATURE_AUTO_ACK=true). The ones the app knows about are loaded once into
+// FeatureFlags; anything else can still be asked for by name with FeatureEnabled.
+const featureFlagPrefix = "FEATURE_"
+
+// FeatureFlags is every known flag, read once at startup.
+type FeatureFlags struct {
+    AutoAck        bool // FEATURE_AUTO_ACK: the broker acks on delivery (falls back to CONSUMER_AUTO_ACK)
+    WelcomeMessage bool // FEATURE_WELCOME_MESSAGE: greet new sockets (default on; WS_WELCOME_MODE picks the format)
+}
+
+var (
+    flags     FeatureFlags
+    flagsOnce sync.Once
+)
+
+// GetFlags returns the feature flags, loading them on first use.
+func GetFlags() FeatureFlags {
+    flagsOnce.Do(func() {
+        flags = FeatureFlags{
+            AutoAck:        FeatureFlag("auto_ack", GetEnvPropertyAsBool("consumer_auto_ack", false)),
+            WelcomeMessage: FeatureFlag("welcome_message", true),
+        }
+    })
+    return flags
+}
+
+// FeatureEnabled reports whether FEATURE_<NAME> is on. Unset or unknown flags are off.
+func FeatureEnabled(name string) bool {
+    return FeatureFlag(name, false)
+}
+
+// FeatureFlag reads FEATURE_<NAME> as a boolean and falls back when it's unset or broken.
+// Usage: config.FeatureFlag("dlq", false) reads FEATURE_DLQ.
+func FeatureFlag(name string, fallback bool) bool {
+    // Make sure .env has been loaded before we read the environment directly.
+    if env.port == "" {
+        ConfigEnv()
+    }
+
+    key := featureFlagPrefix + strings.ToUpper(name)
+    val := os.Getenv(key)
+    if val == "" {
+        return fallback
+    }
+
+    parsed, err := strconv.ParseBool(val)
+    if err != nil {
+        logger.Log(fmt.Sprintf("Invalid boolean for feature flag %v: %v (using %t)", key, val, fallback))
+        return fallback
+    }
+    return parsed
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestFeatureFlag(t *testing.T) {
+	cases := []struct {
+		name     string
+		value    string // "" leaves FEATURE_DLQ unset
+		fallback bool
+		want     bool
+	}{
+		{name: "unset falls back", fallback: true, want: true},
+		{name: "on", value: "true", want: true},
+		{name: "off", value: "0", fallback: true, want: false},
+		{name: "broken falls back", value: "maybe", fallback: true, want: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.value != "" {
+				withEnv(t, map[string]string{"FEATURE_DLQ": tc.value})
+			}
+			if got := FeatureFlag("dlq", tc.fallback); got != tc.want {
+				t.Errorf("got %t, want %t", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestUnknownFeatureIsOff(t *testing.T) {
+	if FeatureEnabled("time_travel") {
+		t.Error("an unset flag is on")
+	}
+	withEnv(t, map[string]string{"FEATURE_PRIORITY": "yes"}) // Not a boolean strconv knows
+	if FeatureEnabled("priority") {
+		t.Error("a flag with a broken value is on")
+	}
+}
+
+// reloadFlags makes GetFlags read the environment again, and again after the test.
+func reloadFlags(t *testing.T) {
+	flagsOnce = sync.Once{}
+	t.Cleanup(func() { flagsOnce = sync.Once{} })
+}
+
+func TestFlagsDefaults(t *testing.T) {
+	reloadFlags(t)
+	withEnv(t, map[string]string{"FEATURE_AUTO_ACK": "", "CONSUMER_AUTO_ACK": "", "FEATURE_WELCOME_MESSAGE": ""})
+
+	if got := GetFlags(); got != (FeatureFlags{AutoAck: false, WelcomeMessage: true}) {
+		t.Errorf("got %+v, want auto-ack off and the welcome message on", got)
+	}
+}
+
+func TestFlagsFromEnv(t *testing.T) {
+	reloadFlags(t)
+	withEnv(t, map[string]string{"FEATURE_AUTO_ACK": "true", "FEATURE_WELCOME_MESSAGE": "false"})
+
+	if got := GetFlags(); got != (FeatureFlags{AutoAck: true, WelcomeMessage: false}) {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestAutoAckFlagFallsBackToTheOldSetting(t *testing.T) {
+	reloadFlags(t)
+	withEnv(t, map[string]string{"FEATURE_AUTO_ACK": "", "CONSUMER_AUTO_ACK": "true"})
+
+	if !GetFlags().AutoAck {
+		t.Error("CONSUMER_AUTO_ACK=true was ignored without FEATURE_AUTO_ACK")
+	}
+}
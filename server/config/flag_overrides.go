@@ -0,0 +1,69 @@
+package config
+
+import (
+    "flag"
+    "sync"
+
+    "github.com/everestp/pizza-shop/logger"
+)
+
+// 10. Command-line Overrides
+// A few settings can be given as flags so several instances can share one host
+// (and one .env) without editing files:
+//
+//     ./pizza-shop -port 8081 -rabbit-host 10.0.0.5 -rabbit-port 5673 -log-level off
+//
+// Precedence is flag > env var > the default passed to the typed getters.
+var (
+    overrides      = map[string]string{}
+    overridesMutex sync.RWMutex
+)
+
+// flagOverrides maps each flag to the config field it replaces.
+var flagOverrides = []struct {
+    flag  string
+    field string
+    usage string
+}{
+    {"port", "port", "HTTP port (overrides PORT)"},
+    {"rabbit-host", "rabbit_mq_host", "RabbitMQ host (overrides RABBIT_MQ_HOST)"},
+    {"rabbit-port", "rabbit_mq_port", "RabbitMQ port (overrides RABBIT_MQ_PORT)"},
+}
+
+// ApplyFlagOverrides parses the command line (without the program name).
+// Only flags that were actually given override anything; the rest fall back to env.
+func ApplyFlagOverrides(args []string) error {
+    flags := flag.NewFlagSet("pizza-shop", flag.ContinueOnError)
+    values := make(map[string]*string, len(flagOverrides))
+    for _, override := range flagOverrides {
+        values[override.flag] = flags.String(override.flag, "", override.usage)
+    }
+    logLevel := flags.String("log-level", "", `"off" silences the logs, anything else turns them on (overrides the "log" env var)`)
+
+    if err := flags.Parse(args); err != nil {
+        return err
+    }
+
+    overridesMutex.Lock()
+    defer overridesMutex.Unlock()
+    flags.Visit(func(f *flag.Flag) {
+        for _, override := range flagOverrides {
+            if override.flag == f.Name {
+                overrides[override.field] = *values[f.Name]
+            }
+        }
+    })
+    if *logLevel != "" {
+        logger.SetLevel(*logLevel)
+    }
+    return nil
+}
+
+// flagOverride returns the value given on the command line for a config field, if any.
+func flagOverride(propertyKey string) (string, bool) {
+    overridesMutex.RLock()
+    defer overridesMutex.RUnlock()
+
+    val, ok := overrides[propertyKey]
+    return val, ok
+}
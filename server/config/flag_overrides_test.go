@@ -0,0 +1,74 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/everestp/pizza-shop/logger"
+)
+
+// withoutOverrides forgets the test's flags afterwards.
+func withoutOverrides(t *testing.T) {
+	t.Cleanup(func() {
+		overridesMutex.Lock()
+		defer overridesMutex.Unlock()
+		overrides = map[string]string{}
+		logger.SetLevel("")
+	})
+}
+
+func TestFlagsOverrideEnv(t *testing.T) {
+	withoutOverrides(t)
+	withEnv(t, map[string]string{"RABBIT_MQ_HOST": "env-host", "RABBIT_MQ_PORT": "5672"})
+
+	if err := ApplyFlagOverrides([]string{"-rabbit-host", "flag-host", "-port", "8081"}); err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if got := GetEnvProperty("rabbit_mq_host"); got != "flag-host" {
+		t.Errorf("rabbit host: got %q, want the flag's", got)
+	}
+	if got := GetEnvPropertyAsInt("port", 0); got != 8081 {
+		t.Errorf("port: got %d, want the flag's", got)
+	}
+	// No -rabbit-port: the env var still counts.
+	if got := GetEnvProperty("rabbit_mq_port"); got != "5672" {
+		t.Errorf("rabbit port: got %q, want the env's", got)
+	}
+}
+
+func TestNoFlagsFallBackToEnv(t *testing.T) {
+	withoutOverrides(t)
+	withEnv(t, map[string]string{"RABBIT_MQ_HOST": "env-host"})
+
+	if err := ApplyFlagOverrides(nil); err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if got := GetEnvProperty("rabbit_mq_host"); got != "env-host" {
+		t.Errorf("rabbit host: got %q, want the env's", got)
+	}
+}
+
+func TestUnknownFlagIsAnError(t *testing.T) {
+	withoutOverrides(t)
+
+	if err := ApplyFlagOverrides([]string{"-rabbit-hots", "x"}); err == nil {
+		t.Error("a misspelled flag was accepted")
+	}
+}
+
+func TestLogLevelFlagWinsOverTheLogEnvVar(t *testing.T) {
+	withoutOverrides(t)
+	withEnv(t, map[string]string{"log": "on"})
+	var logs bytes.Buffer
+	logger.SetOutput(&logs)
+	t.Cleanup(func() { logger.SetOutput(os.Stderr) })
+
+	if err := ApplyFlagOverrides([]string{"-log-level", "off"}); err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	logger.Log("should not be written")
+	if logs.Len() != 0 {
+		t.Errorf("-log-level off still logged %q", logs.String())
+	}
+}
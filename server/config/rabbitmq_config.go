@@ -1,10 +1,15 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/everestp/pizza-shop/constants"
 	"github.com/everestp/pizza-shop/logger"
 	"github.com/rabbitmq/amqp091-go"
 )
@@ -14,11 +19,108 @@ import (
 type RabbitMQConection struct {
 	conn  *amqp091.Connection // The underlying TCP connection
 	queue string              // The name of the default queue for this app
+	name  string              // Connection name shown in the management UI (e.g. "pizza-shop-consumer")
+	users int                 // How many services share it (see ConnectionManager); 0 = not managed
+	mutex sync.Mutex          // Guards 'conn' and 'users': the publisher and the consumers reconnect concurrently
+}
+
+// dialRabbitMQ is the function used to open the TCP connection.
+// It is a variable so the dial step can be swapped out (e.g. to inspect the config).
+var dialRabbitMQ = amqp091.DialConfig
+
+// ConnectionName is what the management UI shows for one of our connections:
+// RABBIT_MQ_CONNECTION_NAME (default "pizza-shop") plus its role, e.g. "pizza-shop-publisher".
+func ConnectionName(role string) string {
+	base := GetEnvProperty("rabbit_mq_connection_name")
+	if base == "" {
+		base = "pizza-shop"
+	}
+	return base + "-" + role
+}
+
+// buildDialConfig reads the heartbeat and connection timeout from env.
+// A short heartbeat means a dead broker is noticed in seconds instead of minutes.
+// The connection name lets operators tell our connections apart in the management UI.
+func buildDialConfig(name string) amqp091.Config {
+	heartbeat := time.Duration(GetEnvPropertyAsInt("rabbit_mq_heartbeat", 10)) * time.Second
+	timeout := time.Duration(GetEnvPropertyAsInt("rabbit_mq_conn_timeout", 30)) * time.Second
+
+	properties := amqp091.NewConnectionProperties()
+	properties.SetClientConnectionName(name)
+
+	return amqp091.Config{
+		Heartbeat:  heartbeat,
+		Locale:     "en_US",
+		Dial:       amqp091.DefaultDial(timeout), // Gives up on the TCP handshake after 'timeout'
+		Properties: properties,
+	}
+}
+
+// QueueArguments returns the extra x-arguments a queue must be declared with.
+// Every declare of the same queue has to pass the SAME arguments, or RabbitMQ refuses it,
+// so all declare paths call this instead of building their own.
+//
+// Kitchen queues (the shared one and every region's) can be bounded with KITCHEN_QUEUE_MAX_LENGTH (unset = unbounded).
+// KITCHEN_QUEUE_OVERFLOW picks what happens when it is full:
+//   - "drop-head" (default): the OLDEST waiting order is discarded to make room.
+//   - "reject-publish": the NEW order is refused, and the publisher reports the rejection.
+//
+// With KITCHEN_DLQ_ENABLED, rejected kitchen messages are dead-lettered to "<queue>.dlq".
+//
+// The queue is recognized by the name the app uses, so a name that already went through
+// QueueName (e.g. the routing key of a retried delivery) gets the same arguments.
+func QueueArguments(queueName string) amqp091.Table {
+	queueName = LogicalQueueName(queueName)
+	isKitchen := queueName == constants.KITCHEN_ORDER_QUEUE || strings.HasPrefix(queueName, constants.KITCHEN_REGION_QUEUE_PREFIX)
+	isSideQueue := strings.HasSuffix(queueName, constants.DEAD_LETTER_QUEUE_SUFFIX) || strings.HasSuffix(queueName, constants.PARKED_QUEUE_SUFFIX)
+	if !isKitchen || isSideQueue {
+		return nil
+	}
+
+	args := amqp091.Table{}
+	if maxLength := GetEnvPropertyAsInt("kitchen_queue_max_length", 0); maxLength > 0 {
+		args["x-max-length"] = int64(maxLength)
+		args["x-overflow"] = KitchenQueueOverflow()
+	}
+	if GetEnvPropertyAsBool("kitchen_dlq_enabled", false) {
+		args["x-dead-letter-exchange"] = "" // The default exchange routes by queue name
+		args["x-dead-letter-routing-key"] = QueueName(queueName + constants.DEAD_LETTER_QUEUE_SUFFIX)
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	return args
+}
+
+// QueueName returns the name a queue has on the broker: QUEUE_NAME_PREFIX (e.g. "staging.")
+// followed by the name the app uses, so environments sharing a broker don't collide.
+// The app keeps using the plain names; only the calls that reach the broker go through here.
+// A name that already carries the prefix (e.g. a delivery's routing key) is returned as is.
+func QueueName(name string) string {
+	prefix := GetEnvProperty("queue_name_prefix")
+	if prefix == "" || strings.HasPrefix(name, prefix) {
+		return name
+	}
+	return prefix + name
+}
+
+// LogicalQueueName undoes QueueName: the name the app uses for a queue, without QUEUE_NAME_PREFIX.
+func LogicalQueueName(name string) string {
+	return strings.TrimPrefix(name, GetEnvProperty("queue_name_prefix"))
+}
+
+// KitchenQueueOverflow returns the configured overflow behavior for the kitchen queue.
+func KitchenQueueOverflow() string {
+	if GetEnvProperty("kitchen_queue_overflow") == "reject-publish" {
+		return "reject-publish"
+	}
+	return "drop-head"
 }
 
 // GetNewRabbitMQConnection initializes a new connection by reading environment variables.
 // It uses a 'fail-fast' approach (panics if it can't connect) which is common during app startup.
-func GetNewRabbitMQConnection() *RabbitMQConection {
+// 'role' ("publisher", "consumer") names the connection, see ConnectionName.
+func GetNewRabbitMQConnection(role string) *RabbitMQConection {
 	// 1. Retrieve credentials from environment variables
 	host := GetEnvProperty("rabbit_mq_host")
 	port := GetEnvProperty("rabbit_mq_port")
@@ -36,21 +138,24 @@ func GetNewRabbitMQConnection() *RabbitMQConection {
 	url := fmt.Sprintf("amqp://%s:%s@%s:%d/", username, password, host, PORT)
 	
 	// 4. Dial opens the TCP connection to the broker
-	conn, err := amqp091.Dial(url)
+	name := ConnectionName(role)
+	conn, err := dialRabbitMQ(url, buildDialConfig(name))
 	if err != nil {
 		panic(fmt.Sprintf("CRITICAL: Failed to connect to RabbitMQ: %v", err))
 	}
 
-	log.Println("Successfully established RabbitMQ connection")
+	log.Printf("Successfully established RabbitMQ connection %q", name)
 
 	return &RabbitMQConection{
 		conn:  conn,
 		queue: queue,
+		name:  name,
 	}
 }
 
 // Connect is a helper method used to re-establish a connection if the original one drops.
-func (r *RabbitMQConection) Connect() *amqp091.Connection {
+// A failed dial is returned, not fatal: the caller's backoff loop decides whether to try again.
+func (r *RabbitMQConection) Connect() (*amqp091.Connection, error) {
 	// Note: In a production app, you might want to DRY (Don't Repeat Yourself) 
 	// by moving the URL construction logic to a separate private helper method.
 	host := GetEnvProperty("rabbit_mq_host")
@@ -61,64 +166,172 @@ func (r *RabbitMQConection) Connect() *amqp091.Connection {
 	PORT, _ := strconv.Atoi(port)
 	url := fmt.Sprintf("amqp://%s:%s@%s:%d/", username, password, host, PORT)
 
-	conn, err := amqp091.Dial(url)
+	conn, err := dialRabbitMQ(url, buildDialConfig(r.name))
 	if err != nil {
-		panic(fmt.Sprintf("Failed to re-connect to RabbitMQ: %v", err))
+		return nil, fmt.Errorf("failed to re-connect to RabbitMQ: %w", err)
 	}
 
 	log.Println("RabbitMQ connection restored")
-	return conn
+	return conn, nil
 }
 
 // DeclareQueue ensures a specific queue exists on the RabbitMQ broker.
 // RabbitMQ is idempotent: if the queue already exists with these settings, it does nothing.
 func (r *RabbitMQConection) DeclareQueue(queueName string) error {
+	if err := r.VerifyQueue(queueName); err != nil {
+		return err
+	}
+
 	// Channels are 'virtual connections' inside a TCP connection. 
 	// They are cheap to create; TCP connections are expensive.
-	channel, err := r.conn.Channel()
+	// Every declare gets its OWN short-lived channel, so it never depends on (or
+	// inherits the state of) a channel someone else opened or closed.
+	channel, err := r.GetChannel()
 	if err != nil {
-		return fmt.Errorf("error creating channel: %w", err)
+		return err
 	}
 	defer channel.Close() // Close the channel as soon as the queue is declared
 
 	_, err = channel.QueueDeclare(
-		queueName, // Name of the queue
+		QueueName(queueName), // Name of the queue
 		true,      // Durable: The queue will survive a broker restart
 		false,     // Delete when unused: The queue won't be deleted if consumers disconnect
 		false,     // Exclusive: Can be used by other connections
 		false,     // No-wait: Do not wait for a server response
-		nil,       // Arguments: Additional config (like TTL)
+		// Arguments: Additional config (like max length)
+		QueueArguments(queueName),
 	)
 	return err
 }
 
 // GetConnection returns the active connection. If nil, it tries to connect.
-func (r *RabbitMQConection) GetConnection() *amqp091.Connection {
+// Only one caller redials at a time; the others wait and get the new connection.
+func (r *RabbitMQConection) GetConnection() (*amqp091.Connection, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
 	if r.conn == nil || r.conn.IsClosed() {
-		r.conn = r.Connect()
+		conn, err := r.Connect()
+		if err != nil {
+			return nil, err
+		}
+		r.conn = conn
 	}
-	return r.conn
+	return r.conn, nil
+}
+
+// IsConnected reports whether the TCP connection is up (without dialing a new one).
+func (r *RabbitMQConection) IsConnected() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.conn != nil && !r.conn.IsClosed()
 }
 
 // GetChannel opens a new channel for performing operations (Publishing/Consuming).
 // You should usually open a channel, do your work, and then close it.
-func (r *RabbitMQConection) GetChannel() *amqp091.Channel {
-	// Ensure connection exists before trying to open a channel
-	if r.conn == nil || r.conn.IsClosed() {
-		r.conn = r.Connect()
+// A failed open (or a failed redial before it) is retried CHANNEL_OPEN_RETRIES times (default 3), waiting
+// CHANNEL_OPEN_BACKOFF_MS (default 100) before the first retry and twice as long each time after.
+func (r *RabbitMQConection) GetChannel() (IAMQPChannel, error) {
+	retries := GetEnvPropertyAsInt("channel_open_retries", 3)
+	backoff := time.Duration(GetEnvPropertyAsInt("channel_open_backoff", 100)) * time.Millisecond
+
+	for attempt := 0; ; attempt++ {
+		// Ensure connection exists before trying to open a channel
+		conn, err := r.GetConnection()
+		if err == nil {
+			var channel *amqp091.Channel
+			if channel, err = conn.Channel(); err == nil {
+				return channel, nil
+			}
+		}
+		if attempt >= retries {
+			return nil, fmt.Errorf("failed to open channel after %d attempt(s): %w", attempt+1, err)
+		}
+		logger.Log(fmt.Sprintf("Failed to open channel (%v), retrying in %v...", err, backoff))
+		time.Sleep(backoff)
+		backoff *= 2
 	}
+}
 
-	channel, err := r.conn.Channel()
+// InspectQueue looks up an existing queue WITHOUT creating it (a "passive" declare)
+// and returns its current message and consumer counts.
+// A missing queue makes the broker close the channel, so we always use a throwaway one.
+func (r *RabbitMQConection) InspectQueue(queueName string) (amqp091.Queue, error) {
+	channel, err := r.GetChannel()
 	if err != nil {
-		logger.Log("Failed to open channel, retrying...")
-		// Simple retry logic
-		channel, err = r.conn.Channel()
-		if err != nil {
-			logger.Log("Permanent channel failure")
+		return amqp091.Queue{}, err
+	}
+	defer channel.Close() // Harmless if the broker already closed it
+
+	queue, err := channel.QueueDeclarePassive(
+		QueueName(queueName), // Name of the queue
+		true,      // Durable: must match how the queue was declared
+		false,     // Delete when unused
+		false,     // Exclusive
+		false,     // No-wait
+		nil,       // Arguments
+	)
+	var amqpErr *amqp091.Error
+	if errors.As(err, &amqpErr) && amqpErr.Code == amqp091.NotFound {
+		return amqp091.Queue{}, fmt.Errorf("%w: %q", ErrQueueNotFound, queueName)
+	}
+	return queue, err
+}
+
+// PurgeQueue deletes every ready message in a queue and returns how many were dropped.
+// Messages already delivered to a consumer (unacked) are not affected.
+func (r *RabbitMQConection) PurgeQueue(queueName string) (int, error) {
+	channel, err := r.GetChannel()
+	if err != nil {
+		return 0, err
+	}
+	defer channel.Close()
+
+	return channel.QueuePurge(QueueName(queueName), false)
+}
+
+// ErrQueueNotFound means the queue doesn't exist on the broker (yet).
+var ErrQueueNotFound = errors.New("queue not found")
+
+// ErrQueueMismatch means a queue already exists on the broker with settings
+// (durability, x-max-length, x-overflow...) different from what this app declares.
+var ErrQueueMismatch = errors.New("existing queue has incompatible settings")
+
+// VerifyQueue checks that an existing queue matches the settings we declare it with.
+// RabbitMQ answers a mismatched declare by closing the channel with a terse 406,
+// so we probe on throwaway channels and turn that into an error that says what to fix.
+// A queue that doesn't exist yet is fine: the caller's declare will create it.
+func (r *RabbitMQConection) VerifyQueue(queueName string) error {
+	// 1. Passive declare: does the queue exist at all?
+	if _, err := r.InspectQueue(queueName); err != nil {
+		if errors.Is(err, ErrQueueNotFound) {
 			return nil
 		}
+		return err
 	}
-	return channel
+
+	// 2. It exists: declare it with OUR settings. Only this throwaway channel dies on a mismatch.
+	channel, err := r.GetChannel()
+	if err != nil {
+		return err
+	}
+	defer channel.Close()
+
+	_, err = channel.QueueDeclare(QueueName(queueName), true, false, false, false, QueueArguments(queueName))
+	return describeDeclareError(queueName, err)
+}
+
+// describeDeclareError wraps a precondition failure in ErrQueueMismatch, keeping
+// the broker's explanation (e.g. "inequivalent arg 'durable' ... received 'true' but current is 'false'").
+func describeDeclareError(queueName string, err error) error {
+	var amqpErr *amqp091.Error
+	if err == nil || !errors.As(err, &amqpErr) || amqpErr.Code != amqp091.PreconditionFailed {
+		return err
+	}
+	detail := strings.TrimPrefix(amqpErr.Reason, "PRECONDITION_FAILED - ")
+	return fmt.Errorf("%w: queue %q: %s; delete the queue or change its settings "+
+		"(durable, KITCHEN_QUEUE_MAX_LENGTH, KITCHEN_QUEUE_OVERFLOW) to match", ErrQueueMismatch, queueName, detail)
 }
 
 // GetQueue returns the default queue name defined in environment variables.
@@ -128,7 +341,16 @@ func (r *RabbitMQConection) GetQueue() string {
 
 // Close gracefully shuts down the RabbitMQ connection. 
 // Should be called when the application stops (e.g., using defer in main.go).
+// A connection shared through the ConnectionManager only closes once its last user closes it.
 func (r *RabbitMQConection) Close() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.users > 1 {
+		r.users--
+		return
+	}
+	r.users = 0
 	if r.conn != nil {
 		r.conn.Close()
 	}
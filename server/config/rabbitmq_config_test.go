@@ -0,0 +1,225 @@
+package config
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/everestp/pizza-shop/constants"
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// withEnv sets env vars for one test and reloads the config with them.
+func withEnv(t *testing.T, vars map[string]string) {
+	t.Helper()
+
+	// Cleanups run last-in first-out: registered before t.Setenv's, the reload
+	// runs after the vars are restored, so no test's config outlives it.
+	t.Cleanup(ConfigEnv)
+	for key, value := range vars {
+		t.Setenv(key, value)
+	}
+	ConfigEnv()
+}
+
+func TestQueueNamePrefix(t *testing.T) {
+	withEnv(t, map[string]string{"QUEUE_NAME_PREFIX": "staging."})
+
+	if got := QueueName("kitchen"); got != "staging.kitchen" {
+		t.Errorf("QueueName: got %q", got)
+	}
+	if got := QueueName("staging.kitchen"); got != "staging.kitchen" {
+		t.Errorf("QueueName of a prefixed name: got %q", got)
+	}
+	if got := LogicalQueueName("staging.kitchen"); got != "kitchen" {
+		t.Errorf("LogicalQueueName: got %q", got)
+	}
+}
+
+func TestEmptyQueueNamePrefixKeepsNames(t *testing.T) {
+	withEnv(t, map[string]string{"QUEUE_NAME_PREFIX": ""})
+
+	if got := QueueName(constants.KITCHEN_ORDER_QUEUE); got != constants.KITCHEN_ORDER_QUEUE {
+		t.Errorf("QueueName: got %q", got)
+	}
+	if got := LogicalQueueName(constants.KITCHEN_ORDER_QUEUE); got != constants.KITCHEN_ORDER_QUEUE {
+		t.Errorf("LogicalQueueName: got %q", got)
+	}
+}
+
+func TestQueueArgumentsIgnoreThePrefix(t *testing.T) {
+	withEnv(t, map[string]string{
+		"QUEUE_NAME_PREFIX":        "staging.",
+		"KITCHEN_QUEUE_MAX_LENGTH": "10",
+		"KITCHEN_QUEUE_OVERFLOW":   "reject-publish",
+		"KITCHEN_DLQ_ENABLED":      "true",
+	})
+
+	plain := QueueArguments(constants.KITCHEN_ORDER_QUEUE)
+	prefixed := QueueArguments(QueueName(constants.KITCHEN_ORDER_QUEUE))
+	for name, args := range map[string]map[string]any{"plain": plain, "prefixed": prefixed} {
+		if args["x-max-length"] != int64(10) || args["x-overflow"] != "reject-publish" {
+			t.Errorf("%s name: got %v", name, args)
+		}
+		if want := "staging." + constants.KITCHEN_ORDER_QUEUE + constants.DEAD_LETTER_QUEUE_SUFFIX; args["x-dead-letter-routing-key"] != want {
+			t.Errorf("%s name: dead-letter key %v, want %q", name, args["x-dead-letter-routing-key"], want)
+		}
+	}
+
+	region := QueueName(constants.KITCHEN_REGION_QUEUE_PREFIX + "north")
+	if args := QueueArguments(region); args["x-max-length"] != int64(10) {
+		t.Errorf("prefixed region queue: got %v", args)
+	}
+	if args := QueueArguments(QueueName(constants.KITCHEN_ORDER_QUEUE + constants.DEAD_LETTER_QUEUE_SUFFIX)); args != nil {
+		t.Errorf("prefixed dead-letter queue: got %v, want none", args)
+	}
+}
+
+func TestLostBrokerIsAnErrorNotAPanic(t *testing.T) {
+	withEnv(t, map[string]string{"RABBIT_MQ_PORT": "5672", "CHANNEL_OPEN_RETRIES": "2", "CHANNEL_OPEN_BACKOFF_MS": "1"})
+
+	dials := 0
+	realDial := dialRabbitMQ
+	dialRabbitMQ = func(url string, config amqp091.Config) (*amqp091.Connection, error) {
+		dials++
+		return nil, errors.New("connection refused")
+	}
+	t.Cleanup(func() { dialRabbitMQ = realDial })
+
+	conn := &RabbitMQConection{name: "pizza-shop-test"} // As if the broker went away
+	channel, err := conn.GetChannel()
+	if err == nil || channel != nil {
+		t.Fatalf("got %v, %v; want an error", channel, err)
+	}
+	if dials != 3 {
+		t.Errorf("dialed %d time(s), want 3 (the first try and 2 retries)", dials)
+	}
+	if conn.IsConnected() {
+		t.Error("a failed redial must not look connected")
+	}
+}
+
+func TestDialConfigUsesTheConfiguredHeartbeatAndTimeout(t *testing.T) {
+	withEnv(t, map[string]string{
+		"RABBIT_MQ_PORT":                       "5672",
+		"RABBIT_MQ_HEARTBEAT_SECONDS":          "3",
+		"RABBIT_MQ_CONNECTION_TIMEOUT_SECONDS": "1",
+	})
+
+	var used amqp091.Config
+	realDial := dialRabbitMQ
+	dialRabbitMQ = func(url string, config amqp091.Config) (*amqp091.Connection, error) {
+		used = config
+		return nil, errors.New("connection refused")
+	}
+	t.Cleanup(func() { dialRabbitMQ = realDial })
+
+	conn := &RabbitMQConection{name: "pizza-shop-test"}
+	conn.Connect()
+	if used.Heartbeat != 3*time.Second {
+		t.Errorf("heartbeat: got %v, want 3s", used.Heartbeat)
+	}
+	if name := used.Properties["connection_name"]; name != "pizza-shop-test" {
+		t.Errorf("connection name: got %v", name)
+	}
+
+	// The timeout lives inside the Dial func: a broker that accepts but never answers
+	// must be given up on after about a second.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		if silent, err := listener.Accept(); err == nil {
+			defer silent.Close()
+			time.Sleep(3 * time.Second)
+		}
+	}()
+
+	socket, err := used.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer socket.Close()
+	start := time.Now()
+	if _, err := socket.Read(make([]byte, 1)); err == nil {
+		t.Fatal("read from a silent broker succeeded")
+	}
+	if waited := time.Since(start); waited > 2*time.Second {
+		t.Errorf("gave up after %v, want about 1s", waited)
+	}
+}
+
+func TestDialConfigDefaults(t *testing.T) {
+	withEnv(t, map[string]string{"RABBIT_MQ_HEARTBEAT_SECONDS": "", "RABBIT_MQ_CONNECTION_TIMEOUT_SECONDS": ""})
+
+	if config := buildDialConfig("pizza-shop-test"); config.Heartbeat != 10*time.Second {
+		t.Errorf("heartbeat: got %v, want the 10s default", config.Heartbeat)
+	}
+}
+
+func TestMismatchedQueueGetsADescriptiveError(t *testing.T) {
+	// What the broker answers when the existing queue is transient and we declare it durable.
+	refused := &amqp091.Error{
+		Code:   amqp091.PreconditionFailed,
+		Reason: "PRECONDITION_FAILED - inequivalent arg 'durable' for queue 'kitchen' in vhost '/': received 'true' but current is 'false'",
+	}
+
+	err := describeDeclareError("kitchen", refused)
+	if !errors.Is(err, ErrQueueMismatch) {
+		t.Fatalf("got %v, want ErrQueueMismatch", err)
+	}
+	message := err.Error()
+	for _, want := range []string{`queue "kitchen"`, "inequivalent arg 'durable'", "delete the queue or change its settings"} {
+		if !strings.Contains(message, want) {
+			t.Errorf("%q does not mention %q", message, want)
+		}
+	}
+	if strings.Contains(message, "PRECONDITION_FAILED -") {
+		t.Errorf("%q still carries the raw AMQP prefix", message)
+	}
+}
+
+func TestOtherDeclareErrorsAreLeftAlone(t *testing.T) {
+	closed := &amqp091.Error{Code: amqp091.ChannelError, Reason: "channel closed"}
+	for _, err := range []error{nil, closed, errors.New("connection reset")} {
+		if got := describeDeclareError("kitchen", err); got != err {
+			t.Errorf("%v: got %v, want it unchanged", err, got)
+		}
+	}
+}
+
+func TestConnectionsAreNamedForTheirRole(t *testing.T) {
+	cases := []struct {
+		name string
+		base string // RABBIT_MQ_CONNECTION_NAME
+		role string
+		want string
+	}{
+		{name: "publisher", role: "publisher", want: "pizza-shop-publisher"},
+		{name: "consumer", role: "consumer", want: "pizza-shop-consumer"},
+		{name: "configured base", base: "pizza-shop-eu", role: "consumer", want: "pizza-shop-eu-consumer"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			withEnv(t, map[string]string{"RABBIT_MQ_PORT": "5672", "RABBIT_MQ_CONNECTION_NAME": tc.base})
+
+			var names []any
+			realDial := dialRabbitMQ
+			dialRabbitMQ = func(url string, config amqp091.Config) (*amqp091.Connection, error) {
+				names = append(names, config.Properties["connection_name"])
+				return nil, nil
+			}
+			t.Cleanup(func() { dialRabbitMQ = realDial })
+
+			conn := GetNewRabbitMQConnection(tc.role)
+			conn.Connect() // A reconnect keeps the name
+			if len(names) != 2 || names[0] != tc.want || names[1] != tc.want {
+				t.Errorf("dialed with connection names %v, want %q twice", names, tc.want)
+			}
+		})
+	}
+}
@@ -2,12 +2,34 @@ package constants
 
 const (
 	KITCHEN_ORDER_QUEUE         = "kitchen"
+	EVENT_TYPE_ORDER            = "order"
+	KITCHEN_REGION_QUEUE_PREFIX = "kitchen.orders."
+	DEAD_LETTER_QUEUE_SUFFIX    = ".dlq"
+	PARKED_QUEUE_SUFFIX         = ".parked"
 	ORDER_ORDERED               = "ordered"
 	ORDER_ACCEPTED              = "accepted"
 	ORDER_PREPARING             = "preparing"
 	ORDER_PREPARED              = "prepared"
 	ORDER_DELIVERED             = "delivered"
+	ORDER_STATUS_CANCELLED      = "cancelled"
 	ORDER_PREPARED_SUCCESSFULLY = "order prepared successfully"
+	ORDER_RECEIVED              = "your order has been accepted and sent to the kitchen"
 	ORDER_DELAYED               = "we are sorry, your order is delayed"
 	ORDER_CANCELLED             = "we regret to say, your order has been cancelled"
-)
\ No newline at end of file
+	ORDER_STATUS_SYNC           = "current order status"
+	ORDER_ITEM_READY            = "part of your order is ready"
+	ORDER_ITEM_PENDING          = "pending"
+	ORDER_ITEM_DONE             = "ready"
+	WS_WELCOME_MESSAGE          = "Connection Established: Started taking order updates..."
+	DEFAULT_ORDER_TAGS          = "delivery,dine-in,takeaway,promo"
+	DEFAULT_WS_SUBPROTOCOLS     = "pizza.v1"
+	DEFAULT_APP_VERSION         = "dev"
+	MAX_ORDER_PRIORITY          = 9
+)
+
+const (
+	// CONTEXT_USER_ID is the Gin context key where the auth middleware stores the caller's ID.
+	CONTEXT_USER_ID = "user_id"
+	// CONTEXT_REQUEST_ID is where the recovery middleware keeps the request's ID (also sent as X-Request-ID).
+	CONTEXT_REQUEST_ID = "request_id"
+)
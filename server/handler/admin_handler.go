@@ -0,0 +1,306 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/everestp/pizza-shop/config"
+	"github.com/everestp/pizza-shop/constants"
+	"github.com/everestp/pizza-shop/logger"
+	"github.com/everestp/pizza-shop/service"
+	"github.com/everestp/pizza-shop/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// AdminHandler serves the ops-only endpoints under /admin.
+type AdminHandler struct {
+	consumer  service.IMessageConsumerService // Dependency: The kitchen worker we tune at runtime
+	seeder    *service.OrderSeeder            // Dependency: Generates synthetic demo orders
+	sockets   IWebSocketHandler               // Dependency: The customers' live connections
+	broker    service.IMessagePubliser        // Dependency: Asks the broker about its queues (and queues admin events)
+	inFlight  *service.InFlightTracker        // Dependency: Orders the kitchen is cooking right now
+	store     service.IOrderStore             // Dependency: Every order and its current status
+	validator service.IOrderStatusValidator   // Dependency: Knows which status may follow which
+	eventLog  service.IEventLog               // Dependency: Audit trail of every status change
+}
+
+// concurrencyRequest is the body of POST /admin/consumer/concurrency.
+type concurrencyRequest struct {
+	Concurrency int `json:"concurrency" binding:"required"`
+}
+
+// notifyRequest is the body of POST /admin/ws/notify.
+// 'message' can be any JSON value and is sent to the client as-is.
+type notifyRequest struct {
+	ID      string          `json:"id" binding:"required"`
+	Message json.RawMessage `json:"message" binding:"required"`
+}
+
+// broadcastRequest is the body of POST /admin/ws/broadcast.
+type broadcastRequest struct {
+	Message json.RawMessage `json:"message" binding:"required"`
+}
+
+// SetConsumerConcurrency scales the kitchen up or down without a restart.
+func (ah *AdminHandler) SetConsumerConcurrency(ctx *gin.Context) {
+	var req concurrencyRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(400, gin.H{
+			"message":    "Body must be {\"concurrency\": <number>}",
+			"statusCode": 400,
+		})
+		return
+	}
+
+	if err := ah.consumer.SetConcurrency(req.Concurrency); err != nil {
+		status := 500
+		if errors.Is(err, service.ErrConcurrencyOutOfRange) {
+			status = 400
+		}
+		ctx.JSON(status, gin.H{
+			"message":    err.Error(),
+			"statusCode": status,
+		})
+		return
+	}
+
+	ctx.JSON(200, gin.H{
+		"data": gin.H{
+			"concurrency": ah.consumer.Concurrency(),
+		},
+		"statusCode": 200,
+		"message":    "Consumer concurrency updated",
+	})
+}
+
+// SeedOrders handles POST /admin/seed?count=N and starts placing N synthetic orders
+// in the background at SEED_ORDERS_PER_SECOND.
+func (ah *AdminHandler) SeedOrders(ctx *gin.Context) {
+	count, err := strconv.Atoi(ctx.DefaultQuery("count", "10"))
+	if err != nil || count < 1 || count > 10000 {
+		ctx.JSON(400, gin.H{
+			"message":    "count must be a number between 1 and 10000",
+			"statusCode": 400,
+		})
+		return
+	}
+
+	ah.seeder.Start(count)
+	ctx.JSON(202, gin.H{
+		"data": gin.H{
+			"count": count,
+		},
+		"statusCode": 202,
+		"message":    "Seeding synthetic orders",
+	})
+}
+
+// ListConnections handles GET /admin/ws/connections: who is connected, and since when.
+func (ah *AdminHandler) ListConnections(ctx *gin.Context) {
+	ctx.JSON(200, gin.H{
+		"data":       ah.sockets.ListConnections(),
+		"statusCode": 200,
+	})
+}
+
+// DisconnectConnection handles DELETE /admin/ws/connections/:id and force-closes that client.
+func (ah *AdminHandler) DisconnectConnection(ctx *gin.Context) {
+	clientId := ctx.Param("id")
+	if !ah.sockets.Disconnect(clientId) {
+		ctx.JSON(404, gin.H{
+			"message":    "No active connection with this id",
+			"statusCode": 404,
+		})
+		return
+	}
+
+	ctx.JSON(200, gin.H{
+		"data": gin.H{
+			"id": clientId,
+		},
+		"statusCode": 200,
+		"message":    "Connection closed",
+	})
+}
+
+// NotifyConnection handles POST /admin/ws/notify and sends a test frame to one client,
+// so frontend devs can exercise their socket handling without placing real orders.
+func (ah *AdminHandler) NotifyConnection(ctx *gin.Context) {
+	var req notifyRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(400, gin.H{
+			"message":    "Body must be valid JSON like {\"id\": \"pizza\", \"message\": {\"type\": \"test\"}}",
+			"statusCode": 400,
+		})
+		return
+	}
+
+	found, err := ah.sockets.Notify(req.ID, req.Message)
+	if !found {
+		ctx.JSON(404, gin.H{
+			"message":    "No active connection with this id",
+			"statusCode": 404,
+		})
+		return
+	}
+	if err != nil {
+		ctx.JSON(502, gin.H{
+			"message":    "Failed to deliver the message",
+			"error":      err.Error(),
+			"statusCode": 502,
+		})
+		return
+	}
+
+	ctx.JSON(200, gin.H{
+		"data": gin.H{
+			"id": req.ID,
+		},
+		"statusCode": 200,
+		"message":    "Message sent",
+	})
+}
+
+// BroadcastMessage handles POST /admin/ws/broadcast and sends one frame to every
+// connected customer and tracking page (e.g. "the kitchen closes in 10 minutes").
+func (ah *AdminHandler) BroadcastMessage(ctx *gin.Context) {
+	var req broadcastRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(400, gin.H{
+			"message":    "Body must be valid JSON like {\"message\": {\"type\": \"announcement\"}}",
+			"statusCode": 400,
+		})
+		return
+	}
+
+	ctx.JSON(200, gin.H{
+		"data": gin.H{
+			"delivered": ah.sockets.BroadcastAll(req.Message),
+		},
+		"statusCode": 200,
+		"message":    "Message broadcast",
+	})
+}
+
+// QueueStats handles GET /admin/queue/:name/stats: backlog and consumers of one queue,
+// without opening the RabbitMQ management UI. The queue is never created by asking.
+func (ah *AdminHandler) QueueStats(ctx *gin.Context) {
+	stats, err := ah.broker.QueueStats(ctx.Param("name"))
+	if errors.Is(err, config.ErrQueueNotFound) {
+		ctx.JSON(404, gin.H{
+			"message":    "Queue not found",
+			"statusCode": 404,
+		})
+		return
+	}
+	if err != nil {
+		ctx.JSON(500, gin.H{
+			"message":    "Failed to read queue statistics",
+			"error":      err.Error(),
+			"statusCode": 500,
+		})
+		return
+	}
+
+	ctx.JSON(200, gin.H{
+		"data":       stats,
+		"statusCode": 200,
+	})
+}
+
+// KitchenLoad handles GET /admin/kitchen/load: how many orders are cooking right now,
+// and whether KITCHEN_MAX_IN_FLIGHT has been reached.
+func (ah *AdminHandler) KitchenLoad(ctx *gin.Context) {
+	ctx.JSON(200, gin.H{
+		"data":       ah.inFlight.Load(),
+		"statusCode": 200,
+	})
+}
+
+// AdvanceOrder handles POST /admin/orders/:orderNo/advance: moves the order to the status that
+// normally comes next (e.g. PREPARING -> PREPARED) without waiting for the kitchen, and queues
+// that status's event so the rest of the flow (notifying the customer...) runs as usual.
+// Every status it can advance to has a kitchen handler; "delivered" tells the customer it's ready.
+// A step still running for the old status finds the order moved on and is rejected.
+func (ah *AdminHandler) AdvanceOrder(ctx *gin.Context) {
+	order, ok := ah.store.Get(ctx.Param("orderNo"))
+	if !ok {
+		ctx.JSON(404, gin.H{
+			"message":    "Order not found",
+			"statusCode": 404,
+		})
+		return
+	}
+
+	// 1. Only a legal next step: delivered and cancelled orders have nowhere to go.
+	next, ok := service.NextStatus(order.Status)
+	if !ok || !ah.validator.CanTransition(order.Status, next) {
+		ctx.JSON(409, gin.H{
+			"message":    fmt.Sprintf("Order in status %q can't be advanced", order.Status),
+			"statusCode": 409,
+		})
+		return
+	}
+	previous := order.Status
+	order, _ = ah.store.UpdateStatus(order.OrderNo, next)
+	if previous == constants.ORDER_PREPARING {
+		ah.inFlight.Leave(order.OrderNo) // Off the stove, whatever the chef is still doing
+	}
+	correlationId, _ := order.Payload["correlation_id"].(string)
+	if err := ah.eventLog.Append(service.OrderEvent{OrderNo: order.OrderNo, Status: next, CorrelationID: correlationId, Timestamp: utils.Clock.Now()}); err != nil {
+		logger.Log(fmt.Sprintf("Failed to record order event: %v", err))
+	}
+	logger.Log(fmt.Sprintf("Admin advanced order #%s from %q to %q", order.OrderNo, previous, next))
+
+	// 2. Queue the event of the new status, built from the order as it was placed.
+	event := make(map[string]any, len(order.Payload)+1)
+	for key, value := range order.Payload {
+		event[key] = value
+	}
+	event["order_status"] = next
+	options := service.PublishOptions{RoutingKey: service.KitchenQueueOf(order.Payload), Context: ctx.Request.Context(), MessageId: service.StepMessageId(event)}
+	if err := ah.broker.PublishEventWithOptions(options, event); err != nil {
+		ctx.JSON(500, gin.H{
+			"message":    "Order advanced but its event could not be queued",
+			"error":      err.Error(),
+			"statusCode": 500,
+		})
+		return
+	}
+
+	ctx.JSON(202, gin.H{
+		"data": gin.H{
+			"order_no": order.OrderNo,
+			"from":     previous,
+			"to":       next,
+		},
+		"message":    fmt.Sprintf("Order advanced to %q", next),
+		"statusCode": 202,
+	})
+}
+
+// PendingQueue handles GET /admin/orders/queue: every customer's orders waiting for a chef,
+// highest priority first and first come first served within a priority.
+func (ah *AdminHandler) PendingQueue(ctx *gin.Context) {
+	ctx.JSON(200, gin.H{
+		"data":       service.QueueOf(ah.store.Pending(), 0),
+		"statusCode": 200,
+	})
+}
+
+// GetAdminHandler is the Constructor.
+func GetAdminHandler(consumer service.IMessageConsumerService, seeder *service.OrderSeeder, sockets IWebSocketHandler, broker service.IMessagePubliser, inFlight *service.InFlightTracker,
+	store service.IOrderStore, validator service.IOrderStatusValidator, eventLog service.IEventLog) *AdminHandler {
+	return &AdminHandler{
+		consumer:  consumer,
+		seeder:    seeder,
+		sockets:   sockets,
+		broker:    broker,
+		inFlight:  inFlight,
+		store:     store,
+		validator: validator,
+		eventLog:  eventLog,
+	}
+}
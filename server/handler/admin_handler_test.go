@@ -0,0 +1,355 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/everestp/pizza-shop/config"
+	"github.com/everestp/pizza-shop/constants"
+	"github.com/everestp/pizza-shop/service"
+	"github.com/gin-gonic/gin"
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// testAdminHandler is an AdminHandler on the in-memory broker, plus what the tests look at.
+type testAdminHandler struct {
+	handler  *AdminHandler
+	consumer *service.MemoryConsumer
+	store    *service.OrderStore
+	sockets  *WebSocketHandler
+	broker   *service.MemoryBroker
+	router   *gin.Engine
+}
+
+func newTestAdminHandler(t *testing.T) *testAdminHandler {
+	t.Helper()
+
+	broker := service.GetMemoryBroker(100)
+	publisher := service.GetMemoryPublisher(broker)
+	consumer := service.GetMemoryConsumer(broker)
+	store := service.GetOrderStore()
+	sockets := GetNewWebSocketHandler(store, service.GetPendingNotificationStore(time.Minute))
+	seeder := service.GetOrderSeeder(context.Background(), 2, func(payload map[string]any) error { return nil })
+	ah := GetAdminHandler(consumer, seeder, sockets, publisher, service.GetInFlightTracker(0), store,
+		service.GetOrderStatusValidator(), service.GetEventLog("", 100))
+
+	// The routes as routes.RegisterAdminRoutes lays them out, minus the token check.
+	router := gin.New()
+	admin := router.Group("/admin")
+	admin.POST("/consumer/concurrency", ah.SetConsumerConcurrency)
+	admin.GET("/ws/connections", ah.ListConnections)
+	admin.DELETE("/ws/connections/:id", ah.DisconnectConnection)
+	admin.POST("/ws/notify", ah.NotifyConnection)
+	admin.GET("/queue/:name/stats", ah.QueueStats)
+	admin.POST("/orders/:orderNo/advance", ah.AdvanceOrder)
+
+	return &testAdminHandler{handler: ah, consumer: consumer, store: store, sockets: sockets, broker: broker, router: router}
+}
+
+// do sends a request and decodes the JSON envelope.
+func (th *testAdminHandler) do(t *testing.T, method, path string, body any) (int, map[string]any) {
+	t.Helper()
+
+	var raw []byte
+	if body != nil {
+		var err error
+		if raw, err = json.Marshal(body); err != nil {
+			t.Fatalf("marshal body: %v", err)
+		}
+	}
+	request := httptest.NewRequest(method, path, bytes.NewReader(raw))
+	request.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	th.router.ServeHTTP(recorder, request)
+
+	var envelope map[string]any
+	if err := json.Unmarshal(recorder.Body.Bytes(), &envelope); err != nil {
+		t.Fatalf("%s %s: response is not JSON: %q", method, path, recorder.Body.String())
+	}
+	return recorder.Code, envelope
+}
+
+func TestConcurrencyEndpointResizesTheConsumer(t *testing.T) {
+	th := newTestAdminHandler(t)
+
+	code, body := th.do(t, "POST", "/admin/consumer/concurrency", map[string]any{"concurrency": 4})
+	if code != 200 || body["data"].(map[string]any)["concurrency"] != 4.0 {
+		t.Fatalf("got %d %v, want 200 with the new limit", code, body)
+	}
+	if th.consumer.Concurrency() != 4 {
+		t.Errorf("consumer limit: got %d, want 4", th.consumer.Concurrency())
+	}
+}
+
+func TestConcurrencyEndpointRejectsOutOfBoundsValues(t *testing.T) {
+	th := newTestAdminHandler(t)
+	before := th.consumer.Concurrency()
+
+	for _, body := range []any{
+		map[string]any{"concurrency": -3},
+		map[string]any{"concurrency": 1_000_000},
+		map[string]any{"concurrency": "many"},
+		nil,
+	} {
+		if code, envelope := th.do(t, "POST", "/admin/consumer/concurrency", body); code != 400 || envelope["statusCode"] != 400.0 {
+			t.Errorf("%v: got %d %v, want a 400 envelope", body, code, envelope)
+		}
+	}
+	if th.consumer.Concurrency() != before {
+		t.Errorf("a rejected request changed the limit to %d", th.consumer.Concurrency())
+	}
+}
+
+// connectedIds lists the IDs the connections endpoint reports.
+func (th *testAdminHandler) connectedIds(t *testing.T) []string {
+	t.Helper()
+
+	code, body := th.do(t, "GET", "/admin/ws/connections", nil)
+	if code != 200 {
+		t.Fatalf("list: got %d %v", code, body)
+	}
+	var ids []string
+	for _, connection := range body["data"].([]any) {
+		ids = append(ids, connection.(map[string]any)["id"].(string))
+	}
+	return ids
+}
+
+func TestConnectionsEndpointListsAndDisconnectsClients(t *testing.T) {
+	th := newTestAdminHandler(t)
+	alice := &recordingConnection{onWrite: func() {}}
+	bob := &recordingConnection{onWrite: func() {}}
+	th.sockets.addConnection("alice", alice)
+	th.sockets.addConnection("bob", bob)
+
+	if ids := th.connectedIds(t); len(ids) != 2 {
+		t.Fatalf("listed %v, want alice and bob", ids)
+	}
+
+	if code, body := th.do(t, "DELETE", "/admin/ws/connections/bob", nil); code != 200 {
+		t.Fatalf("disconnect: got %d %v", code, body)
+	}
+	if !bob.closed || alice.closed {
+		t.Errorf("closed: alice %v, bob %v; want only bob", alice.closed, bob.closed)
+	}
+	if ids := th.connectedIds(t); len(ids) != 1 || ids[0] != "alice" {
+		t.Errorf("listed %v after the disconnect, want just alice", ids)
+	}
+	if code, _ := th.do(t, "DELETE", "/admin/ws/connections/bob", nil); code != 404 {
+		t.Errorf("disconnecting bob again: got %d, want 404", code)
+	}
+}
+
+// inspectedQueues is a broker whose passive declares find only the queues listed here.
+type inspectedQueues struct {
+	service.IMessagePubliser
+	queues map[string]service.QueueStats
+}
+
+func (iq inspectedQueues) QueueStats(queueName string) (service.QueueStats, error) {
+	stats, ok := iq.queues[queueName]
+	if !ok {
+		return service.QueueStats{}, config.ErrQueueNotFound
+	}
+	return stats, nil
+}
+
+func TestQueueStatsEndpoint(t *testing.T) {
+	th := newTestAdminHandler(t)
+	th.handler.broker = inspectedQueues{queues: map[string]service.QueueStats{
+		"kitchen": {Name: "kitchen", Messages: 7, Consumers: 2},
+	}}
+
+	code, body := th.do(t, "GET", "/admin/queue/kitchen/stats", nil)
+	stats, _ := body["data"].(map[string]any)
+	if code != 200 || stats["name"] != "kitchen" || stats["messages"] != 7.0 || stats["consumers"] != 2.0 {
+		t.Errorf("got %d %v, want kitchen with 7 messages and 2 consumers", code, body)
+	}
+	if code, body := th.do(t, "GET", "/admin/queue/nope/stats", nil); code != 404 || body["statusCode"] != 404.0 {
+		t.Errorf("missing queue: got %d %v, want a 404 envelope", code, body)
+	}
+}
+
+func TestNotifySendsTheTestFrameToOneConnection(t *testing.T) {
+	th := newTestAdminHandler(t)
+	alice := &recordingConnection{onWrite: func() {}}
+	bob := &recordingConnection{onWrite: func() {}}
+	th.sockets.addConnection("alice", alice)
+	th.sockets.addConnection("bob", bob)
+
+	code, body := th.do(t, "POST", "/admin/ws/notify", map[string]any{
+		"id":      "alice",
+		"message": map[string]any{"type": "test", "order_status": "prepared"},
+	})
+	if code != 200 {
+		t.Fatalf("got %d %v, want 200", code, body)
+	}
+	if len(alice.sent) != 1 || string(alice.sent[0]) != `{"order_status":"prepared","type":"test"}` {
+		t.Errorf("alice got %q, want the test frame as sent", alice.sent)
+	}
+	if len(bob.sent) != 0 {
+		t.Errorf("bob got %q, want nothing", bob.sent)
+	}
+}
+
+func TestNotifyUnknownConnectionIsA404(t *testing.T) {
+	th := newTestAdminHandler(t)
+
+	code, body := th.do(t, "POST", "/admin/ws/notify", map[string]any{"id": "nobody", "message": map[string]any{"type": "test"}})
+	if code != 404 {
+		t.Errorf("got %d %v, want 404", code, body)
+	}
+}
+
+func TestNotifyNeedsValidJSON(t *testing.T) {
+	th := newTestAdminHandler(t)
+	alice := &recordingConnection{onWrite: func() {}}
+	th.sockets.addConnection("alice", alice)
+
+	for _, raw := range []string{`{"id": "alice", "message": {"type": }`, `{"id": "alice"}`} {
+		request := httptest.NewRequest("POST", "/admin/ws/notify", strings.NewReader(raw))
+		request.Header.Set("Content-Type", "application/json")
+		recorder := httptest.NewRecorder()
+		th.router.ServeHTTP(recorder, request)
+
+		if recorder.Code != 400 {
+			t.Errorf("%s: got %d, want 400", raw, recorder.Code)
+		}
+	}
+	if len(alice.sent) != 0 {
+		t.Errorf("alice got %q from invalid requests", alice.sent)
+	}
+}
+
+// capturingProcessor acks every message and hands its body to the test.
+type capturingProcessor struct {
+	bodies chan []byte
+}
+
+func (cp *capturingProcessor) ProcessMessage(ctx context.Context, message interface{}) error {
+	msg := message.(amqp091.Delivery)
+	msg.Ack(false)
+	cp.bodies <- msg.Body
+	return nil
+}
+
+// queuedEvents reads what is published to the kitchen queue, until the test ends.
+func (th *testAdminHandler) queuedEvents(t *testing.T) <-chan []byte {
+	t.Helper()
+
+	processor := &capturingProcessor{bodies: make(chan []byte, 10)}
+	consumer := service.GetMemoryConsumer(th.broker)
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		consumer.ConsumeEventAndProcess(constants.KITCHEN_ORDER_QUEUE, processor)
+	}()
+	t.Cleanup(func() {
+		consumer.StopConsuming(context.Background())
+		<-exited
+	})
+	return processor.bodies
+}
+
+func TestAdvanceMovesAPreparingOrderToPrepared(t *testing.T) {
+	th := newTestAdminHandler(t)
+	events := th.queuedEvents(t)
+	th.store.Save(service.Order{OrderNo: "A1", OwnerID: "alice", Status: constants.ORDER_PREPARING,
+		Payload: map[string]any{"order_no": "A1", "customer_id": "alice", "order_status": constants.ORDER_ORDERED}})
+
+	code, body := th.do(t, "POST", "/admin/orders/A1/advance", nil)
+	data, _ := body["data"].(map[string]any)
+	if code != 202 || data["from"] != constants.ORDER_PREPARING || data["to"] != constants.ORDER_PREPARED {
+		t.Fatalf("got %d %v, want 202 from preparing to prepared", code, body)
+	}
+	if order, _ := th.store.Get("A1"); order.Status != constants.ORDER_PREPARED {
+		t.Errorf("status: got %q, want prepared", order.Status)
+	}
+
+	// The prepared event is queued, so the customer is told as if the kitchen had finished.
+	select {
+	case raw := <-events:
+		var event map[string]any
+		if err := json.Unmarshal(raw, &event); err != nil || event["order_status"] != constants.ORDER_PREPARED || event["order_no"] != "A1" {
+			t.Errorf("queued %s, want A1's prepared event", raw)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no event was queued")
+	}
+}
+
+func TestAdvancingAPreparedOrderTellsTheCustomer(t *testing.T) {
+	th := newTestAdminHandler(t)
+	var writes atomic.Int32
+	alice := &recordingConnection{onWrite: func() { writes.Add(1) }}
+	th.sockets.addConnection("alice", alice)
+	th.store.Save(service.Order{OrderNo: "A1", OwnerID: "alice", Status: constants.ORDER_PREPARED,
+		Payload: map[string]any{"order_no": "A1", "customer_id": "alice", "order_status": constants.ORDER_ORDERED}})
+
+	// The kitchen side, as main wires it, reading the queue the advance publishes to.
+	processor := service.GetMessageProcessorService(service.GetMemoryPublisher(th.broker), th.sockets.GetConnection,
+		service.GetOrderStatusValidator(), th.store, service.GetKitchenMetrics(), service.ProcessorOptions{})
+	kitchen := service.GetMemoryConsumer(th.broker)
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		kitchen.ConsumeEventAndProcess(constants.KITCHEN_ORDER_QUEUE, processor)
+	}()
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			kitchen.StopConsuming(context.Background())
+			<-exited
+		})
+	}
+	t.Cleanup(stop)
+
+	code, body := th.do(t, "POST", "/admin/orders/A1/advance", nil)
+	if data, _ := body["data"].(map[string]any); code != 202 || data["to"] != constants.ORDER_DELIVERED {
+		t.Fatalf("got %d %v, want 202 to delivered", code, body)
+	}
+	waitFor(t, func() bool { return writes.Load() > 0 })
+	stop()
+
+	var update map[string]any
+	if len(alice.sent) != 1 || json.Unmarshal(alice.sent[0], &update) != nil || update["message"] != constants.ORDER_PREPARED_SUCCESSFULLY {
+		t.Errorf("alice got %q, want the ready notification", alice.sent)
+	}
+}
+
+func TestIllegalAdvanceIsRejected(t *testing.T) {
+	cases := []struct {
+		name   string
+		status string // "" = no such order
+		want   int
+	}{
+		{name: "delivered", status: constants.ORDER_DELIVERED, want: 409},
+		{name: "cancelled", status: constants.ORDER_STATUS_CANCELLED, want: 409},
+		{name: "unknown order", want: 404},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			th := newTestAdminHandler(t)
+			if tc.status != "" {
+				th.store.Save(service.Order{OrderNo: "A1", OwnerID: "alice", Status: tc.status, Payload: map[string]any{"order_no": "A1"}})
+			}
+
+			if code, body := th.do(t, "POST", "/admin/orders/A1/advance", nil); code != tc.want {
+				t.Fatalf("got %d %v, want %d", code, body, tc.want)
+			}
+			if order, ok := th.store.Get("A1"); ok && order.Status != tc.status {
+				t.Errorf("status changed to %q", order.Status)
+			}
+			if depth, _ := service.GetMemoryPublisher(th.broker).QueueDepth(constants.KITCHEN_ORDER_QUEUE); depth != 0 {
+				t.Errorf("%d event(s) queued for a rejected advance", depth)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/everestp/pizza-shop/logger"
+	"github.com/everestp/pizza-shop/service"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// AlertsHandler is the admin WebSocket group: every ops console connected here
+// receives SLA escalations as they happen.
+// A console opened with "?tag=delivery" only gets escalations for orders with that tag.
+type AlertsHandler struct {
+	upgrader websocket.Upgrader
+	clients  *clientGroup   // Every admin console currently watching
+	tags     map[int]string // Console ID -> the tag it filters on (absent = everything)
+	mutex    sync.Mutex     // Guards 'tags'
+}
+
+// HandleConnection upgrades an admin console and keeps it registered until it disconnects.
+func (ah *AlertsHandler) HandleConnection(ctx *gin.Context) {
+	conn, err := upgradeConnection(&ah.upgrader, ctx)
+	if err != nil {
+		logger.Log(fmt.Sprintf("CRITICAL: Failed to upgrade alerts connection: %v", err))
+		return
+	}
+	defer conn.Close()
+
+	id := ah.clients.add(service.NewWebSocketConnection(ctx.Request.Context(), conn, connectionMetadata(ctx)))
+	defer ah.clients.remove(id)
+	if tag := strings.ToLower(ctx.Query("tag")); tag != "" {
+		ah.setFilter(id, tag)
+		defer ah.setFilter(id, "")
+	}
+
+	// Consoles only listen; reading just tells us when they leave.
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			logger.Log(fmt.Sprintf("Admin console [%d] %s", id, describeReadError(err)))
+			return
+		}
+	}
+}
+
+// NotifyEscalation pushes one SLA escalation to every admin console.
+func (ah *AlertsHandler) NotifyEscalation(escalation service.SLAEscalation) {
+	bytes, err := service.MarshalWebSocketMessage(escalation)
+	if err != nil {
+		logger.Log(fmt.Sprintf("Failed to encode escalation: %v", err))
+		return
+	}
+	ah.clients.broadcastWhere(bytes, func(id int) bool {
+		ah.mutex.Lock()
+		tag, filtered := ah.tags[id]
+		ah.mutex.Unlock()
+		return !filtered || service.HasTag(escalation.Tags, tag)
+	})
+}
+
+// setFilter remembers (or, with "", forgets) the tag a console filters on.
+func (ah *AlertsHandler) setFilter(id int, tag string) {
+	ah.mutex.Lock()
+	defer ah.mutex.Unlock()
+
+	if tag == "" {
+		delete(ah.tags, id)
+		return
+	}
+	ah.tags[id] = tag
+}
+
+
+// CloseAll says goodbye to every admin console (used during shutdown).
+func (ah *AlertsHandler) CloseAll() {
+	ah.clients.closeAll()
+}
+
+// GetAlertsHandler is the Constructor.
+func GetAlertsHandler() *AlertsHandler {
+	return &AlertsHandler{
+		clients: newClientGroup("admin console"),
+		tags:    make(map[int]string),
+		upgrader: newUpgrader(),
+	}
+}
@@ -0,0 +1,34 @@
+package handler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/everestp/pizza-shop/service"
+)
+
+func TestTaggedAlertsConsoleOnlyGetsMatchingEscalations(t *testing.T) {
+	ah := GetAlertsHandler()
+	everything := dialTestSocket(t, ah.HandleConnection, "")
+	deliveries := dialTestSocket(t, ah.HandleConnection, "?tag=Delivery")
+	waitFor(t, func() bool {
+		ah.clients.mutex.Lock()
+		defer ah.clients.mutex.Unlock()
+		ah.mutex.Lock()
+		defer ah.mutex.Unlock()
+		return len(ah.clients.clients) == 2 && len(ah.tags) == 1
+	})
+
+	ah.NotifyEscalation(service.SLAEscalation{Type: "sla_breach", OrderNo: "A1", Tags: []string{"dine-in"}})
+	ah.NotifyEscalation(service.SLAEscalation{Type: "sla_breach", OrderNo: "A2", Tags: []string{"delivery", "promo"}})
+
+	for _, want := range []string{"A1", "A2"} {
+		if frame := readFrame(t, everything); frame["order_no"] != want {
+			t.Errorf("unfiltered console: got %v, want %s", frame, want)
+		}
+	}
+	if frame := readFrame(t, deliveries); frame["order_no"] != "A2" {
+		t.Errorf("delivery console: got %v, want only A2", frame)
+	}
+	expectSilence(t, deliveries, 50*time.Millisecond)
+}
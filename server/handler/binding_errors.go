@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// FieldProblem is one thing wrong with a request body, phrased for the client.
+type FieldProblem struct {
+	Field   string `json:"field,omitempty"` // JSON path, e.g. "items[0].price"
+	Problem string `json:"problem"`
+}
+
+// orderRequest describes the order fields we validate. The order itself stays a
+// free-form map (extra fields travel with it); this only checks the known ones.
+type orderRequest struct {
+	Items    []orderItemRequest `json:"items" binding:"omitempty,dive"`
+	Notes    string             `json:"notes"`
+	Tags     []string           `json:"tags"`
+	Region   string             `json:"region"`
+	StoreID  string             `json:"store_id"`
+	Priority float64            `json:"priority"`
+}
+
+type orderItemRequest struct {
+	Name     string  `json:"name" binding:"required"`
+	Price    float64 `json:"price" binding:"gte=0"`
+	Quantity int     `json:"quantity" binding:"gte=0"`
+}
+
+// bindingProblems explains a binding/validation error field by field.
+// Go type names never reach the client: types are described as "a number", "text" etc.
+func bindingProblems(err error) []FieldProblem {
+	var fieldErrors validator.ValidationErrors
+	if errors.As(err, &fieldErrors) {
+		problems := make([]FieldProblem, 0, len(fieldErrors))
+		for _, fe := range fieldErrors {
+			problems = append(problems, FieldProblem{Field: fieldPath(fe), Problem: describeRule(fe)})
+		}
+		return problems
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return []FieldProblem{{Field: typeErr.Field, Problem: "must be " + describeKind(typeErr.Type)}}
+	}
+
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return []FieldProblem{{Problem: fmt.Sprintf("malformed JSON at byte %d", syntaxErr.Offset)}}
+	}
+	return []FieldProblem{{Problem: "body must be a JSON object"}}
+}
+
+// init makes validation errors use the JSON names ("store_id", not "StoreID").
+// gin's validator is process-wide, so it is set up once here rather than on a request.
+func init() {
+	if engine, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		engine.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "-" {
+				return ""
+			}
+			return name
+		})
+	}
+}
+
+// fieldPath drops the struct name from "orderRequest.items[0].name".
+func fieldPath(fe validator.FieldError) string {
+	namespace := fe.Namespace()
+	if i := strings.Index(namespace, "."); i >= 0 {
+		return namespace[i+1:]
+	}
+	return namespace
+}
+
+func describeRule(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "gte":
+		return "must be at least " + fe.Param()
+	case "lte":
+		return "must be at most " + fe.Param()
+	case "max":
+		return "must be at most " + fe.Param() + " long"
+	default:
+		return "is invalid (" + fe.Tag() + ")"
+	}
+}
+
+func describeKind(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "text"
+	case reflect.Bool:
+		return "true or false"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "a whole number"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "a list"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	default:
+		return "a different type"
+	}
+}
@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/everestp/pizza-shop/logger"
+	"github.com/everestp/pizza-shop/service"
+	"github.com/gorilla/websocket"
+)
+
+// clientGroup is a set of sockets that all receive the SAME broadcast
+// (stats dashboards, admin alert consoles). They have no user ID, so we number them.
+type clientGroup struct {
+	name    string                               // Used in log lines, e.g. "stats dashboard"
+	clients map[int]service.IWebSocketConnection // Everyone currently listening
+	nextId  int
+	mutex   sync.Mutex // Guards 'clients' and 'nextId'
+}
+
+// add registers a client and returns its number.
+func (cg *clientGroup) add(client service.IWebSocketConnection) int {
+	cg.mutex.Lock()
+	defer cg.mutex.Unlock()
+
+	cg.nextId++
+	cg.clients[cg.nextId] = client
+	return cg.nextId
+}
+
+// remove forgets a client that went away.
+func (cg *clientGroup) remove(id int) {
+	cg.mutex.Lock()
+	defer cg.mutex.Unlock()
+
+	delete(cg.clients, id)
+}
+
+// broadcast sends one frame to every client.
+// The clients are copied under the lock and written to outside it, so a slow client
+// doesn't block joins and leaves; the ones that fail are closed and pruned afterwards.
+func (cg *clientGroup) broadcast(bytes []byte) {
+	cg.broadcastWhere(bytes, nil)
+}
+
+// broadcastWhere is broadcast limited to the clients 'match' accepts (nil = everyone).
+func (cg *clientGroup) broadcastWhere(bytes []byte, match func(id int) bool) {
+	cg.mutex.Lock()
+	clients := make(map[int]service.IWebSocketConnection, len(cg.clients))
+	for id, client := range cg.clients {
+		if match == nil || match(id) {
+			clients[id] = client
+		}
+	}
+	cg.mutex.Unlock()
+
+	for id, client := range clients {
+		if err := client.SendMessage(bytes); err != nil {
+			logger.Log(fmt.Sprintf("Failed to push to %s [%d], dropping it: %v", cg.name, id, err))
+			client.Close()
+			cg.prune(id, client)
+		}
+	}
+}
+
+// prune forgets a failed client, unless its handler already removed it.
+func (cg *clientGroup) prune(id int, client service.IWebSocketConnection) {
+	cg.mutex.Lock()
+	defer cg.mutex.Unlock()
+
+	if cg.clients[id] == client {
+		delete(cg.clients, id)
+	}
+}
+
+// closeAll says goodbye to every client (used during shutdown).
+func (cg *clientGroup) closeAll() {
+	cg.mutex.Lock()
+	defer cg.mutex.Unlock()
+
+	for id, client := range cg.clients {
+		service.CloseWith(client, websocket.CloseGoingAway, shutdownCloseReason)
+		delete(cg.clients, id)
+	}
+}
+
+func newClientGroup(name string) *clientGroup {
+	return &clientGroup{
+		name:    name,
+		clients: make(map[int]service.IWebSocketConnection),
+	}
+}
@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/everestp/pizza-shop/logger"
+	"github.com/everestp/pizza-shop/service"
+)
+
+// StartReaper runs ReapDeadConnections every 'interval' until ctx is cancelled.
+// It is a safety net on top of the per-connection keep-alive: an entry whose read loop
+// never noticed its client was gone would otherwise stay in the "Address Book" forever.
+func (h *WebSocketHandler) StartReaper(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.ReapDeadConnections()
+		}
+	}
+}
+
+// ReapDeadConnections pings every customer socket and order watcher and removes the ones
+// that fail (or whose context already ended). It returns how many were reaped.
+// Pings run outside the lock (each may wait up to the write timeout), and an entry is only
+// removed if it is still the same connection, so a quick reconnect is never thrown away.
+// Connections close at most once, so racing the handler's own cleanup is harmless.
+func (h *WebSocketHandler) ReapDeadConnections() int {
+	// 1. Snapshot under the lock.
+	h.mutex.Lock()
+	customers := make(map[string]service.IWebSocketConnection, len(*h.connection))
+	for clientId, connection := range *h.connection {
+		customers[clientId] = connection
+	}
+	watchers := make(map[service.IWebSocketConnection]string)
+	for orderNo, connections := range h.orderWatchers {
+		for connection := range connections {
+			watchers[connection] = orderNo
+		}
+	}
+	h.mutex.Unlock()
+
+	// 2. Ping everyone without holding it.
+	reaped := 0
+	for clientId, connection := range customers {
+		if isAlive(connection) {
+			continue
+		}
+		connection.Close()
+		h.removeConnection(clientId, connection)
+		logger.Log(fmt.Sprintf("Reaper: removed dead connection for [%s]", clientId))
+		reaped++
+	}
+	for connection, orderNo := range watchers {
+		if isAlive(connection) {
+			continue
+		}
+		connection.Close()
+		h.removeOrderWatcher(orderNo, connection)
+		logger.Log(fmt.Sprintf("Reaper: removed dead tracking page for order #%s", orderNo))
+		reaped++
+	}
+	return reaped
+}
+
+// isAlive is false once the connection's context ended or it can't take a ping.
+func isAlive(connection service.IWebSocketConnection) bool {
+	if connection.Context().Err() != nil {
+		return false
+	}
+	return connection.Ping() == nil
+}
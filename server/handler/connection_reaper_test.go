@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/everestp/pizza-shop/service"
+)
+
+// pingedConnection is a socket whose ping result is chosen by the test.
+type pingedConnection struct {
+	recordingConnection
+	ctx     context.Context
+	pingErr error
+	onPing  func() // Runs during the ping, when set
+	mutex   sync.Mutex
+	closes  int
+}
+
+func newPingedConnection(ctx context.Context, pingErr error) *pingedConnection {
+	return &pingedConnection{recordingConnection: recordingConnection{onWrite: func() {}}, ctx: ctx, pingErr: pingErr}
+}
+
+func (c *pingedConnection) Ping() error {
+	if c.onPing != nil {
+		c.onPing()
+	}
+	return c.pingErr
+}
+func (c *pingedConnection) Context() context.Context { return c.ctx }
+func (c *pingedConnection) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.closes++
+	return nil
+}
+
+func (c *pingedConnection) closeCount() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.closes
+}
+
+func TestReaperRemovesOnlyTheDeadConnections(t *testing.T) {
+	h := GetNewWebSocketHandler(service.GetOrderStore(), service.GetPendingNotificationStore(time.Minute))
+	ended, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	live := newPingedConnection(context.Background(), nil)
+	unreachable := newPingedConnection(context.Background(), errors.New("broken pipe"))
+	gone := newPingedConnection(ended, nil) // Its read loop already ended
+	liveWatcher := newPingedConnection(context.Background(), nil)
+	deadWatcher := newPingedConnection(context.Background(), errors.New("broken pipe"))
+	h.addConnection("alice", live)
+	h.addConnection("bob", unreachable)
+	h.addConnection("carol", gone)
+	h.addOrderWatcher("A1", liveWatcher)
+	h.addOrderWatcher("A2", deadWatcher)
+
+	if reaped := h.ReapDeadConnections(); reaped != 3 {
+		t.Errorf("reaped %d, want the 3 dead sockets", reaped)
+	}
+	if h.GetConnection("alice") != live || h.ConnectionCount() != 1 {
+		t.Errorf("got %d connection(s), want only alice's", h.ConnectionCount())
+	}
+	if watchers := h.GetOrderWatchers("A1"); len(watchers) != 1 || watchers[0] != liveWatcher {
+		t.Errorf("A1 watchers: got %v, want the live one", watchers)
+	}
+	if watchers := h.GetOrderWatchers("A2"); len(watchers) != 0 {
+		t.Errorf("A2 watchers: got %v, want none", watchers)
+	}
+
+	// A second pass finds nothing new, and nobody is closed twice.
+	if reaped := h.ReapDeadConnections(); reaped != 0 {
+		t.Errorf("second pass reaped %d", reaped)
+	}
+	for name, c := range map[string]*pingedConnection{"bob": unreachable, "carol": gone, "A2 watcher": deadWatcher} {
+		if c.closeCount() != 1 {
+			t.Errorf("%s closed %d time(s), want once", name, c.closeCount())
+		}
+	}
+	for name, c := range map[string]*pingedConnection{"alice": live, "A1 watcher": liveWatcher} {
+		if c.closeCount() != 0 {
+			t.Errorf("%s was closed", name)
+		}
+	}
+}
+
+func TestReaperKeepsAReconnectThatReplacedTheDeadEntry(t *testing.T) {
+	h := GetNewWebSocketHandler(service.GetOrderStore(), service.GetPendingNotificationStore(time.Minute))
+	reconnected := newPingedConnection(context.Background(), nil)
+	dead := newPingedConnection(context.Background(), errors.New("broken pipe"))
+	// alice reconnects while the reaper is pinging her old socket.
+	dead.onPing = func() { h.addConnection("alice", reconnected) }
+	h.addConnection("alice", dead)
+
+	if reaped := h.ReapDeadConnections(); reaped != 1 {
+		t.Errorf("reaped %d, want the old socket", reaped)
+	}
+	if h.GetConnection("alice") != reconnected {
+		t.Error("the reaper removed the reconnected socket along with the dead one")
+	}
+	if dead.closeCount() != 1 || reconnected.closeCount() != 0 {
+		t.Errorf("closes: old %d, new %d; want 1 and 0", dead.closeCount(), reconnected.closeCount())
+	}
+}
@@ -0,0 +1,18 @@
+package handler
+
+import (
+	_ "embed"
+
+	"github.com/gin-gonic/gin"
+)
+
+// demoPage is a one-file test client: it opens /ws, places an order and prints every update.
+// It is compiled into the binary so the demo works without any files next to it.
+//
+//go:embed assets/demo.html
+var demoPage []byte
+
+// ServeDemoUI handles GET /demo (only registered with SERVE_DEMO_UI=true).
+func ServeDemoUI(ctx *gin.Context) {
+	ctx.Data(200, "text/html; charset=utf-8", demoPage)
+}
@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"github.com/everestp/pizza-shop/service"
+	"github.com/gin-gonic/gin"
+)
+
+// HealthHandler serves GET /health: is the kitchen consuming, and is the broker answering?
+// It always answers 200 (quickly, even when the broker hangs); "status" says "ok" or "degraded".
+type HealthHandler struct {
+	consumer service.IMessageConsumerService // Dependency: Reports whether the breaker paused it
+	probe    *service.BrokerProbe            // Dependency: Asks the broker about the kitchen queue
+}
+
+// Health reports the consumer's breaker and the broker probe.
+func (hh *HealthHandler) Health(ctx *gin.Context) {
+	breaker := hh.consumer.Breaker()
+	broker := hh.probe.Probe(ctx.Request.Context())
+
+	status, message := "ok", "Kitchen is consuming orders"
+	if breaker.State == "paused" {
+		status, message = "degraded", "Kitchen consumption is paused after repeated failures"
+	}
+	if broker.Status != "ok" {
+		status, message = "degraded", "The message broker is not answering"
+	}
+
+	ctx.JSON(200, gin.H{
+		"message":    message,
+		"status":     status,
+		"consumer":   breaker,
+		"broker":     broker,
+		"statusCode": 200,
+	})
+}
+
+// GetHealthHandler is the Constructor.
+func GetHealthHandler(consumer service.IMessageConsumerService, probe *service.BrokerProbe) *HealthHandler {
+	return &HealthHandler{
+		consumer: consumer,
+		probe:    probe,
+	}
+}
@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/everestp/pizza-shop/service"
+	"github.com/gin-gonic/gin"
+)
+
+func TestHealthReportsAHungBrokerAsDegraded(t *testing.T) {
+	hung := make(chan struct{})
+	t.Cleanup(func() { close(hung) })
+	cases := []struct {
+		name  string
+		check func() error
+		want  string
+	}{
+		{name: "broker answers", check: func() error { return nil }, want: "ok"},
+		{name: "broker hangs", check: func() error { <-hung; return nil }, want: "degraded"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			consumer := service.GetMemoryConsumer(service.GetMemoryBroker(1))
+			probe := service.GetBrokerProbe(tc.check, 50*time.Millisecond, 0)
+			router := gin.New()
+			router.GET("/health", GetHealthHandler(consumer, probe).Health)
+
+			start := time.Now()
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest("GET", "/health", nil))
+			if waited := time.Since(start); waited > time.Second {
+				t.Fatalf("/health took %v", waited)
+			}
+
+			var body struct {
+				Status string              `json:"status"`
+				Broker service.ProbeResult `json:"broker"`
+			}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil || recorder.Code != 200 {
+				t.Fatalf("got %d %s", recorder.Code, recorder.Body)
+			}
+			if body.Status != tc.want || body.Broker.Status != tc.want {
+				t.Errorf("got %s, want status %q", recorder.Body, tc.want)
+			}
+		})
+	}
+}
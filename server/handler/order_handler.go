@@ -1,15 +1,35 @@
 package handler
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/everestp/pizza-shop/config"
 	"github.com/everestp/pizza-shop/constants"
+	"github.com/everestp/pizza-shop/logger"
 	"github.com/everestp/pizza-shop/service"
+	"github.com/everestp/pizza-shop/utils"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 )
 
 // OrderHandler is the "Postman" of your API. 
 // It receives HTTP requests and passes them to the RabbitMQ system.
 type OrderHandler struct {
-	messagePublisher service.IMessagePubliser // Dependency: Interface to talk to RabbitMQ
+	messagePublisher service.IMessagePubliser      // Dependency: Interface to talk to RabbitMQ
+	store            service.IOrderStore           // Dependency: Remembers who owns which order
+	router           *service.KitchenRouter        // Dependency: Picks the region's kitchen queue
+	validator        service.IOrderStatusValidator // Dependency: Knows which orders may still be cancelled
+	metrics          *service.KitchenMetrics       // Dependency: Counts orders for the stats dashboard
+	eventLog         service.IEventLog             // Dependency: Audit trail of every status change
+	orderNumbers     service.IOrderNumberGenerator // Dependency: Numbers orders that arrive without one
+	sockets          IWebSocketHandler             // Dependency: Re-sends an order's status to its live connections
+	inFlight         *service.InFlightTracker      // Dependency: How many orders the kitchen is cooking
 }
 
 // CreateOrder handles the POST request when a user places a pizza order.
@@ -18,43 +38,417 @@ func (oh *OrderHandler) CreateOrder(ctx *gin.Context) {
 
 	// 1. Bind JSON: Read the data sent by the user (e.g., pizza type, quantity).
 	// If the JSON is broken, we return a 400 Bad Request immediately.
-	if err := ctx.ShouldBindJSON(&payload); err != nil {
+	// The body is read once and bound twice: into the free-form payload, then into
+	// orderRequest to validate the fields we know (items, notes, region, store_id).
+	var request orderRequest
+	err := ctx.ShouldBindBodyWith(&payload, binding.JSON)
+	if err == nil {
+		err = ctx.ShouldBindBodyWith(&request, binding.JSON)
+	}
+	if err != nil {
+		// The body limit middleware cut the read short: that's a 413, not a 400.
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			ctx.JSON(413, gin.H{
+				"message":    "Request body too large",
+				"statusCode": 413,
+			})
+			return
+		}
 		ctx.JSON(400, gin.H{
 			"message":    "Invalid order data provided",
+			"errors":     bindingProblems(err),
 			"statusCode": 400,
 		})
 		return // Stop processing if input is bad
 	}
 
-	// 2. Initial State: Every new order starts with the status "ORDERED".
+	// The body limit bounds the bytes; MAX_ORDER_ITEMS (default 50, 0 = no limit) bounds the line items.
+	if maxItems := config.GetEnvPropertyAsInt("max_order_items", 50); maxItems > 0 && len(request.Items) > maxItems {
+		ctx.JSON(422, gin.H{
+			"message":    fmt.Sprintf("An order can have at most %d items, this one has %d", maxItems, len(request.Items)),
+			"statusCode": 422,
+		})
+		return
+	}
+
+	status, body := oh.PlaceOrder(ctx.Request.Context(), payload, ctx.GetString(constants.CONTEXT_USER_ID))
+	ctx.JSON(status, body)
+}
+
+// PlaceOrder does everything after binding: pricing, stamping, routing, storing and
+// publishing. It returns the HTTP status and body to reply with, so non-HTTP callers
+// (like the demo seeder) place orders exactly the way customers do.
+func (oh *OrderHandler) PlaceOrder(ctx context.Context, payload map[string]any, userId string) (int, gin.H) {
+	// Tracing: this span is the root of the order's trace across every queue hop.
+	ctx, span := service.StartSpan(ctx, "CreateOrder")
+	defer span.End()
+
+	// 2. Pricing: If the order lists its items, work out what the customer owes.
+	// The totals travel with the event so the "ready" notification can show the amount due.
+	var items []service.OrderItem
+	if rawItems, ok := payload["items"]; ok {
+		var err error
+		items, err = service.ParseOrderItems(rawItems)
+		if err != nil {
+			return 400, gin.H{
+				"message":    err.Error(),
+				"statusCode": 400,
+			}
+		}
+		totals := service.PriceOrder(items, config.GetEnvPropertyAsFloat("tax_rate", 0))
+		payload["subtotal"] = totals.Subtotal
+		payload["tax"] = totals.Tax
+		payload["total"] = totals.Total
+	}
+
+	// Special instructions (e.g. "extra crispy, no onions") ride along with the order
+	// all the way to the "ready" notification. MAX_ORDER_NOTES_LENGTH defaults to 280.
+	if rawNotes, ok := payload["notes"]; ok {
+		notes, err := service.SanitizeNotes(rawNotes, config.GetEnvPropertyAsInt("max_order_notes_length", 280))
+		if err != nil {
+			return 400, gin.H{
+				"message":    err.Error(),
+				"statusCode": 400,
+			}
+		}
+		if notes == "" {
+			delete(payload, "notes")
+		} else {
+			payload["notes"] = notes
+		}
+	}
+
+	// Tags (e.g. ["delivery", "promo"]) must come from ORDER_TAGS; they travel with the
+	// event and let GET /orders and the admin alerts be filtered.
+	var tags []string
+	if rawTags, ok := payload["tags"]; ok {
+		allowed := config.GetEnvProperty("order_tags")
+		if allowed == "" {
+			allowed = constants.DEFAULT_ORDER_TAGS
+		}
+		var err error
+		tags, err = service.ValidateTags(rawTags, service.ParseTagAllowlist(allowed))
+		if err != nil {
+			return 400, gin.H{
+				"message":    err.Error(),
+				"statusCode": 400,
+			}
+		}
+		if len(tags) == 0 {
+			delete(payload, "tags")
+		} else {
+			payload["tags"] = tags
+		}
+	}
+
+	// Priority (0 = normal, up to MAX_ORDER_PRIORITY) moves the order up the pending queue.
+	priority, err := service.ParsePriority(payload["priority"])
+	if err != nil {
+		return 400, gin.H{
+			"message":    err.Error(),
+			"statusCode": 400,
+		}
+	}
+	if priority == 0 {
+		delete(payload, "priority")
+	} else {
+		payload["priority"] = priority
+	}
+
+	// Backpressure: with KITCHEN_MAX_IN_FLIGHT set, a full stove turns new orders away.
+	if oh.inFlight.Full() {
+		return 503, gin.H{
+			"message":    "The kitchen is too busy right now, please try again in a moment",
+			"statusCode": 503,
+		}
+	}
+
+	// 3. Initial State: Every new order starts with the status "ORDERED".
 	// We add this to the payload so the Consumer knows how to process it later.
 	payload["order_status"] = constants.ORDER_ORDERED
+	payload["type"] = constants.EVENT_TYPE_ORDER // Other event types may share the kitchen queue
+
+	// 4. Ownership: Stamp the order with the caller (from the token) and make sure
+	// it has an order number we can look it up by later.
+	// The correlation ID ties together every event this order produces.
+	payload["customer_id"] = userId
+	if _, ok := payload["order_no"]; !ok {
+		payload["order_no"] = oh.orderNumbers.Next()
+	}
+	payload["correlation_id"] = utils.RandomId()
+	payload["created_at"] = utils.Clock.Now().UTC().Format(time.RFC3339Nano) // Start of the order's SLA clock
+	orderNo := fmt.Sprint(payload["order_no"])
 
-	// 3. Hand-off: Send the order to RabbitMQ. 
+	// 5. Routing: Multi-store chains send the order to its region's kitchen
+	// ("region", or "store_id" as a fallback). Unknown regions use the default kitchen.
+	region, _ := payload["region"].(string)
+	if region == "" {
+		region, _ = payload["store_id"].(string)
+	}
+	queueName, err := oh.router.QueueFor(region)
+	if err != nil {
+		return 500, gin.H{
+			"message": "Failed to route order to a kitchen",
+			"error":   err.Error(),
+		}
+	}
+	payload["kitchen_queue"] = queueName
+
+	// A client may pick its own order number, but never one that is already taken:
+	// that would hand someone else's order to the caller.
+	created := oh.store.Create(service.Order{
+		OrderNo:  orderNo,
+		OwnerID:  userId,
+		Status:   constants.ORDER_ORDERED,
+		Payload:  payload,
+		Items:    service.NewItemStates(items),
+		Tags:     tags,
+		Priority: priority,
+	})
+	if !created {
+		return 409, gin.H{
+			"message":    fmt.Sprintf("Order #%s already exists", orderNo),
+			"statusCode": 409,
+		}
+	}
+
+	// 6. Hand-off: Send the order to RabbitMQ. 
 	// This makes our API fast because we don't wait for the chef to cook; 
 	// we just put the order on the "To-Do List" (Queue).
-	err := oh.messagePublisher.PublishEvent(constants.KITCHEN_ORDER_QUEUE, payload)
+	options := service.PublishOptions{RoutingKey: queueName, Context: ctx, MessageId: service.StepMessageId(payload)}
+	err = oh.messagePublisher.PublishEventWithOptions(options, payload)
+	if errors.Is(err, service.ErrPublishRejected) {
+		// The kitchen is at capacity: ask the customer to try again shortly.
+		oh.store.UpdateStatus(orderNo, constants.ORDER_STATUS_CANCELLED)
+		return 503, gin.H{
+			"message":    "The kitchen is too busy right now, please try again in a moment",
+			"statusCode": 503,
+		}
+	}
+	if errors.Is(err, service.ErrUnroutable) {
+		// No queue is bound for this kitchen (PUBLISH_MANDATORY=true caught it): nobody would cook it.
+		oh.store.UpdateStatus(orderNo, constants.ORDER_STATUS_CANCELLED)
+		return 500, gin.H{
+			"message":    "No kitchen is taking orders on this route, your order was not placed",
+			"error":      err.Error(),
+			"statusCode": 500,
+		}
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		// The request's deadline (REQUEST_TIMEOUT_MS) ran out before RabbitMQ answered.
+		oh.store.UpdateStatus(orderNo, constants.ORDER_STATUS_CANCELLED)
+		return 504, gin.H{
+			"message":    "Timed out sending your order to the kitchen, please try again",
+			"statusCode": 504,
+		}
+	}
 	if err != nil {
+		// Whatever else went wrong, the kitchen never got it: don't leave a ghost order in the queue.
+		oh.store.UpdateStatus(orderNo, constants.ORDER_STATUS_CANCELLED)
+		return 500, gin.H{
+			"message":    "Failed to send order to kitchen",
+			"error":      err.Error(),
+			"statusCode": 500,
+		}
+	}
+
+	oh.metrics.RecordOrder()
+	oh.recordEvent(orderNo, constants.ORDER_ORDERED, payload["correlation_id"])
+
+	// 7. Response: Tell the user "We got your order!" 
+	// They can now wait for the WebSocket update.
+	return 200, gin.H{
+		"data":       payload,
+		"statusCode": 200,
+		"message":    "Order accepted successfully! The kitchen is being notified.",
+	}
+}
+
+// GetOrder handles GET /orders/:orderNo and returns the order's current state.
+func (oh *OrderHandler) GetOrder(ctx *gin.Context) {
+	order, ok := oh.findOwnedOrder(ctx)
+	if !ok {
+		return
+	}
+
+	ctx.JSON(200, gin.H{
+		"data":       order,
+		"statusCode": 200,
+	})
+}
+
+// ListOrders handles GET /orders and returns the caller's orders, newest first.
+// "?tag=delivery" keeps only the orders with that tag.
+func (oh *OrderHandler) ListOrders(ctx *gin.Context) {
+	userId := ctx.GetString(constants.CONTEXT_USER_ID)
+	tag := strings.ToLower(ctx.Query("tag"))
+
+	orders := make([]service.Order, 0)
+	for _, order := range oh.store.All() {
+		if order.OwnerID == userId && (tag == "" || order.HasTag(tag)) {
+			orders = append(orders, order)
+		}
+	}
+	sort.Slice(orders, func(i, j int) bool {
+		return orders[i].CreatedAt.After(orders[j].CreatedAt)
+	})
+
+	ctx.JSON(200, gin.H{
+		"data":       orders,
+		"statusCode": 200,
+	})
+}
+
+// PendingQueue handles GET /orders/queue: the caller's orders still waiting for a chef,
+// with their place in the kitchen's queue (highest priority first, then first come first served).
+// Other customers' orders only show up as the gaps in the positions; ops see the whole
+// queue on GET /admin/orders/queue.
+func (oh *OrderHandler) PendingQueue(ctx *gin.Context) {
+	ctx.JSON(200, gin.H{
+		"data":       service.QueueOfOwner(oh.store.Pending(), ctx.GetString(constants.CONTEXT_USER_ID)),
+		"statusCode": 200,
+	})
+}
+
+// ResendStatus handles POST /orders/:orderNo/resend.
+// A client whose socket reconnected and may have missed updates gets the order's
+// current status pushed again (just the latest state, not the whole history).
+func (oh *OrderHandler) ResendStatus(ctx *gin.Context) {
+	order, ok := oh.findOwnedOrder(ctx)
+	if !ok {
+		return
+	}
+
+	pushed := oh.sockets.ResendStatus(order)
+	ctx.JSON(202, gin.H{
+		"data": gin.H{
+			"order_no":     order.OrderNo,
+			"order_status": order.Status,
+			"connections":  pushed,
+		},
+		"statusCode": 202,
+		"message":    "Current status sent to your open connections",
+	})
+}
+
+// CancelOrder handles POST /orders/:orderNo/cancel.
+// The store is updated right away (so the kitchen stops working on it) and a
+// "cancelled" event is queued so the customer hears about it over WebSocket.
+func (oh *OrderHandler) CancelOrder(ctx *gin.Context) {
+	order, ok := oh.findOwnedOrder(ctx)
+	if !ok {
+		return
+	}
+
+	// 1. Only orders that haven't left the oven can be cancelled.
+	if !oh.validator.CanTransition(order.Status, constants.ORDER_STATUS_CANCELLED) {
+		ctx.JSON(409, gin.H{
+			"message":    fmt.Sprintf("Order in status %q can no longer be cancelled", order.Status),
+			"statusCode": 409,
+		})
+		return
+	}
+	order, _ = oh.store.UpdateStatus(order.OrderNo, constants.ORDER_STATUS_CANCELLED)
+	oh.recordEvent(order.OrderNo, constants.ORDER_STATUS_CANCELLED, order.Payload["correlation_id"])
+	oh.inFlight.Leave(order.OrderNo) // Off the stove now, not once the cancelled event gets through the queue
+
+	// 2. Let the processor notify the customer.
+	event := map[string]any{
+		"order_no":       order.OrderNo,
+		"customer_id":    order.OwnerID,
+		"order_status":   constants.ORDER_STATUS_CANCELLED,
+		"correlation_id": order.Payload["correlation_id"],
+		"kitchen_queue":  service.KitchenQueueOf(order.Payload),
+	}
+	options := service.PublishOptions{RoutingKey: service.KitchenQueueOf(order.Payload), Context: ctx.Request.Context(), MessageId: service.StepMessageId(event)}
+	if err := oh.messagePublisher.PublishEventWithOptions(options, event); err != nil {
 		ctx.JSON(500, gin.H{
-			"message": "Failed to send order to kitchen",
+			"message": "Order cancelled but the notification could not be queued",
 			"error":   err.Error(),
 		})
 		return
 	}
 
-	// 4. Response: Tell the user "We got your order!" 
-	// They can now wait for the WebSocket update.
 	ctx.JSON(200, gin.H{
-		"data":       payload,
+		"data":       order,
 		"statusCode": 200,
-		"message":    "Order accepted successfully! The kitchen is being notified.",
+		"message":    "Order cancelled successfully",
 	})
 }
 
+// GetOrderHistory handles GET /orders/:orderNo/history and returns every
+// status the order went through, oldest first.
+func (oh *OrderHandler) GetOrderHistory(ctx *gin.Context) {
+	order, ok := oh.findOwnedOrder(ctx)
+	if !ok {
+		return
+	}
+
+	history, err := oh.eventLog.History(order.OrderNo)
+	if err != nil {
+		ctx.JSON(500, gin.H{
+			"message": "Failed to read order history",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(200, gin.H{
+		"data":       history,
+		"statusCode": 200,
+	})
+}
+
+// recordEvent appends one status change to the audit trail.
+// A failure here is logged but never fails the customer's request.
+func (oh *OrderHandler) recordEvent(orderNo string, status string, correlationId any) {
+	id, _ := correlationId.(string)
+	err := oh.eventLog.Append(service.OrderEvent{
+		OrderNo:       orderNo,
+		Status:        status,
+		CorrelationID: id,
+		Timestamp:     utils.Clock.Now(),
+	})
+	if err != nil {
+		logger.Log(fmt.Sprintf("Failed to record order event: %v", err))
+	}
+}
+
+// findOwnedOrder looks up :orderNo and checks it belongs to the caller.
+// It writes the 404/403 response itself and returns false when the caller should stop.
+func (oh *OrderHandler) findOwnedOrder(ctx *gin.Context) (service.Order, bool) {
+	order, ok := oh.store.Get(ctx.Param("orderNo"))
+	if !ok {
+		ctx.JSON(404, gin.H{
+			"message":    "Order not found",
+			"statusCode": 404,
+		})
+		return service.Order{}, false
+	}
+
+	if order.OwnerID != ctx.GetString(constants.CONTEXT_USER_ID) {
+		ctx.JSON(403, gin.H{
+			"message":    "You are not allowed to access this order",
+			"statusCode": 403,
+		})
+		return service.Order{}, false
+	}
+	return order, true
+}
+
 // GetOrderHandler is the Constructor. 
 // Note: I fixed the parameter type to service.IMessagePubliser to match the struct.
-func GetOrderHandler(messagePublisher service.IMessagePubliser) *OrderHandler {
+func GetOrderHandler(messagePublisher service.IMessagePubliser, store service.IOrderStore, router *service.KitchenRouter, validator service.IOrderStatusValidator, metrics *service.KitchenMetrics, eventLog service.IEventLog, orderNumbers service.IOrderNumberGenerator, sockets IWebSocketHandler, inFlight *service.InFlightTracker) *OrderHandler {
 	return &OrderHandler{
 		messagePublisher: messagePublisher,
+		store:            store,
+		router:           router,
+		validator:        validator,
+		metrics:          metrics,
+		eventLog:         eventLog,
+		orderNumbers:     orderNumbers,
+		sockets:          sockets,
+		inFlight:         inFlight,
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,760 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/everestp/pizza-shop/constants"
+	"github.com/everestp/pizza-shop/middleware"
+	"github.com/everestp/pizza-shop/service"
+	"github.com/everestp/pizza-shop/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// userTokens is a token verifier for tests: the token IS the user ID.
+type userTokens struct{}
+
+func (userTokens) Verify(token string) (string, error) {
+	if token == "" {
+		return "", service.ErrInvalidToken
+	}
+	return token, nil
+}
+
+// testOrderHandler is an OrderHandler on the in-memory broker, plus what the tests look at.
+type testOrderHandler struct {
+	handler *OrderHandler
+	store   *service.OrderStore
+	broker  *service.MemoryBroker
+	router  *gin.Engine
+}
+
+func newTestOrderHandler(t *testing.T) *testOrderHandler {
+	t.Helper()
+
+	broker := service.GetMemoryBroker(100)
+	publisher := service.GetMemoryPublisher(broker)
+	store := service.GetOrderStore()
+	oh := GetOrderHandler(publisher, store, service.GetKitchenRouter(nil, publisher), service.GetOrderStatusValidator(),
+		service.GetKitchenMetrics(), service.GetEventLog("", 100), service.UUIDOrderNumberGenerator{},
+		GetNewWebSocketHandler(store, service.GetPendingNotificationStore(time.Minute)), service.GetInFlightTracker(0))
+
+	router := gin.New()
+	orders := router.Group("/orders", middleware.AuthMiddleware(userTokens{}))
+	orders.POST("/create", oh.CreateOrder)
+	orders.GET("", oh.ListOrders)
+	orders.GET("/queue", oh.PendingQueue)
+	orders.GET("/:orderNo", oh.GetOrder)
+	orders.GET("/:orderNo/history", oh.GetOrderHistory)
+	orders.POST("/:orderNo/cancel", oh.CancelOrder)
+	orders.POST("/:orderNo/resend", oh.ResendStatus)
+
+	return &testOrderHandler{handler: oh, store: store, broker: broker, router: router}
+}
+
+// do sends a request as 'user' and decodes the JSON envelope.
+func (th *testOrderHandler) do(t *testing.T, method, path, user string, body any) (int, map[string]any) {
+	t.Helper()
+
+	var reader *bytes.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("marshal body: %v", err)
+		}
+		reader = bytes.NewReader(raw)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	request := httptest.NewRequest(method, path, reader)
+	request.Header.Set("Content-Type", "application/json")
+	if user != "" {
+		request.Header.Set("Authorization", "Bearer "+user)
+	}
+	recorder := httptest.NewRecorder()
+	th.router.ServeHTTP(recorder, request)
+
+	var envelope map[string]any
+	if err := json.Unmarshal(recorder.Body.Bytes(), &envelope); err != nil {
+		t.Fatalf("%s %s: response is not JSON: %q", method, path, recorder.Body.String())
+	}
+	return recorder.Code, envelope
+}
+
+func margherita(orderNo string) map[string]any {
+	order := map[string]any{"items": []map[string]any{{"name": "margherita", "price": 10, "quantity": 1}}}
+	if orderNo != "" {
+		order["order_no"] = orderNo
+	}
+	return order
+}
+
+func TestOwnerCanReadOwnOrder(t *testing.T) {
+	th := newTestOrderHandler(t)
+
+	if code, body := th.do(t, "POST", "/orders/create", "alice", margherita("A1")); code != 200 {
+		t.Fatalf("create: got %d %v", code, body)
+	}
+	code, body := th.do(t, "GET", "/orders/A1", "alice", nil)
+	if code != 200 {
+		t.Fatalf("get own order: got %d %v", code, body)
+	}
+	if owner := body["data"].(map[string]any)["owner_id"]; owner != "alice" {
+		t.Errorf("owner: got %v, want alice", owner)
+	}
+}
+
+func TestOtherUserIsForbidden(t *testing.T) {
+	th := newTestOrderHandler(t)
+	th.do(t, "POST", "/orders/create", "alice", margherita("A1"))
+
+	if code, _ := th.do(t, "GET", "/orders/A1", "mallory", nil); code != 403 {
+		t.Errorf("get: got %d, want 403", code)
+	}
+	if code, _ := th.do(t, "POST", "/orders/A1/cancel", "mallory", nil); code != 403 {
+		t.Errorf("cancel: got %d, want 403", code)
+	}
+	if code, _ := th.do(t, "GET", "/orders/A1", "", nil); code != 401 {
+		t.Errorf("no token: got %d, want 401", code)
+	}
+}
+
+func TestCancelledOrderFreesItsKitchenSlotRightAway(t *testing.T) {
+	th := newTestOrderHandler(t)
+	th.handler.inFlight = service.GetInFlightTracker(1)
+	th.do(t, "POST", "/orders/create", "alice", margherita("A1"))
+	stopped := false
+	th.handler.inFlight.Enter("A1", func() { stopped = true }) // The chef is on it
+
+	if code, _ := th.do(t, "POST", "/orders/create", "alice", margherita("A2")); code != 503 {
+		t.Fatalf("got %d, want a 503 while the kitchen is full", code)
+	}
+	if code, body := th.do(t, "POST", "/orders/A1/cancel", "alice", nil); code != 200 {
+		t.Fatalf("cancel: got %d %v", code, body)
+	}
+	if !stopped || th.handler.inFlight.Count() != 0 {
+		t.Errorf("stopped=%v in flight=%d: want the cook stopped and the slot free", stopped, th.handler.inFlight.Count())
+	}
+	if code, body := th.do(t, "POST", "/orders/create", "alice", margherita("A2")); code != 200 {
+		t.Errorf("got %d %v, want the next order taken", code, body)
+	}
+}
+
+func TestTakenOrderNumberIsRejected(t *testing.T) {
+	th := newTestOrderHandler(t)
+	th.do(t, "POST", "/orders/create", "alice", margherita("A1"))
+
+	code, body := th.do(t, "POST", "/orders/create", "mallory", margherita("A1"))
+	if code != 409 {
+		t.Fatalf("reused order number: got %d %v, want 409", code, body)
+	}
+	order, _ := th.store.Get("A1")
+	if order.OwnerID != "alice" {
+		t.Errorf("owner after the rejected order: got %q, want alice", order.OwnerID)
+	}
+	if code, _ := th.do(t, "GET", "/orders/A1", "alice", nil); code != 200 {
+		t.Errorf("owner lost access: got %d", code)
+	}
+}
+
+func TestOrderNumberIsGeneratedWhenMissing(t *testing.T) {
+	th := newTestOrderHandler(t)
+
+	code, body := th.do(t, "POST", "/orders/create", "alice", margherita(""))
+	if code != 200 {
+		t.Fatalf("create: got %d %v", code, body)
+	}
+	orderNo, _ := body["data"].(map[string]any)["order_no"].(string)
+	if orderNo == "" {
+		t.Fatalf("no order number generated: %v", body)
+	}
+	if _, ok := th.store.Get(orderNo); !ok {
+		t.Errorf("order %q was not stored", orderNo)
+	}
+}
+
+func TestPendingQueueShowsOnlyTheCallersOrders(t *testing.T) {
+	th := newTestOrderHandler(t)
+	rush := margherita("B1")
+	rush["priority"] = 1 // Ahead of A1 whatever the clock says
+	th.do(t, "POST", "/orders/create", "bob", rush)
+	th.do(t, "POST", "/orders/create", "alice", margherita("A1"))
+
+	code, body := th.do(t, "GET", "/orders/queue", "alice", nil)
+	if code != 200 {
+		t.Fatalf("got %d %v", code, body)
+	}
+	queue := body["data"].([]any)
+	if len(queue) != 1 {
+		t.Fatalf("got %v, want only A1", queue)
+	}
+	entry := queue[0].(map[string]any)
+	if entry["order_no"] != "A1" || entry["position"] != float64(2) {
+		t.Errorf("got %v, want A1 at position 2", entry)
+	}
+}
+
+// failingPublisher is a broker that is up but refuses every publish with an unexpected error.
+type failingPublisher struct {
+	service.IMessagePubliser
+}
+
+func (failingPublisher) PublishEventWithOptions(options service.PublishOptions, body any) error {
+	return errors.New("channel closed")
+}
+
+func TestOrderTotalsIncludeTax(t *testing.T) {
+	withEnv(t, map[string]string{"TAX_RATE": "0.13"})
+	th := newTestOrderHandler(t)
+
+	code, body := th.do(t, "POST", "/orders/create", "alice", map[string]any{"items": []map[string]any{
+		{"name": "margherita", "price": 9.5, "quantity": 2},
+		{"name": "cola", "price": 3, "quantity": 1},
+	}})
+	if code != 200 {
+		t.Fatalf("create: got %d %v", code, body)
+	}
+	data := body["data"].(map[string]any)
+	if data["subtotal"] != 22.0 || data["tax"] != 2.86 || data["total"] != 24.86 {
+		t.Errorf("got subtotal %v, tax %v, total %v; want 22, 2.86, 24.86", data["subtotal"], data["tax"], data["total"])
+	}
+}
+
+func TestNegativePriceIsRejected(t *testing.T) {
+	th := newTestOrderHandler(t)
+
+	code, body := th.do(t, "POST", "/orders/create", "alice", map[string]any{
+		"order_no": "A1",
+		"items":    []map[string]any{{"name": "margherita", "price": -10, "quantity": 1}},
+	})
+	if code != 400 || body["statusCode"] != 400.0 {
+		t.Fatalf("got %d %v, want a 400 envelope", code, body)
+	}
+	if _, ok := th.store.Get("A1"); ok {
+		t.Error("the rejected order was stored")
+	}
+}
+
+func TestFailedPublishCancelsTheOrder(t *testing.T) {
+	th := newTestOrderHandler(t)
+	th.handler.messagePublisher = failingPublisher{}
+
+	code, body := th.do(t, "POST", "/orders/create", "alice", margherita("A1"))
+	if code != 500 || body["statusCode"] != 500.0 {
+		t.Fatalf("got %d %v, want a 500 envelope", code, body)
+	}
+	if order, _ := th.store.Get("A1"); order.Status != constants.ORDER_STATUS_CANCELLED {
+		t.Errorf("status after the failed publish: got %q, want cancelled", order.Status)
+	}
+	if code, body := th.do(t, "GET", "/orders/queue", "alice", nil); code != 200 || len(body["data"].([]any)) != 0 {
+		t.Errorf("the order the kitchen never got is still queued: %d %v", code, body)
+	}
+}
+
+// instantClock is a fake clock on which every timer fires right away, so cooking takes no time.
+type instantClock struct {
+	utils.RealClock
+}
+
+func (instantClock) NewTimer(d time.Duration) *time.Timer { return time.NewTimer(0) }
+
+// slowCookClock cooks for an hour (anything a second or longer); everything else is instant.
+type slowCookClock struct {
+	utils.RealClock
+}
+
+func (slowCookClock) NewTimer(d time.Duration) *time.Timer {
+	if d >= time.Second {
+		return time.NewTimer(time.Hour)
+	}
+	return time.NewTimer(0)
+}
+
+// startKitchen runs the kitchen side on the handler's broker, the way main wires it: the same
+// store, audit trail and in-flight tracker as the order handler, with cooking on an instant clock.
+// 'connection' finds the customers' sockets (nil: everyone is offline).
+// The returned stop waits for the kitchen to finish; after it, what the sockets got can be read.
+func (th *testOrderHandler) startKitchen(t *testing.T, connection func(clientId string) service.IWebSocketConnection) (stop func()) {
+	t.Helper()
+	return th.startKitchenOn(t, instantClock{}, connection)
+}
+
+// startKitchenOn is startKitchen with cooking on 'clock'.
+func (th *testOrderHandler) startKitchenOn(t *testing.T, clock utils.IClock, connection func(clientId string) service.IWebSocketConnection) (stop func()) {
+	t.Helper()
+
+	utils.Clock = clock
+	processor := service.GetMessageProcessorService(th.handler.messagePublisher, connection, service.GetOrderStatusValidator(), th.store,
+		service.GetKitchenMetrics(), service.ProcessorOptions{EventLog: th.handler.eventLog, InFlight: th.handler.inFlight})
+	consumer := service.GetMemoryConsumer(th.broker)
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		consumer.ConsumeEventAndProcess(service.RegionQueueName(""), processor)
+	}()
+
+	var once sync.Once
+	stop = func() {
+		once.Do(func() {
+			consumer.StopConsuming(context.Background())
+			<-exited // Done with utils.Clock before it is put back
+			utils.Clock = utils.RealClock{}
+		})
+	}
+	t.Cleanup(stop)
+	return stop
+}
+
+func TestCancellingDuringTheCookStopsTheChef(t *testing.T) {
+	th := newTestOrderHandler(t)
+	var writes atomic.Int32
+	alice := &recordingConnection{onWrite: func() { writes.Add(1) }}
+	stop := th.startKitchenOn(t, slowCookClock{}, func(clientId string) service.IWebSocketConnection {
+		if clientId == "alice" {
+			return alice
+		}
+		return nil
+	})
+	t.Cleanup(func() { th.handler.inFlight.Leave("A1") }) // So a failed test doesn't wait out the hour
+
+	th.do(t, "POST", "/orders/create", "alice", margherita("A1"))
+	waitFor(t, func() bool { return th.handler.inFlight.Count() == 1 }) // On the stove, for an hour
+	if code, body := th.do(t, "POST", "/orders/A1/cancel", "alice", nil); code != 200 {
+		t.Fatalf("cancel: got %d %v", code, body)
+	}
+
+	// Accepted, then cancelled: the cancellation doesn't wait behind the cook.
+	waitFor(t, func() bool { return writes.Load() == 2 })
+	stop()
+	var last map[string]any
+	for _, frame := range alice.sent {
+		last = nil
+		json.Unmarshal(frame, &last)
+		if _, failed := last["error"]; failed {
+			t.Errorf("alice was told the order failed: %s", frame)
+		}
+	}
+	if last["message"] != constants.ORDER_CANCELLED {
+		t.Errorf("last update %v, want the cancellation", last)
+	}
+	if order, _ := th.store.Get("A1"); order.Status != constants.ORDER_STATUS_CANCELLED {
+		t.Errorf("status %q, want cancelled", order.Status)
+	}
+}
+
+func TestHistoryShowsTheWholeLifecycleInOrder(t *testing.T) {
+	th := newTestOrderHandler(t)
+	th.startKitchen(t, nil)
+
+	if code, body := th.do(t, "POST", "/orders/create", "alice", margherita("A1")); code != 200 {
+		t.Fatalf("create: got %d %v", code, body)
+	}
+	waitFor(t, func() bool {
+		order, _ := th.store.Get("A1")
+		return order.Status == constants.ORDER_DELIVERED
+	})
+
+	code, body := th.do(t, "GET", "/orders/A1/history", "alice", nil)
+	if code != 200 {
+		t.Fatalf("history: got %d %v", code, body)
+	}
+	want := []string{constants.ORDER_ORDERED, constants.ORDER_PREPARING, constants.ORDER_PREPARED, constants.ORDER_DELIVERED}
+	history := body["data"].([]any)
+	if len(history) != len(want) {
+		t.Fatalf("got %v, want %v", history, want)
+	}
+	for i, status := range want {
+		if got := history[i].(map[string]any)["order_status"]; got != status {
+			t.Errorf("event %d: got %v, want %s", i, got, status)
+		}
+	}
+	if code, _ := th.do(t, "GET", "/orders/A1/history", "mallory", nil); code != 403 {
+		t.Errorf("someone else's history: got %d, want 403", code)
+	}
+}
+
+func TestOversizedChunkedOrderIsA413(t *testing.T) {
+	th := newTestOrderHandler(t)
+	router := gin.New()
+	router.POST("/orders/create", middleware.BodyLimitMiddleware(64), func(ctx *gin.Context) {
+		ctx.Set(constants.CONTEXT_USER_ID, "alice")
+		th.handler.CreateOrder(ctx)
+	})
+
+	order := margherita("A1")
+	order["notes"] = strings.Repeat("extra cheese ", 10)
+	raw, _ := json.Marshal(order)
+	request := httptest.NewRequest("POST", "/orders/create", bytes.NewReader(raw))
+	request.Header.Set("Content-Type", "application/json")
+	request.ContentLength = -1 // Chunked: the handler only finds out while reading
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+
+	if recorder.Code != 413 {
+		t.Fatalf("got %d %s, want 413", recorder.Code, recorder.Body)
+	}
+	if _, ok := th.store.Get("A1"); ok {
+		t.Error("the oversized order was stored")
+	}
+}
+
+func TestFullKitchenQueueIsA503(t *testing.T) {
+	th := newTestOrderHandler(t)
+	th.handler.messagePublisher = service.GetMemoryPublisher(service.GetMemoryBroker(1)) // Room for one order
+
+	if code, body := th.do(t, "POST", "/orders/create", "alice", margherita("A1")); code != 200 {
+		t.Fatalf("first order: got %d %v", code, body)
+	}
+	code, body := th.do(t, "POST", "/orders/create", "alice", margherita("A2"))
+	if code != 503 || body["statusCode"] != 503.0 {
+		t.Fatalf("got %d %v, want a 503 envelope", code, body)
+	}
+	if order, _ := th.store.Get("A2"); order.Status != constants.ORDER_STATUS_CANCELLED {
+		t.Errorf("the rejected order is %q, want cancelled", order.Status)
+	}
+}
+
+func TestOrderIsPublishedToItsRegionsQueue(t *testing.T) {
+	th := newTestOrderHandler(t)
+	publisher := service.GetMemoryPublisher(th.broker)
+	th.handler.router = service.GetKitchenRouter([]string{"north"}, publisher)
+
+	north := margherita("A1")
+	north["region"] = "north"
+	elsewhere := margherita("A2")
+	elsewhere["region"] = "atlantis"
+	for _, order := range []map[string]any{north, elsewhere} {
+		if code, body := th.do(t, "POST", "/orders/create", "alice", order); code != 200 {
+			t.Fatalf("create %v: got %d %v", order["order_no"], code, body)
+		}
+	}
+
+	for queue, want := range map[string]int{service.RegionQueueName("north"): 1, constants.KITCHEN_ORDER_QUEUE: 1} {
+		if depth, _ := publisher.QueueDepth(queue); depth != want {
+			t.Errorf("%s holds %d order(s), want %d", queue, depth, want)
+		}
+	}
+}
+
+// slowPublisher is a kitchen queue that doesn't answer until the publish is given up on.
+type slowPublisher struct {
+	service.IMessagePubliser
+}
+
+func (slowPublisher) PublishEventWithOptions(options service.PublishOptions, body any) error {
+	select {
+	case <-options.Context.Done():
+		return options.Context.Err()
+	case <-time.After(15 * time.Second):
+		return nil
+	}
+}
+
+func TestSlowPublishIsCutOffWithA504(t *testing.T) {
+	th := newTestOrderHandler(t)
+	th.handler.messagePublisher = slowPublisher{th.handler.messagePublisher}
+	router := gin.New()
+	router.POST("/orders/create", middleware.TimeoutMiddleware(50*time.Millisecond), func(ctx *gin.Context) {
+		ctx.Set(constants.CONTEXT_USER_ID, "alice")
+		th.handler.CreateOrder(ctx)
+	})
+	th.router = router
+
+	start := time.Now()
+	code, body := th.do(t, "POST", "/orders/create", "", margherita("A1"))
+	if code != 504 || body["statusCode"] != 504.0 {
+		t.Fatalf("got %d %v, want a 504 envelope", code, body)
+	}
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("the request took %v, want it cut off at the 50ms timeout", took)
+	}
+	if order, _ := th.store.Get("A1"); order.Status != constants.ORDER_STATUS_CANCELLED {
+		t.Errorf("the timed-out order is %q, want cancelled", order.Status)
+	}
+}
+
+func TestResendPushesTheCurrentStatusToTheOrdersSockets(t *testing.T) {
+	th := newTestOrderHandler(t)
+	th.store.Save(service.Order{OrderNo: "A1", OwnerID: "alice", Status: constants.ORDER_PREPARED})
+	th.store.Save(service.Order{OrderNo: "B1", OwnerID: "bob", Status: constants.ORDER_PREPARING})
+	sockets := th.handler.sockets.(*WebSocketHandler)
+	alice := &recordingConnection{onWrite: func() {}}
+	bob := &recordingConnection{onWrite: func() {}}
+	sockets.addConnection("alice", alice)
+	sockets.addConnection("bob", bob)
+
+	code, body := th.do(t, "POST", "/orders/A1/resend", "alice", nil)
+	if code != 202 || body["data"].(map[string]any)["connections"] != 1.0 {
+		t.Fatalf("got %d %v, want 202 with one connection pushed", code, body)
+	}
+	if len(alice.sent) != 1 {
+		t.Fatalf("alice got %d frame(s), want 1", len(alice.sent))
+	}
+	var sync map[string]any
+	json.Unmarshal(alice.sent[0], &sync)
+	order, _ := sync["order"].(map[string]any)
+	if sync["message"] != constants.ORDER_STATUS_SYNC || order["order_no"] != "A1" || order["order_status"] != constants.ORDER_PREPARED {
+		t.Errorf("got %s, want A1's current status", alice.sent[0])
+	}
+	if len(bob.sent) != 0 {
+		t.Errorf("bob got %q for alice's order", bob.sent)
+	}
+
+	if code, _ := th.do(t, "POST", "/orders/NOPE/resend", "alice", nil); code != 404 {
+		t.Errorf("unknown order: got %d, want 404", code)
+	}
+}
+
+func TestOrderNotesReachTheReadyNotification(t *testing.T) {
+	th := newTestOrderHandler(t)
+	alice := &recordingConnection{onWrite: func() {}}
+	stop := th.startKitchen(t, func(clientId string) service.IWebSocketConnection {
+		if clientId == "alice" {
+			return alice
+		}
+		return nil
+	})
+
+	order := margherita("A1")
+	order["notes"] = "  extra crispy,\n\tno onions\x07 "
+	if code, body := th.do(t, "POST", "/orders/create", "alice", order); code != 200 {
+		t.Fatalf("create: got %d %v", code, body)
+	}
+	waitFor(t, func() bool {
+		order, _ := th.store.Get("A1")
+		return order.Status == constants.ORDER_DELIVERED
+	})
+	stop()
+
+	var ready map[string]any
+	for _, frame := range alice.sent {
+		var update map[string]any
+		if json.Unmarshal(frame, &update) == nil && update["message"] == constants.ORDER_PREPARED_SUCCESSFULLY {
+			ready = update
+		}
+	}
+	if ready == nil {
+		t.Fatalf("no ready notification among %q", alice.sent)
+	}
+	if ready["notes"] != "extra crispy, no onions" {
+		t.Errorf("ready notification notes: got %q, want the cleaned-up instructions", ready["notes"])
+	}
+}
+
+func TestOverlyLongNotesAreRejected(t *testing.T) {
+	withEnv(t, map[string]string{"MAX_ORDER_NOTES_LENGTH": "20"})
+	th := newTestOrderHandler(t)
+
+	order := margherita("A1")
+	order["notes"] = strings.Repeat("extra cheese ", 3)
+	code, body := th.do(t, "POST", "/orders/create", "alice", order)
+	if code != 400 || !strings.Contains(body["message"].(string), "limit is 20") {
+		t.Fatalf("got %d %v, want a 400 naming the limit", code, body)
+	}
+	if _, ok := th.store.Get("A1"); ok {
+		t.Error("the order was stored anyway")
+	}
+}
+
+func TestMalformedOrderListsTheOffendingFields(t *testing.T) {
+	th := newTestOrderHandler(t)
+
+	cases := []struct {
+		name  string
+		order map[string]any
+		want  map[string]string // field -> problem
+	}{
+		{
+			name:  "missing name and negative price",
+			order: map[string]any{"items": []map[string]any{{"price": -1, "quantity": 1}}},
+			want:  map[string]string{"items[0].name": "is required", "items[0].price": "must be at least 0"},
+		},
+		{
+			name:  "price as text",
+			order: map[string]any{"items": []map[string]any{{"name": "margherita", "price": "ten"}}},
+			want:  map[string]string{"items.0.price": "must be a number"},
+		},
+		{
+			name:  "fractional quantity",
+			order: map[string]any{"items": []map[string]any{{"name": "margherita", "price": 10, "quantity": 1.5}}},
+			want:  map[string]string{"items.0.quantity": "must be a whole number"},
+		},
+		{
+			name:  "notes as a number",
+			order: map[string]any{"items": []map[string]any{{"name": "margherita", "price": 10}}, "notes": 42},
+			want:  map[string]string{"notes": "must be text"},
+		},
+		{
+			name:  "tags as an object",
+			order: map[string]any{"items": []map[string]any{{"name": "margherita", "price": 10}}, "tags": map[string]any{"vip": true}},
+			want:  map[string]string{"tags": "must be a list"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			code, body := th.do(t, "POST", "/orders/create", "alice", c.order)
+			if code != 400 {
+				t.Fatalf("got %d %v, want a 400", code, body)
+			}
+			got := map[string]string{}
+			problems, _ := body["errors"].([]any)
+			for _, p := range problems {
+				problem := p.(map[string]any)
+				field, _ := problem["field"].(string)
+				got[field], _ = problem["problem"].(string)
+			}
+			if len(got) != len(c.want) {
+				t.Errorf("got problems %v, want %v", got, c.want)
+			}
+			for field, want := range c.want {
+				if got[field] != want {
+					t.Errorf("%s: got %q, want %q (all: %v)", field, got[field], want, got)
+				}
+			}
+
+			raw, _ := json.Marshal(body)
+			for _, internal := range []string{"orderRequest", "orderItemRequest", "float64", "int", "string"} {
+				if strings.Contains(string(raw), internal) {
+					t.Errorf("the 400 leaks the Go name %q: %s", internal, raw)
+				}
+			}
+		})
+	}
+}
+
+func TestValidationSpeaksJSONBeforeAnyRequest(t *testing.T) {
+	// Straight at gin's validator, no handler involved: the JSON names are set up at start-up.
+	err := binding.Validator.ValidateStruct(orderRequest{Items: []orderItemRequest{{Price: 10}}})
+	problems := bindingProblems(err)
+	if len(problems) != 1 || problems[0].Field != "items[0].name" {
+		t.Errorf("got %+v, want one problem on items[0].name", problems)
+	}
+}
+
+func TestBrokenJSONIsA400WithoutFields(t *testing.T) {
+	th := newTestOrderHandler(t)
+
+	request := httptest.NewRequest("POST", "/orders/create", strings.NewReader(`{"items": ]}`))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Authorization", "Bearer alice")
+	recorder := httptest.NewRecorder()
+	th.router.ServeHTTP(recorder, request)
+
+	var body map[string]any
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil || recorder.Code != 400 {
+		t.Fatalf("got %d %q, want a 400 envelope", recorder.Code, recorder.Body.String())
+	}
+	problems, _ := body["errors"].([]any)
+	if len(problems) != 1 {
+		t.Fatalf("got problems %v, want exactly one", problems)
+	}
+	problem := problems[0].(map[string]any)
+	if _, ok := problem["field"]; ok || !strings.HasPrefix(problem["problem"].(string), "malformed JSON") {
+		t.Errorf("got %v, want a malformed JSON problem without a field", problem)
+	}
+}
+
+// unroutablePublisher is a broker that returns every mandatory publish: no queue is bound.
+type unroutablePublisher struct {
+	service.IMessagePubliser
+}
+
+func (unroutablePublisher) PublishEventWithOptions(options service.PublishOptions, body any) error {
+	return fmt.Errorf("%w: routing key %q (312 NO_ROUTE)", service.ErrUnroutable, options.RoutingKey)
+}
+
+func TestUnroutableOrderIsReportedAndCancelled(t *testing.T) {
+	th := newTestOrderHandler(t)
+	th.handler.messagePublisher = unroutablePublisher{}
+
+	code, body := th.do(t, "POST", "/orders/create", "alice", margherita("A1"))
+	if code != 500 || !strings.Contains(body["message"].(string), "No kitchen is taking orders") {
+		t.Fatalf("got %d %v, want the unroutable order reported", code, body)
+	}
+	if order, _ := th.store.Get("A1"); order.Status != constants.ORDER_STATUS_CANCELLED {
+		t.Errorf("status: got %q, want cancelled", order.Status)
+	}
+}
+
+func TestUnknownTagRejectsTheOrder(t *testing.T) {
+	withEnv(t, map[string]string{"ORDER_TAGS": "delivery,promo"})
+	th := newTestOrderHandler(t)
+
+	order := margherita("A1")
+	order["tags"] = []string{"delivery", "vip"}
+	code, body := th.do(t, "POST", "/orders/create", "alice", order)
+	if code != 400 || !strings.Contains(body["message"].(string), `"vip"`) {
+		t.Fatalf("got %d %v, want a 400 naming the unknown tag", code, body)
+	}
+	if _, ok := th.store.Get("A1"); ok {
+		t.Error("the order was stored anyway")
+	}
+}
+
+func TestOrdersCanBeFilteredByTag(t *testing.T) {
+	th := newTestOrderHandler(t)
+	for orderNo, tags := range map[string][]string{"A1": {"delivery"}, "A2": {"dine-in"}, "A3": {"Delivery", "promo"}, "A4": nil} {
+		order := margherita(orderNo)
+		if tags != nil {
+			order["tags"] = tags
+		}
+		if code, body := th.do(t, "POST", "/orders/create", "alice", order); code != 200 {
+			t.Fatalf("create %s: %d %v", orderNo, code, body)
+		}
+	}
+	if code, body := th.do(t, "POST", "/orders/create", "bob", map[string]any{
+		"order_no": "B1", "items": margherita("")["items"], "tags": []string{"delivery"},
+	}); code != 200 {
+		t.Fatalf("create B1: %d %v", code, body)
+	}
+
+	code, body := th.do(t, "GET", "/orders?tag=delivery", "alice", nil)
+	if code != 200 {
+		t.Fatalf("got %d %v", code, body)
+	}
+	got := map[string]bool{}
+	for _, order := range body["data"].([]any) {
+		got[order.(map[string]any)["order_no"].(string)] = true
+	}
+	if len(got) != 2 || !got["A1"] || !got["A3"] {
+		t.Errorf("got %v, want alice's delivery orders A1 and A3", got)
+	}
+
+	if _, body := th.do(t, "GET", "/orders", "alice", nil); len(body["data"].([]any)) != 4 {
+		t.Errorf("unfiltered: got %d order(s), want all 4 of alice's", len(body["data"].([]any)))
+	}
+}
+
+func TestOrderItemCap(t *testing.T) {
+	withEnv(t, map[string]string{"MAX_ORDER_ITEMS": "3"})
+	th := newTestOrderHandler(t)
+
+	order := func(orderNo string, items int) map[string]any {
+		lines := make([]map[string]any, items)
+		for i := range lines {
+			lines[i] = map[string]any{"name": "margherita", "price": 10, "quantity": 1}
+		}
+		return map[string]any{"order_no": orderNo, "items": lines}
+	}
+
+	if code, body := th.do(t, "POST", "/orders/create", "alice", order("A1", 3)); code != 200 {
+		t.Errorf("at the cap: got %d %v, want 200", code, body)
+	}
+	code, body := th.do(t, "POST", "/orders/create", "alice", order("A2", 4))
+	if code != 422 || !strings.Contains(body["message"].(string), "at most 3 items, this one has 4") {
+		t.Errorf("over the cap: got %d %v, want a 422 naming the limit", code, body)
+	}
+	if _, ok := th.store.Get("A2"); ok {
+		t.Error("the order over the cap was stored")
+	}
+}
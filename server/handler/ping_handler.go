@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"time"
+
+	"github.com/everestp/pizza-shop/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// PingHandler serves GET /ping: a cheap liveness check that never touches the broker.
+// Besides "I'm alive" it tells monitoring which build is running and for how long.
+type PingHandler struct {
+	started time.Time // When the server started
+	version string    // APP_VERSION, e.g. a git tag (default "dev")
+}
+
+// Ping reports uptime, version and the server's current time.
+func (ph *PingHandler) Ping(ctx *gin.Context) {
+	now := utils.Clock.Now()
+	ctx.JSON(200, gin.H{
+		"message":        "Pizza Shop is open",
+		"version":        ph.version,
+		"started_at":     ph.started.UTC().Format(time.RFC3339),
+		"time":           now.UTC().Format(time.RFC3339Nano),
+		"uptime_seconds": now.Sub(ph.started).Seconds(),
+		"statusCode":     200,
+	})
+}
+
+// GetPingHandler is the Constructor.
+func GetPingHandler(started time.Time, version string) *PingHandler {
+	return &PingHandler{
+		started: started,
+		version: version,
+	}
+}
@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/everestp/pizza-shop/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// steppingClock moves forward by 'step' every time it is read.
+type steppingClock struct {
+	utils.RealClock
+	now  time.Time
+	step time.Duration
+}
+
+func (sc *steppingClock) Now() time.Time {
+	sc.now = sc.now.Add(sc.step)
+	return sc.now
+}
+
+func TestPingReportsUptimeAndVersion(t *testing.T) {
+	started := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	utils.Clock = &steppingClock{now: started, step: 1500 * time.Millisecond}
+	t.Cleanup(func() { utils.Clock = utils.RealClock{} })
+
+	router := gin.New()
+	router.GET("/ping", GetPingHandler(started, "v1.4.2").Ping)
+	ping := func() map[string]any {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest("GET", "/ping", nil))
+		var body map[string]any
+		if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil || recorder.Code != 200 {
+			t.Fatalf("got %d %s", recorder.Code, recorder.Body)
+		}
+		return body
+	}
+
+	first, second := ping(), ping()
+	if first["uptime_seconds"] != 1.5 || second["uptime_seconds"] != 3.0 {
+		t.Errorf("uptime: got %v then %v, want 1.5 then 3", first["uptime_seconds"], second["uptime_seconds"])
+	}
+	if second["time"] != "2026-01-01T12:00:03Z" || second["started_at"] != "2026-01-01T12:00:00Z" {
+		t.Errorf("got time %v, started_at %v", second["time"], second["started_at"])
+	}
+	if first["version"] != "v1.4.2" {
+		t.Errorf("version: got %v, want v1.4.2", first["version"])
+	}
+}
@@ -0,0 +1,273 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/everestp/pizza-shop/logger"
+	"github.com/everestp/pizza-shop/service"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// KitchenStats is one frame pushed to the ops dashboard.
+type KitchenStats struct {
+	OrdersPerMinute   int   `json:"orders_per_minute"`
+	QueueDepth        int   `json:"queue_depth"`
+	AverageCookTimeMs int64 `json:"average_cook_time_ms"`
+	AverageReadyMs    int64 `json:"average_time_to_ready_ms"`
+	ActiveConnections int   `json:"active_connections"`
+	// The front of the pending queue (at most statsQueueLength), by priority then arrival.
+	PendingOrders []service.QueuedOrder `json:"pending_orders"`
+	Timestamp     time.Time             `json:"timestamp"`
+}
+
+// statsQueueLength is how much of the pending queue each stats frame carries.
+const statsQueueLength = 20
+
+// ActivityEvent is one order event on a dashboard's activity feed.
+// Replay is true for the backlog sent right after (re)connecting.
+type ActivityEvent struct {
+	Type   string             `json:"type"` // Always "order_event"
+	Replay bool               `json:"replay"`
+	Event  service.OrderEvent `json:"event"`
+}
+
+// ReplayDone marks the end of the backlog; everything after it is live.
+type ReplayDone struct {
+	Type  string `json:"type"` // Always "replay_done"
+	Count int    `json:"count"`
+}
+
+// activityFeed tracks one dashboard that asked for order events.
+// While its backlog is being sent, live events are parked in 'pending'.
+type activityFeed struct {
+	live    bool
+	pending []service.OrderEvent
+}
+
+// StatsHandler streams live kitchen metrics to every connected dashboard.
+// Unlike the customer socket, every client here receives the SAME broadcast.
+// The pending queue and the activity feed show every customer's orders, so the
+// route is admin-only (see routes.RegisterRoutes).
+type StatsHandler struct {
+	upgrader          websocket.Upgrader
+	clients           *clientGroup // Every dashboard currently watching
+	metrics           *service.KitchenMetrics
+	queueDepth        func() (int, error)    // How many orders are waiting in the kitchen queue
+	activeConnections func() int             // How many customers are online
+	pendingOrders     func() []service.Order // Orders waiting for a chef, already in kitchen order
+	interval          time.Duration          // How often we push a frame
+	eventLog          service.IEventLog
+	replayWindow      time.Duration         // The furthest back a dashboard may replay
+	replayLimit       int                   // The most events one replay (or one backlog of live events) holds
+	feeds             map[int]*activityFeed // Dashboard ID -> its activity feed (absent = stats only)
+	mutex             sync.Mutex            // Guards 'feeds'
+}
+
+// HandleConnection upgrades a dashboard and keeps it registered until it disconnects.
+func (sh *StatsHandler) HandleConnection(ctx *gin.Context) {
+	conn, err := upgradeConnection(&sh.upgrader, ctx)
+	if err != nil {
+		logger.Log(fmt.Sprintf("CRITICAL: Failed to upgrade stats connection: %v", err))
+		return
+	}
+	defer conn.Close()
+
+	client := service.NewWebSocketConnection(ctx.Request.Context(), conn, connectionMetadata(ctx))
+	// ?frames=binary: every frame goes out as a binary message (e.g. for a msgpack-aware dashboard).
+	if ctx.Query("frames") == "binary" {
+		client.SetBinary(true)
+	}
+	id := sh.clients.add(client)
+	defer sh.clients.remove(id)
+
+	// ?replay_minutes=N also subscribes to order events, starting with the last N minutes.
+	if raw, requested := ctx.GetQuery("replay_minutes"); requested {
+		minutes, err := strconv.Atoi(raw)
+		if err != nil || minutes < 0 {
+			minutes = 0
+		}
+		defer sh.dropFeed(id)
+		sh.replay(id, client, time.Duration(minutes)*time.Minute)
+	}
+
+	// Dashboards only listen; reading just tells us when they leave.
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			logger.Log(fmt.Sprintf("Stats dashboard [%d] %s", id, describeReadError(err)))
+			return
+		}
+	}
+}
+
+// Start pushes a stats frame to every dashboard on each tick until ctx is cancelled.
+func (sh *StatsHandler) Start(ctx context.Context) {
+	ticker := time.NewTicker(sh.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			sh.broadcast(sh.collect())
+		}
+	}
+}
+
+// collect builds a fresh snapshot from the metrics counters.
+func (sh *StatsHandler) collect() KitchenStats {
+	depth, err := sh.queueDepth()
+	if err != nil {
+		logger.Log(fmt.Sprintf("Failed to read queue depth: %v", err))
+	}
+
+	return KitchenStats{
+		OrdersPerMinute:   sh.metrics.OrdersPerMinute(),
+		QueueDepth:        depth,
+		AverageCookTimeMs: sh.metrics.AverageCookTime().Milliseconds(),
+		AverageReadyMs:    sh.metrics.AverageTimeToReady().Milliseconds(),
+		ActiveConnections: sh.activeConnections(),
+		PendingOrders:     service.QueueOf(sh.pendingOrders(), statsQueueLength),
+		Timestamp:         time.Now(),
+	}
+}
+
+// broadcast sends one frame to all dashboards.
+func (sh *StatsHandler) broadcast(stats KitchenStats) {
+	bytes, err := service.MarshalWebSocketMessage(stats)
+	if err != nil {
+		logger.Log(fmt.Sprintf("Failed to encode stats: %v", err))
+		return
+	}
+	sh.clients.broadcast(bytes)
+}
+
+// replay sends a dashboard the events of the last 'window' (capped at replayWindow),
+// then whatever arrived meanwhile, and only then switches it to live events.
+// Events seen in the backlog are not sent twice.
+func (sh *StatsHandler) replay(id int, client service.IWebSocketConnection, window time.Duration) {
+	if window > sh.replayWindow {
+		window = sh.replayWindow
+	}
+
+	// 1. Park live events from now on, so nothing falls between the backlog and the live feed
+	sh.mutex.Lock()
+	sh.feeds[id] = &activityFeed{}
+	sh.mutex.Unlock()
+
+	// 2. Send the backlog
+	events := []service.OrderEvent{}
+	if window > 0 {
+		var err error
+		events, err = sh.eventLog.Since(time.Now().Add(-window), sh.replayLimit)
+		if err != nil {
+			logger.Log(fmt.Sprintf("Failed to read the event log for stats dashboard [%d]: %v", id, err))
+		}
+	}
+
+	sent := make(map[string]bool, len(events))
+	for _, event := range events {
+		sent[eventKey(event)] = true
+		sh.send(client, ActivityEvent{Type: "order_event", Replay: true, Event: event})
+	}
+	sh.send(client, ReplayDone{Type: "replay_done", Count: len(events)})
+
+	// 3. Drain what was parked meanwhile; go live once nothing is left
+	for {
+		sh.mutex.Lock()
+		feed := sh.feeds[id]
+		pending := feed.pending
+		feed.pending = nil
+		if len(pending) == 0 {
+			feed.live = true
+			sh.mutex.Unlock()
+			break
+		}
+		sh.mutex.Unlock()
+
+		for _, event := range pending {
+			if !sent[eventKey(event)] {
+				sh.send(client, ActivityEvent{Type: "order_event", Event: event})
+			}
+		}
+	}
+	logger.Log(fmt.Sprintf("Replayed %d events to stats dashboard [%d]", len(events), id))
+}
+
+// NotifyEvent pushes a new order event to the live feeds and parks it for the ones still replaying.
+// Subscribed to the event log in main.go.
+func (sh *StatsHandler) NotifyEvent(event service.OrderEvent) {
+	live := map[int]bool{}
+	sh.mutex.Lock()
+	for id, feed := range sh.feeds {
+		if feed.live {
+			live[id] = true
+		} else if len(feed.pending) < sh.replayLimit {
+			feed.pending = append(feed.pending, event)
+		}
+	}
+	sh.mutex.Unlock()
+
+	if len(live) == 0 {
+		return
+	}
+	bytes, err := service.MarshalWebSocketMessage(ActivityEvent{Type: "order_event", Event: event})
+	if err != nil {
+		logger.Log(fmt.Sprintf("Failed to encode order event: %v", err))
+		return
+	}
+	sh.clients.broadcastWhere(bytes, func(id int) bool { return live[id] })
+}
+
+// dropFeed forgets a dashboard's activity feed once it leaves.
+func (sh *StatsHandler) dropFeed(id int) {
+	sh.mutex.Lock()
+	defer sh.mutex.Unlock()
+
+	delete(sh.feeds, id)
+}
+
+// send writes one frame to a single dashboard.
+func (sh *StatsHandler) send(client service.IWebSocketConnection, frame any) {
+	bytes, err := service.MarshalWebSocketMessage(frame)
+	if err != nil {
+		logger.Log(fmt.Sprintf("Failed to encode dashboard frame: %v", err))
+		return
+	}
+	if err := client.SendMessage(bytes); err != nil {
+		logger.Log(fmt.Sprintf("Failed to push to stats dashboard: %v", err))
+	}
+}
+
+// eventKey identifies an event for de-duplication between the backlog and the live feed.
+func eventKey(event service.OrderEvent) string {
+	return fmt.Sprintf("%s|%s|%d", event.OrderNo, event.Status, event.Timestamp.UnixNano())
+}
+
+// CloseAll says goodbye to every dashboard (used during shutdown).
+func (sh *StatsHandler) CloseAll() {
+	sh.clients.closeAll()
+}
+
+// GetStatsHandler is the Constructor.
+func GetStatsHandler(metrics *service.KitchenMetrics, queueDepth func() (int, error), activeConnections func() int, pendingOrders func() []service.Order, interval time.Duration,
+	eventLog service.IEventLog, replayWindow time.Duration, replayLimit int) *StatsHandler {
+	return &StatsHandler{
+		clients:           newClientGroup("stats dashboard"),
+		metrics:           metrics,
+		queueDepth:        queueDepth,
+		activeConnections: activeConnections,
+		pendingOrders:     pendingOrders,
+		interval:          interval,
+		eventLog:          eventLog,
+		replayWindow:      replayWindow,
+		replayLimit:       replayLimit,
+		feeds:             make(map[int]*activityFeed),
+		upgrader:          newUpgrader(),
+	}
+}
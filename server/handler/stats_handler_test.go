@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/everestp/pizza-shop/service"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// dialTestSocket serves 'handle' at /socket and connects to it with the given query.
+// The server and the client are closed when the test ends.
+func dialTestSocket(t *testing.T, handle gin.HandlerFunc, query string) *websocket.Conn {
+	t.Helper()
+
+	router := gin.New()
+	router.GET("/socket", handle)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/socket" + query
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial %s: %v", url, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// readFrame reads one JSON frame into a map, failing the test after a second of silence.
+func readFrame(t *testing.T, conn *websocket.Conn) map[string]any {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, message, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("read frame: %v", err)
+	}
+	var frame map[string]any
+	if err := json.Unmarshal(message, &frame); err != nil {
+		t.Fatalf("frame is not JSON: %q", message)
+	}
+	return frame
+}
+
+// expectSilence fails the test if a frame arrives within 'wait'.
+func expectSilence(t *testing.T, conn *websocket.Conn, wait time.Duration) {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(wait))
+	if _, message, err := conn.ReadMessage(); err == nil {
+		t.Fatalf("unexpected frame: %s", message)
+	}
+}
+
+func newTestStatsHandler(eventLog service.IEventLog, interval time.Duration) *StatsHandler {
+	store := service.GetOrderStore()
+	return GetStatsHandler(service.GetKitchenMetrics(),
+		func() (int, error) { return 3, nil },
+		func() int { return 2 },
+		store.Pending,
+		interval, eventLog, time.Hour, 100)
+}
+
+func TestReplayIsChronologicalThenLiveWithoutDuplicates(t *testing.T) {
+	eventLog := service.GetNotifyingEventLog(service.GetEventLog("", 100))
+	sh := newTestStatsHandler(eventLog, time.Hour)
+	eventLog.Subscribe(sh.NotifyEvent)
+
+	now := time.Now()
+	eventLog.Append(service.OrderEvent{OrderNo: "A1", Status: "ordered", Timestamp: now.Add(-3 * time.Minute)})
+	eventLog.Append(service.OrderEvent{OrderNo: "A1", Status: "preparing", Timestamp: now.Add(-2 * time.Minute)})
+	eventLog.Append(service.OrderEvent{OrderNo: "OLD", Status: "ordered", Timestamp: now.Add(-30 * time.Minute)})
+
+	conn := dialTestSocket(t, sh.HandleConnection, "?replay_minutes=5")
+
+	for _, want := range []string{"ordered", "preparing"} {
+		frame := readFrame(t, conn)
+		event := frame["event"].(map[string]any)
+		if frame["type"] != "order_event" || frame["replay"] != true || event["order_status"] != want || event["order_no"] != "A1" {
+			t.Fatalf("replay: got %v, want A1 %s", frame, want)
+		}
+	}
+	if frame := readFrame(t, conn); frame["type"] != "replay_done" || frame["count"] != float64(2) {
+		t.Fatalf("got %v, want replay_done with 2 events", frame)
+	}
+
+	eventLog.Append(service.OrderEvent{OrderNo: "A1", Status: "prepared", Timestamp: time.Now()})
+	frame := readFrame(t, conn)
+	if frame["replay"] != false || frame["event"].(map[string]any)["order_status"] != "prepared" {
+		t.Fatalf("live: got %v", frame)
+	}
+	expectSilence(t, conn, 50*time.Millisecond)
+}
+
+func TestStatsClientReceivesPeriodicFrames(t *testing.T) {
+	sh := newTestStatsHandler(service.GetEventLog("", 10), 20*time.Millisecond)
+	conn := dialTestSocket(t, sh.HandleConnection, "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go sh.Start(ctx)
+
+	for i := 0; i < 2; i++ {
+		frame := readFrame(t, conn)
+		for _, field := range []string{"orders_per_minute", "queue_depth", "average_cook_time_ms", "active_connections", "pending_orders", "timestamp"} {
+			if _, ok := frame[field]; !ok {
+				t.Errorf("frame %d has no %q: %v", i, field, frame)
+			}
+		}
+		if frame["queue_depth"] != float64(3) || frame["active_connections"] != float64(2) {
+			t.Errorf("frame %d: got %v", i, frame)
+		}
+	}
+}
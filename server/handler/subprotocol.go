@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/everestp/pizza-shop/config"
+	"github.com/everestp/pizza-shop/constants"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// Subprotocols version our WebSocket messages: a client asks for one in the handshake
+// (Sec-WebSocket-Protocol: pizza.v1) and the server echoes the one it picked.
+// WS_SUBPROTOCOLS lists the ones we speak (default "pizza.v1").
+// WS_SUBPROTOCOL_POLICY decides what happens when a client offers none of them:
+//   - "allow" (default): it connects anyway, with no subprotocol selected.
+//   - "reject": the upgrade is refused with a 400.
+//
+// Clients that offer no subprotocol at all always connect, as they did before.
+
+// ErrUnsupportedSubprotocol means the client only offered subprotocols we don't speak.
+var ErrUnsupportedSubprotocol = errors.New("unsupported websocket subprotocol")
+
+// supportedSubprotocols reads WS_SUBPROTOCOLS, e.g. "pizza.v2,pizza.v1".
+func supportedSubprotocols() []string {
+	raw := config.GetEnvProperty("ws_subprotocols")
+	if raw == "" {
+		raw = constants.DEFAULT_WS_SUBPROTOCOLS
+	}
+
+	protocols := []string{}
+	for _, protocol := range strings.Split(raw, ",") {
+		if protocol = strings.TrimSpace(protocol); protocol != "" {
+			protocols = append(protocols, protocol)
+		}
+	}
+	return protocols
+}
+
+// newUpgrader is the upgrader every socket endpoint shares.
+func newUpgrader() websocket.Upgrader {
+	return websocket.Upgrader{
+		// CheckOrigin: true allows any website to connect to your socket.
+		// In production, you would restrict this to your specific domain.
+		CheckOrigin:  func(r *http.Request) bool { return true },
+		Subprotocols: supportedSubprotocols(),
+	}
+}
+
+// upgradeConnection applies WS_SUBPROTOCOL_POLICY, then upgrades.
+// A rejected client gets a normal HTTP 400, which is why this runs BEFORE the upgrade.
+func upgradeConnection(upgrader *websocket.Upgrader, ctx *gin.Context) (*websocket.Conn, error) {
+	offered := websocket.Subprotocols(ctx.Request)
+	if len(offered) > 0 && config.GetEnvProperty("ws_subprotocol_policy") == "reject" && !speaksAny(upgrader.Subprotocols, offered) {
+		ctx.JSON(400, gin.H{
+			"message":    fmt.Sprintf("Unsupported WebSocket subprotocol, supported: %s", strings.Join(upgrader.Subprotocols, ", ")),
+			"statusCode": 400,
+		})
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedSubprotocol, strings.Join(offered, ", "))
+	}
+	return upgrader.Upgrade(ctx.Writer, ctx.Request, nil)
+}
+
+// speaksAny reports whether any offered subprotocol is supported.
+func speaksAny(supported, offered []string) bool {
+	for _, protocol := range offered {
+		for _, candidate := range supported {
+			if protocol == candidate {
+				return true
+			}
+		}
+	}
+	return false
+}
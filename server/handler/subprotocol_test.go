@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+func TestSubprotocolNegotiation(t *testing.T) {
+	cases := []struct {
+		name      string
+		supported string // WS_SUBPROTOCOLS
+		policy    string // WS_SUBPROTOCOL_POLICY
+		offered   []string
+		want      string // The selected subprotocol
+		wantCode  int
+	}{
+		{name: "supported", offered: []string{"pizza.v1"}, want: "pizza.v1", wantCode: http.StatusSwitchingProtocols},
+		{name: "our first choice", supported: "pizza.v2,pizza.v1", offered: []string{"pizza.v3", "pizza.v1", "pizza.v2"}, want: "pizza.v2", wantCode: http.StatusSwitchingProtocols},
+		{name: "unsupported, allowed", offered: []string{"pizza.v9"}, want: "", wantCode: http.StatusSwitchingProtocols},
+		{name: "unsupported, rejected", policy: "reject", offered: []string{"pizza.v9"}, wantCode: http.StatusBadRequest},
+		{name: "none offered, rejecting policy", policy: "reject", want: "", wantCode: http.StatusSwitchingProtocols},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			withEnv(t, map[string]string{"WS_SUBPROTOCOLS": tc.supported, "WS_SUBPROTOCOL_POLICY": tc.policy})
+			ah := GetAlertsHandler()
+			router := gin.New()
+			router.GET("/socket", ah.HandleConnection)
+			server := httptest.NewServer(router)
+			t.Cleanup(server.Close)
+
+			dialer := websocket.Dialer{Subprotocols: tc.offered}
+			conn, response, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/socket", nil)
+			if response == nil {
+				t.Fatalf("dial: %v", err)
+			}
+			if response.StatusCode != tc.wantCode {
+				t.Fatalf("got %d (%v), want %d", response.StatusCode, err, tc.wantCode)
+			}
+			if conn == nil {
+				return
+			}
+			// The handler reads the config after the upgrade; it must be done before the cleanup reloads it.
+			consoles := func() int {
+				ah.clients.mutex.Lock()
+				defer ah.clients.mutex.Unlock()
+				return len(ah.clients.clients)
+			}
+			t.Cleanup(func() {
+				waitFor(t, func() bool { return consoles() == 1 })
+				conn.Close()
+				waitFor(t, func() bool { return consoles() == 0 })
+			})
+			if got := conn.Subprotocol(); got != tc.want {
+				t.Errorf("selected %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
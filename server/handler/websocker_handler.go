@@ -1,10 +1,16 @@
 package handler
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"net/http"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/everestp/pizza-shop/config"
+	"github.com/everestp/pizza-shop/constants"
 	"github.com/everestp/pizza-shop/logger"
 	"github.com/everestp/pizza-shop/service"
 	"github.com/gin-gonic/gin"
@@ -14,7 +20,22 @@ import (
 // IWebSocketHandler is the contract for managing WebSocket traffic.
 type IWebSocketHandler interface {
 	HandleConnection(ctx *gin.Context)
-	GetConnectionMap() *map[string]service.IWebSocketConnection
+	HandleOrderConnection(ctx *gin.Context)
+	GetOrderWatchers(orderNo string) []service.IWebSocketConnection
+	GetConnection(clientId string) service.IWebSocketConnection
+	BroadcastAll(message []byte) int
+	CloseAll()
+	ConnectionCount() int
+	ListConnections() []ConnectionInfo
+	Disconnect(clientId string) bool
+	Notify(clientId string, message []byte) (bool, error)
+	ResendStatus(order service.Order) int
+}
+
+// ConnectionInfo describes one connected customer for the admin API.
+type ConnectionInfo struct {
+	ID string `json:"id"`
+	service.ConnectionMetadata
 }
 
 // WebSocketHandler manages the lifecycle of browser-to-server connections.
@@ -22,12 +43,41 @@ type WebSocketHandler struct {
 	upgrader   websocket.Upgrader                        // Tools to turn HTTP into WebSocket
 	connection *map[string]service.IWebSocketConnection // The "Address Book" of online users
 	mutex      sync.Mutex                                // The "Lock" to prevent map crashes
+	store      service.IOrderStore                       // Used to check who owns an order
+	pending    *service.PendingNotificationStore         // Messages missed while the user was offline
+	// subscriptions holds the orders each connected user chose to follow (see IsFollowing).
+	// It lasts as long as the socket: a user who drops and reconnects starts over, and
+	// gets the old choice back with one "resubscribe" message.
+	subscriptions map[string]map[string]bool
+	// orderWatchers holds the sockets opened on /ws/orders/:orderNo, which follow
+	// exactly one order (and nothing else the user owns).
+	orderWatchers map[string]map[service.IWebSocketConnection]bool
+	// shutdownCtx is cancelled by CloseAll. It is the parent of every connection's
+	// context, so each read loop exits promptly even when its client never sends another byte.
+	shutdownCtx context.Context
+	shutdown    context.CancelFunc
 }
 
 // HandleConnection is the main endpoint (e.g., /ws). It runs every time a user connects.
+// Callers may pass "?order_no=" to follow one order; they must own it.
 func (h *WebSocketHandler) HandleConnection(ctx *gin.Context) {
-	// 1. Upgrade: Change the connection from HTTP to WebSocket protocol.
-	conn, err := h.upgrader.Upgrade(ctx.Writer, ctx.Request, nil)
+	userId := ctx.GetString(constants.CONTEXT_USER_ID)
+
+	// 0. Ownership: Refuse BEFORE upgrading, while we can still send a normal HTTP 403.
+	if orderNo := ctx.Query("order_no"); orderNo != "" {
+		order, ok := h.store.Get(orderNo)
+		if !ok || order.OwnerID != userId {
+			ctx.JSON(403, gin.H{
+				"message":    "You are not allowed to follow this order",
+				"statusCode": 403,
+			})
+			return
+		}
+	}
+
+	// 1. Upgrade: Change the connection from HTTP to WebSocket protocol
+	// (agreeing on a subprotocol, e.g. "pizza.v1", if the client asks for one).
+	conn, err := upgradeConnection(&h.upgrader, ctx)
 	if err != nil {
 		logger.Log(fmt.Sprintf("CRITICAL: Failed to upgrade connection: %v", err))
 		return
@@ -35,55 +85,495 @@ func (h *WebSocketHandler) HandleConnection(ctx *gin.Context) {
 	// 2. Ensure the connection closes when this function finishes.
 	defer conn.Close()
 
-	// 3. Welcome Message: Send an initial message to the client.
-	conn.WriteMessage(websocket.TextMessage, []byte("Connection Established: Started taking order updates..."))
+	// 3. Wrap & Store: Wrap the raw connection in our Service and add it to our Map.
+	connection := newCustomerConnection(h.shutdownCtx, conn, connectionMetadata(ctx))
+	// Closing the connection cancels its context, which stops every goroutine working for it.
+	defer connection.Close()
 
-	// 4. Wrap & Store: Wrap the raw connection in our Service and add it to our Map.
-	connection := service.NewWebSocketConnection(conn)
+	// 4. Welcome Message: Send an initial message to the client (unless WS_WELCOME_MODE=off).
+	// It goes through the connection like every other frame, so it gets the same framing.
+	if frame, ok := welcomeFrame(); ok {
+		connection.SendMessage(frame)
+	}
 	
-	// We use "pizza" as a hardcoded ID for now. 
-	// In a real app, you'd get the UserID from a Token or URL.
-	h.addConnection("pizza", connection)
+	// The user ID comes from the token checked by the auth middleware,
+	// so each customer only receives updates for their own orders.
+	h.addConnection(userId, connection)
+	// Forget the connection when the user leaves, so new updates are kept for them instead.
+	defer h.removeConnection(userId, connection)
+	if orderNo := ctx.Query("order_no"); orderNo != "" {
+		h.subscribe(userId, orderNo)
+	}
 
 	// 5. Keep Alive: This loop keeps the connection open.
 	// Without this loop, the function would end and the connection would close.
+	// ReadMessage blocks, so it runs in its own goroutine and we wait on
+	// EITHER the next message OR the connection's context ending (closed, or server shutting down).
+	reads, readErr := readLoop(connection.Context(), conn)
+	for {
+		select {
+		case data := <-reads:
+			h.handleClientMessage(userId, connection, data)
+		case err := <-readErr:
+			logger.Log(fmt.Sprintf("Customer [%s] %s", userId, describeReadError(err)))
+			return // Triggers the defer conn.Close()
+		case <-connection.Context().Done():
+			logger.Log(fmt.Sprintf("Connection context ended, releasing connection for [%s]", userId))
+			return
+		}
+	}
+}
+
+// HandleOrderConnection serves /ws/orders/:orderNo, a socket for a single order's tracking page.
+// It follows just that order: the current status is sent right away, then every update.
+func (h *WebSocketHandler) HandleOrderConnection(ctx *gin.Context) {
+	userId := ctx.GetString(constants.CONTEXT_USER_ID)
+	orderNo := ctx.Param("orderNo")
+
+	// Ownership: Refuse BEFORE upgrading, while we can still send a normal HTTP 403.
+	order, ok := h.store.Get(orderNo)
+	if !ok || order.OwnerID != userId {
+		ctx.JSON(403, gin.H{
+			"message":    "You are not allowed to follow this order",
+			"statusCode": 403,
+		})
+		return
+	}
+
+	conn, err := upgradeConnection(&h.upgrader, ctx)
+	if err != nil {
+		logger.Log(fmt.Sprintf("CRITICAL: Failed to upgrade connection: %v", err))
+		return
+	}
+	defer conn.Close()
+
+	connection := newCustomerConnection(h.shutdownCtx, conn, connectionMetadata(ctx))
+	defer connection.Close()
+	h.addOrderWatcher(orderNo, connection)
+	defer h.removeOrderWatcher(orderNo, connection)
+	h.sendCurrentStatus(connection, order)
+
+	// Tracking pages only listen; reading just tells us when they leave.
+	reads, readErr := readLoop(connection.Context(), conn)
 	for {
-		// We read messages here if we expect the client to talk back.
-		_, _, err := conn.ReadMessage()
+		select {
+		case <-reads:
+		case err := <-readErr:
+			logger.Log(fmt.Sprintf("Tracking page for order #%s %s", orderNo, describeReadError(err)))
+			return
+		case <-connection.Context().Done():
+			return
+		}
+	}
+}
+
+// newCustomerConnection wraps a customer socket.
+// Customer sockets get a small send queue so a brief stall doesn't lose updates,
+// and, with WS_DELIVERY_RECEIPTS=true, receipts for the updates that matter most.
+func newCustomerConnection(parent context.Context, conn *websocket.Conn, metadata service.ConnectionMetadata) service.IWebSocketConnection {
+	buffered := service.NewBufferedConnection(service.NewWebSocketConnection(parent, conn, metadata),
+		time.Duration(config.GetEnvPropertyAsInt("ws_send_retry_window", 2000))*time.Millisecond,
+		config.GetEnvPropertyAsInt("ws_send_queue_size", 32))
+	if !config.GetEnvPropertyAsBool("ws_delivery_receipts", false) {
+		return buffered
+	}
+	return service.NewReceiptConnection(buffered,
+		time.Duration(config.GetEnvPropertyAsInt("ws_receipt_window", 5000))*time.Millisecond,
+		config.GetEnvPropertyAsInt("ws_receipt_max_pending", 32))
+}
+
+// welcomeFrame builds the greeting sent right after the upgrade, per WS_WELCOME_MODE:
+//   - "text" (default): WS_WELCOME_MESSAGE as plain text
+//   - "json": {"type": "welcome", "message": ...}, for clients that only speak JSON
+//   - "off": nothing is sent (same as FEATURE_WELCOME_MESSAGE=false)
+func welcomeFrame() ([]byte, bool) {
+	if !config.GetFlags().WelcomeMessage {
+		return nil, false
+	}
+
+	message := config.GetEnvProperty("ws_welcome_message")
+	if message == "" {
+		message = constants.WS_WELCOME_MESSAGE
+	}
+
+	switch strings.ToLower(config.GetEnvProperty("ws_welcome_mode")) {
+	case "off":
+		return nil, false
+	case "json":
+		frame, err := service.MarshalWebSocketMessage(map[string]any{
+			"type":    "welcome",
+			"message": message,
+		})
 		if err != nil {
-			logger.Log("Client disconnected or error occurred")
-			break // Exit the loop to trigger the defer conn.Close()
+			logger.Log(fmt.Sprintf("Failed to encode welcome message: %v", err))
+			return nil, false
+		}
+		return frame, true
+	default:
+		return []byte(message), true
+	}
+}
+
+// connectionMetadata captures who opened the socket, from the upgrade request.
+func connectionMetadata(ctx *gin.Context) service.ConnectionMetadata {
+	return service.ConnectionMetadata{
+		ConnectedAt: time.Now(),
+		RemoteAddr:  ctx.ClientIP(),
+		UserAgent:   ctx.Request.UserAgent(),
+	}
+}
+
+// addOrderWatcher registers a socket that follows one order.
+func (h *WebSocketHandler) addOrderWatcher(orderNo string, connection service.IWebSocketConnection) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.orderWatchers[orderNo] == nil {
+		h.orderWatchers[orderNo] = make(map[service.IWebSocketConnection]bool)
+	}
+	h.orderWatchers[orderNo][connection] = true
+}
+
+// removeOrderWatcher forgets a tracking page that went away.
+func (h *WebSocketHandler) removeOrderWatcher(orderNo string, connection service.IWebSocketConnection) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	delete(h.orderWatchers[orderNo], connection)
+	if len(h.orderWatchers[orderNo]) == 0 {
+		delete(h.orderWatchers, orderNo)
+	}
+}
+
+// GetOrderWatchers lists the sockets following one order.
+// The processor uses it to push that order's updates to its tracking pages.
+func (h *WebSocketHandler) GetOrderWatchers(orderNo string) []service.IWebSocketConnection {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	watchers := make([]service.IWebSocketConnection, 0, len(h.orderWatchers[orderNo]))
+	for connection := range h.orderWatchers[orderNo] {
+		watchers = append(watchers, connection)
+	}
+	return watchers
+}
+
+// readLoop reads messages in the background and hands them over on 'reads'.
+// It stops at the first read error, which is reported on the returned error channel.
+func readLoop(ctx context.Context, conn *websocket.Conn) (<-chan []byte, <-chan error) {
+	reads := make(chan []byte)
+	readErr := make(chan error, 1) // Buffered so the goroutine can always exit
+
+	go func() {
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				readErr <- err
+				return
+			}
+			select {
+			case reads <- data:
+			case <-ctx.Done():
+				return
+			}
 		}
+	}()
+	return reads, readErr
+}
+
+// describeReadError says why a socket's read loop ended, for the logs.
+// An oversized frame is a client misbehaving, not a normal goodbye, so it is called out.
+func describeReadError(err error) string {
+	if errors.Is(err, websocket.ErrReadLimit) {
+		return "sent a frame larger than WS_MAX_FRAME_BYTES; connection closed"
+	}
+	if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseNoStatusReceived) {
+		return "disconnected"
+	}
+	var closeErr *websocket.CloseError
+	if errors.As(err, &closeErr) {
+		return fmt.Sprintf("closed the connection with code %d (%s)", closeErr.Code, closeErr.Text)
+	}
+	return fmt.Sprintf("disconnected: %v", err)
+}
+
+// sendCurrentStatus pushes the order's latest known status to one connection.
+func (h *WebSocketHandler) sendCurrentStatus(connection service.IWebSocketConnection, order service.Order) {
+	update := map[string]any{
+		"order_no":     order.OrderNo,
+		"order_status": order.Status,
+		"updated_at":   order.UpdatedAt,
+	}
+	if notes, ok := order.Payload["notes"]; ok {
+		update["notes"] = notes
+	}
+	bytes, err := service.MarshalWebSocketMessage(map[string]any{
+		"message": constants.ORDER_STATUS_SYNC,
+		"order":   update,
+	})
+	if err != nil {
+		logger.Log(fmt.Sprintf("Failed to encode status of order #%s: %v", order.OrderNo, err))
+		return
+	}
+	if err := connection.SendMessage(bytes); err != nil {
+		logger.Log(fmt.Sprintf("Failed to send status of order #%s: %v", order.OrderNo, err))
+	}
+}
+
+// ResendStatus pushes the order's current status again to the owner's socket
+// and to every tracking page open on it. Returns how many connections got it.
+func (h *WebSocketHandler) ResendStatus(order service.Order) int {
+	h.mutex.Lock()
+	targets := make([]service.IWebSocketConnection, 0, len(h.orderWatchers[order.OrderNo])+1)
+	if connection, ok := (*h.connection)[order.OwnerID]; ok {
+		targets = append(targets, connection)
+	}
+	for connection := range h.orderWatchers[order.OrderNo] {
+		targets = append(targets, connection)
+	}
+	h.mutex.Unlock()
+
+	// Send outside the lock: a slow client must not hold up everyone else.
+	for _, connection := range targets {
+		h.sendCurrentStatus(connection, order)
 	}
+	return len(targets)
+}
+
+// subscribe adds an order to the ones the user's socket follows.
+// The first subscribe narrows a socket that followed everything down to the chosen orders.
+func (h *WebSocketHandler) subscribe(userId string, orderNo string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.subscriptions[userId] == nil {
+		h.subscriptions[userId] = make(map[string]bool)
+	}
+	h.subscriptions[userId][orderNo] = true
+}
+
+// unsubscribe stops following an order. A socket that followed everything keeps
+// following the user's other unfinished orders.
+func (h *WebSocketHandler) unsubscribe(userId string, orderNo string) {
+	owned := h.unfinishedOrders(userId)
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.subscriptions[userId] == nil {
+		h.subscriptions[userId] = owned
+	}
+	delete(h.subscriptions[userId], orderNo)
+}
+
+// unfinishedOrders lists the user's orders that may still get updates.
+func (h *WebSocketHandler) unfinishedOrders(userId string) map[string]bool {
+	orderNos := make(map[string]bool)
+	for _, order := range h.store.All() {
+		if order.OwnerID == userId && order.Status != constants.ORDER_DELIVERED && order.Status != constants.ORDER_STATUS_CANCELLED {
+			orderNos[order.OrderNo] = true
+		}
+	}
+	return orderNos
+}
+
+// IsFollowing reports whether the user's socket wants updates of this order.
+// A socket that never subscribed or unsubscribed follows every order the user owns
+// (and so does an offline user, whose missed updates are kept for later).
+// Once it has chosen, it only gets the orders it subscribed to.
+// The processor asks this before pushing an order's update to its owner.
+func (h *WebSocketHandler) IsFollowing(userId string, orderNo string) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	chosen, ok := h.subscriptions[userId]
+	return !ok || chosen[orderNo]
 }
 
 // addConnection safely puts a new user into our "Address Book" (Map).
+// The missed notifications are taken out under the lock (so none is queued after we drained)
+// but sent after it, so a slow client doesn't hold up everyone else.
 func (h *WebSocketHandler) addConnection(clientId string, connection service.IWebSocketConnection) {
 	// Lock the map before writing so two users connecting at once don't crash the server.
+	h.mutex.Lock()
+	(*h.connection)[clientId] = connection
+	delete(h.subscriptions, clientId) // A new socket follows everything until it chooses
+	missed := h.pending.Drain(clientId)
+	h.mutex.Unlock()
+
+	metadata := connection.Metadata()
+	logger.Log(fmt.Sprintf("User [%s] added to active connections (from %s, %q)", clientId, metadata.RemoteAddr, metadata.UserAgent))
+
+	// Deliver anything the user missed while they were offline.
+	for _, message := range missed {
+		if err := connection.SendMessage(message); err != nil {
+			logger.Log(fmt.Sprintf("Failed to deliver missed notification to [%s]: %v", clientId, err))
+		}
+	}
+}
+
+// removeConnection takes a user out of the "Address Book", but only if the entry is still
+// this connection (a quick reconnect may already have replaced it).
+func (h *WebSocketHandler) removeConnection(clientId string, connection service.IWebSocketConnection) {
 	h.mutex.Lock()
 	defer h.mutex.Unlock()
 
-	(*h.connection)[clientId] = connection
-	logger.Log(fmt.Sprintf("User [%s] added to active connections", clientId))
+	if (*h.connection)[clientId] == connection {
+		delete(*h.connection, clientId)
+		delete(h.subscriptions, clientId)
+		logger.Log(fmt.Sprintf("User [%s] removed from active connections (connected for %v)", clientId, time.Since(connection.Metadata().ConnectedAt).Round(time.Second)))
+	}
 }
 
-// GetConnectionMap returns the pointer to our address book.
+// shutdownCloseReason goes with the "going away" close frame every client gets on shutdown.
+const shutdownCloseReason = "server shutting down"
+
+// CloseAll sends a close frame to every connected user and empties the "Address Book".
+// It is called during shutdown so browsers get a clean goodbye.
+// The maps are emptied under the lock and the close frames are sent after it, like BroadcastAll.
+func (h *WebSocketHandler) CloseAll() {
+	h.shutdown()
+
+	h.mutex.Lock()
+	customers := *h.connection
+	*h.connection = make(map[string]service.IWebSocketConnection)
+	watchers := h.orderWatchers
+	h.orderWatchers = make(map[string]map[service.IWebSocketConnection]bool)
+	h.mutex.Unlock()
+
+	for clientId, connection := range customers {
+		if err := service.CloseWith(connection, websocket.CloseGoingAway, shutdownCloseReason); err != nil {
+			logger.Log(fmt.Sprintf("Failed to close connection for [%s]: %v", clientId, err))
+		}
+	}
+	for _, connections := range watchers {
+		for connection := range connections {
+			service.CloseWith(connection, websocket.CloseGoingAway, shutdownCloseReason)
+		}
+	}
+	logger.Log("All WebSocket connections closed")
+}
+
+// ConnectionCount returns how many users are online right now.
+func (h *WebSocketHandler) ConnectionCount() int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	return len(*h.connection)
+}
+
+// ListConnections returns every connected user and when/where they connected from, oldest first.
+func (h *WebSocketHandler) ListConnections() []ConnectionInfo {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	connections := make([]ConnectionInfo, 0, len(*h.connection))
+	for clientId, connection := range *h.connection {
+		connections = append(connections, ConnectionInfo{ID: clientId, ConnectionMetadata: connection.Metadata()})
+	}
+	sort.Slice(connections, func(i, j int) bool {
+		return connections[i].ConnectedAt.Before(connections[j].ConnectedAt)
+	})
+	return connections
+}
+
+// Disconnect force-closes one user's connection (a close frame is sent) and
+// removes it from the "Address Book". Returns false if the user isn't connected.
+func (h *WebSocketHandler) Disconnect(clientId string) bool {
+	h.mutex.Lock()
+	connection, ok := (*h.connection)[clientId]
+	if ok {
+		delete(*h.connection, clientId)
+		delete(h.subscriptions, clientId)
+	}
+	h.mutex.Unlock()
+
+	if !ok {
+		return false
+	}
+	if err := service.CloseWith(connection, websocket.CloseNormalClosure, "disconnected by an admin"); err != nil {
+		logger.Log(fmt.Sprintf("Failed to close connection for [%s]: %v", clientId, err))
+	}
+	logger.Log(fmt.Sprintf("User [%s] was disconnected by an admin", clientId))
+	return true
+}
+
+// Notify sends one raw frame to a connected user. Returns false if the user isn't connected.
+// The send happens outside the lock, so a slow client doesn't hold up everyone else.
+func (h *WebSocketHandler) Notify(clientId string, message []byte) (bool, error) {
+	h.mutex.Lock()
+	connection, ok := (*h.connection)[clientId]
+	h.mutex.Unlock()
+
+	if !ok {
+		return false, nil
+	}
+	return true, connection.SendMessage(message)
+}
+
+// GetConnection looks up one user's socket (nil when they're offline).
 // This is used by the MessageProcessor to find users to send alerts to.
-func (h *WebSocketHandler) GetConnectionMap() *map[string]service.IWebSocketConnection {
-	return h.connection
+func (h *WebSocketHandler) GetConnection(clientId string) service.IWebSocketConnection {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	return (*h.connection)[clientId]
+}
+
+// BroadcastAll sends one frame to every customer socket and tracking page and returns
+// how many received it. Users connect and leave while we send, so the targets are copied
+// under the lock and written to outside it; sockets that fail are closed and pruned after,
+// with the same "still this connection?" check as removeConnection.
+func (h *WebSocketHandler) BroadcastAll(message []byte) int {
+	h.mutex.Lock()
+	customers := make(map[string]service.IWebSocketConnection, len(*h.connection))
+	for clientId, connection := range *h.connection {
+		customers[clientId] = connection
+	}
+	watchers := make(map[service.IWebSocketConnection]string)
+	for orderNo, connections := range h.orderWatchers {
+		for connection := range connections {
+			watchers[connection] = orderNo
+		}
+	}
+	h.mutex.Unlock()
+
+	delivered := 0
+	for clientId, connection := range customers {
+		if err := connection.SendMessage(message); err != nil {
+			logger.Log(fmt.Sprintf("Broadcast to [%s] failed, dropping the connection: %v", clientId, err))
+			connection.Close()
+			h.removeConnection(clientId, connection)
+			continue
+		}
+		delivered++
+	}
+	for connection, orderNo := range watchers {
+		if err := connection.SendMessage(message); err != nil {
+			logger.Log(fmt.Sprintf("Broadcast to tracking page for order #%s failed, dropping it: %v", orderNo, err))
+			connection.Close()
+			h.removeOrderWatcher(orderNo, connection)
+			continue
+		}
+		delivered++
+	}
+	return delivered
 }
 
 // GetNewWebSocketHandler is the Constructor to set up the receptionist service.
-func GetNewWebSocketHandler() *WebSocketHandler {
+func GetNewWebSocketHandler(store service.IOrderStore, pending *service.PendingNotificationStore) *WebSocketHandler {
 	// Initialize the map (make sure it's not nil!)
 	connection := make(map[string]service.IWebSocketConnection)
+	shutdownCtx, shutdown := context.WithCancel(context.Background())
 	
 	return &WebSocketHandler{
-		connection: &connection,
-		upgrader: websocket.Upgrader{
-			// CheckOrigin: true allows any website to connect to your socket.
-			// In production, you would restrict this to your specific domain.
-			CheckOrigin: func(r *http.Request) bool { return true },
-		},
+		connection:    &connection,
+		store:         store,
+		pending:       pending,
+		subscriptions: make(map[string]map[string]bool),
+		orderWatchers: make(map[string]map[service.IWebSocketConnection]bool),
+		shutdownCtx:   shutdownCtx,
+		shutdown:      shutdown,
+		upgrader:      newUpgrader(),
 	}
 }
\ No newline at end of file
@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"fmt"
+
+	"github.com/everestp/pizza-shop/constants"
+	"github.com/everestp/pizza-shop/logger"
+	"github.com/everestp/pizza-shop/service"
+)
+
+// handleClientMessage parses what the browser sent and runs the matching command.
+// Anything we can't understand gets an error envelope back instead of silence.
+func (h *WebSocketHandler) handleClientMessage(userId string, connection service.IWebSocketConnection, data []byte) {
+	cmd, err := service.ParseClientCommand(data)
+	if err != nil {
+		h.reply(connection, map[string]any{"type": "error", "error": err.Error()})
+		return
+	}
+
+	switch cmd.Action {
+	case service.ActionSubscribe:
+		h.handleSubscribe(userId, connection, cmd)
+	case service.ActionUnsubscribe:
+		h.unsubscribe(userId, cmd.OrderNo)
+		h.reply(connection, map[string]any{"type": "ack", "action": cmd.Action, "order_no": cmd.OrderNo})
+	case service.ActionAckPickup:
+		h.handleAckPickup(userId, connection, cmd)
+	case service.ActionResubscribe:
+		h.handleResubscribe(userId, connection, cmd)
+	case service.ActionAckMessage:
+		h.handleReceipt(userId, connection, cmd)
+	}
+}
+
+// handleReceipt is the client confirming it got an update that asked for a receipt.
+// Nothing is sent back: an ack of an ack would only invite loops.
+func (h *WebSocketHandler) handleReceipt(userId string, connection service.IWebSocketConnection, cmd service.ClientCommand) {
+	receipts, ok := connection.(service.IReceiptConnection)
+	if !ok || !receipts.Acknowledge(cmd.MessageID) {
+		logger.Log(fmt.Sprintf("User [%s] acked message %s, which we are not waiting on", userId, cmd.MessageID))
+	}
+}
+
+// handleSubscribe starts following one order the user owns.
+func (h *WebSocketHandler) handleSubscribe(userId string, connection service.IWebSocketConnection, cmd service.ClientCommand) {
+	if _, ok := h.ownedOrder(userId, cmd.OrderNo); !ok {
+		h.reply(connection, map[string]any{"type": "error", "action": cmd.Action, "order_no": cmd.OrderNo, "error": "order not found"})
+		return
+	}
+	h.subscribe(userId, cmd.OrderNo)
+	h.reply(connection, map[string]any{"type": "ack", "action": cmd.Action, "order_no": cmd.OrderNo})
+}
+
+// handleAckPickup is the customer confirming they collected a finished order.
+func (h *WebSocketHandler) handleAckPickup(userId string, connection service.IWebSocketConnection, cmd service.ClientCommand) {
+	order, ok := h.ownedOrder(userId, cmd.OrderNo)
+	if !ok {
+		h.reply(connection, map[string]any{"type": "error", "action": cmd.Action, "order_no": cmd.OrderNo, "error": "order not found"})
+		return
+	}
+	if order.Status != constants.ORDER_DELIVERED {
+		h.reply(connection, map[string]any{"type": "error", "action": cmd.Action, "order_no": cmd.OrderNo, "error": "order is not ready for pickup yet"})
+		return
+	}
+
+	logger.Log(fmt.Sprintf("User [%s] picked up order #%s", userId, cmd.OrderNo))
+	h.unsubscribe(userId, cmd.OrderNo) // Nothing more will happen to this order
+	h.reply(connection, map[string]any{"type": "ack", "action": cmd.Action, "order_no": cmd.OrderNo})
+}
+
+// handleResubscribe restores a reconnecting client's subscriptions.
+func (h *WebSocketHandler) handleResubscribe(userId string, connection service.IWebSocketConnection, cmd service.ClientCommand) {
+	for _, orderNo := range cmd.OrderNos {
+		// Never restore a subscription to somebody else's order.
+		order, ok := h.ownedOrder(userId, orderNo)
+		if !ok {
+			logger.Log(fmt.Sprintf("User [%s] tried to resubscribe to order #%s they don't own", userId, orderNo))
+			continue
+		}
+		h.subscribe(userId, orderNo)
+
+		// Re-sync: the client may have missed updates while it was offline.
+		if cmd.Replay {
+			h.sendCurrentStatus(connection, order)
+		}
+	}
+}
+
+// ownedOrder returns the order only if it exists AND belongs to the user.
+// Someone else's order looks exactly like a missing one, so IDs can't be probed.
+func (h *WebSocketHandler) ownedOrder(userId string, orderNo string) (service.Order, bool) {
+	order, ok := h.store.Get(orderNo)
+	if !ok || order.OwnerID != userId {
+		return service.Order{}, false
+	}
+	return order, true
+}
+
+// reply sends a small JSON envelope back to the client.
+func (h *WebSocketHandler) reply(connection service.IWebSocketConnection, envelope map[string]any) {
+	bytes, err := service.MarshalWebSocketMessage(envelope)
+	if err != nil {
+		logger.Log(fmt.Sprintf("Failed to encode reply: %v", err))
+		return
+	}
+	if err := connection.SendMessage(bytes); err != nil {
+		logger.Log(fmt.Sprintf("Failed to send reply: %v", err))
+	}
+}
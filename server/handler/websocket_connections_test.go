@@ -0,0 +1,371 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/everestp/pizza-shop/constants"
+	"github.com/everestp/pizza-shop/logger"
+	"github.com/everestp/pizza-shop/service"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// recordingConnection is a customer socket that records what it was sent.
+// 'onWrite' runs on every send and close, i.e. while the handler is talking to the client.
+type recordingConnection struct {
+	sent        [][]byte
+	closed      bool
+	closeCode   int // Set when closed with CloseWith
+	closeReason string
+	onWrite     func()
+}
+
+func (c *recordingConnection) SendMessage(message []byte) error {
+	c.onWrite()
+	c.sent = append(c.sent, message)
+	return nil
+}
+func (c *recordingConnection) SendBinary(message []byte) error  { return c.SendMessage(message) }
+func (c *recordingConnection) ReceivedMessage() ([]byte, error) { return nil, nil }
+func (c *recordingConnection) Ping() error                      { return nil }
+func (c *recordingConnection) Context() context.Context         { return context.Background() }
+func (c *recordingConnection) Metadata() service.ConnectionMetadata {
+	return service.ConnectionMetadata{ConnectedAt: time.Now()}
+}
+func (c *recordingConnection) Close() error {
+	c.onWrite()
+	c.closed = true
+	return nil
+}
+func (c *recordingConnection) CloseWith(code int, reason string) error {
+	c.closeCode, c.closeReason = code, reason
+	return c.Close()
+}
+
+// withoutDeadlock fails the test if 'step' doesn't return within a second.
+func withoutDeadlock(t *testing.T, name string, step func()) {
+	t.Helper()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		step()
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("%s is still holding the lock while talking to the client", name)
+	}
+}
+
+// newLockCheckingConnection returns a socket that looks the handler up on every write,
+// which only works when the handler isn't holding its lock.
+func newLockCheckingConnection(h *WebSocketHandler) *recordingConnection {
+	return &recordingConnection{onWrite: func() { h.ConnectionCount() }}
+}
+
+func TestMissedNotificationsAreDeliveredOnReconnect(t *testing.T) {
+	pending := service.GetPendingNotificationStore(time.Minute)
+	h := GetNewWebSocketHandler(service.GetOrderStore(), pending)
+	pending.Add("alice", []byte("first"))
+	pending.Add("alice", []byte("second"))
+
+	connection := newLockCheckingConnection(h)
+	withoutDeadlock(t, "addConnection", func() { h.addConnection("alice", connection) })
+
+	if len(connection.sent) != 2 || string(connection.sent[0]) != "first" || string(connection.sent[1]) != "second" {
+		t.Fatalf("got %q, want the missed notifications in order", connection.sent)
+	}
+	if h.GetConnection("alice") != connection {
+		t.Error("the new socket is not registered")
+	}
+	if missed := pending.Drain("alice"); len(missed) != 0 {
+		t.Errorf("%d notification(s) left over after delivery", len(missed))
+	}
+}
+
+func TestDisconnectClosesOutsideTheLock(t *testing.T) {
+	h := GetNewWebSocketHandler(service.GetOrderStore(), service.GetPendingNotificationStore(time.Minute))
+	connection := newLockCheckingConnection(h)
+	h.addConnection("alice", connection)
+
+	var disconnected bool
+	withoutDeadlock(t, "Disconnect", func() { disconnected = h.Disconnect("alice") })
+	if !disconnected || !connection.closed || h.GetConnection("alice") != nil {
+		t.Errorf("disconnected=%v closed=%v: want the socket closed and gone", disconnected, connection.closed)
+	}
+	if connection.closeCode != websocket.CloseNormalClosure || connection.closeReason != "disconnected by an admin" {
+		t.Errorf("closed with %d %q; the client must not be told the server is shutting down", connection.closeCode, connection.closeReason)
+	}
+	if h.Disconnect("alice") {
+		t.Error("a second Disconnect should report the user as offline")
+	}
+}
+
+func TestCloseAllClosesEverySocketOutsideTheLock(t *testing.T) {
+	h := GetNewWebSocketHandler(service.GetOrderStore(), service.GetPendingNotificationStore(time.Minute))
+	customer := newLockCheckingConnection(h)
+	watcher := newLockCheckingConnection(h)
+	h.addConnection("alice", customer)
+	h.addOrderWatcher("A1", watcher)
+
+	withoutDeadlock(t, "CloseAll", h.CloseAll)
+	if !customer.closed || !watcher.closed {
+		t.Errorf("customer closed=%v, tracking page closed=%v", customer.closed, watcher.closed)
+	}
+	for _, connection := range []*recordingConnection{customer, watcher} {
+		if connection.closeCode != websocket.CloseGoingAway || connection.closeReason != shutdownCloseReason {
+			t.Errorf("closed with %d %q, want going away: %q", connection.closeCode, connection.closeReason, shutdownCloseReason)
+		}
+	}
+	if h.ConnectionCount() != 0 || len(h.GetOrderWatchers("A1")) != 0 {
+		t.Error("CloseAll left sockets registered")
+	}
+}
+
+func TestHandlerReturnsOnShutdownWithoutClientActivity(t *testing.T) {
+	h := GetNewWebSocketHandler(service.GetOrderStore(), service.GetPendingNotificationStore(time.Minute))
+	returned := make(chan struct{})
+	conn := dialTestSocket(t, func(ctx *gin.Context) {
+		defer close(returned)
+		ctx.Set(constants.CONTEXT_USER_ID, "alice")
+		h.HandleConnection(ctx)
+	}, "")
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, _, err := conn.ReadMessage(); err != nil { // The welcome message; the client says nothing after it
+		t.Fatalf("welcome: %v", err)
+	}
+	waitFor(t, func() bool { return h.GetConnection("alice") != nil })
+
+	h.shutdown() // Only the shutdown context: no close frame, no client read error
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatal("the handler is still blocked reading after the shutdown context was cancelled")
+	}
+	if h.GetConnection("alice") != nil {
+		t.Error("the connection is still registered after the handler returned")
+	}
+}
+
+func TestConnectionMetadataComesFromTheUpgradeRequest(t *testing.T) {
+	h := GetNewWebSocketHandler(service.GetOrderStore(), service.GetPendingNotificationStore(time.Minute))
+	router := gin.New()
+	router.GET("/socket", func(ctx *gin.Context) {
+		ctx.Set(constants.CONTEXT_USER_ID, "alice")
+		h.HandleConnection(ctx)
+	})
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	before := time.Now()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/socket",
+		http.Header{"User-Agent": {"PizzaTracker/2.1"}})
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	waitFor(t, func() bool { return h.GetConnection("alice") != nil })
+
+	connections := h.ListConnections()
+	if len(connections) != 1 {
+		t.Fatalf("listed %d connection(s), want alice's", len(connections))
+	}
+	metadata := connections[0].ConnectionMetadata
+	if metadata.UserAgent != "PizzaTracker/2.1" || metadata.RemoteAddr != "127.0.0.1" {
+		t.Errorf("got user agent %q from %q, want the dialer's", metadata.UserAgent, metadata.RemoteAddr)
+	}
+	if metadata.ConnectedAt.Before(before) || metadata.ConnectedAt.After(time.Now()) {
+		t.Errorf("connected at %v, want during the test", metadata.ConnectedAt)
+	}
+}
+
+func TestWelcomeMessageFollowsTheConfiguredMode(t *testing.T) {
+	cases := []struct {
+		mode, message string
+		want          string // "" = no welcome at all
+	}{
+		{mode: "", want: constants.WS_WELCOME_MESSAGE},
+		{mode: "text", message: "Ciao!", want: "Ciao!"},
+		{mode: "json", message: "Ciao!", want: `{"message":"Ciao!","type":"welcome"}`},
+		{mode: "off", message: "Ciao!"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.mode, func(t *testing.T) {
+			withEnv(t, map[string]string{"WS_WELCOME_MODE": tc.mode, "WS_WELCOME_MESSAGE": tc.message})
+			h := GetNewWebSocketHandler(service.GetOrderStore(), service.GetPendingNotificationStore(time.Minute))
+			conn := dialTestSocket(t, func(ctx *gin.Context) {
+				ctx.Set(constants.CONTEXT_USER_ID, "alice")
+				h.HandleConnection(ctx)
+			}, "")
+			// The handler reads the config; it must be done before the cleanup reloads it.
+			t.Cleanup(func() {
+				waitFor(t, func() bool { return h.GetConnection("alice") != nil })
+				conn.Close()
+				waitFor(t, func() bool { return h.GetConnection("alice") == nil })
+			})
+
+			if tc.want == "" {
+				expectSilence(t, conn, 100*time.Millisecond)
+				return
+			}
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			if _, frame, err := conn.ReadMessage(); err != nil || string(frame) != tc.want {
+				t.Errorf("got %q (%v), want %q", frame, err, tc.want)
+			}
+		})
+	}
+}
+
+// lockedBuffer collects log lines written from the handler's goroutines.
+type lockedBuffer struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.String()
+}
+
+func TestOversizedFrameClosesTheConnection(t *testing.T) {
+	withEnv(t, map[string]string{"WS_MAX_FRAME_BYTES": "1024", "log": "on"})
+	logs := &lockedBuffer{}
+	logger.SetOutput(logs)
+	t.Cleanup(func() { logger.SetOutput(os.Stderr) })
+
+	h := GetNewWebSocketHandler(service.GetOrderStore(), service.GetPendingNotificationStore(time.Minute))
+	returned := make(chan struct{})
+	conn := dialTestSocket(t, func(ctx *gin.Context) {
+		defer close(returned)
+		ctx.Set(constants.CONTEXT_USER_ID, "alice")
+		h.HandleConnection(ctx)
+	}, "")
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, _, err := conn.ReadMessage(); err != nil {
+		t.Fatalf("welcome: %v", err)
+	}
+
+	if err := conn.WriteMessage(websocket.TextMessage, bytes.Repeat([]byte("x"), 2048)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	_, _, err := conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+		t.Errorf("got %v, want a 'message too big' close", err)
+	}
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatal("the handler kept the connection after the oversized frame")
+	}
+	if h.GetConnection("alice") != nil {
+		t.Error("the connection is still registered")
+	}
+	if !strings.Contains(logs.String(), "Customer [alice] sent a frame larger than WS_MAX_FRAME_BYTES") {
+		t.Errorf("the oversized frame wasn't logged as such: %q", logs.String())
+	}
+}
+
+func TestDescribeReadError(t *testing.T) {
+	cases := []struct {
+		err  error
+		want string
+	}{
+		{websocket.ErrReadLimit, "sent a frame larger than WS_MAX_FRAME_BYTES; connection closed"},
+		{&websocket.CloseError{Code: websocket.CloseNormalClosure}, "disconnected"},
+		{&websocket.CloseError{Code: websocket.CloseGoingAway}, "disconnected"},
+		{&websocket.CloseError{Code: websocket.ClosePolicyViolation, Text: "bye"}, "closed the connection with code 1008 (bye)"},
+		{io.ErrUnexpectedEOF, "disconnected: unexpected EOF"},
+	}
+	for _, c := range cases {
+		if got := describeReadError(c.err); got != c.want {
+			t.Errorf("%v: got %q, want %q", c.err, got, c.want)
+		}
+	}
+}
+
+// countingConnection is a socket that is safe to use from several goroutines at once.
+type countingConnection struct {
+	recordingConnection
+	fail   bool // Every send fails, like a client that went away
+	sent   atomic.Int64
+	closes atomic.Int64
+}
+
+func (c *countingConnection) SendMessage(message []byte) error {
+	if c.fail {
+		return errors.New("broken pipe")
+	}
+	c.sent.Add(1)
+	return nil
+}
+func (c *countingConnection) Close() error {
+	c.closes.Add(1)
+	return nil
+}
+
+func TestBroadcastAllWhileConnectionsComeAndGo(t *testing.T) {
+	h := GetNewWebSocketHandler(service.GetOrderStore(), service.GetPendingNotificationStore(time.Minute))
+	steady := &countingConnection{}
+	broken := &countingConnection{fail: true}
+	h.addConnection("steady", steady)
+	h.addConnection("broken", broken)
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for worker := 0; worker < 4; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				clientId := fmt.Sprintf("user-%d-%d", worker, i%5)
+				connection := &countingConnection{fail: i%3 == 0}
+				h.addConnection(clientId, connection)
+				h.addOrderWatcher(clientId, connection)
+				h.removeOrderWatcher(clientId, connection)
+				h.removeConnection(clientId, connection)
+			}
+		}(worker)
+	}
+
+	broadcasts := 0
+	for deadline := time.Now().Add(200 * time.Millisecond); time.Now().Before(deadline); broadcasts++ {
+		h.BroadcastAll([]byte(`{"type":"announcement"}`))
+	}
+	close(stop)
+	wg.Wait()
+
+	if got := steady.sent.Load(); got != int64(broadcasts) {
+		t.Errorf("the steady client got %d of %d broadcasts", got, broadcasts)
+	}
+	if h.GetConnection("broken") != nil || broken.closes.Load() != 1 {
+		t.Errorf("the failing client wasn't dropped once (closed %d time(s))", broken.closes.Load())
+	}
+	if h.GetConnection("steady") != steady {
+		t.Error("the steady client was dropped")
+	}
+}
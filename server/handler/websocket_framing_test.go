@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/everestp/pizza-shop/constants"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// readFramed reads one frame, checks its opcode and (with 'prefixed') its length prefix,
+// and decodes the JSON payload.
+func readFramed(t *testing.T, conn *websocket.Conn, wantType int, prefixed bool) map[string]any {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	messageType, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("read frame: %v", err)
+	}
+	if messageType != wantType {
+		t.Fatalf("frame %q: got opcode %d, want %d", data, messageType, wantType)
+	}
+	if prefixed {
+		if len(data) < 4 || int(binary.BigEndian.Uint32(data)) != len(data)-4 {
+			t.Fatalf("frame %q: missing or wrong length prefix", data)
+		}
+		data = data[4:]
+	}
+	var frame map[string]any
+	if err := json.Unmarshal(data, &frame); err != nil {
+		t.Fatalf("frame is not JSON: %q", data)
+	}
+	return frame
+}
+
+func TestEveryOutboundFrameGetsTheConfiguredFraming(t *testing.T) {
+	cases := []struct {
+		name      string
+		frameType string // WS_FRAME_TYPE
+		prefix    string // WS_LENGTH_PREFIX
+		want      int
+	}{
+		{name: "text by default", want: websocket.TextMessage},
+		{name: "binary", frameType: "binary", want: websocket.BinaryMessage},
+		{name: "length-prefixed", prefix: "true", want: websocket.BinaryMessage},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			withEnv(t, map[string]string{"WS_FRAME_TYPE": tc.frameType, "WS_LENGTH_PREFIX": tc.prefix, "WS_WELCOME_MODE": "json"})
+			f := newSubscriptionFixture(t, "A1")
+			conn := dialTestSocket(t, func(ctx *gin.Context) {
+				ctx.Set(constants.CONTEXT_USER_ID, "alice")
+				f.sockets.HandleConnection(ctx)
+			}, "")
+			prefixed := tc.prefix == "true"
+
+			if welcome := readFramed(t, conn, tc.want, prefixed); welcome["type"] != "welcome" {
+				t.Errorf("got %v, want the welcome", welcome)
+			}
+			waitFor(t, func() bool { return f.sockets.GetConnection("alice") != nil })
+			// The handler reads the config until the socket is gone; it must be gone before the reload.
+			t.Cleanup(func() {
+				conn.Close()
+				waitFor(t, func() bool { return f.sockets.GetConnection("alice") == nil })
+			})
+
+			if err := conn.WriteJSON(map[string]any{"action": "teleport"}); err != nil {
+				t.Fatalf("send: %v", err)
+			}
+			if reply := readFramed(t, conn, tc.want, prefixed); reply["type"] != "error" {
+				t.Errorf("got %v, want the error reply", reply)
+			}
+
+			f.cancel(t, "A1")
+			update := readFramed(t, conn, tc.want, prefixed)
+			if order, _ := update["order"].(map[string]any); order["order_no"] != "A1" {
+				t.Errorf("got %v, want A1's update", update)
+			}
+		})
+	}
+}
@@ -0,0 +1,269 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/everestp/pizza-shop/constants"
+	"github.com/everestp/pizza-shop/service"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// noopAcknowledger settles test deliveries without a broker.
+type noopAcknowledger struct{}
+
+func (noopAcknowledger) Ack(tag uint64, multiple bool) error                { return nil }
+func (noopAcknowledger) Nack(tag uint64, multiple bool, requeue bool) error { return nil }
+func (noopAcknowledger) Reject(tag uint64, requeue bool) error              { return nil }
+
+// subscriptionFixture is a customer socket wired to a real processor, the way main wires them.
+type subscriptionFixture struct {
+	sockets   *WebSocketHandler
+	store     *service.OrderStore
+	processor *service.MessageProcessor
+}
+
+func newSubscriptionFixture(t *testing.T, orderNos ...string) *subscriptionFixture {
+	t.Helper()
+
+	store := service.GetOrderStore()
+	for _, orderNo := range orderNos {
+		store.Save(service.Order{OrderNo: orderNo, OwnerID: "alice", Status: constants.ORDER_PREPARING})
+	}
+	sockets := GetNewWebSocketHandler(store, service.GetPendingNotificationStore(time.Minute))
+	publisher := service.GetMemoryPublisher(service.GetMemoryBroker(10))
+	processor := service.GetMessageProcessorService(publisher, sockets.GetConnection, service.GetOrderStatusValidator(), store,
+		service.GetKitchenMetrics(), service.ProcessorOptions{Watchers: sockets.GetOrderWatchers})
+	processor.SetSubscriptions(sockets.IsFollowing)
+	return &subscriptionFixture{sockets: sockets, store: store, processor: processor}
+}
+
+// connect opens alice's customer socket and skips the welcome message.
+func (f *subscriptionFixture) connect(t *testing.T) *websocket.Conn {
+	t.Helper()
+
+	conn := dialTestSocket(t, func(ctx *gin.Context) {
+		ctx.Set(constants.CONTEXT_USER_ID, "alice")
+		f.sockets.HandleConnection(ctx)
+	}, "")
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, _, err := conn.ReadMessage(); err != nil {
+		t.Fatalf("welcome: %v", err)
+	}
+	waitFor(t, func() bool { return f.sockets.GetConnection("alice") != nil })
+	return conn
+}
+
+// command sends a client command and waits for its reply (when it has one).
+func command(t *testing.T, conn *websocket.Conn, cmd map[string]any, reply bool) map[string]any {
+	t.Helper()
+
+	if err := conn.WriteJSON(cmd); err != nil {
+		t.Fatalf("send %v: %v", cmd, err)
+	}
+	if !reply {
+		return nil
+	}
+	return readFrame(t, conn)
+}
+
+// cancel runs a "cancelled" event for the order through the processor.
+func (f *subscriptionFixture) cancel(t *testing.T, orderNo string) {
+	t.Helper()
+
+	body, _ := json.Marshal(map[string]any{"order_no": orderNo, "order_status": constants.ORDER_STATUS_CANCELLED, "customer_id": "alice"})
+	delivery := amqp091.Delivery{Acknowledger: noopAcknowledger{}, Body: body}
+	if err := f.processor.ProcessMessage(context.Background(), delivery); err != nil {
+		t.Fatalf("process %s: %v", orderNo, err)
+	}
+}
+
+// expectUpdate reads the next frame and checks it is about the order.
+func expectUpdate(t *testing.T, conn *websocket.Conn, orderNo string) {
+	t.Helper()
+
+	frame := readFrame(t, conn)
+	order, _ := frame["order"].(map[string]any)
+	if order["order_no"] != orderNo {
+		t.Fatalf("got %v, want an update of %s", frame, orderNo)
+	}
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met within a second")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSocketFollowsEveryOwnOrderByDefault(t *testing.T) {
+	f := newSubscriptionFixture(t, "A1", "A2")
+	conn := f.connect(t)
+
+	f.cancel(t, "A1")
+	expectUpdate(t, conn, "A1")
+	f.cancel(t, "A2")
+	expectUpdate(t, conn, "A2")
+}
+
+func TestUnsubscribedOrderStopsReceivingUpdates(t *testing.T) {
+	f := newSubscriptionFixture(t, "A1", "A2")
+	conn := f.connect(t)
+
+	if reply := command(t, conn, map[string]any{"action": "unsubscribe", "order_no": "A1"}, true); reply["type"] != "ack" {
+		t.Fatalf("unsubscribe: got %v", reply)
+	}
+
+	f.cancel(t, "A1")
+	f.cancel(t, "A2")
+	expectUpdate(t, conn, "A2") // A1's update never came
+	expectSilence(t, conn, 50*time.Millisecond)
+
+	if f.sockets.IsFollowing("alice", "A1") || !f.sockets.IsFollowing("alice", "A2") {
+		t.Error("IsFollowing: want A2 only")
+	}
+}
+
+func TestSubscribeNarrowsToTheChosenOrders(t *testing.T) {
+	f := newSubscriptionFixture(t, "A1", "A2")
+	conn := f.connect(t)
+
+	command(t, conn, map[string]any{"action": "subscribe", "order_no": "A2"}, true)
+
+	f.cancel(t, "A1")
+	f.cancel(t, "A2")
+	expectUpdate(t, conn, "A2")
+	expectSilence(t, conn, 50*time.Millisecond)
+}
+
+func TestResubscribeAfterReconnectRestoresSubscriptionsAndStatuses(t *testing.T) {
+	f := newSubscriptionFixture(t, "A1", "A2", "A3")
+	first := f.connect(t)
+	command(t, first, map[string]any{"action": "subscribe", "order_no": "A2"}, true)
+	first.Close()
+	waitFor(t, func() bool { return f.sockets.GetConnection("alice") == nil })
+
+	// The server forgot the old socket's choice: the new one follows everything...
+	second := f.connect(t)
+	if !f.sockets.IsFollowing("alice", "A1") {
+		t.Fatal("a new socket should follow every order until it chooses")
+	}
+
+	// ...until it restores what it followed before, getting the current statuses back.
+	command(t, second, map[string]any{"action": "resubscribe", "order_nos": []string{"A2", "A3"}, "replay": true}, false)
+	for _, orderNo := range []string{"A2", "A3"} {
+		frame := readFrame(t, second)
+		order, _ := frame["order"].(map[string]any)
+		if frame["message"] != constants.ORDER_STATUS_SYNC || order["order_no"] != orderNo || order["order_status"] != constants.ORDER_PREPARING {
+			t.Fatalf("replay: got %v, want the status of %s", frame, orderNo)
+		}
+	}
+
+	f.cancel(t, "A1")
+	f.cancel(t, "A3")
+	expectUpdate(t, second, "A3")
+	expectSilence(t, second, 50*time.Millisecond)
+}
+
+func TestResubscribeSkipsOrdersOfOtherUsers(t *testing.T) {
+	f := newSubscriptionFixture(t, "A1")
+	f.store.Save(service.Order{OrderNo: "B1", OwnerID: "bob", Status: constants.ORDER_PREPARING})
+	conn := f.connect(t)
+
+	command(t, conn, map[string]any{"action": "resubscribe", "order_nos": []string{"B1", "A1"}, "replay": true}, false)
+	expectUpdate(t, conn, "A1") // Only A1's status is replayed
+	expectSilence(t, conn, 50*time.Millisecond)
+	if f.sockets.IsFollowing("alice", "B1") {
+		t.Error("alice must not follow bob's order")
+	}
+}
+
+func TestInvalidCommandGetsAnErrorEnvelope(t *testing.T) {
+	f := newSubscriptionFixture(t, "A1")
+	conn := f.connect(t)
+
+	for _, cmd := range []map[string]any{
+		{"action": "subscribe"},
+		{"action": "teleport", "order_no": "A1"},
+	} {
+		reply := command(t, conn, cmd, true)
+		if reply["type"] != "error" || reply["error"] == "" {
+			t.Errorf("%v: got %v, want an error envelope", cmd, reply)
+		}
+	}
+	// Someone else's order looks like a missing one.
+	f.store.Save(service.Order{OrderNo: "B1", OwnerID: "bob", Status: constants.ORDER_PREPARING})
+	if reply := command(t, conn, map[string]any{"action": "subscribe", "order_no": "B1"}, true); reply["type"] != "error" || reply["error"] != "order not found" {
+		t.Errorf("subscribe to bob's order: got %v", reply)
+	}
+	if !f.sockets.IsFollowing("alice", "A1") {
+		t.Error("a refused subscribe must not narrow what the socket follows")
+	}
+}
+
+// trackingURL serves alice's tracking pages and returns their base URL ("ws://.../ws/orders/").
+func (f *subscriptionFixture) trackingURL(t *testing.T) string {
+	t.Helper()
+
+	router := gin.New()
+	router.GET("/ws/orders/:orderNo", func(ctx *gin.Context) {
+		ctx.Set(constants.CONTEXT_USER_ID, "alice")
+		f.sockets.HandleOrderConnection(ctx)
+	})
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http") + "/ws/orders/"
+}
+
+// track opens alice's tracking page for one order and checks it starts with the current status.
+func (f *subscriptionFixture) track(t *testing.T, orderNo string) *websocket.Conn {
+	t.Helper()
+
+	conn, _, err := websocket.DefaultDialer.Dial(f.trackingURL(t)+orderNo, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	frame := readFrame(t, conn)
+	order, _ := frame["order"].(map[string]any)
+	if frame["message"] != constants.ORDER_STATUS_SYNC || order["order_no"] != orderNo || order["order_status"] != constants.ORDER_PREPARING {
+		t.Fatalf("first frame: got %v, want the current status of %s", frame, orderNo)
+	}
+	waitFor(t, func() bool { return len(f.sockets.GetOrderWatchers(orderNo)) == 1 })
+	return conn
+}
+
+func TestTrackingPageGetsOnlyItsOrder(t *testing.T) {
+	f := newSubscriptionFixture(t, "A1", "A2")
+	page := f.track(t, "A1")
+
+	f.cancel(t, "A2")
+	f.cancel(t, "A1")
+	expectUpdate(t, page, "A1")
+	expectSilence(t, page, 50*time.Millisecond)
+}
+
+func TestTrackingPageOfSomeoneElsesOrderIsRefused(t *testing.T) {
+	f := newSubscriptionFixture(t)
+	f.store.Save(service.Order{OrderNo: "B1", OwnerID: "bob", Status: constants.ORDER_PREPARING})
+
+	url := f.trackingURL(t)
+	for _, orderNo := range []string{"B1", "MISSING"} {
+		_, response, err := websocket.DefaultDialer.Dial(url+orderNo, nil)
+		if err == nil || response == nil || response.StatusCode != 403 {
+			t.Errorf("%s: got %v, want a 403 before the upgrade", orderNo, err)
+		}
+	}
+}
@@ -1,13 +1,79 @@
 package logger
 
 import (
+	"fmt"
+	"io"
 	"log"
 	"os"
+	"sync/atomic"
 )
 
+// level is set by the -log-level flag and wins over the "log" env var when not empty.
+var level string
+
+// SetLevel overrides the "log" env var: "off" silences logging, anything else turns it on.
+// Call it at startup, before any goroutine logs.
+func SetLevel(newLevel string) {
+	level = newLevel
+}
+
+// SetOutput sends every log line to w (a file, a buffer, a syslog writer...).
+// It redirects the standard "log" package too, so both kinds of lines end up together.
+func SetOutput(w io.Writer) {
+	log.SetOutput(w)
+}
+
+// SetDestination picks where logs go from LOG_OUTPUT: "stdout", "stderr" or a file path
+// (appended to, created if missing). Empty keeps the default, stderr.
+// For a file, the returned Closer is that file (nil otherwise); close it on shutdown.
+func SetDestination(destination string) (io.Closer, error) {
+	switch destination {
+	case "", "stderr":
+		SetOutput(os.Stderr)
+		return nil, nil
+	case "stdout":
+		SetOutput(os.Stdout)
+		return nil, nil
+	}
+
+	file, err := os.OpenFile(destination, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log file %q: %w", destination, err)
+	}
+	SetOutput(file)
+	return file, nil
+}
+
+// sampleRate and sampled implement Sampled: 1 in 'sampleRate' lines is kept.
+var (
+	sampleRate atomic.Int64
+	sampled    atomic.Int64
+)
+
+// SetSampleRate keeps 1 in n of the Sampled lines (LOG_SAMPLE_RATE); n <= 1 keeps them all.
+func SetSampleRate(n int) {
+	if n < 1 {
+		n = 1
+	}
+	sampleRate.Store(int64(n))
+}
+
+// Sampled is Log for the routine lines written for EVERY message (received, action, published),
+// which flood the log under load. Only 1 in LOG_SAMPLE_RATE of them is written.
+// Errors and anything unusual should keep using Log, which is never sampled.
+func Sampled(message any) {
+	if rate := sampleRate.Load(); rate > 1 && (sampled.Add(1)-1)%rate != 0 {
+		return
+	}
+	Log(message)
+}
+
 func Log(message any) {
 	isLogenabled := os.Getenv("log")
-	if isLogenabled != "" {
+	if level != "" {
+		isLogenabled = level
+	}
+	if isLogenabled != "" && isLogenabled != "off" {
 		log.Println(message)
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,127 @@
+package logger
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// captureLogs sends log lines to a buffer, with logging on, for the rest of the test.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+
+	var buf bytes.Buffer
+	SetOutput(&buf)
+	SetLevel("on")
+	t.Cleanup(func() {
+		SetOutput(os.Stderr)
+		SetLevel("")
+	})
+	return &buf
+}
+
+func TestLogLinesGoToTheWriter(t *testing.T) {
+	buf := captureLogs(t)
+
+	Log("Order #A1 is ready")
+	log.Println("a line from the standard log package")
+
+	for _, want := range []string{"Order #A1 is ready", "a line from the standard log package"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("%q was not captured, got %q", want, buf.String())
+		}
+	}
+}
+
+func TestLogOffWritesNothing(t *testing.T) {
+	buf := captureLogs(t)
+	SetLevel("off")
+
+	Log("Order #A1 is ready")
+	if buf.Len() != 0 {
+		t.Errorf("logging is off but got %q", buf.String())
+	}
+}
+
+func TestLogFileIsAppendedTo(t *testing.T) {
+	captureLogs(t)
+	path := filepath.Join(t.TempDir(), "pizza-shop.log")
+	if err := os.WriteFile(path, []byte("from the last run\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := SetDestination(path)
+	if err != nil || file == nil {
+		t.Fatalf("got %v, %v; want the open file", file, err)
+	}
+	Log("Order #A1 is ready")
+	file.Close()
+
+	written, _ := os.ReadFile(path)
+	if !strings.HasPrefix(string(written), "from the last run\n") || !strings.Contains(string(written), "Order #A1 is ready") {
+		t.Errorf("log file holds %q", written)
+	}
+}
+
+func TestStandardDestinationsNeedNoClosing(t *testing.T) {
+	captureLogs(t)
+
+	for _, destination := range []string{"", "stderr", "stdout"} {
+		if file, err := SetDestination(destination); file != nil || err != nil {
+			t.Errorf("%q: got %v, %v", destination, file, err)
+		}
+	}
+}
+
+func TestUnwritableLogFileIsAnError(t *testing.T) {
+	captureLogs(t)
+
+	path := filepath.Join(t.TempDir(), "missing-dir", "pizza-shop.log")
+	if _, err := SetDestination(path); err == nil || !strings.Contains(err.Error(), path) {
+		t.Errorf("got %v, want an error naming %s", err, path)
+	}
+}
+
+// withSampleRate sets LOG_SAMPLE_RATE for one test, starting the count from zero.
+func withSampleRate(t *testing.T, n int) {
+	t.Helper()
+
+	SetSampleRate(n)
+	sampled.Store(0)
+	t.Cleanup(func() { SetSampleRate(1) })
+}
+
+func TestSampledLinesAreThinnedButErrorsAreNot(t *testing.T) {
+	cases := []struct {
+		rate int
+		want int // Of 100 routine lines
+	}{
+		{rate: 10, want: 10},
+		{rate: 3, want: 34},
+		{rate: 1, want: 100},
+		{rate: 0, want: 100},
+	}
+	for _, tc := range cases {
+		t.Run(fmt.Sprintf("LOG_SAMPLE_RATE=%d", tc.rate), func(t *testing.T) {
+			buf := captureLogs(t)
+			withSampleRate(t, tc.rate)
+
+			for i := 0; i < 100; i++ {
+				Sampled("Step 1: Received message")
+				if i%20 == 0 {
+					Log("CRITICAL: failed to process message")
+				}
+			}
+			if got := strings.Count(buf.String(), "Received message"); got != tc.want {
+				t.Errorf("kept %d of 100 routine lines, want %d", got, tc.want)
+			}
+			if got := strings.Count(buf.String(), "CRITICAL"); got != 5 {
+				t.Errorf("kept %d of 5 errors, want every one", got)
+			}
+		})
+	}
+}
@@ -1,7 +1,15 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/everestp/pizza-shop/config"
 	"github.com/everestp/pizza-shop/constants"
@@ -10,57 +18,449 @@ import (
 	"github.com/everestp/pizza-shop/middleware"
 	"github.com/everestp/pizza-shop/routes"
 	"github.com/everestp/pizza-shop/service"
+	"github.com/everestp/pizza-shop/utils"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func main() {
+    startedAt := utils.Clock.Now()
+
+    // 0. Command-line Overrides (-port, -rabbit-host, -rabbit-port, -log-level) win over env vars.
+    if err := config.ApplyFlagOverrides(os.Args[1:]); err != nil {
+        if errors.Is(err, flag.ErrHelp) {
+            os.Exit(0)
+        }
+        os.Exit(2) // The flag package has already printed what was wrong and the usage.
+    }
+
+    // Logs go to stderr unless LOG_OUTPUT says "stdout" or names a file to append to.
+    logFile, err := logger.SetDestination(config.GetEnvProperty("log_output"))
+    if err != nil {
+        fmt.Fprintln(os.Stderr, err)
+        os.Exit(1)
+    }
+    if logFile != nil {
+        defer logFile.Close()
+    }
+    // LOG_SAMPLE_RATE=N keeps 1 in N of the per-message lines (default 1 = all); errors are never dropped.
+    logger.SetSampleRate(config.GetEnvPropertyAsInt("log_sample_rate", 1))
+
     // 1. Initialize the Web Framework (Gin)
-    app := gin.Default()
+    // gin.New, not gin.Default: our RecoveryMiddleware replaces gin.Recovery, so only the access log is added back.
+    app := gin.New()
 
     // 2. Middleware Setup
+    // Logger writes one access-log line per request.
+    app.Use(gin.Logger())
     // Recovery ensures that if one request crashes, the whole server doesn't die.
-    app.Use(gin.Recovery())
+    // Ours also logs the request ID, route and order number with the stack.
+    app.Use(middleware.RecoveryMiddleware)
     // CorsMiddleware allows your frontend (React/Angular) to talk to this backend.
     app.Use(middleware.CorsMiddleware)
+    // Every request gets a deadline (REQUEST_TIMEOUT_MS, default 10s) that handlers pass down.
+    app.Use(middleware.TimeoutMiddleware(time.Duration(config.GetEnvPropertyAsInt("request_timeout", 10000)) * time.Millisecond))
 
     // 3. Health Check (Ping)
     // Used by monitoring tools or just to check if the server is "alive."
-    app.GET("/ping", func(ctx *gin.Context) {
-        ctx.JSON(200, gin.H{
-            "message":    "Pizza Shop is open",
-            "statusCode": 200,
-        })
-    })
+    // It also reports uptime and APP_VERSION, without asking the broker anything.
+    app.GET("/ping", handler.GetPingHandler(startedAt, appVersion()).Ping)
 
     // 4. Service Initialization
+    // Feature flags (FEATURE_<NAME>) are read once here so the log shows what this environment runs with.
+    logger.Log(fmt.Sprintf("Feature flags: %+v", config.GetFlags()))
+
+    // Tracing is off unless OTEL_TRACES_EXPORTER names an exporter (e.g. "stdout").
+    shutdownTracing := service.InitTracing(config.GetEnvProperty("otel_traces_exporter"))
+
     // We create our RabbitMQ tools (Publisher to send, Consumer to listen).
-    messagePublisher := service.GetMessagePublisher()
-    messageConsumer := service.GetMessageConsumerService()
+    // They get their connections from one manager instead of each dialing its own.
+    rabbitConnections := config.GetConnectionManager()
+    messagePublisher, messageConsumer := getMessageBroker(rabbitConnections)
+
+    // Health: is the kitchen consuming (or paused by the breaker after repeated failures),
+    // and does the broker answer a look-up of the kitchen queue within HEALTH_PROBE_TIMEOUT_MS?
+    brokerProbe := service.GetBrokerProbe(func() error {
+        _, err := messagePublisher.QueueStats(constants.KITCHEN_ORDER_QUEUE)
+        return err
+    }, time.Duration(config.GetEnvPropertyAsInt("health_probe_timeout", 2000))*time.Millisecond,
+        config.GetEnvPropertyAsInt("health_probe_retries", 1))
+    app.GET("/health", handler.GetHealthHandler(messageConsumer, brokerProbe).Health)
+
+    // Make sure the kitchen queue exists (with its max-length settings, if any).
+    if err := messagePublisher.DeclareQueue(constants.KITCHEN_ORDER_QUEUE); err != nil {
+        logger.Log(fmt.Sprintf("CRITICAL: failed to declare kitchen queue: %v", err))
+    }
 
     // 5. Real-time Logic Setup
     // Start the WebSocket receptionist and the Processor (the brain).
     // Note how we pass the WebSocket 'Connection Map' directly into the processor.
-    websocketHandler := handler.GetNewWebSocketHandler()
-    messageProcessor := service.GetMessageProcessorService(messagePublisher, websocketHandler.GetConnectionMap())
+    // The order store is shared so HTTP handlers and the processor agree on each order's status.
+    orderStore := service.GetOrderStore()
+    kitchenMetrics := service.GetKitchenMetrics()
+    // Orders on the stove right now; with KITCHEN_MAX_IN_FLIGHT > 0, new orders get a 503 once it's full.
+    inFlight := service.GetInFlightTracker(config.GetEnvPropertyAsInt("kitchen_max_in_flight", 0))
+    // Audit trail: in memory by default, or appended to EVENT_LOG_FILE when set.
+    // Wrapped so the stats dashboards can follow order events live.
+    eventLog := service.GetNotifyingEventLog(service.GetEventLog(config.GetEnvProperty("event_log_file"), config.GetEnvPropertyAsInt("event_log_capacity", 1000)))
+    // Notifications for offline customers are kept for PENDING_NOTIFICATION_TTL_SECONDS (default 15 min).
+    pendingNotifications := service.GetPendingNotificationStore(time.Duration(config.GetEnvPropertyAsInt("pending_notification_ttl", 900)) * time.Second)
+    // ORDER_WEBHOOK_URL: POST every accepted order (signed with ORDER_WEBHOOK_SECRET) to an external kitchen system.
+    orderWebhook := service.GetOrderWebhook(config.GetEnvProperty("order_webhook_url"), config.GetEnvProperty("order_webhook_secret"),
+        time.Duration(config.GetEnvPropertyAsInt("order_webhook_timeout", 5000))*time.Millisecond,
+        config.GetEnvPropertyAsInt("order_webhook_max_attempts", 3))
+    websocketHandler := handler.GetNewWebSocketHandler(orderStore, pendingNotifications)
+    messageProcessor := service.GetMessageProcessorService(messagePublisher, websocketHandler.GetConnection, service.GetOrderStatusValidator(), orderStore, kitchenMetrics, service.ProcessorOptions{
+        EventLog: eventLog,
+        Pending:  pendingNotifications,
+        AutoAck:  messageConsumer.AutoAck(),
+        Watchers: websocketHandler.GetOrderWatchers,
+        Webhook:  orderWebhook,
+        InFlight: inFlight,
+    })
+    // Customers who subscribe/unsubscribe on their socket only get the orders they follow.
+    messageProcessor.SetSubscriptions(websocketHandler.IsFollowing)
+    // A POS with its own status labels (ORDER_STATUS_LABELS) is translated at the edges.
+    if statusLabels, err := service.ParseStatusLabels(config.GetEnvProperty("order_status_labels")); err != nil {
+        logger.Log(fmt.Sprintf("CRITICAL: ignoring ORDER_STATUS_LABELS: %v", err))
+    } else {
+        messageProcessor.SetStatusLabels(statusLabels)
+    }
+
+    // The ops dashboard gets a metrics frame every STATS_PUSH_INTERVAL_SECONDS (default 5).
+    // With ?replay_minutes=N it also gets order events, replaying at most REPLAY_MAX_MINUTES (default 60)
+    // and REPLAY_MAX_EVENTS (default 500) of history first.
+    statsHandler := handler.GetStatsHandler(
+        kitchenMetrics,
+        func() (int, error) { return messagePublisher.QueueDepth(constants.KITCHEN_ORDER_QUEUE) },
+        websocketHandler.ConnectionCount,
+        orderStore.Pending,
+        time.Duration(config.GetEnvPropertyAsInt("stats_push_interval", 5))*time.Second,
+        eventLog,
+        time.Duration(config.GetEnvPropertyAsInt("replay_max_minutes", 60))*time.Minute,
+        config.GetEnvPropertyAsInt("replay_max_events", 500),
+    )
+    eventLog.Subscribe(statsHandler.NotifyEvent)
+
+    // Cancelled on Ctrl+C (SIGINT) or a container stop (SIGTERM).
+    signalCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+    defer stop()
+
+    // Every WS_REAP_INTERVAL seconds (default 60, 0 = off) sockets that fail a ping are dropped.
+    go websocketHandler.StartReaper(signalCtx, time.Duration(config.GetEnvPropertyAsInt("ws_reap_interval", 60))*time.Second)
 
     // 6. Start the Background Worker
     // We use a 'goroutine' (go func) because consuming messages is a blocking task.
     // It must run in the background while the Gin server handles HTTP requests.
-    go func() {
-        err := messageConsumer.ConsumeEventAndProcess(constants.KITCHEN_ORDER_QUEUE, messageProcessor)
-        if err != nil {
-            logger.Log(fmt.Sprintf("CRITICAL: failed to consume events: %v", err))
+    // KITCHEN_REGIONS lists the regions with their own kitchen queue; CONSUMER_REGIONS narrows
+    // which of them (plus "default" for the shared queue) this instance cooks for.
+    kitchenRegions := service.ParseRegions(config.GetEnvProperty("kitchen_regions"))
+    servedRegions := service.ParseRegions(config.GetEnvProperty("consumer_regions"))
+    if len(servedRegions) == 0 {
+        servedRegions = append([]string{service.DefaultRegion}, kitchenRegions...)
+    }
+    // With KITCHEN_DLQ_ENABLED, every kitchen queue also gets "<queue>.dlq" (dead letters, retried
+    // after DLQ_REPROCESS_DELAY_SECONDS) and "<queue>.parked" (out of retries, DLQ_MAX_ATTEMPTS).
+    // The DLQ has its own consumer so the delay never ties up a kitchen worker.
+    var dlqConsumer service.IMessageConsumerService
+    if config.GetEnvPropertyAsBool("kitchen_dlq_enabled", false) && config.GetEnvProperty("message_broker") != "memory" {
+        dlqConsumer = service.GetMessageConsumerService(rabbitConnections.Connection("consumer"))
+    }
+    purge := purgeOnStart()
+    for _, region := range servedRegions {
+        queueName := service.RegionQueueName(region)
+        if err := prepareKitchenQueue(messageConsumer, queueName, purge); err != nil {
+            logger.Log(fmt.Sprintf("CRITICAL: failed to declare queue %q: %v", queueName, err))
+            continue
         }
-    }()
+        go func() {
+            err := messageConsumer.ConsumeEventAndProcess(queueName, messageProcessor)
+            if err != nil {
+                logger.Log(fmt.Sprintf("CRITICAL: failed to consume events from %q: %v", queueName, err))
+            }
+        }()
+        if dlqConsumer != nil {
+            startDeadLetterConsumer(dlqConsumer, messagePublisher, queueName)
+        }
+    }
+    go statsHandler.Start(signalCtx)
+
+    // Prometheus: GET /metrics reports orders per status and the backlog of every served queue.
+    servedQueues := make([]string, 0, len(servedRegions))
+    for _, region := range servedRegions {
+        servedQueues = append(servedQueues, service.RegionQueueName(region))
+    }
+    registry := prometheus.NewRegistry()
+    registry.MustRegister(service.GetOrderGauges(orderStore, messagePublisher, servedQueues))
+    app.GET("/metrics", gin.WrapH(promhttp.HandlerFor(registry, promhttp.HandlerOpts{})))
+
+    // SLA timers: ORDER_SLAS (e.g. "ordered=30s,preparing=10m") sets how long an order may stay
+    // in each status; overdue orders are logged and pushed to the admin alert consoles.
+    alertsHandler := handler.GetAlertsHandler()
+    slas, err := service.ParseSLAs(config.GetEnvProperty("order_slas"))
+    if err != nil {
+        logger.Log(fmt.Sprintf("CRITICAL: ignoring ORDER_SLAS: %v", err))
+    }
+    slaMonitor := service.GetSLAMonitor(orderStore, slas,
+        time.Duration(config.GetEnvPropertyAsInt("sla_check_interval", 5))*time.Second,
+        alertsHandler.NotifyEscalation)
+    go slaMonitor.Start(signalCtx)
+
+    // Eviction: delivered/cancelled orders older than ORDER_MAX_AGE_SECONDS (default 1h) are
+    // dropped every ORDER_EVICTION_INTERVAL seconds so the store doesn't grow forever. 0 keeps them all.
+    orderSweeper := service.GetOrderSweeper(orderStore,
+        time.Duration(config.GetEnvPropertyAsInt("order_max_age_seconds", 3600))*time.Second,
+        time.Duration(config.GetEnvPropertyAsInt("order_eviction_interval", 60))*time.Second)
+    go orderSweeper.Start(signalCtx)
 
     // 7. Route Registration
     // This connects the URL paths (/ws and /orders) to their respective handlers.
-    routes.RegisterRoutes(app, messagePublisher, websocketHandler)
+    // Tokens are verified with JWT_SECRET; without one, everyone is the demo "pizza" customer.
+    tokenVerifier := service.GetTokenVerifier(config.GetEnvProperty("jwt_secret"))
+    kitchenRouter := service.GetKitchenRouter(kitchenRegions, messagePublisher)
+    // Order numbers: random UUIDs by default, or "ORD-000123" style with ORDER_NUMBER_STRATEGY=sequential.
+    orderNumberPrefix := config.GetEnvProperty("order_number_prefix")
+    if orderNumberPrefix == "" {
+        orderNumberPrefix = "ORD-"
+    }
+    orderNumbers, err := service.GetOrderNumberGenerator(config.GetEnvProperty("order_number_strategy"), orderNumberPrefix, config.GetEnvProperty("order_number_state_file"))
+    if err != nil {
+        // Starting the count over could hand out numbers that already exist; use UUIDs instead.
+        logger.Log(fmt.Sprintf("CRITICAL: cannot restore order numbers, using uuid: %v", err))
+        orderNumbers = service.UUIDOrderNumberGenerator{}
+    }
+    orderHandler := handler.GetOrderHandler(messagePublisher, orderStore, kitchenRouter, service.GetOrderStatusValidator(), kitchenMetrics, eventLog, orderNumbers, websocketHandler, inFlight)
+
+    // Demo seeding: synthetic orders go through the same path as real ones.
+    // SEED_ORDERS=N places N orders at startup; POST /admin/seed?count=N does it on demand.
+    seeder := service.GetOrderSeeder(signalCtx, config.GetEnvPropertyAsFloat("seed_orders_rate", 2), func(payload map[string]any) error {
+        status, body := orderHandler.PlaceOrder(context.Background(), payload, "seed-bot")
+        if status != 200 {
+            return fmt.Errorf("status %d: %v", status, body["message"])
+        }
+        return nil
+    })
+    if count := config.GetEnvPropertyAsInt("seed_orders", 0); count > 0 {
+        seeder.Start(count)
+    }
+
+    routes.RegisterRoutes(app, orderHandler, websocketHandler, statsHandler, tokenVerifier,
+        handler.GetAdminHandler(messageConsumer, seeder, websocketHandler, messagePublisher, inFlight, orderStore, service.GetOrderStatusValidator(), eventLog), alertsHandler, config.GetEnvProperty("admin_token"))
+
+    // Self-check: log what we actually run with (secrets redacted) now that every default is known.
+    config.LogEffectiveConfig()
 
     // 8. Launch the Server
+    // We use our own http.Server (instead of app.Run) so we can shut it down gracefully.
     port := config.GetEnvProperty("port")
+    server := &http.Server{
+        Addr:    fmt.Sprintf(":%s", port),
+        Handler: app,
+    }
+    go func() {
+        if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+            logger.Log(fmt.Sprintf("CRITICAL: HTTP server failed: %v", err))
+        }
+    }()
     logger.Log(fmt.Sprintf("Pizza shop started successfully on port : %s", port))
 
+    // 9. Wait for the shutdown signal.
     // This line blocks the main thread and keeps the app running.
-    app.Run(fmt.Sprintf(":%s", port))
-}
\ No newline at end of file
+    <-signalCtx.Done()
+
+    // 10. Close the shop in the right order.
+    timeout := time.Duration(config.GetEnvPropertyAsInt("shutdown_timeout", 30)) * time.Second
+    shop := shopComponents{
+        server:    server,
+        seeder:    seeder,
+        consumer:  messageConsumer,
+        sockets:   []socketGroup{websocketHandler, statsHandler, alertsHandler},
+        publisher: messagePublisher,
+        tracing:   shutdownTracing,
+    }
+    if orderWebhook != nil {
+        shop.webhook = orderWebhook
+    }
+    if dlqConsumer != nil {
+        shop.dlqConsumer = dlqConsumer
+    }
+    gracefulShutdown(timeout, shop.shutdownSteps())
+}
+
+// shutdownStep is one stage of closing the shop.
+type shutdownStep struct {
+    name string
+    run  func(ctx context.Context) error
+}
+
+// The parts of the shop that have to be stopped, by what shutdown needs from them.
+type (
+    httpServer    interface{ Shutdown(ctx context.Context) error }
+    waiter        interface{ Wait() }
+    queueConsumer interface {
+        StopConsuming(ctx context.Context) error
+        Close()
+    }
+    socketGroup interface{ CloseAll() }
+    closer      interface{ Close() }
+)
+
+// shopComponents is everything gracefulShutdown stops. 'webhook' and 'dlqConsumer' are
+// nil when they are turned off.
+type shopComponents struct {
+    server      httpServer
+    seeder      waiter
+    consumer    queueConsumer
+    webhook     waiter
+    dlqConsumer queueConsumer
+    sockets     []socketGroup
+    publisher   closer
+    tracing     func(ctx context.Context) error
+}
+
+// shutdownSteps is the order the shop closes in: stop taking orders, finish the ones in
+// progress, say goodbye to the browsers, and only then close the broker.
+func (shop shopComponents) shutdownSteps() []shutdownStep {
+    return []shutdownStep{
+        // Stop taking new orders and let in-flight HTTP requests finish.
+        {name: "http server", run: shop.server.Shutdown},
+        // Seeding stops on the shutdown signal; wait for the order in progress.
+        {name: "order seeder", run: func(ctx context.Context) error {
+            shop.seeder.Wait()
+            return nil
+        }},
+        // Stop pulling from the queue and let the pizzas in the oven finish.
+        {name: "message consumer", run: shop.consumer.StopConsuming},
+        // Let webhook calls for orders already accepted finish.
+        {name: "order webhook", run: func(ctx context.Context) error {
+            if shop.webhook == nil {
+                return nil
+            }
+            done := make(chan struct{})
+            go func() {
+                shop.webhook.Wait()
+                close(done)
+            }()
+            select {
+            case <-done:
+                return nil
+            case <-ctx.Done():
+                return ctx.Err()
+            }
+        }},
+        {name: "dead-letter consumer", run: func(ctx context.Context) error {
+            if shop.dlqConsumer == nil {
+                return nil
+            }
+            return shop.dlqConsumer.StopConsuming(ctx)
+        }},
+        // Say goodbye to every browser with a proper close frame.
+        {name: "websocket connections", run: func(ctx context.Context) error {
+            for _, sockets := range shop.sockets {
+                sockets.CloseAll()
+            }
+            return nil
+        }},
+        // The broker goes last: the steps above may still need to publish or ack.
+        {name: "rabbitmq connections", run: func(ctx context.Context) error {
+            shop.consumer.Close()
+            if shop.dlqConsumer != nil {
+                shop.dlqConsumer.Close()
+            }
+            shop.publisher.Close()
+            return nil
+        }},
+        // Flush the last spans to the exporter.
+        {name: "tracing", run: shop.tracing},
+    }
+}
+
+// gracefulShutdown runs each step in order, sharing one total deadline.
+// A failing step is logged but never stops the later steps from running,
+// so the broker connections are always closed at the end.
+func gracefulShutdown(timeout time.Duration, steps []shutdownStep) {
+    logger.Log("Shutdown signal received, closing the shop...")
+
+    ctx, cancel := context.WithTimeout(context.Background(), timeout)
+    defer cancel()
+
+    for _, step := range steps {
+        logger.Log(fmt.Sprintf("Shutdown: stopping %s", step.name))
+        if err := step.run(ctx); err != nil {
+            logger.Log(fmt.Sprintf("Shutdown: %s did not stop cleanly: %v", step.name, err))
+        }
+    }
+    logger.Log("Pizza shop closed. See you tomorrow!")
+}
+
+// getMessageBroker picks the transport: RabbitMQ by default, or an in-memory
+// broker when MESSAGE_BROKER=memory (local demos without a RabbitMQ server).
+func getMessageBroker(connections *config.ConnectionManager) (service.IMessagePubliser, service.IMessageConsumerService) {
+    if config.GetEnvProperty("message_broker") == "memory" {
+        logger.Log("Using the in-memory message broker; messages are lost on restart")
+        broker := service.GetMemoryBroker(config.GetEnvPropertyAsInt("memory_queue_capacity", 1000))
+        return service.GetMemoryPublisher(broker), service.GetMemoryConsumer(broker)
+    }
+    return service.GetMessagePublisher(connections.Connection("publisher")), service.GetMessageConsumerService(connections.Connection("consumer"))
+}
+
+// appVersion is the build /ping reports: APP_VERSION, or "dev" when it isn't set.
+func appVersion() string {
+    if version := config.GetEnvProperty("app_version"); version != "" {
+        return version
+    }
+    return constants.DEFAULT_APP_VERSION
+}
+
+// purgeOnStart reads PURGE_QUEUE_ON_START (dev only, default off): throw away what a previous
+// run left in the kitchen queues, so demos start clean. It never applies with GIN_MODE=release.
+func purgeOnStart() bool {
+    purge := config.GetEnvPropertyAsBool("purge_queue_on_start", false)
+    if purge && gin.Mode() == gin.ReleaseMode {
+        logger.Log("CRITICAL: ignoring PURGE_QUEUE_ON_START in release mode")
+        return false
+    }
+    return purge
+}
+
+// prepareKitchenQueue declares a kitchen queue and, when 'purge' is set, empties it.
+// A failed purge is only logged: the queue is still usable.
+func prepareKitchenQueue(consumer service.IMessageConsumerService, queueName string, purge bool) error {
+    if err := consumer.DeclareQueue(queueName); err != nil {
+        return err
+    }
+    if !purge {
+        return nil
+    }
+    purged, err := consumer.PurgeQueue(queueName)
+    if err != nil {
+        logger.Log(fmt.Sprintf("CRITICAL: failed to purge queue %q: %v", queueName, err))
+    } else {
+        logger.Log(fmt.Sprintf("PURGE_QUEUE_ON_START: dropped %d stale message(s) from %q", purged, queueName))
+    }
+    return nil
+}
+
+// startDeadLetterConsumer declares a kitchen queue's DLQ and parked queue and
+// starts the consumer that gives dead-lettered orders their delayed second chance.
+func startDeadLetterConsumer(dlqConsumer service.IMessageConsumerService, publisher service.IMessagePubliser, queueName string) {
+    dlqName := service.DeadLetterQueueName(queueName)
+    for _, name := range []string{dlqName, service.ParkedQueueName(queueName)} {
+        if err := dlqConsumer.DeclareQueue(name); err != nil {
+            logger.Log(fmt.Sprintf("CRITICAL: failed to declare queue %q: %v", name, err))
+            return
+        }
+    }
+
+    reprocessor := service.GetDLQReprocessor(publisher, queueName,
+        time.Duration(config.GetEnvPropertyAsInt("dlq_reprocess_delay", 30))*time.Second,
+        // The retry header also counts the processor's own retries (MAX_RETRY_COUNT, default 3).
+        config.GetEnvPropertyAsInt("dlq_max_attempts", 6),
+        dlqConsumer.AutoAck())
+    go func() {
+        if err := dlqConsumer.ConsumeEventAndProcess(dlqName, reprocessor); err != nil {
+            logger.Log(fmt.Sprintf("CRITICAL: failed to consume events from %q: %v", dlqName, err))
+        }
+    }()
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "reflect"
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/everestp/pizza-shop/config"
+    "github.com/everestp/pizza-shop/service"
+    "github.com/gin-gonic/gin"
+)
+
+// shutdownLog records the calls the fakes below receive, in order.
+type shutdownLog struct {
+    calls []string
+    mutex sync.Mutex
+}
+
+func (sl *shutdownLog) record(call string) {
+    sl.mutex.Lock()
+    defer sl.mutex.Unlock()
+    sl.calls = append(sl.calls, call)
+}
+
+func (sl *shutdownLog) list() []string {
+    sl.mutex.Lock()
+    defer sl.mutex.Unlock()
+    return append([]string(nil), sl.calls...)
+}
+
+// fakePart stands in for every component: it logs each call under its name.
+type fakePart struct {
+    name    string
+    log     *shutdownLog
+    err     error         // Returned by Shutdown and StopConsuming
+    blockOn chan struct{} // Wait blocks until it is closed (nil: returns at once)
+}
+
+func (fp *fakePart) Shutdown(ctx context.Context) error {
+    fp.log.record(fp.name + ".Shutdown")
+    return fp.err
+}
+
+func (fp *fakePart) StopConsuming(ctx context.Context) error {
+    fp.log.record(fp.name + ".StopConsuming")
+    return fp.err
+}
+
+func (fp *fakePart) Wait() {
+    fp.log.record(fp.name + ".Wait")
+    if fp.blockOn != nil {
+        <-fp.blockOn
+    }
+}
+
+func (fp *fakePart) Close()    { fp.log.record(fp.name + ".Close") }
+func (fp *fakePart) CloseAll() { fp.log.record(fp.name + ".CloseAll") }
+
+func newFakeShop(log *shutdownLog) shopComponents {
+    part := func(name string) *fakePart { return &fakePart{name: name, log: log} }
+    return shopComponents{
+        server:      part("server"),
+        seeder:      part("seeder"),
+        consumer:    part("consumer"),
+        webhook:     part("webhook"),
+        dlqConsumer: part("dlq"),
+        sockets:     []socketGroup{part("customers"), part("stats"), part("alerts")},
+        publisher:   part("publisher"),
+        tracing: func(ctx context.Context) error {
+            log.record("tracing.Shutdown")
+            return nil
+        },
+    }
+}
+
+func TestShutdownOrder(t *testing.T) {
+    log := &shutdownLog{}
+    gracefulShutdown(time.Second, newFakeShop(log).shutdownSteps())
+
+    want := []string{
+        "server.Shutdown",        // No new orders
+        "seeder.Wait",            // The seeded order in progress
+        "consumer.StopConsuming", // The pizzas in the oven
+        "webhook.Wait",
+        "dlq.StopConsuming",
+        "customers.CloseAll", "stats.CloseAll", "alerts.CloseAll",
+        "consumer.Close", "dlq.Close", "publisher.Close", // The broker, once nobody needs it
+        "tracing.Shutdown",
+    }
+    if got := log.list(); !reflect.DeepEqual(got, want) {
+        t.Errorf("got  %v\nwant %v", got, want)
+    }
+}
+
+func TestFailingStepDoesNotStopTheRest(t *testing.T) {
+    log := &shutdownLog{}
+    shop := newFakeShop(log)
+    shop.server.(*fakePart).err = errors.New("listener already closed")
+    shop.webhook = nil // Turned off
+    shop.dlqConsumer = nil
+
+    gracefulShutdown(time.Second, shop.shutdownSteps())
+
+    got := log.list()
+    if len(got) == 0 || got[len(got)-1] != "tracing.Shutdown" {
+        t.Fatalf("shutdown stopped early: %v", got)
+    }
+    for _, call := range got {
+        if call == "webhook.Wait" || call == "dlq.StopConsuming" || call == "dlq.Close" {
+            t.Errorf("%s was called on a component that is turned off", call)
+        }
+    }
+}
+
+func TestStuckWebhookIsCutOffByTheDeadline(t *testing.T) {
+    log := &shutdownLog{}
+    shop := newFakeShop(log)
+    stuck := make(chan struct{})
+    defer close(stuck)
+    shop.webhook.(*fakePart).blockOn = stuck
+
+    done := make(chan struct{})
+    go func() {
+        gracefulShutdown(50*time.Millisecond, shop.shutdownSteps())
+        close(done)
+    }()
+    select {
+    case <-done:
+    case <-time.After(time.Second):
+        t.Fatal("shutdown hung on a webhook call that never finished")
+    }
+    if got := log.list(); got[len(got)-1] != "tracing.Shutdown" {
+        t.Errorf("the steps after the webhook didn't run: %v", got)
+    }
+}
+
+func TestAppVersionDefaultsToDev(t *testing.T) {
+    for configured, want := range map[string]string{"v1.4.2": "v1.4.2", "": "dev"} {
+        t.Run("APP_VERSION="+configured, func(t *testing.T) {
+            t.Cleanup(config.ConfigEnv)
+            t.Setenv("APP_VERSION", configured)
+            config.ConfigEnv()
+
+            if got := appVersion(); got != want {
+                t.Errorf("got %q, want %q", got, want)
+            }
+        })
+    }
+}
+
+func TestPurgeOnStartIsOffUnlessAskedForOutsideRelease(t *testing.T) {
+    cases := []struct {
+        flag, mode string
+        want       bool
+    }{
+        {flag: "", mode: gin.DebugMode, want: false},
+        {flag: "true", mode: gin.DebugMode, want: true},
+        {flag: "true", mode: gin.ReleaseMode, want: false},
+    }
+    for _, tc := range cases {
+        t.Run(tc.flag+"/"+tc.mode, func(t *testing.T) {
+            t.Cleanup(config.ConfigEnv)
+            t.Setenv("PURGE_QUEUE_ON_START", tc.flag)
+            config.ConfigEnv()
+            mode := gin.Mode()
+            gin.SetMode(tc.mode)
+            t.Cleanup(func() { gin.SetMode(mode) })
+
+            if got := purgeOnStart(); got != tc.want {
+                t.Errorf("got %v, want %v", got, tc.want)
+            }
+        })
+    }
+}
+
+func TestKitchenQueueIsPurgedOnlyWhenAsked(t *testing.T) {
+    for _, purge := range []bool{false, true} {
+        broker := service.GetMemoryBroker(10)
+        publisher := service.GetMemoryPublisher(broker)
+        publisher.PublishEvent("kitchen", map[string]any{"order_no": "stale"}) // Left over from the last run
+
+        if err := prepareKitchenQueue(service.GetMemoryConsumer(broker), "kitchen", purge); err != nil {
+            t.Fatalf("purge=%v: %v", purge, err)
+        }
+        want := 1
+        if purge {
+            want = 0
+        }
+        if depth, _ := publisher.QueueDepth("kitchen"); depth != want {
+            t.Errorf("purge=%v: %d message(s) left, want %d", purge, depth, want)
+        }
+    }
+}
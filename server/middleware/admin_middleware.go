@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"crypto/subtle"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// AdminMiddleware protects ops endpoints with a shared token sent as "X-Admin-Token".
+// Browsers can't set headers on a WebSocket upgrade, so admin sockets (the stats and
+// alerts dashboards) may send it as "?admin_token=" instead; plain HTTP calls may not.
+// With no token configured the admin API is switched off entirely.
+func AdminMiddleware(adminToken string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		given := ctx.GetHeader("X-Admin-Token")
+		if given == "" && websocket.IsWebSocketUpgrade(ctx.Request) {
+			given = ctx.Query("admin_token")
+		}
+		if adminToken == "" || subtle.ConstantTimeCompare([]byte(given), []byte(adminToken)) != 1 {
+			ctx.AbortWithStatusJSON(403, gin.H{
+				"message":    "Admin access denied",
+				"statusCode": 403,
+			})
+			return
+		}
+		ctx.Next()
+	}
+}
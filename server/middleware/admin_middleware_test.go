@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAdminMiddleware(t *testing.T) {
+	router := gin.New()
+	router.GET("/admin/thing", AdminMiddleware("tok"), func(ctx *gin.Context) {
+		ctx.Status(200)
+	})
+
+	cases := []struct {
+		name    string
+		query   string
+		header  string
+		upgrade bool
+		want    int
+	}{
+		{name: "header", header: "tok", want: 200},
+		{name: "wrong header", header: "nope", want: 403},
+		{name: "no token", want: 403},
+		{name: "query on a websocket upgrade", query: "?admin_token=tok", upgrade: true, want: 200},
+		{name: "wrong query on a websocket upgrade", query: "?admin_token=nope", upgrade: true, want: 403},
+		{name: "query on plain http", query: "?admin_token=tok", want: 403},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			request := httptest.NewRequest("GET", "/admin/thing"+tc.query, nil)
+			if tc.header != "" {
+				request.Header.Set("X-Admin-Token", tc.header)
+			}
+			if tc.upgrade {
+				request.Header.Set("Connection", "Upgrade")
+				request.Header.Set("Upgrade", "websocket")
+			}
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+			if recorder.Code != tc.want {
+				t.Errorf("got %d, want %d", recorder.Code, tc.want)
+			}
+		})
+	}
+}
+
+func TestAdminMiddlewareWithoutTokenConfigured(t *testing.T) {
+	router := gin.New()
+	router.GET("/admin/thing", AdminMiddleware(""), func(ctx *gin.Context) {
+		ctx.Status(200)
+	})
+
+	request := httptest.NewRequest("GET", "/admin/thing", nil)
+	request.Header.Set("X-Admin-Token", "")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	if recorder.Code != 403 {
+		t.Errorf("got %d, want 403 (admin API off)", recorder.Code)
+	}
+}
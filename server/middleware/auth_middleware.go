@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/everestp/pizza-shop/constants"
+	"github.com/everestp/pizza-shop/service"
+	"github.com/gin-gonic/gin"
+)
+
+// AuthMiddleware reads the caller's token, verifies it and stores the user ID
+// in the Gin context for the handlers (ctx.GetString(constants.CONTEXT_USER_ID)).
+// Browsers can't set headers on a WebSocket upgrade, so "?token=" is accepted too.
+func AuthMiddleware(verifier service.ITokenVerifier) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		token := strings.TrimPrefix(ctx.GetHeader("Authorization"), "Bearer ")
+		if token == "" {
+			token = ctx.Query("token")
+		}
+
+		userId, err := verifier.Verify(token)
+		if err != nil {
+			ctx.AbortWithStatusJSON(401, gin.H{
+				"message":    "Invalid or missing token",
+				"statusCode": 401,
+			})
+			return
+		}
+
+		ctx.Set(constants.CONTEXT_USER_ID, userId)
+		ctx.Next()
+	}
+}
@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BodyLimitMiddleware rejects request bodies larger than maxBytes with 413.
+// Requests that announce their size are refused up front; for the rest (e.g. chunked
+// uploads) the body is wrapped so reading stops at the limit, and the handler's
+// bind fails with *http.MaxBytesError.
+func BodyLimitMiddleware(maxBytes int64) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if ctx.Request.ContentLength > maxBytes {
+			ctx.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{
+				"message":    "Request body too large",
+				"statusCode": http.StatusRequestEntityTooLarge,
+			})
+			return
+		}
+
+		ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxBytes)
+		ctx.Next()
+	}
+}
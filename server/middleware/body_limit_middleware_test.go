@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newBodyLimitRouter serves a handler that binds the body the way the order handler does.
+func newBodyLimitRouter(maxBytes int64) *gin.Engine {
+	router := gin.New()
+	router.POST("/orders/create", BodyLimitMiddleware(maxBytes), func(ctx *gin.Context) {
+		var order map[string]any
+		if err := ctx.ShouldBindJSON(&order); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				ctx.Status(http.StatusRequestEntityTooLarge)
+				return
+			}
+			ctx.Status(http.StatusBadRequest)
+			return
+		}
+		ctx.Status(http.StatusOK)
+	})
+	return router
+}
+
+// orderOfSize is a JSON body of exactly 'size' bytes.
+func orderOfSize(size int) string {
+	const frame = `{"notes":""}`
+	return `{"notes":"` + strings.Repeat("x", size-len(frame)) + `"}`
+}
+
+func TestBodyLimitMiddleware(t *testing.T) {
+	router := newBodyLimitRouter(100)
+
+	cases := []struct {
+		name    string
+		size    int
+		chunked bool // No Content-Length: only reading the body finds out it is too big
+		want    int
+	}{
+		{name: "under the limit", size: 99, want: http.StatusOK},
+		{name: "at the limit", size: 100, want: http.StatusOK},
+		{name: "just over the limit", size: 101, want: http.StatusRequestEntityTooLarge},
+		{name: "chunked, under the limit", size: 99, chunked: true, want: http.StatusOK},
+		{name: "chunked, just over the limit", size: 101, chunked: true, want: http.StatusRequestEntityTooLarge},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			request := httptest.NewRequest("POST", "/orders/create", strings.NewReader(orderOfSize(tc.size)))
+			request.Header.Set("Content-Type", "application/json")
+			if tc.chunked {
+				request.ContentLength = -1
+			}
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+			if recorder.Code != tc.want {
+				t.Errorf("got %d, want %d", recorder.Code, tc.want)
+			}
+		})
+	}
+}
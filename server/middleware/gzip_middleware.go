@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gin-contrib/gzip"
+	"github.com/gin-gonic/gin"
+)
+
+// GzipMiddleware compresses the response when the client sends "Accept-Encoding: gzip".
+// It is meant for the routes that return big JSON lists, not for the whole app.
+// WebSocket upgrades are never compressed: the handshake must reach the upgrader untouched.
+// A level of 0 (gzip.NoCompression) turns the middleware off.
+func GzipMiddleware(level int) gin.HandlerFunc {
+	if level == gzip.NoCompression {
+		return func(ctx *gin.Context) {
+			ctx.Next()
+		}
+	}
+
+	return gzip.Gzip(level, gzip.WithCustomShouldCompressFn(func(ctx *gin.Context) bool {
+		if strings.EqualFold(ctx.GetHeader("Upgrade"), "websocket") {
+			return false
+		}
+		return strings.Contains(ctx.GetHeader("Accept-Encoding"), "gzip")
+	}))
+}
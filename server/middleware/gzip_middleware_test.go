@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newListRouter serves a long JSON list, like GET /orders for a regular customer.
+func newListRouter(level int) *gin.Engine {
+	orders := make([]gin.H, 500)
+	for i := range orders {
+		orders[i] = gin.H{"order_no": fmt.Sprintf("A%d", i), "order_status": "prepared"}
+	}
+	router := gin.New()
+	router.GET("/orders", GzipMiddleware(level), func(ctx *gin.Context) {
+		ctx.JSON(200, gin.H{"data": orders, "statusCode": 200})
+	})
+	return router
+}
+
+func TestGzipMiddleware(t *testing.T) {
+	cases := []struct {
+		name           string
+		level          int
+		acceptEncoding string
+		upgrade        bool
+		wantGzip       bool
+	}{
+		{name: "compressed when asked", level: gzip.DefaultCompression, acceptEncoding: "gzip, deflate", wantGzip: true},
+		{name: "plain when not asked", level: gzip.DefaultCompression},
+		{name: "plain when off", level: gzip.NoCompression, acceptEncoding: "gzip"},
+		{name: "websocket upgrades are left alone", level: gzip.DefaultCompression, acceptEncoding: "gzip", upgrade: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			request := httptest.NewRequest("GET", "/orders", nil)
+			if tc.acceptEncoding != "" {
+				request.Header.Set("Accept-Encoding", tc.acceptEncoding)
+			}
+			if tc.upgrade {
+				request.Header.Set("Upgrade", "websocket")
+			}
+			recorder := httptest.NewRecorder()
+			newListRouter(tc.level).ServeHTTP(recorder, request)
+
+			var body io.Reader = recorder.Body
+			if encoding := recorder.Header().Get("Content-Encoding"); tc.wantGzip {
+				if encoding != "gzip" {
+					t.Fatalf("Content-Encoding: got %q, want gzip", encoding)
+				}
+				reader, err := gzip.NewReader(recorder.Body)
+				if err != nil {
+					t.Fatalf("the body isn't gzip: %v", err)
+				}
+				body = reader
+			} else if encoding != "" {
+				t.Fatalf("Content-Encoding: got %q, want a plain body", encoding)
+			}
+
+			var envelope struct {
+				Data []map[string]any `json:"data"`
+			}
+			if err := json.NewDecoder(body).Decode(&envelope); err != nil || len(envelope.Data) != 500 {
+				t.Errorf("got %d order(s) (%v), want the whole list", len(envelope.Data), err)
+			}
+		})
+	}
+}
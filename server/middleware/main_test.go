@@ -0,0 +1,18 @@
+package middleware
+
+import (
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestMain pins PORT: the config reloads itself on every read while PORT is unset,
+// which would race with the goroutines the tests start.
+func TestMain(m *testing.M) {
+	if os.Getenv("PORT") == "" {
+		os.Setenv("PORT", "8080")
+	}
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
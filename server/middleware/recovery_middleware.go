@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/everestp/pizza-shop/constants"
+	"github.com/everestp/pizza-shop/logger"
+	"github.com/everestp/pizza-shop/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// RecoveryMiddleware turns a panic in an HTTP handler into a clean 500 envelope.
+// Unlike gin.Recovery it logs what we need to find the request again: its ID
+// (from "X-Request-ID", or a fresh one that is echoed back), the route, the
+// order number if the path has one, and the stack.
+// Panics while processing queue messages are handled by the consumer, not here.
+func RecoveryMiddleware(ctx *gin.Context) {
+	requestId := ctx.GetHeader("X-Request-ID")
+	if requestId == "" {
+		requestId = utils.RandomId()
+	}
+	ctx.Set(constants.CONTEXT_REQUEST_ID, requestId)
+	ctx.Header("X-Request-ID", requestId)
+
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		// The client went away mid-response; net/http handles (and silences) this one.
+		if err, ok := r.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+			panic(r)
+		}
+
+		logger.Log(fmt.Sprintf("CRITICAL: panic in HTTP handler request_id=%s method=%s path=%s order_no=%q user_id=%q: %v\n%s",
+			requestId, ctx.Request.Method, ctx.FullPath(), ctx.Param("orderNo"), ctx.GetString(constants.CONTEXT_USER_ID), r, debug.Stack()))
+
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"message":    "Something went wrong on our side, please try again",
+			"statusCode": http.StatusInternalServerError,
+			"request_id": requestId,
+		})
+	}()
+	ctx.Next()
+}
@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/everestp/pizza-shop/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// captureLog collects the log lines written during the test.
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+
+	var buf bytes.Buffer
+	logger.SetLevel("on")
+	logger.SetOutput(&buf)
+	t.Cleanup(func() {
+		logger.SetLevel("")
+		logger.SetOutput(os.Stderr)
+	})
+	return &buf
+}
+
+func newPanickingRouter() *gin.Engine {
+	router := gin.New()
+	router.Use(RecoveryMiddleware)
+	router.GET("/orders/:orderNo", func(ctx *gin.Context) {
+		panic("oven on fire")
+	})
+	return router
+}
+
+func TestHandlerPanicBecomesA500Envelope(t *testing.T) {
+	logs := captureLog(t)
+
+	request := httptest.NewRequest("GET", "/orders/A1", nil)
+	request.Header.Set("X-Request-ID", "req-42")
+	recorder := httptest.NewRecorder()
+	newPanickingRouter().ServeHTTP(recorder, request)
+
+	if recorder.Code != 500 {
+		t.Fatalf("got %d, want 500", recorder.Code)
+	}
+	var envelope map[string]any
+	if err := json.Unmarshal(recorder.Body.Bytes(), &envelope); err != nil {
+		t.Fatalf("body is not JSON: %q", recorder.Body.String())
+	}
+	if envelope["statusCode"] != 500.0 || envelope["request_id"] != "req-42" || envelope["message"] == "" {
+		t.Errorf("got %v, want a 500 envelope with the request ID", envelope)
+	}
+
+	line := logs.String()
+	for _, want := range []string{"request_id=req-42", "path=/orders/:orderNo", `order_no="A1"`, "oven on fire"} {
+		if !strings.Contains(line, want) {
+			t.Errorf("log is missing %q:\n%s", want, line)
+		}
+	}
+}
+
+func TestRequestWithoutIdGetsOneInTheLogAndTheResponse(t *testing.T) {
+	logs := captureLog(t)
+
+	recorder := httptest.NewRecorder()
+	newPanickingRouter().ServeHTTP(recorder, httptest.NewRequest("GET", "/orders/A1", nil))
+
+	requestId := recorder.Header().Get("X-Request-ID")
+	if requestId == "" {
+		t.Fatal("no X-Request-ID was echoed back")
+	}
+	if !strings.Contains(logs.String(), "request_id="+requestId) {
+		t.Errorf("log doesn't carry the generated request ID %q:\n%s", requestId, logs.String())
+	}
+}
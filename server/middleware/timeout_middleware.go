@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TimeoutMiddleware gives every request a deadline (REQUEST_TIMEOUT_MS) through its context.
+// Handlers pass ctx.Request.Context() down (e.g. to the publisher), so slow work is cut off
+// at the deadline; if the handler didn't answer by then, the client gets a 504.
+// WebSocket upgrades are left alone: they live far longer than any request.
+// A timeout of 0 turns the middleware off.
+func TimeoutMiddleware(timeout time.Duration) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if timeout <= 0 || strings.EqualFold(ctx.GetHeader("Upgrade"), "websocket") {
+			ctx.Next()
+			return
+		}
+
+		requestCtx, cancel := context.WithTimeout(ctx.Request.Context(), timeout)
+		defer cancel()
+		ctx.Request = ctx.Request.WithContext(requestCtx)
+
+		ctx.Next()
+
+		if errors.Is(requestCtx.Err(), context.DeadlineExceeded) && !ctx.Writer.Written() {
+			ctx.AbortWithStatusJSON(http.StatusGatewayTimeout, gin.H{
+				"message":    "Request timed out",
+				"statusCode": http.StatusGatewayTimeout,
+			})
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newSlowRouter serves a handler that waits for its request context, like a slow publish does.
+func newSlowRouter(timeout time.Duration) *gin.Engine {
+	router := gin.New()
+	router.GET("/slow", TimeoutMiddleware(timeout), func(ctx *gin.Context) {
+		select {
+		case <-ctx.Request.Context().Done():
+		case <-time.After(100 * time.Millisecond):
+			ctx.Status(http.StatusOK)
+		}
+	})
+	return router
+}
+
+func TestTimeoutMiddleware(t *testing.T) {
+	cases := []struct {
+		name    string
+		timeout time.Duration
+		upgrade bool
+		want    int
+	}{
+		{name: "cut off at the deadline", timeout: 20 * time.Millisecond, want: http.StatusGatewayTimeout},
+		{name: "off", timeout: 0, want: http.StatusOK},
+		{name: "websocket upgrades are left alone", timeout: 20 * time.Millisecond, upgrade: true, want: http.StatusOK},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			request := httptest.NewRequest("GET", "/slow", nil)
+			if tc.upgrade {
+				request.Header.Set("Upgrade", "websocket")
+			}
+			recorder := httptest.NewRecorder()
+			newSlowRouter(tc.timeout).ServeHTTP(recorder, request)
+
+			if recorder.Code != tc.want {
+				t.Errorf("got %d %s, want %d", recorder.Code, recorder.Body, tc.want)
+			}
+		})
+	}
+}
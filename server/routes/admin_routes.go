@@ -0,0 +1,89 @@
+package routes
+
+import (
+    "github.com/everestp/pizza-shop/handler"
+    "github.com/gin-gonic/gin"
+)
+
+// RegisterAdminRoutes connects the ops-only "/admin" paths to their logic.
+// The group is already protected by the admin token middleware.
+func RegisterAdminRoutes(router *gin.RouterGroup, adminHandler *handler.AdminHandler, alertsHandler *handler.AlertsHandler) {
+
+    // POST http://localhost:PORT/admin/consumer/concurrency  {"concurrency": 20}
+    // Resizes the worker pool and the broker prefetch while the app is running.
+    router.POST(
+        "/consumer/concurrency",
+        adminHandler.SetConsumerConcurrency,
+    )
+
+    // POST http://localhost:PORT/admin/seed?count=50
+    // Places synthetic demo orders so the dashboard has something to show.
+    router.POST(
+        "/seed",
+        adminHandler.SeedOrders,
+    )
+
+    // GET http://localhost:PORT/admin/ws/connections
+    // Lists the connected customers and when they connected.
+    router.GET(
+        "/ws/connections",
+        adminHandler.ListConnections,
+    )
+
+    // DELETE http://localhost:PORT/admin/ws/connections/:id
+    // Force-disconnects one misbehaving client.
+    router.DELETE(
+        "/ws/connections/:id",
+        adminHandler.DisconnectConnection,
+    )
+
+    // POST http://localhost:PORT/admin/ws/notify  {"id": "pizza", "message": {"type": "test"}}
+    // Sends a test frame to one client (for frontend development).
+    router.POST(
+        "/ws/notify",
+        adminHandler.NotifyConnection,
+    )
+
+    // POST http://localhost:PORT/admin/ws/broadcast  {"message": {"type": "announcement"}}
+    // Sends one frame to every connected customer and tracking page.
+    router.POST(
+        "/ws/broadcast",
+        adminHandler.BroadcastMessage,
+    )
+
+    // GET http://localhost:PORT/admin/queue/kitchen/stats
+    // Message and consumer counts of one queue (404 if it doesn't exist).
+    router.GET(
+        "/queue/:name/stats",
+        adminHandler.QueueStats,
+    )
+
+    // GET http://localhost:PORT/admin/kitchen/load
+    // Orders being cooked right now, oldest first, and the KITCHEN_MAX_IN_FLIGHT limit.
+    router.GET(
+        "/kitchen/load",
+        adminHandler.KitchenLoad,
+    )
+
+    // GET http://localhost:PORT/admin/orders/queue
+    // Every order waiting for a chef, by priority then arrival.
+    router.GET(
+        "/orders/queue",
+        adminHandler.PendingQueue,
+    )
+
+    // POST http://localhost:PORT/admin/orders/A1/advance
+    // Pushes an order to its next status (e.g. preparing -> prepared) without waiting for the cook timer.
+    router.POST(
+        "/orders/:orderNo/advance",
+        adminHandler.AdvanceOrder,
+    )
+
+    // WebSocket http://localhost:PORT/admin/alerts
+    // Admin consoles connect here to receive SLA escalations (ORDER_SLAS) live.
+    // Browsers can't set X-Admin-Token on a WebSocket, so they pass "?admin_token=..." instead.
+    router.GET(
+        "/alerts",
+        alertsHandler.HandleConnection,
+    )
+}
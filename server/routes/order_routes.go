@@ -1,23 +1,43 @@
 package routes
 
 import (
+    "compress/gzip"
+
+    "github.com/everestp/pizza-shop/config"
     "github.com/everestp/pizza-shop/handler"
-    "github.com/everestp/pizza-shop/service"
+    "github.com/everestp/pizza-shop/middleware"
     "github.com/gin-gonic/gin"
 )
 
 // RegisterOrderRoutes connects the "Orders" URL paths to their logic.
-// It takes a RouterGroup (e.g., "/orders") and the RabbitMQ Publisher.
-func RegisterOrderRoutes(router *gin.RouterGroup, messagePublisher service.IMessagePubliser) {
-
-    // 1. Initialize the Handler
-    // We "inject" the messagePublisher so the handler can send messages to RabbitMQ.
-    oh := handler.GetOrderHandler(messagePublisher)
+// It takes a RouterGroup (e.g., "/orders") and the Order Handler.
+// The handler is built in main because the demo seeder places orders through it too.
+func RegisterOrderRoutes(router *gin.RouterGroup, oh *handler.OrderHandler) {
 
-    // 2. Define the Endpoint
+    // 1. Define the Endpoint
     // This creates the path: POST http://localhost:PORT/orders/create
     router.POST(
         "/create",
         oh.CreateOrder, // This function handles the JSON input and RabbitMQ publishing.
     )
+
+    // 2. List Endpoints
+    // These can return long JSON arrays, so they are gzipped for clients that ask for it.
+    // HTTP_GZIP_LEVEL picks the level (1 fastest .. 9 smallest, -1 default); 0 turns it off.
+    compress := middleware.GzipMiddleware(config.GetEnvPropertyAsInt("http_gzip_level", gzip.DefaultCompression))
+
+    // GET http://localhost:PORT/orders -> every order the caller placed, newest first
+    router.GET("", compress, oh.ListOrders)
+    // GET http://localhost:PORT/orders/queue -> my orders waiting for a chef, with their place in the queue
+    router.GET("/queue", compress, oh.PendingQueue)
+
+    // 3. Owner-only Endpoints
+    // GET  http://localhost:PORT/orders/:orderNo        -> current state of the order
+    // POST http://localhost:PORT/orders/:orderNo/cancel -> cancel it while it's still cooking
+    // GET  http://localhost:PORT/orders/:orderNo/history -> every status it went through
+    // POST http://localhost:PORT/orders/:orderNo/resend -> push the current status to my sockets again
+    router.GET("/:orderNo", oh.GetOrder)
+    router.GET("/:orderNo/history", compress, oh.GetOrderHistory)
+    router.POST("/:orderNo/cancel", oh.CancelOrder)
+    router.POST("/:orderNo/resend", oh.ResendStatus)
 }
\ No newline at end of file
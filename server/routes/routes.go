@@ -1,14 +1,16 @@
 package routes
 
 import (
+    "github.com/everestp/pizza-shop/config"
     "github.com/everestp/pizza-shop/handler"
+    "github.com/everestp/pizza-shop/middleware"
     "github.com/everestp/pizza-shop/service"
     "github.com/gin-gonic/gin"
 )
 
 // RegisterRoutes is the "Master Switchboard". 
 // It connects the Gin engine to all the different parts of your application.
-func RegisterRoutes(r *gin.Engine, messagePublisher service.IMessagePubliser, websocketHandler handler.IWebSocketHandler) {
+func RegisterRoutes(r *gin.Engine, orderHandler *handler.OrderHandler, websocketHandler handler.IWebSocketHandler, statsHandler *handler.StatsHandler, verifier service.ITokenVerifier, adminHandler *handler.AdminHandler, alertsHandler *handler.AlertsHandler, adminToken string) {
 
     // 1. Create a Base Group
     // All routes in the app start from here.
@@ -17,19 +19,41 @@ func RegisterRoutes(r *gin.Engine, messagePublisher service.IMessagePubliser, we
     // 2. WebSocket Routes Group
     // Path: http://localhost:PORT/ws/
     // This group handles the "Live" connection between the user and the server.
-    wsr := router.Group("/ws")
+    // Every customer-facing group requires a valid token so users only see their own orders.
+    wsr := router.Group("/ws", middleware.AuthMiddleware(verifier))
     {
         // We pass the websocketHandler here so it can manage the online users map.
         RegisterWebSocketRoutes(wsr, websocketHandler)
     }
 
+    // Live kitchen metrics for the ops dashboard: "ws://yourdomain.com/ws/stats?admin_token=..."
+    // Admin-only: the pending queue and the activity feed show every customer's orders.
+    router.GET("/ws/stats", middleware.AdminMiddleware(adminToken), statsHandler.HandleConnection)
+
     // 3. Order Routes Group
     // Path: http://localhost:PORT/orders/
     // This group handles the "Transactional" part (creating new pizza orders).
-    or := router.Group("/orders")
+    // Bodies above MAX_ORDER_BODY_BYTES (default 1 MiB) are rejected with 413 before binding.
+    maxBodyBytes := int64(config.GetEnvPropertyAsInt("max_order_body_bytes", 1<<20))
+    or := router.Group("/orders", middleware.AuthMiddleware(verifier), middleware.BodyLimitMiddleware(maxBodyBytes))
+    {
+        // The order handler pushes new orders into RabbitMQ.
+        RegisterOrderRoutes(or, orderHandler)
+    }
+
+    // 4. Admin Routes Group
+    // Path: http://localhost:PORT/admin/
+    // Ops-only controls, protected by the ADMIN_TOKEN header (or "?admin_token=" on WebSocket upgrades).
+    ar := router.Group("/admin", middleware.AdminMiddleware(adminToken))
     {
-        // We pass the messagePublisher so that new orders can be pushed into RabbitMQ.
-        RegisterOrderRoutes(or, messagePublisher)
+        RegisterAdminRoutes(ar, adminHandler, alertsHandler)
+    }
+
+    // 5. Demo Page
+    // Path: http://localhost:PORT/demo
+    // A tiny browser client for demos. Off unless SERVE_DEMO_UI=true (then GET /demo is a 404).
+    if config.GetEnvPropertyAsBool("serve_demo_ui", false) {
+        router.GET("/demo", handler.ServeDemoUI)
     }
 
 }
\ No newline at end of file
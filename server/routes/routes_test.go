@@ -0,0 +1,195 @@
+package routes
+
+import (
+    "context"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/everestp/pizza-shop/config"
+    "github.com/everestp/pizza-shop/handler"
+    "github.com/everestp/pizza-shop/service"
+    "github.com/gin-gonic/gin"
+    "github.com/gorilla/websocket"
+)
+
+// userTokens is a token verifier for tests: the token IS the user ID.
+type userTokens struct{}
+
+func (userTokens) Verify(token string) (string, error) {
+    if token == "" {
+        return "", service.ErrInvalidToken
+    }
+    return token, nil
+}
+
+// newTestServer wires every route the way main does, on the in-memory broker.
+func newTestServer(t *testing.T, adminToken string) *httptest.Server {
+    t.Helper()
+
+    broker := service.GetMemoryBroker(100)
+    publisher := service.GetMemoryPublisher(broker)
+    consumer := service.GetMemoryConsumer(broker)
+    store := service.GetOrderStore()
+    metrics := service.GetKitchenMetrics()
+    eventLog := service.GetNotifyingEventLog(service.GetEventLog("", 100))
+    inFlight := service.GetInFlightTracker(0)
+    sockets := handler.GetNewWebSocketHandler(store, service.GetPendingNotificationStore(time.Minute))
+    orders := handler.GetOrderHandler(publisher, store, service.GetKitchenRouter(nil, publisher), service.GetOrderStatusValidator(),
+        metrics, eventLog, service.UUIDOrderNumberGenerator{}, sockets, inFlight)
+    stats := handler.GetStatsHandler(metrics, func() (int, error) { return 0, nil }, sockets.ConnectionCount, store.Pending,
+        time.Hour, eventLog, time.Hour, 100)
+    eventLog.Subscribe(stats.NotifyEvent)
+    seeder := service.GetOrderSeeder(context.Background(), 2, func(payload map[string]any) error { return nil })
+    admin := handler.GetAdminHandler(consumer, seeder, sockets, publisher, inFlight, store, service.GetOrderStatusValidator(), eventLog)
+
+    app := gin.New()
+    RegisterRoutes(app, orders, sockets, stats, userTokens{}, admin, handler.GetAlertsHandler(), adminToken)
+    server := httptest.NewServer(app)
+    t.Cleanup(server.Close)
+    return server
+}
+
+// dial opens a WebSocket to 'path' and returns the handshake's HTTP status.
+func dial(t *testing.T, server *httptest.Server, path string) int {
+    t.Helper()
+
+    url := "ws" + strings.TrimPrefix(server.URL, "http") + path
+    conn, response, err := websocket.DefaultDialer.Dial(url, nil)
+    if err == nil {
+        conn.Close()
+        return response.StatusCode
+    }
+    if response == nil {
+        t.Fatalf("dial %s: %v", path, err)
+    }
+    return response.StatusCode
+}
+
+func TestStatsSocketIsAdminOnly(t *testing.T) {
+    server := newTestServer(t, "tok")
+
+    cases := []struct {
+        name string
+        path string
+        want int
+    }{
+        {name: "customer token", path: "/ws/stats?token=alice", want: http.StatusForbidden},
+        {name: "customer token asking for the activity feed", path: "/ws/stats?token=alice&replay_minutes=5", want: http.StatusForbidden},
+        {name: "wrong admin token", path: "/ws/stats?admin_token=nope", want: http.StatusForbidden},
+        {name: "admin token", path: "/ws/stats?admin_token=tok", want: http.StatusSwitchingProtocols},
+        {name: "admin token with the activity feed", path: "/ws/stats?admin_token=tok&replay_minutes=5", want: http.StatusSwitchingProtocols},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            if got := dial(t, server, tc.path); got != tc.want {
+                t.Errorf("got %d, want %d", got, tc.want)
+            }
+        })
+    }
+}
+
+func TestAlertsSocketAcceptsTheAdminTokenInTheQuery(t *testing.T) {
+    server := newTestServer(t, "tok")
+
+    cases := []struct {
+        name string
+        path string
+        want int
+    }{
+        {name: "admin token", path: "/admin/alerts?admin_token=tok", want: http.StatusSwitchingProtocols},
+        {name: "admin token with a tag filter", path: "/admin/alerts?admin_token=tok&tag=delivery", want: http.StatusSwitchingProtocols},
+        {name: "wrong admin token", path: "/admin/alerts?admin_token=nope", want: http.StatusForbidden},
+        {name: "customer token", path: "/admin/alerts?token=alice", want: http.StatusForbidden},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            if got := dial(t, server, tc.path); got != tc.want {
+                t.Errorf("got %d, want %d", got, tc.want)
+            }
+        })
+    }
+}
+
+func TestAdminQueryTokenIsOnlyForUpgrades(t *testing.T) {
+    server := newTestServer(t, "tok")
+
+    response, err := http.Get(server.URL + "/admin/orders/queue?admin_token=tok")
+    if err != nil {
+        t.Fatalf("get: %v", err)
+    }
+    response.Body.Close()
+    if response.StatusCode != http.StatusForbidden {
+        t.Errorf("got %d, want 403: plain HTTP calls must send the header", response.StatusCode)
+    }
+}
+
+func TestCustomerSocketStillNeedsCustomerToken(t *testing.T) {
+    server := newTestServer(t, "tok")
+
+    if got := dial(t, server, "/ws/?token=alice"); got != http.StatusSwitchingProtocols {
+        t.Errorf("customer: got %d, want 101", got)
+    }
+    if got := dial(t, server, "/ws/"); got != http.StatusUnauthorized {
+        t.Errorf("no token: got %d, want 401", got)
+    }
+}
+
+func TestDemoPageIsServedOnlyWhenEnabled(t *testing.T) {
+    cases := []struct {
+        name    string
+        enabled string
+        want    int
+    }{
+        {name: "enabled", enabled: "true", want: http.StatusOK},
+        {name: "disabled", enabled: "false", want: http.StatusNotFound},
+        {name: "unset", enabled: "", want: http.StatusNotFound},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            t.Cleanup(config.ConfigEnv) // Runs after t.Setenv restored the var
+            t.Setenv("SERVE_DEMO_UI", tc.enabled)
+            config.ConfigEnv()
+            server := newTestServer(t, "tok")
+
+            response, err := http.Get(server.URL + "/demo")
+            if err != nil {
+                t.Fatalf("get: %v", err)
+            }
+            defer response.Body.Close()
+            if response.StatusCode != tc.want {
+                t.Fatalf("got %d, want %d", response.StatusCode, tc.want)
+            }
+            if tc.want != http.StatusOK {
+                return
+            }
+            body, _ := io.ReadAll(response.Body)
+            if !strings.HasPrefix(response.Header.Get("Content-Type"), "text/html") || !strings.Contains(string(body), "/ws") {
+                t.Errorf("got %q %.80q, want the embedded demo page", response.Header.Get("Content-Type"), body)
+            }
+        })
+    }
+}
+
+func TestAdvancingAnOrderNeedsTheAdminToken(t *testing.T) {
+    server := newTestServer(t, "tok")
+
+    for token, want := range map[string]int{"": http.StatusForbidden, "nope": http.StatusForbidden, "tok": http.StatusNotFound} {
+        request, _ := http.NewRequest("POST", server.URL+"/admin/orders/A1/advance", nil)
+        if token != "" {
+            request.Header.Set("X-Admin-Token", token)
+        }
+        response, err := http.DefaultClient.Do(request)
+        if err != nil {
+            t.Fatalf("post: %v", err)
+        }
+        response.Body.Close()
+        // With the right token the call gets through, to an order that doesn't exist.
+        if response.StatusCode != want {
+            t.Errorf("token %q: got %d, want %d", token, response.StatusCode, want)
+        }
+    }
+}
@@ -7,6 +7,7 @@ import (
 
 // RegisterWebSocketRoutes sets up the live communication path.
 // It takes a RouterGroup (like "/ws") and the Handler that knows how to manage connections.
+// The ops stats socket lives next to it, but behind the admin token (see RegisterRoutes).
 func RegisterWebSocketRoutes(router *gin.RouterGroup, websocketHandler handler.IWebSocketHandler) {
     
     // This defines the specific endpoint for WebSockets.
@@ -15,6 +16,13 @@ func RegisterWebSocketRoutes(router *gin.RouterGroup, websocketHandler handler.I
         "/", 
         websocketHandler.HandleConnection, // The function that upgrades HTTP to WebSocket
     )
+
+    // One order's tracking page: "ws://yourdomain.com/ws/orders/1234"
+    // Follows only that order and starts with its current status.
+    router.GET(
+        "/orders/:orderNo",
+        websocketHandler.HandleOrderConnection,
+    )
 }
 
 /* FUTURE REFERENCE:
@@ -0,0 +1,130 @@
+package service
+
+import (
+    "fmt"
+    "sync"
+    "time"
+
+    "github.com/everestp/pizza-shop/logger"
+    "github.com/rabbitmq/amqp091-go"
+)
+
+// AckBatcher turns many single acks into one "multiple" ack (msg.Ack(true)),
+// saving a broker round-trip per message under high volume.
+//
+// It sits between the deliveries and their channel: the consumer points each
+// Delivery's Acknowledger at the batcher, so the processor keeps calling
+// msg.Ack(false) as usual. Because workers finish out of order, a multiple ack
+// is only ever sent up to the highest CONTIGUOUS finished delivery tag, so a
+// message still in the oven is never acked by accident.
+//
+// Nacks and rejects are sent right away (they must not wait); they just fill their gap.
+// Keep the batch size below the prefetch, or the window timer will be doing all the flushing.
+type AckBatcher struct {
+    channel    amqp091.Acknowledger // The real channel the deliveries came from
+    settled    map[uint64]bool      // Finished tags above 'contiguous', true = acked
+    contiguous uint64               // Every tag up to here is finished
+    ackUpTo    uint64               // Highest finished tag that was an ack and is not yet sent
+    pending    int                  // Acks waiting to be sent
+    batchSize  int                  // Send once this many acks are waiting...
+    window     time.Duration        // ...or once the oldest has waited this long
+    timer      *time.Timer
+    mutex      sync.Mutex
+}
+
+// Ack records a finished message. A 'multiple' ack from the caller is sent as-is after a flush.
+func (ab *AckBatcher) Ack(tag uint64, multiple bool) error {
+    ab.mutex.Lock()
+    defer ab.mutex.Unlock()
+
+    if multiple {
+        ab.flush()
+        return ab.channel.Ack(tag, true)
+    }
+    ab.settle(tag, true)
+    if ab.pending >= ab.batchSize {
+        return ab.flush()
+    }
+    if ab.pending > 0 && ab.timer == nil {
+        ab.timer = time.AfterFunc(ab.window, func() { ab.Flush() })
+    }
+    return nil
+}
+
+// Nack is sent to the broker immediately; the tag then stops blocking later acks.
+func (ab *AckBatcher) Nack(tag uint64, multiple bool, requeue bool) error {
+    ab.mutex.Lock()
+    defer ab.mutex.Unlock()
+
+    if multiple {
+        ab.flush()
+        return ab.channel.Nack(tag, true, requeue)
+    }
+    err := ab.channel.Nack(tag, false, requeue)
+    ab.settle(tag, false)
+    return err
+}
+
+// Reject is a single-message Nack.
+func (ab *AckBatcher) Reject(tag uint64, requeue bool) error {
+    return ab.Nack(tag, false, requeue)
+}
+
+// settle marks a tag finished and moves the contiguous mark forward. Caller holds the lock.
+func (ab *AckBatcher) settle(tag uint64, acked bool) {
+    if tag <= ab.contiguous {
+        return
+    }
+    ab.settled[tag] = acked
+    for {
+        acked, ok := ab.settled[ab.contiguous+1]
+        if !ok {
+            return
+        }
+        delete(ab.settled, ab.contiguous+1)
+        ab.contiguous++
+        if acked {
+            ab.ackUpTo = ab.contiguous
+            ab.pending++
+        }
+    }
+}
+
+// Flush sends every ack that can be sent right now.
+func (ab *AckBatcher) Flush() error {
+    ab.mutex.Lock()
+    defer ab.mutex.Unlock()
+
+    return ab.flush()
+}
+
+// flush sends one multiple ack up to 'ackUpTo'. Caller holds the lock.
+func (ab *AckBatcher) flush() error {
+    if ab.timer != nil {
+        ab.timer.Stop()
+        ab.timer = nil
+    }
+    if ab.pending == 0 {
+        return nil
+    }
+    count := ab.pending
+    ab.pending = 0
+    if err := ab.channel.Ack(ab.ackUpTo, true); err != nil {
+        logger.Log(fmt.Sprintf("Failed to ack %d message(s) up to tag %d: %v", count, ab.ackUpTo, err))
+        return err
+    }
+    return nil
+}
+
+// GetAckBatcher is the Constructor. One batcher per channel: delivery tags are per channel.
+func GetAckBatcher(channel amqp091.Acknowledger, batchSize int, window time.Duration) *AckBatcher {
+    if window <= 0 {
+        window = 100 * time.Millisecond
+    }
+    return &AckBatcher{
+        channel:   channel,
+        settled:   make(map[uint64]bool),
+        batchSize: batchSize,
+        window:    window,
+    }
+}
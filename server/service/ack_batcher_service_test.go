@@ -0,0 +1,87 @@
+package service
+
+import (
+    "fmt"
+    "sync"
+    "testing"
+    "time"
+)
+
+// channelCalls records what reached the channel, e.g. "ack 3 multiple" or "nack 2 requeue".
+type channelCalls struct {
+    calls []string
+    mutex sync.Mutex
+}
+
+func (cc *channelCalls) record(format string, args ...any) error {
+    cc.mutex.Lock()
+    defer cc.mutex.Unlock()
+    cc.calls = append(cc.calls, fmt.Sprintf(format, args...))
+    return nil
+}
+
+func (cc *channelCalls) Ack(tag uint64, multiple bool) error {
+    return cc.record("ack %d multiple=%t", tag, multiple)
+}
+func (cc *channelCalls) Nack(tag uint64, multiple bool, requeue bool) error {
+    return cc.record("nack %d requeue=%t", tag, requeue)
+}
+func (cc *channelCalls) Reject(tag uint64, requeue bool) error { return cc.Nack(tag, false, requeue) }
+
+func (cc *channelCalls) snapshot() []string {
+    cc.mutex.Lock()
+    defer cc.mutex.Unlock()
+    return append([]string(nil), cc.calls...)
+}
+
+func expectCalls(t *testing.T, got []string, want ...string) {
+    t.Helper()
+
+    if fmt.Sprint(got) != fmt.Sprint(want) {
+        t.Errorf("channel got %q, want %q", got, want)
+    }
+}
+
+func TestOutOfOrderAcksWaitForTheGap(t *testing.T) {
+    channel := &channelCalls{}
+    batcher := GetAckBatcher(channel, 1, time.Hour)
+
+    batcher.Ack(2, false)
+    batcher.Ack(3, false)
+    expectCalls(t, channel.snapshot()) // Tag 1 is still cooking: nothing may be acked
+
+    batcher.Ack(1, false)
+    expectCalls(t, channel.snapshot(), "ack 3 multiple=true")
+}
+
+func TestAcksAreSentOncePerBatch(t *testing.T) {
+    channel := &channelCalls{}
+    batcher := GetAckBatcher(channel, 3, time.Hour)
+
+    for tag := uint64(1); tag <= 6; tag++ {
+        batcher.Ack(tag, false)
+    }
+    expectCalls(t, channel.snapshot(), "ack 3 multiple=true", "ack 6 multiple=true")
+}
+
+func TestNacksGoOutAtOnceAndCloseTheirGap(t *testing.T) {
+    channel := &channelCalls{}
+    batcher := GetAckBatcher(channel, 2, time.Hour)
+
+    batcher.Ack(1, false)
+    batcher.Nack(2, false, true)
+    expectCalls(t, channel.snapshot(), "nack 2 requeue=true")
+
+    batcher.Ack(3, false)
+    expectCalls(t, channel.snapshot(), "nack 2 requeue=true", "ack 3 multiple=true")
+}
+
+func TestPartialBatchIsFlushedAfterTheWindow(t *testing.T) {
+    channel := &channelCalls{}
+    batcher := GetAckBatcher(channel, 100, 20*time.Millisecond)
+
+    batcher.Ack(1, false)
+    batcher.Ack(2, false)
+    waitUntil(t, func() bool { return len(channel.snapshot()) > 0 })
+    expectCalls(t, channel.snapshot(), "ack 2 multiple=true")
+}
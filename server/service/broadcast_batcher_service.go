@@ -0,0 +1,70 @@
+package service
+
+import (
+    "encoding/json"
+    "fmt"
+    "sync"
+    "time"
+
+    "github.com/everestp/pizza-shop/logger"
+)
+
+// BroadcastBatcher coalesces WebSocket updates for the same client.
+// When twenty pizzas come out of the oven at once, the customer gets ONE frame
+// holding a JSON array instead of twenty separate writes.
+type BroadcastBatcher struct {
+    window  time.Duration                               // How long to collect updates before sending
+    send    func(clientId string, message []byte) error // The real "write to socket" function
+    pending map[string][]json.RawMessage                // Updates waiting to go out, per client
+    mutex   sync.Mutex
+}
+
+// Enqueue adds a message to the client's batch. The first message of a batch
+// starts the timer; everything that arrives before it fires rides along.
+func (b *BroadcastBatcher) Enqueue(clientId string, message []byte) {
+    b.mutex.Lock()
+    defer b.mutex.Unlock()
+
+    if _, waiting := b.pending[clientId]; !waiting {
+        time.AfterFunc(b.window, func() { b.flush(clientId) })
+    }
+    b.pending[clientId] = append(b.pending[clientId], json.RawMessage(message))
+}
+
+// flush sends whatever has been collected for one client.
+// A single update is sent as-is, so clients only see arrays when batching actually happened.
+func (b *BroadcastBatcher) flush(clientId string) {
+    b.mutex.Lock()
+    messages := b.pending[clientId]
+    delete(b.pending, clientId)
+    b.mutex.Unlock()
+
+    if len(messages) == 0 {
+        return
+    }
+
+    frame := []byte(messages[0])
+    if len(messages) > 1 {
+        var err error
+        if frame, err = MarshalWebSocketMessage(messages); err != nil {
+            logger.Log(fmt.Sprintf("Failed to build batch for [%s]: %v", clientId, err))
+            return
+        }
+    }
+
+    if err := b.send(clientId, frame); err != nil {
+        logger.Log(fmt.Sprintf("Failed to send batch of %d updates to [%s]: %v", len(messages), clientId, err))
+    }
+}
+
+// GetBroadcastBatcher is the Constructor. A zero window disables batching (returns nil).
+func GetBroadcastBatcher(window time.Duration, send func(clientId string, message []byte) error) *BroadcastBatcher {
+    if window <= 0 {
+        return nil
+    }
+    return &BroadcastBatcher{
+        window:  window,
+        send:    send,
+        pending: make(map[string][]json.RawMessage),
+    }
+}
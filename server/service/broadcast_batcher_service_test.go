@@ -0,0 +1,105 @@
+package service
+
+import (
+    "encoding/json"
+    "sync"
+    "testing"
+    "time"
+)
+
+// frameRecorder collects the frames a batcher sends, per client.
+type frameRecorder struct {
+    frames chan [2]string // [client, frame]
+}
+
+func newFrameRecorder() *frameRecorder {
+    return &frameRecorder{frames: make(chan [2]string, 10)}
+}
+
+func (fr *frameRecorder) send(clientId string, message []byte) error {
+    fr.frames <- [2]string{clientId, string(message)}
+    return nil
+}
+
+func (fr *frameRecorder) next(t *testing.T) (string, string) {
+    t.Helper()
+
+    select {
+    case frame := <-fr.frames:
+        return frame[0], frame[1]
+    case <-time.After(time.Second):
+        t.Fatal("no frame was sent")
+        return "", ""
+    }
+}
+
+func TestUpdatesWithinTheWindowArriveAsOneFrame(t *testing.T) {
+    recorder := newFrameRecorder()
+    batcher := GetBroadcastBatcher(50*time.Millisecond, recorder.send)
+
+    for _, status := range []string{"preparing", "prepared", "delivered"} {
+        batcher.Enqueue("alice", []byte(`{"order_status":"`+status+`"}`))
+    }
+
+    client, frame := recorder.next(t)
+    var batch []map[string]string
+    if err := json.Unmarshal([]byte(frame), &batch); err != nil {
+        t.Fatalf("frame %q is not a JSON array: %v", frame, err)
+    }
+    if client != "alice" || len(batch) != 3 || batch[0]["order_status"] != "preparing" || batch[2]["order_status"] != "delivered" {
+        t.Errorf("got %s %v, want alice's 3 updates in order", client, batch)
+    }
+    select {
+    case extra := <-recorder.frames:
+        t.Errorf("unexpected second frame %v", extra)
+    case <-time.After(80 * time.Millisecond):
+    }
+}
+
+func TestUpdatesOutsideTheWindowArriveSeparately(t *testing.T) {
+    recorder := newFrameRecorder()
+    batcher := GetBroadcastBatcher(20*time.Millisecond, recorder.send)
+
+    batcher.Enqueue("alice", []byte(`{"order_status":"preparing"}`))
+    if _, frame := recorder.next(t); frame != `{"order_status":"preparing"}` {
+        t.Errorf("got %q, want the single update as-is", frame)
+    }
+    batcher.Enqueue("alice", []byte(`{"order_status":"prepared"}`))
+    if _, frame := recorder.next(t); frame != `{"order_status":"prepared"}` {
+        t.Errorf("got %q, want the later update on its own", frame)
+    }
+}
+
+func TestEachClientGetsItsOwnBatch(t *testing.T) {
+    recorder := newFrameRecorder()
+    batcher := GetBroadcastBatcher(30*time.Millisecond, recorder.send)
+
+    var wg sync.WaitGroup
+    for _, client := range []string{"alice", "bob"} {
+        wg.Add(1)
+        go func(client string) {
+            defer wg.Done()
+            batcher.Enqueue(client, []byte(`{"n":1}`))
+            batcher.Enqueue(client, []byte(`{"n":2}`))
+        }(client)
+    }
+    wg.Wait()
+
+    seen := map[string]bool{}
+    for i := 0; i < 2; i++ {
+        client, frame := recorder.next(t)
+        if frame != `[{"n":1},{"n":2}]` {
+            t.Errorf("%s got %q", client, frame)
+        }
+        seen[client] = true
+    }
+    if !seen["alice"] || !seen["bob"] {
+        t.Errorf("got batches for %v", seen)
+    }
+}
+
+func TestZeroWindowTurnsBatchingOff(t *testing.T) {
+    if GetBroadcastBatcher(0, newFrameRecorder().send) != nil {
+        t.Error("a zero window should disable the batcher")
+    }
+}
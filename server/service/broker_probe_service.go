@@ -0,0 +1,97 @@
+package service
+
+import (
+    "context"
+    "fmt"
+    "sync"
+    "time"
+)
+
+// BrokerProbe checks the broker for /health by looking the kitchen queue up
+// (a passive declare on a throwaway channel, which is always closed afterwards).
+// A hung broker must not make /health hang too, so each probe gets
+// HEALTH_PROBE_TIMEOUT_MS (default 2000) in total, retries a failed attempt up to
+// HEALTH_PROBE_RETRIES times (default 1) within it, and otherwise reports "degraded".
+// While a probe is still stuck, later health checks don't start another one.
+type BrokerProbe struct {
+    check   func() error // One attempt, e.g. inspecting the kitchen queue
+    timeout time.Duration
+    retries int
+    running bool // An attempt is still waiting on the broker
+    mutex   sync.Mutex
+}
+
+// ProbeResult is the broker part of GET /health.
+type ProbeResult struct {
+    Status    string `json:"status"` // "ok" or "degraded"
+    Error     string `json:"error,omitempty"`
+    LatencyMs int64  `json:"latency_ms"`
+}
+
+// Probe runs the check, giving up once ctx or the probe timeout runs out.
+func (bp *BrokerProbe) Probe(ctx context.Context) ProbeResult {
+    ctx, cancel := context.WithTimeout(ctx, bp.timeout)
+    defer cancel()
+
+    start := time.Now()
+    var err error
+    for attempt := 0; attempt <= bp.retries; attempt++ {
+        if err = bp.attempt(ctx); err == nil || ctx.Err() != nil {
+            break
+        }
+    }
+
+    result := ProbeResult{Status: "ok", LatencyMs: time.Since(start).Milliseconds()}
+    if err != nil {
+        result.Status = "degraded"
+        result.Error = err.Error()
+    }
+    return result
+}
+
+// attempt runs the check once in the background, so a hung broker only costs us the timeout.
+// The check finishes (and closes its channel) on its own even after we stop waiting.
+func (bp *BrokerProbe) attempt(ctx context.Context) error {
+    bp.mutex.Lock()
+    if bp.running {
+        bp.mutex.Unlock()
+        return fmt.Errorf("previous broker probe has not answered yet")
+    }
+    bp.running = true
+    bp.mutex.Unlock()
+
+    done := make(chan error, 1) // Buffered: a late check must still be able to finish
+    go func() {
+        defer func() {
+            bp.mutex.Lock()
+            bp.running = false
+            bp.mutex.Unlock()
+        }()
+        // Reconnecting panics when the broker is unreachable; that is a failed probe, not a crash.
+        defer func() {
+            if r := recover(); r != nil {
+                done <- fmt.Errorf("broker unreachable: %v", r)
+            }
+        }()
+        done <- bp.check()
+    }()
+
+    select {
+    case err := <-done:
+        return err
+    case <-ctx.Done():
+        return fmt.Errorf("broker did not answer within %v: %w", bp.timeout, ctx.Err())
+    }
+}
+
+// GetBrokerProbe is the Constructor.
+func GetBrokerProbe(check func() error, timeout time.Duration, retries int) *BrokerProbe {
+    if retries < 0 {
+        retries = 0
+    }
+    return &BrokerProbe{
+        check:   check,
+        timeout: timeout,
+        retries: retries,
+    }
+}
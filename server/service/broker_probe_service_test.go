@@ -0,0 +1,112 @@
+package service
+
+import (
+    "context"
+    "errors"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+// slowChannel is a probe channel on a broker that doesn't answer until 'answer' is closed.
+// Like config.RabbitMQConection.InspectQueue, the check always closes its channel when done.
+type slowChannel struct {
+    answer chan struct{}
+    mutex  sync.Mutex
+    opened int
+    closed int
+}
+
+func (sc *slowChannel) check() error {
+    sc.mutex.Lock()
+    sc.opened++
+    sc.mutex.Unlock()
+    defer func() {
+        sc.mutex.Lock()
+        sc.closed++
+        sc.mutex.Unlock()
+    }()
+
+    <-sc.answer // The passive declare hangs here
+    return nil
+}
+
+func (sc *slowChannel) counts() (opened, closed int) {
+    sc.mutex.Lock()
+    defer sc.mutex.Unlock()
+    return sc.opened, sc.closed
+}
+
+func TestHungBrokerProbeIsDegradedNotHung(t *testing.T) {
+    channel := &slowChannel{answer: make(chan struct{})}
+    probe := GetBrokerProbe(channel.check, 50*time.Millisecond, 2)
+
+    start := time.Now()
+    result := probe.Probe(context.Background())
+    if waited := time.Since(start); waited > time.Second {
+        t.Fatalf("the probe waited %v on a hung broker", waited)
+    }
+    if result.Status != "degraded" || !strings.Contains(result.Error, "did not answer") {
+        t.Errorf("got %+v, want degraded on the timeout", result)
+    }
+
+    // Still stuck: the next health check doesn't pile another channel on the broker.
+    if result := probe.Probe(context.Background()); result.Status != "degraded" {
+        t.Errorf("second probe: got %+v, want degraded", result)
+    }
+    if opened, _ := channel.counts(); opened != 1 {
+        t.Errorf("opened %d probe channel(s) while the first hung, want 1", opened)
+    }
+
+    // Once the broker answers, the stuck channel is closed and probes are fine again.
+    close(channel.answer)
+    waitUntil(t, func() bool {
+        _, closed := channel.counts()
+        return closed == 1
+    })
+    waitUntil(t, func() bool { return probe.Probe(context.Background()).Status == "ok" })
+    if opened, closed := channel.counts(); opened != closed {
+        t.Errorf("%d probe channel(s) opened, %d closed", opened, closed)
+    }
+}
+
+func TestProbeRetriesAFailedAttempt(t *testing.T) {
+    cases := []struct {
+        name     string
+        failures int
+        retries  int
+        want     string
+        attempts int
+    }{
+        {name: "answers first time", failures: 0, retries: 1, want: "ok", attempts: 1},
+        {name: "answers on the retry", failures: 1, retries: 1, want: "ok", attempts: 2},
+        {name: "out of retries", failures: 5, retries: 2, want: "degraded", attempts: 3},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            attempts := 0
+            check := func() error {
+                attempts++
+                if attempts <= tc.failures {
+                    return errors.New("channel/connection is not open")
+                }
+                return nil
+            }
+
+            result := GetBrokerProbe(check, time.Second, tc.retries).Probe(context.Background())
+            if result.Status != tc.want || attempts != tc.attempts {
+                t.Errorf("got %+v after %d attempt(s), want %s after %d", result, attempts, tc.want, tc.attempts)
+            }
+        })
+    }
+}
+
+func TestUnreachableBrokerIsAFailedProbeNotACrash(t *testing.T) {
+    check := func() error { panic("CRITICAL: Failed to connect to RabbitMQ: connection refused") }
+
+    result := GetBrokerProbe(check, time.Second, 0).Probe(context.Background())
+    if result.Status != "degraded" || !strings.Contains(result.Error, "connection refused") {
+        t.Errorf("got %+v, want degraded with the reason", result)
+    }
+}
@@ -0,0 +1,175 @@
+package service
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "sync"
+    "time"
+
+    "github.com/everestp/pizza-shop/logger"
+    "github.com/everestp/pizza-shop/utils"
+    "github.com/gorilla/websocket"
+)
+
+// ErrConnectionClosed is returned once a buffered connection has given up on its client.
+var ErrConnectionClosed = errors.New("websocket connection closed")
+
+// BufferedConnection smooths over brief client stalls.
+// Sends go into a small per-client queue that a single writer goroutine drains, so a slow
+// client holds up its own writer instead of whoever is sending (the processor, a broadcast).
+// A write that fails, including one that hits the write deadline, is fatal: gorilla keeps
+// returning the same error on every later write, and a timed-out frame may be half on the
+// wire, so there is nothing left to retry. The socket is closed, which makes the handler
+// prune the connection like any other disconnect. If the queue stays full for longer than
+// 'window' (the writer is stuck on the client), we give up the same way.
+type BufferedConnection struct {
+    conn      IWebSocketConnection
+    frames    chan queuedFrame // Messages waiting for the writer, oldest first; capacity is the queue size
+    window    time.Duration    // How long the queue may stay full before we give up
+    fullSince time.Time        // Zero while the queue has room
+    closed    bool
+    mutex     sync.Mutex       // Guards everything above and sends on 'frames'
+}
+
+// queuedFrame is a message waiting in the queue, with the kind of frame it goes out as.
+type queuedFrame struct {
+    message []byte
+    binary  bool // Sent with SendBinary instead of SendMessage
+}
+
+// SendMessage queues the message behind any earlier ones; the writer sends it.
+func (bc *BufferedConnection) SendMessage(message []byte) error {
+    return bc.enqueue(queuedFrame{message: message})
+}
+
+// SendBinary is SendMessage for binary frames; both share one queue, so order is kept.
+func (bc *BufferedConnection) SendBinary(message []byte) error {
+    return bc.enqueue(queuedFrame{message: message, binary: true})
+}
+
+// enqueue hands a frame to the writer without waiting for the client.
+// A full queue drops its oldest message, until it has been full for longer than the window.
+func (bc *BufferedConnection) enqueue(frame queuedFrame) error {
+    bc.mutex.Lock()
+    defer bc.mutex.Unlock()
+
+    if bc.closed {
+        return ErrConnectionClosed
+    }
+    select {
+    case bc.frames <- frame:
+        bc.fullSince = time.Time{}
+        return nil
+    default:
+    }
+
+    now := utils.Clock.Now()
+    if bc.fullSince.IsZero() {
+        bc.fullSince = now
+    }
+    if now.Sub(bc.fullSince) > bc.window {
+        logger.Log(fmt.Sprintf("Client still not keeping up after %v, closing connection", bc.window))
+        bc.giveUp(websocket.CloseTryAgainLater, "client too slow")
+        return ErrConnectionClosed
+    }
+    select {
+    case <-bc.frames:
+        logger.Log("Send queue full, dropping the oldest message")
+    default: // The writer just took it
+    }
+    bc.frames <- frame // Room was made above, and only enqueue sends (under the lock)
+    return nil
+}
+
+// write drains the queue in order until the connection is given up on or closes.
+func (bc *BufferedConnection) write() {
+    for {
+        select {
+        case frame, ok := <-bc.frames:
+            if !ok {
+                return
+            }
+            var err error
+            if frame.binary {
+                err = bc.conn.SendBinary(frame.message)
+            } else {
+                err = bc.conn.SendMessage(frame.message)
+            }
+            if err != nil {
+                logger.Log(fmt.Sprintf("Failed to write to client: %v, closing connection", err))
+                bc.mutex.Lock()
+                bc.giveUp(websocket.CloseNormalClosure, "")
+                bc.mutex.Unlock()
+                return
+            }
+        case <-bc.conn.Context().Done():
+            bc.Close()
+            return
+        }
+    }
+}
+
+// giveUp drops the queue, stops the writer and closes the socket with this code and reason.
+// Caller holds the lock.
+func (bc *BufferedConnection) giveUp(code int, reason string) error {
+    if bc.closed {
+        return nil
+    }
+    bc.closed = true
+    close(bc.frames)
+    for range bc.frames {
+    }
+    return CloseWith(bc.conn, code, reason)
+}
+
+func (bc *BufferedConnection) ReceivedMessage() ([]byte, error) {
+    return bc.conn.ReceivedMessage()
+}
+
+func (bc *BufferedConnection) Context() context.Context {
+    return bc.conn.Context()
+}
+
+func (bc *BufferedConnection) Metadata() ConnectionMetadata {
+    return bc.conn.Metadata()
+}
+
+// Ping checks the client directly; queued messages don't wait behind it.
+func (bc *BufferedConnection) Ping() error {
+    bc.mutex.Lock()
+    closed := bc.closed
+    bc.mutex.Unlock()
+
+    if closed {
+        return ErrConnectionClosed
+    }
+    return bc.conn.Ping()
+}
+
+func (bc *BufferedConnection) Close() error {
+    return bc.CloseWith(websocket.CloseNormalClosure, "")
+}
+
+// CloseWith drops whatever is still queued and closes the socket with this code and reason.
+func (bc *BufferedConnection) CloseWith(code int, reason string) error {
+    bc.mutex.Lock()
+    defer bc.mutex.Unlock()
+
+    return bc.giveUp(code, reason)
+}
+
+// NewBufferedConnection is the constructor.
+// The writer goroutine runs until the connection is closed (by us or through its context).
+func NewBufferedConnection(conn IWebSocketConnection, window time.Duration, maxQueue int) *BufferedConnection {
+    if maxQueue < 1 {
+        maxQueue = 1
+    }
+    bc := &BufferedConnection{
+        conn:   conn,
+        window: window,
+        frames: make(chan queuedFrame, maxQueue),
+    }
+    go bc.write()
+    return bc
+}
@@ -0,0 +1,235 @@
+package service
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/everestp/pizza-shop/utils"
+    "github.com/gorilla/websocket"
+)
+
+// stallingSocket is a client whose writes block while it is stalled, until it is unstalled or closed.
+type stallingSocket struct {
+    mutex    sync.Mutex
+    unstall  chan struct{} // Closed when the client is writable again; nil while healthy
+    fail     error         // When set, every write fails with it
+    attempts int
+    sent     []string
+    closed   chan struct{}
+}
+
+func newStallingSocket(stalled bool) *stallingSocket {
+    ss := &stallingSocket{closed: make(chan struct{})}
+    if stalled {
+        ss.unstall = make(chan struct{})
+    }
+    return ss
+}
+
+func (ss *stallingSocket) SendMessage(message []byte) error {
+    ss.mutex.Lock()
+    ss.attempts++
+    unstall, fail := ss.unstall, ss.fail
+    ss.mutex.Unlock()
+
+    if fail != nil {
+        return fail
+    }
+    if unstall != nil {
+        select {
+        case <-unstall:
+        case <-ss.closed:
+            return os.ErrDeadlineExceeded // What the write deadline returns
+        }
+    }
+    ss.mutex.Lock()
+    defer ss.mutex.Unlock()
+    ss.sent = append(ss.sent, string(message))
+    return nil
+}
+func (ss *stallingSocket) SendBinary(message []byte) error  { return ss.SendMessage(message) }
+func (ss *stallingSocket) ReceivedMessage() ([]byte, error) { return nil, nil }
+func (ss *stallingSocket) Ping() error                      { return nil }
+func (ss *stallingSocket) Context() context.Context         { return context.Background() }
+func (ss *stallingSocket) Metadata() ConnectionMetadata     { return ConnectionMetadata{} }
+func (ss *stallingSocket) Close() error {
+    ss.mutex.Lock()
+    defer ss.mutex.Unlock()
+    select {
+    case <-ss.closed:
+    default:
+        close(ss.closed)
+    }
+    return nil
+}
+
+func (ss *stallingSocket) setWritable() {
+    ss.mutex.Lock()
+    defer ss.mutex.Unlock()
+    if ss.unstall != nil {
+        close(ss.unstall)
+    }
+}
+
+func (ss *stallingSocket) snapshot() (sent []string, attempts int, closed bool) {
+    ss.mutex.Lock()
+    defer ss.mutex.Unlock()
+    select {
+    case <-ss.closed:
+        closed = true
+    default:
+    }
+    return append([]string(nil), ss.sent...), ss.attempts, closed
+}
+
+// waitForAttempts waits until the writer has tried 'n' writes.
+func (ss *stallingSocket) waitForAttempts(t *testing.T, n int) {
+    t.Helper()
+    waitUntil(t, func() bool {
+        _, attempts, _ := ss.snapshot()
+        return attempts >= n
+    })
+}
+
+func TestSendsDoNotWaitForAStalledClient(t *testing.T) {
+    socket := newStallingSocket(true)
+    buffered := NewBufferedConnection(socket, time.Hour, 10)
+    t.Cleanup(func() { buffered.Close() })
+
+    for _, message := range []string{"first", "second", "third"} {
+        if err := buffered.SendMessage([]byte(message)); err != nil {
+            t.Fatalf("a send to a stalled client failed: %v", err)
+        }
+    }
+    socket.setWritable()
+
+    // The writer catches up on its own, in order, without a new message coming in.
+    waitUntil(t, func() bool {
+        sent, _, _ := socket.snapshot()
+        return len(sent) == 3
+    })
+    if sent, _, closed := socket.snapshot(); strings.Join(sent, ",") != "first,second,third" || closed {
+        t.Errorf("sent %q (closed %v), want first, second, third on an open socket", sent, closed)
+    }
+}
+
+func TestFailedWriteIsNotRetried(t *testing.T) {
+    socket := newStallingSocket(false)
+    socket.fail = os.ErrDeadlineExceeded // Even a timeout: gorilla returns it again for every later write
+    buffered := NewBufferedConnection(socket, time.Hour, 10)
+
+    buffered.SendMessage([]byte("lost"))
+    buffered.SendMessage([]byte("also lost"))
+    waitUntil(t, func() bool {
+        _, _, closed := socket.snapshot()
+        return closed
+    })
+    if _, attempts, _ := socket.snapshot(); attempts != 1 {
+        t.Errorf("%d writes attempted, want 1: a failed write closes the client", attempts)
+    }
+    if err := buffered.SendMessage([]byte("after")); !errors.Is(err, ErrConnectionClosed) {
+        t.Errorf("got %v, want ErrConnectionClosed once the client was given up on", err)
+    }
+}
+
+func TestFullSendQueueDropsTheOldest(t *testing.T) {
+    socket := newStallingSocket(true)
+    buffered := NewBufferedConnection(socket, time.Hour, 2)
+    t.Cleanup(func() { buffered.Close() })
+
+    buffered.SendMessage([]byte("1"))
+    socket.waitForAttempts(t, 1) // The writer is stuck on "1"; the queue holds the rest
+    for _, message := range []string{"2", "3", "4"} {
+        buffered.SendMessage([]byte(message))
+    }
+    socket.setWritable()
+
+    waitUntil(t, func() bool {
+        sent, _, _ := socket.snapshot()
+        return len(sent) == 3
+    })
+    if sent, _, _ := socket.snapshot(); strings.Join(sent, ",") != "1,3,4" {
+        t.Errorf("sent %q, want the one being written and the 2 newest", sent)
+    }
+}
+
+func TestClientThatStaysBehindIsPruned(t *testing.T) {
+    clock := &manualClock{now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+    utils.Clock = clock
+    t.Cleanup(func() { utils.Clock = utils.RealClock{} })
+
+    socket := newStallingSocket(true)
+    buffered := NewBufferedConnection(socket, time.Second, 1)
+
+    buffered.SendMessage([]byte("1"))
+    socket.waitForAttempts(t, 1)
+    buffered.SendMessage([]byte("2")) // Fills the queue
+    if err := buffered.SendMessage([]byte("3")); err != nil {
+        t.Fatalf("a queue that just filled up gave up: %v", err)
+    }
+
+    clock.now = clock.now.Add(2 * time.Second)
+    if err := buffered.SendMessage([]byte("4")); !errors.Is(err, ErrConnectionClosed) {
+        t.Errorf("got %v, want ErrConnectionClosed once the queue was full for longer than the window", err)
+    }
+    if _, _, closed := socket.snapshot(); !closed {
+        t.Error("the stalled socket was left open")
+    }
+}
+
+// dialStalledClient connects to a server that upgrades the socket and then never reads from it,
+// like a browser tab that stopped draining its socket.
+func dialStalledClient(t *testing.T) *websocket.Conn {
+    t.Helper()
+
+    release := make(chan struct{})
+    upgrader := websocket.Upgrader{}
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        conn, err := upgrader.Upgrade(w, r, nil)
+        if err != nil {
+            return
+        }
+        defer conn.Close()
+        <-release
+    }))
+    t.Cleanup(server.Close)
+    t.Cleanup(func() { close(release) })
+
+    conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+    if err != nil {
+        t.Fatalf("dial: %v", err)
+    }
+    return conn
+}
+
+func TestWriteTimeoutOnARealSocketClosesIt(t *testing.T) {
+    withEnv(t, map[string]string{"WS_WRITE_TIMEOUT_MS": "50"})
+    ws := NewWebSocketConnection(context.Background(), dialStalledClient(t), ConnectionMetadata{})
+    buffered := NewBufferedConnection(ws, time.Hour, 4)
+
+    // Keep sending until the kernel buffers fill, a write hits its deadline and the socket is closed.
+    payload := []byte(strings.Repeat("x", 256*1024))
+    deadline := time.Now().Add(5 * time.Second)
+    for buffered.SendMessage(payload) == nil {
+        if time.Now().After(deadline) {
+            t.Fatal("a client that never reads was never given up on")
+        }
+        time.Sleep(time.Millisecond)
+    }
+
+    select {
+    case <-ws.Context().Done():
+    default:
+        t.Error("the connection was not closed after its write timed out")
+    }
+    if err := buffered.SendMessage([]byte("after")); !errors.Is(err, ErrConnectionClosed) {
+        t.Errorf("got %v, want ErrConnectionClosed after the timeout", err)
+    }
+}
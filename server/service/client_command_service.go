@@ -0,0 +1,57 @@
+package service
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+)
+
+// The actions a WebSocket client may send.
+const (
+    ActionSubscribe   = "subscribe"   // {"action":"subscribe","order_no":"A1"}
+    ActionUnsubscribe = "unsubscribe" // {"action":"unsubscribe","order_no":"A1"}
+    ActionAckPickup   = "ack_pickup"  // {"action":"ack_pickup","order_no":"A1"}
+    ActionResubscribe = "resubscribe" // {"action":"resubscribe","order_nos":["A1","B2"],"replay":true}
+    ActionAckMessage  = "ack"         // {"action":"ack","message_id":"9f86d081884c7d65"} (delivery receipt)
+)
+
+// ErrInvalidCommand is returned for anything the client sent that we can't act on.
+var ErrInvalidCommand = errors.New("invalid client command")
+
+// ClientCommand is one message from the browser. "action" says which kind it is;
+// the other fields are only required by the actions that use them.
+type ClientCommand struct {
+    Action    string   `json:"action"`
+    OrderNo   string   `json:"order_no,omitempty"`
+    OrderNos  []string `json:"order_nos,omitempty"`
+    Replay    bool     `json:"replay,omitempty"`     // resubscribe: also send each order's current status
+    MessageID string   `json:"message_id,omitempty"` // ack: the "message_id" of the update being confirmed
+}
+
+// ParseClientCommand decodes a client message and checks it has what its action needs.
+func ParseClientCommand(data []byte) (ClientCommand, error) {
+    var cmd ClientCommand
+    if err := json.Unmarshal(data, &cmd); err != nil {
+        return ClientCommand{}, fmt.Errorf("%w: message is not valid JSON", ErrInvalidCommand)
+    }
+
+    switch cmd.Action {
+    case ActionSubscribe, ActionUnsubscribe, ActionAckPickup:
+        if cmd.OrderNo == "" {
+            return ClientCommand{}, fmt.Errorf("%w: %q requires \"order_no\"", ErrInvalidCommand, cmd.Action)
+        }
+    case ActionResubscribe:
+        if len(cmd.OrderNos) == 0 {
+            return ClientCommand{}, fmt.Errorf("%w: %q requires \"order_nos\"", ErrInvalidCommand, cmd.Action)
+        }
+    case ActionAckMessage:
+        if cmd.MessageID == "" {
+            return ClientCommand{}, fmt.Errorf("%w: %q requires \"message_id\"", ErrInvalidCommand, cmd.Action)
+        }
+    case "":
+        return ClientCommand{}, fmt.Errorf("%w: missing \"action\"", ErrInvalidCommand)
+    default:
+        return ClientCommand{}, fmt.Errorf("%w: unknown action %q", ErrInvalidCommand, cmd.Action)
+    }
+    return cmd, nil
+}
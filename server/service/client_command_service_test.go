@@ -0,0 +1,50 @@
+package service
+
+import (
+    "errors"
+    "testing"
+)
+
+func TestParseClientCommand(t *testing.T) {
+    cases := []struct {
+        name    string
+        data    string
+        want    ClientCommand
+        wantErr bool
+    }{
+        {name: "subscribe", data: `{"action":"subscribe","order_no":"A1"}`, want: ClientCommand{Action: ActionSubscribe, OrderNo: "A1"}},
+        {name: "unsubscribe", data: `{"action":"unsubscribe","order_no":"A1"}`, want: ClientCommand{Action: ActionUnsubscribe, OrderNo: "A1"}},
+        {name: "ack_pickup", data: `{"action":"ack_pickup","order_no":"A1"}`, want: ClientCommand{Action: ActionAckPickup, OrderNo: "A1"}},
+        {name: "resubscribe", data: `{"action":"resubscribe","order_nos":["A1","B2"],"replay":true}`, want: ClientCommand{Action: ActionResubscribe, OrderNos: []string{"A1", "B2"}, Replay: true}},
+        {name: "ack", data: `{"action":"ack","message_id":"m1"}`, want: ClientCommand{Action: ActionAckMessage, MessageID: "m1"}},
+        {name: "subscribe without order_no", data: `{"action":"subscribe"}`, wantErr: true},
+        {name: "resubscribe without order_nos", data: `{"action":"resubscribe","order_nos":[]}`, wantErr: true},
+        {name: "ack without message_id", data: `{"action":"ack"}`, wantErr: true},
+        {name: "missing action", data: `{"order_no":"A1"}`, wantErr: true},
+        {name: "unknown action", data: `{"action":"teleport","order_no":"A1"}`, wantErr: true},
+        {name: "not json", data: `subscribe A1`, wantErr: true},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            got, err := ParseClientCommand([]byte(tc.data))
+            if tc.wantErr {
+                if !errors.Is(err, ErrInvalidCommand) {
+                    t.Fatalf("got %+v, %v; want ErrInvalidCommand", got, err)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatalf("unexpected error: %v", err)
+            }
+            if got.Action != tc.want.Action || got.OrderNo != tc.want.OrderNo || got.Replay != tc.want.Replay ||
+                got.MessageID != tc.want.MessageID || len(got.OrderNos) != len(tc.want.OrderNos) {
+                t.Fatalf("got %+v, want %+v", got, tc.want)
+            }
+            for index := range got.OrderNos {
+                if got.OrderNos[index] != tc.want.OrderNos[index] {
+                    t.Fatalf("order_nos: got %v, want %v", got.OrderNos, tc.want.OrderNos)
+                }
+            }
+        })
+    }
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+    "errors"
+    "fmt"
+    "sync"
+    "time"
+
+    "github.com/everestp/pizza-shop/config"
+    "github.com/everestp/pizza-shop/logger"
+)
+
+// ConsumerBreaker is a circuit breaker for the consumers. When every message fails
+// (e.g. a dependency is down), retrying at full speed only hammers it and spins the
+// queue, so after CONSUMER_BREAKER_THRESHOLD failures in a row (0 = off) consuming
+// pauses for CONSUMER_BREAKER_COOLDOWN_SECONDS, then resumes with a clean slate.
+// Illegal transitions don't count: they are bad messages, not a broken kitchen.
+type ConsumerBreaker struct {
+    threshold int
+    cooldown  time.Duration
+    failures  int           // Consecutive failures so far
+    trips     int           // How many times we have paused
+    openUntil time.Time     // Zero while consuming normally
+    resumed   chan struct{} // Closed when the current pause ends (nil while not paused)
+    mutex     sync.Mutex
+}
+
+// BreakerState is what /health reports about a consumer.
+type BreakerState struct {
+    State               string     `json:"state"` // "consuming" or "paused"
+    ConsecutiveFailures int        `json:"consecutive_failures"`
+    Threshold           int        `json:"threshold"` // 0 = the breaker is off
+    PausedUntil         *time.Time `json:"paused_until,omitempty"`
+    Trips               int        `json:"trips"`
+}
+
+// Record notes how a message went. It returns true when this failure paused consuming;
+// the caller then stops taking messages until Wait returns.
+func (cb *ConsumerBreaker) Record(err error) bool {
+    if cb == nil || cb.threshold < 1 {
+        return false
+    }
+
+    cb.mutex.Lock()
+    defer cb.mutex.Unlock()
+
+    if err == nil {
+        cb.failures = 0
+        return false
+    }
+    if errors.Is(err, ErrInvalidTransition) {
+        return false
+    }
+    if cb.resumed != nil {
+        return false // Already paused: the messages still in the oven don't count twice
+    }
+
+    cb.failures++
+    if cb.failures < cb.threshold {
+        return false
+    }
+
+    cb.trips++
+    cb.openUntil = time.Now().Add(cb.cooldown)
+    resumed := make(chan struct{})
+    cb.resumed = resumed
+    logger.Log(fmt.Sprintf("CRITICAL: %d messages failed in a row, pausing consumption for %v", cb.failures, cb.cooldown))
+
+    time.AfterFunc(cb.cooldown, func() {
+        cb.mutex.Lock()
+        defer cb.mutex.Unlock()
+
+        cb.failures = 0
+        cb.openUntil = time.Time{}
+        cb.resumed = nil
+        close(resumed)
+        logger.Log("Consumer cooldown over, resuming consumption")
+    })
+    return true
+}
+
+// Wait blocks while consuming is paused, or until 'stop' is closed.
+func (cb *ConsumerBreaker) Wait(stop <-chan struct{}) {
+    if cb == nil {
+        return
+    }
+
+    cb.mutex.Lock()
+    resumed := cb.resumed
+    cb.mutex.Unlock()
+
+    if resumed == nil {
+        return
+    }
+    select {
+    case <-resumed:
+    case <-stop:
+    }
+}
+
+// Paused reports whether consuming is paused right now.
+func (cb *ConsumerBreaker) Paused() bool {
+    if cb == nil {
+        return false
+    }
+
+    cb.mutex.Lock()
+    defer cb.mutex.Unlock()
+
+    return cb.resumed != nil
+}
+
+// State reports the breaker for the health check.
+func (cb *ConsumerBreaker) State() BreakerState {
+    if cb == nil {
+        return BreakerState{State: "consuming"}
+    }
+
+    cb.mutex.Lock()
+    defer cb.mutex.Unlock()
+
+    state := BreakerState{
+        State:               "consuming",
+        ConsecutiveFailures: cb.failures,
+        Threshold:           cb.threshold,
+        Trips:               cb.trips,
+    }
+    if cb.resumed != nil {
+        until := cb.openUntil
+        state.State = "paused"
+        state.PausedUntil = &until
+    }
+    return state
+}
+
+// newConsumerBreaker reads CONSUMER_BREAKER_THRESHOLD (default 0 = off) and
+// CONSUMER_BREAKER_COOLDOWN_SECONDS (default 30).
+func newConsumerBreaker() *ConsumerBreaker {
+    return GetConsumerBreaker(config.GetEnvPropertyAsInt("consumer_breaker_threshold", 0),
+        time.Duration(config.GetEnvPropertyAsInt("consumer_breaker_cooldown", 30))*time.Second)
+}
+
+// GetConsumerBreaker is the Constructor. threshold < 1 turns the breaker off.
+func GetConsumerBreaker(threshold int, cooldown time.Duration) *ConsumerBreaker {
+    return &ConsumerBreaker{
+        threshold: threshold,
+        cooldown:  cooldown,
+    }
+}
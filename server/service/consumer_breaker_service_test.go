@@ -0,0 +1,115 @@
+package service
+
+import (
+    "errors"
+    "fmt"
+    "testing"
+    "time"
+)
+
+func TestBreakerTripsOnlyOnConsecutiveFailures(t *testing.T) {
+    cb := GetConsumerBreaker(3, time.Hour)
+    failed := errors.New("kitchen printer is down")
+
+    cb.Record(failed)
+    cb.Record(failed)
+    cb.Record(nil) // A success starts the count again
+    cb.Record(failed)
+    cb.Record(fmt.Errorf("order A1: %w", ErrInvalidTransition)) // A bad message, not a broken kitchen
+    if cb.Record(failed) || cb.Paused() {
+        t.Fatalf("paused after 2 failures in a row: %+v", cb.State())
+    }
+    if !cb.Record(failed) {
+        t.Fatal("the third failure in a row didn't pause consuming")
+    }
+    if cb.Record(failed) {
+        t.Error("a failure during the pause paused it again")
+    }
+
+    state := cb.State()
+    if state.State != "paused" || state.Trips != 1 || state.PausedUntil == nil {
+        t.Errorf("got %+v, want paused once", state)
+    }
+}
+
+func TestBreakerResumesAfterTheCooldown(t *testing.T) {
+    cb := GetConsumerBreaker(1, 50*time.Millisecond)
+    cb.Record(errors.New("boom"))
+
+    waited := make(chan struct{})
+    go func() {
+        defer close(waited)
+        cb.Wait(nil)
+    }()
+    select {
+    case <-waited:
+    case <-time.After(time.Second):
+        t.Fatal("Wait was still blocked long after the cooldown")
+    }
+    if state := cb.State(); state.State != "consuming" || state.ConsecutiveFailures != 0 || state.PausedUntil != nil {
+        t.Errorf("got %+v, want consuming with a clean slate", state)
+    }
+}
+
+func TestBreakerWaitGivesUpOnStop(t *testing.T) {
+    cb := GetConsumerBreaker(1, time.Hour)
+    cb.Record(errors.New("boom"))
+
+    stop := make(chan struct{})
+    waited := make(chan struct{})
+    go func() {
+        defer close(waited)
+        cb.Wait(stop)
+    }()
+    close(stop)
+    select {
+    case <-waited:
+    case <-time.After(time.Second):
+        t.Fatal("Wait ignored the stop")
+    }
+}
+
+func TestBreakerOffByDefault(t *testing.T) {
+    withEnv(t, map[string]string{"CONSUMER_BREAKER_THRESHOLD": ""})
+
+    cb := newConsumerBreaker()
+    for i := 0; i < 100; i++ {
+        if cb.Record(errors.New("boom")) {
+            t.Fatal("a breaker with no threshold paused consuming")
+        }
+    }
+    var none *ConsumerBreaker
+    if none.Record(errors.New("boom")) || none.State().State != "consuming" {
+        t.Error("a nil breaker must never pause")
+    }
+}
+
+func TestConsumerPausesAfterRepeatedFailuresAndResumes(t *testing.T) {
+    f := startConsumerWith(t, "kitchen", func(f *consumerFixture) {
+        f.consumer.breaker = GetConsumerBreaker(2, 200*time.Millisecond)
+        f.processor.failOn = "burnt"
+    })
+    channel := f.broker.channels[0]
+
+    f.broker.deliver(f.tag, 1, channel, []byte("burnt"))
+    f.broker.deliver(f.tag, 2, channel, []byte("burnt"))
+
+    // Paused: the subscription is cancelled, so the broker stops sending.
+    waitUntil(t, func() bool {
+        f.broker.mutex.Lock()
+        defer f.broker.mutex.Unlock()
+        _, subscribed := f.broker.consumers[f.tag]
+        return !subscribed
+    })
+    if state := f.consumer.Breaker(); state.State != "paused" || state.Trips != 1 {
+        t.Fatalf("got %+v, want paused", state)
+    }
+
+    // After the cooldown it subscribes again and takes messages as before.
+    resumed := f.subscribed(t)
+    if state := f.consumer.Breaker(); state.State != "consuming" || state.ConsecutiveFailures != 0 {
+        t.Errorf("after the cooldown: got %+v, want consuming", state)
+    }
+    f.broker.deliver(f.tag, 3, resumed, []byte("margherita"))
+    f.expectProcessed(t, "margherita")
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+    "fmt"
+    "sync"
+    "time"
+
+    "github.com/everestp/pizza-shop/logger"
+)
+
+// IReceiptConnection is a socket that can ask the client to confirm it got a message.
+type IReceiptConnection interface {
+    IWebSocketConnection
+    // SendWithReceipt sends a frame carrying 'messageId' and waits for the client's ack;
+    // without one within the receipt window, the frame is sent once more.
+    SendWithReceipt(messageId string, message []byte) error
+    // Acknowledge records the client's {"action":"ack","message_id":"..."}.
+    // It returns false for an ID we aren't waiting on (unknown, already acked or already re-sent).
+    Acknowledge(messageId string) bool
+}
+
+// ReceiptConnection adds delivery receipts to a customer socket (WS_DELIVERY_RECEIPTS=true).
+// Important updates (e.g. "your order is ready") carry a "message_id"; if the client doesn't
+// ack it within WS_RECEIPT_WINDOW_MS (default 5000), it is re-sent ONCE and then forgotten.
+// At most WS_RECEIPT_MAX_PENDING (default 32) receipts are awaited; the oldest go first.
+type ReceiptConnection struct {
+    IWebSocketConnection
+    window     time.Duration
+    maxPending int
+    pending    map[string]pendingReceipt // Message ID -> the frame waiting for its ack
+    mutex      sync.Mutex                // Guards 'pending'
+}
+
+// pendingReceipt is a frame the client hasn't confirmed yet.
+type pendingReceipt struct {
+    message []byte
+    sentAt  time.Time
+}
+
+// SendWithReceipt sends the frame and starts waiting for its ack.
+func (rc *ReceiptConnection) SendWithReceipt(messageId string, message []byte) error {
+    if err := rc.SendMessage(message); err != nil {
+        return err
+    }
+
+    rc.mutex.Lock()
+    if len(rc.pending) >= rc.maxPending {
+        rc.dropOldest()
+    }
+    rc.pending[messageId] = pendingReceipt{message: message, sentAt: time.Now()}
+    rc.mutex.Unlock()
+
+    time.AfterFunc(rc.window, func() { rc.resend(messageId) })
+    return nil
+}
+
+// Acknowledge stops waiting for a message.
+func (rc *ReceiptConnection) Acknowledge(messageId string) bool {
+    rc.mutex.Lock()
+    defer rc.mutex.Unlock()
+
+    _, ok := rc.pending[messageId]
+    delete(rc.pending, messageId)
+    return ok
+}
+
+// resend sends an unacknowledged frame a second (and last) time.
+func (rc *ReceiptConnection) resend(messageId string) {
+    rc.mutex.Lock()
+    receipt, ok := rc.pending[messageId]
+    delete(rc.pending, messageId)
+    rc.mutex.Unlock()
+
+    if !ok || rc.Context().Err() != nil {
+        return // Acked in time, or the client is gone
+    }
+    logger.Log(fmt.Sprintf("No receipt for message %s after %v, sending it again", messageId, rc.window))
+    if err := rc.SendMessage(receipt.message); err != nil {
+        logger.Log(fmt.Sprintf("Failed to re-send message %s: %v", messageId, err))
+    }
+}
+
+// dropOldest forgets the receipt we have waited on the longest. Caller holds the lock.
+func (rc *ReceiptConnection) dropOldest() {
+    oldestId := ""
+    var oldest time.Time
+    for id, receipt := range rc.pending {
+        if oldestId == "" || receipt.sentAt.Before(oldest) {
+            oldestId, oldest = id, receipt.sentAt
+        }
+    }
+    logger.Log(fmt.Sprintf("Too many unacknowledged messages, no longer waiting on %s", oldestId))
+    delete(rc.pending, oldestId)
+}
+
+// CloseWith passes the close code and reason on to the wrapped connection.
+func (rc *ReceiptConnection) CloseWith(code int, reason string) error {
+    return CloseWith(rc.IWebSocketConnection, code, reason)
+}
+
+// NewReceiptConnection is the constructor.
+func NewReceiptConnection(conn IWebSocketConnection, window time.Duration, maxPending int) *ReceiptConnection {
+    if maxPending < 1 {
+        maxPending = 1
+    }
+    return &ReceiptConnection{
+        IWebSocketConnection: conn,
+        window:               window,
+        maxPending:           maxPending,
+        pending:              make(map[string]pendingReceipt),
+    }
+}
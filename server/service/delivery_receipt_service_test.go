@@ -0,0 +1,130 @@
+package service
+
+import (
+    "context"
+    "encoding/json"
+    "testing"
+    "time"
+
+    "github.com/everestp/pizza-shop/constants"
+    "github.com/rabbitmq/amqp091-go"
+)
+
+// expectFrame waits for the next frame sent to the customer.
+func expectFrame(t *testing.T, cs *customerSocket, want string) {
+    t.Helper()
+
+    select {
+    case frame := <-cs.frames:
+        if string(frame) != want {
+            t.Fatalf("got %s, want %s", frame, want)
+        }
+    case <-time.After(time.Second):
+        t.Fatalf("%s never arrived", want)
+    }
+}
+
+// expectNoFrame fails the test if the customer is sent anything within 'wait'.
+func expectNoFrame(t *testing.T, cs *customerSocket, wait time.Duration) {
+    t.Helper()
+
+    select {
+    case frame := <-cs.frames:
+        t.Fatalf("unexpected frame: %s", frame)
+    case <-time.After(wait):
+    }
+}
+
+func TestUnackedMessageIsResentOnce(t *testing.T) {
+    alice := &customerSocket{frames: make(chan []byte, 10)}
+    rc := NewReceiptConnection(alice, 20*time.Millisecond, 32)
+
+    if err := rc.SendWithReceipt("m1", []byte(`{"message_id":"m1"}`)); err != nil {
+        t.Fatalf("send: %v", err)
+    }
+    expectFrame(t, alice, `{"message_id":"m1"}`)
+    expectFrame(t, alice, `{"message_id":"m1"}`) // The re-send, after the window
+    expectNoFrame(t, alice, 100*time.Millisecond)
+
+    if rc.Acknowledge("m1") {
+        t.Error("an ack after the re-send was still awaited")
+    }
+}
+
+func TestAckedMessageIsNotResent(t *testing.T) {
+    alice := &customerSocket{frames: make(chan []byte, 10)}
+    rc := NewReceiptConnection(alice, 20*time.Millisecond, 32)
+
+    rc.SendWithReceipt("m1", []byte(`{"message_id":"m1"}`))
+    expectFrame(t, alice, `{"message_id":"m1"}`)
+    if !rc.Acknowledge("m1") {
+        t.Fatal("the ack was for a message we weren't waiting on")
+    }
+    expectNoFrame(t, alice, 100*time.Millisecond)
+
+    if rc.Acknowledge("m1") || rc.Acknowledge("never-sent") {
+        t.Error("acks of unknown or already acked messages were accepted")
+    }
+}
+
+func TestPendingReceiptsAreBounded(t *testing.T) {
+    alice := &customerSocket{frames: make(chan []byte, 10)}
+    rc := NewReceiptConnection(alice, 50*time.Millisecond, 2)
+
+    for _, id := range []string{"m1", "m2", "m3"} {
+        rc.SendWithReceipt(id, []byte(id))
+        expectFrame(t, alice, id)
+        time.Sleep(time.Millisecond) // Distinct send times, so "oldest" is m1
+    }
+    if rc.Acknowledge("m1") {
+        t.Error("m1 is still awaited past WS_RECEIPT_MAX_PENDING")
+    }
+
+    // Only the two still awaited are re-sent.
+    resent := map[string]bool{}
+    for i := 0; i < 2; i++ {
+        select {
+        case frame := <-alice.frames:
+            resent[string(frame)] = true
+        case <-time.After(time.Second):
+            t.Fatalf("re-sent only %v", resent)
+        }
+    }
+    if !resent["m2"] || !resent["m3"] {
+        t.Errorf("re-sent %v, want m2 and m3", resent)
+    }
+    expectNoFrame(t, alice, 100*time.Millisecond)
+}
+
+func TestReadyUpdateAsksForAReceipt(t *testing.T) {
+    alice := &customerSocket{frames: make(chan []byte, 10)}
+    rc := NewReceiptConnection(alice, time.Hour, 32)
+    store := GetOrderStore()
+    store.Save(Order{OrderNo: "A1", OwnerID: "alice", Status: constants.ORDER_PREPARED})
+    online := func(clientId string) IWebSocketConnection { return rc }
+    processor := GetMessageProcessorService(GetMemoryPublisher(GetMemoryBroker(10)), online, GetOrderStatusValidator(), store,
+        GetKitchenMetrics(), ProcessorOptions{})
+
+    err := processor.ProcessMessage(context.Background(), amqp091.Delivery{
+        Acknowledger: &settlements{},
+        Body:         orderEvent(t, "A1", constants.ORDER_PREPARED),
+    })
+    if err != nil {
+        t.Fatalf("process: %v", err)
+    }
+
+    var update map[string]any
+    select {
+    case frame := <-alice.frames:
+        json.Unmarshal(frame, &update)
+    case <-time.After(time.Second):
+        t.Fatal("no ready update")
+    }
+    messageId, _ := update["message_id"].(string)
+    if update["message"] != constants.ORDER_PREPARED_SUCCESSFULLY || messageId == "" {
+        t.Fatalf("got %v, want the ready update with a message_id", update)
+    }
+    if !rc.Acknowledge(messageId) {
+        t.Errorf("the ready update's receipt for %s isn't awaited", messageId)
+    }
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "time"
+
+    "github.com/everestp/pizza-shop/constants"
+    "github.com/everestp/pizza-shop/logger"
+    "github.com/everestp/pizza-shop/utils"
+    "github.com/rabbitmq/amqp091-go"
+)
+
+// RetryCountHeader counts how many times a message has been given another chance.
+const RetryCountHeader = "x-retry-count"
+
+// RetryCount reads the retry header; a message without one has never been retried.
+func RetryCount(headers amqp091.Table) int {
+    switch count := headers[RetryCountHeader].(type) {
+    case int:
+        return count
+    case int32:
+        return int(count)
+    case int64:
+        return int(count)
+    }
+    return 0
+}
+
+// DLQReprocessor consumes a queue's dead-letter queue. Each message waits 'delay'
+// and is then re-published to the main queue, so a transient failure gets a second
+// chance without hot-looping. After 'maxAttempts' chances it is parked for good
+// (moved to the parked queue, where a human can look at it).
+//
+// It is an IMessageProcessor, so it runs on a normal consumer. Use a consumer of
+// its own: the delay keeps a worker busy.
+type DLQReprocessor struct {
+    publisher   IMessagePubliser
+    mainQueue   string        // Where the second chance goes, e.g. "kitchen"
+    parkedQueue string        // Where hopeless messages end up, e.g. "kitchen.parked"
+    delay       time.Duration // Wait before re-publishing
+    maxAttempts int           // Re-publishes allowed before parking
+    autoAck     bool          // The consumer already acked for us
+}
+
+func (dr *DLQReprocessor) ProcessMessage(ctx context.Context, message interface{}) error {
+    msg, ok := message.(amqp091.Delivery)
+    if !ok {
+        return fmt.Errorf("unsupported message type %T: expected amqp091.Delivery", message)
+    }
+    attempts := RetryCount(msg.Headers)
+
+    target := dr.mainQueue
+    if attempts >= dr.maxAttempts {
+        logger.Log(fmt.Sprintf("Parking message for order #%v after %d attempt(s)", orderNoFromBody(msg.Body), attempts))
+        target = dr.parkedQueue
+    } else {
+        utils.Clock.Sleep(dr.delay)
+        logger.Log(fmt.Sprintf("Re-publishing order #%v to %q (attempt %d of %d)", orderNoFromBody(msg.Body), dr.mainQueue, attempts+1, dr.maxAttempts))
+    }
+
+    err := dr.publisher.PublishEventWithOptions(PublishOptions{
+        RoutingKey: target,
+        Headers:    amqp091.Table{RetryCountHeader: int64(attempts + 1)},
+        Context:    ctx,
+        MessageId:  msg.MessageId, // It was never processed, so the same ID is fine
+    }, json.RawMessage(msg.Body))
+    if err != nil {
+        // Keep it in the DLQ and try again later.
+        if !dr.autoAck {
+            msg.Nack(false, true)
+        }
+        return fmt.Errorf("failed to move dead-lettered message to %q: %w", target, err)
+    }
+    if !dr.autoAck {
+        msg.Ack(false)
+    }
+    return nil
+}
+
+// GetDLQReprocessor is the Constructor.
+func GetDLQReprocessor(publisher IMessagePubliser, mainQueue string, delay time.Duration, maxAttempts int, autoAck bool) *DLQReprocessor {
+    return &DLQReprocessor{
+        publisher:   publisher,
+        mainQueue:   mainQueue,
+        parkedQueue: ParkedQueueName(mainQueue),
+        delay:       delay,
+        maxAttempts: maxAttempts,
+        autoAck:     autoAck,
+    }
+}
+
+// DeadLetterQueueName is the DLQ for a queue, e.g. "kitchen.dlq".
+func DeadLetterQueueName(queueName string) string {
+    return queueName + constants.DEAD_LETTER_QUEUE_SUFFIX
+}
+
+// ParkedQueueName is where a queue's messages go once they run out of retries.
+func ParkedQueueName(queueName string) string {
+    return queueName + constants.PARKED_QUEUE_SUFFIX
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+    "context"
+    "testing"
+    "time"
+
+    "github.com/everestp/pizza-shop/constants"
+    "github.com/everestp/pizza-shop/utils"
+    "github.com/rabbitmq/amqp091-go"
+)
+
+// take returns the next message waiting on an in-memory queue (nil if there is none).
+func take(broker *MemoryBroker, queueName string) *amqp091.Delivery {
+    select {
+    case msg := <-broker.queue(queueName):
+        return &msg
+    default:
+        return nil
+    }
+}
+
+func deadLettered(attempts int, settled *settlements) amqp091.Delivery {
+    delivery := amqp091.Delivery{Acknowledger: settled, MessageId: "A1:ordered", Body: []byte(`{"order_no":"A1"}`)}
+    if attempts > 0 {
+        delivery.Headers = amqp091.Table{RetryCountHeader: int64(attempts)}
+    }
+    return delivery
+}
+
+func TestDeadLetteredMessageGoesBackAfterTheDelay(t *testing.T) {
+    clock := &sleepingClock{now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+    utils.Clock = clock
+    t.Cleanup(func() { utils.Clock = utils.RealClock{} })
+    broker := GetMemoryBroker(10)
+    reprocessor := GetDLQReprocessor(GetMemoryPublisher(broker), constants.KITCHEN_ORDER_QUEUE, 30*time.Second, 3, false)
+    settled := &settlements{}
+
+    start := clock.now
+    if err := reprocessor.ProcessMessage(context.Background(), deadLettered(1, settled)); err != nil {
+        t.Fatalf("reprocess: %v", err)
+    }
+    if waited := clock.now.Sub(start); waited != 30*time.Second {
+        t.Errorf("waited %v, want the 30s delay", waited)
+    }
+    retried := take(broker, constants.KITCHEN_ORDER_QUEUE)
+    if retried == nil || RetryCount(retried.Headers) != 2 || retried.MessageId != "A1:ordered" || string(retried.Body) != `{"order_no":"A1"}` {
+        t.Fatalf("main queue got %+v, want the same message with its retry count at 2", retried)
+    }
+    if settled.acks != 1 {
+        t.Errorf("settled %+v, want the DLQ copy acked", settled)
+    }
+}
+
+func TestMessageOutOfAttemptsIsParkedAtOnce(t *testing.T) {
+    clock := &sleepingClock{}
+    utils.Clock = clock
+    t.Cleanup(func() { utils.Clock = utils.RealClock{} })
+    broker := GetMemoryBroker(10)
+    reprocessor := GetDLQReprocessor(GetMemoryPublisher(broker), constants.KITCHEN_ORDER_QUEUE, 30*time.Second, 3, false)
+
+    if err := reprocessor.ProcessMessage(context.Background(), deadLettered(3, &settlements{})); err != nil {
+        t.Fatalf("reprocess: %v", err)
+    }
+    if !clock.now.IsZero() {
+        t.Error("a message that is being parked waited for the delay")
+    }
+    if take(broker, constants.KITCHEN_ORDER_QUEUE) != nil {
+        t.Error("an exhausted message went back to the kitchen")
+    }
+    if parked := take(broker, ParkedQueueName(constants.KITCHEN_ORDER_QUEUE)); parked == nil {
+        t.Error("the exhausted message was not parked")
+    }
+}
+
+func TestFailedMoveLeavesTheMessageInTheDLQ(t *testing.T) {
+    utils.Clock = &sleepingClock{}
+    t.Cleanup(func() { utils.Clock = utils.RealClock{} })
+    broker := GetMemoryBroker(1)
+    publisher := GetMemoryPublisher(broker)
+    publisher.PublishEvent(constants.KITCHEN_ORDER_QUEUE, map[string]any{}) // The main queue is full
+    reprocessor := GetDLQReprocessor(publisher, constants.KITCHEN_ORDER_QUEUE, time.Second, 3, false)
+    settled := &settlements{}
+
+    if err := reprocessor.ProcessMessage(context.Background(), deadLettered(0, settled)); err == nil {
+        t.Fatal("got no error for a failed re-publish")
+    }
+    if settled.requeues != 1 || settled.acks != 0 {
+        t.Errorf("settled %+v, want it requeued in the DLQ", settled)
+    }
+}
@@ -0,0 +1,233 @@
+package service
+
+import (
+    "bufio"
+    "encoding/json"
+    "fmt"
+    "os"
+    "sync"
+    "time"
+)
+
+// OrderEvent is one line in an order's audit trail.
+type OrderEvent struct {
+    OrderNo       string    `json:"order_no"`
+    Status        string    `json:"order_status"`
+    CorrelationID string    `json:"correlation_id"`
+    Timestamp     time.Time `json:"timestamp"`
+}
+
+// 1. The Interface
+// An append-only record of everything that happened to every order.
+type IEventLog interface {
+    Append(event OrderEvent) error
+    History(orderNo string) ([]OrderEvent, error)
+    // Since returns every order's events from 'since' on, oldest first,
+    // keeping only the newest 'limit' of them.
+    Since(since time.Time, limit int) ([]OrderEvent, error)
+}
+
+// 2. In-Memory Ring Buffer (the default)
+// Keeps the most recent 'capacity' events; the oldest ones are overwritten.
+type RingBufferEventLog struct {
+    events []OrderEvent
+    next   int  // Where the next event will be written
+    full   bool // True once we've wrapped around at least once
+    mutex  sync.RWMutex
+}
+
+// Append records an event, overwriting the oldest one when the buffer is full.
+func (rb *RingBufferEventLog) Append(event OrderEvent) error {
+    rb.mutex.Lock()
+    defer rb.mutex.Unlock()
+
+    rb.events[rb.next] = event
+    rb.next = (rb.next + 1) % len(rb.events)
+    if rb.next == 0 {
+        rb.full = true
+    }
+    return nil
+}
+
+// History returns one order's events, oldest first.
+func (rb *RingBufferEventLog) History(orderNo string) ([]OrderEvent, error) {
+    rb.mutex.RLock()
+    defer rb.mutex.RUnlock()
+
+    // Walk from the oldest slot to the newest.
+    start, count := 0, rb.next
+    if rb.full {
+        start, count = rb.next, len(rb.events)
+    }
+
+    history := []OrderEvent{}
+    for i := 0; i < count; i++ {
+        event := rb.events[(start+i)%len(rb.events)]
+        if event.OrderNo == orderNo {
+            history = append(history, event)
+        }
+    }
+    return history, nil
+}
+
+// Since returns recent events across all orders, oldest first.
+func (rb *RingBufferEventLog) Since(since time.Time, limit int) ([]OrderEvent, error) {
+    rb.mutex.RLock()
+    defer rb.mutex.RUnlock()
+
+    start, count := 0, rb.next
+    if rb.full {
+        start, count = rb.next, len(rb.events)
+    }
+
+    recent := []OrderEvent{}
+    for i := 0; i < count; i++ {
+        event := rb.events[(start+i)%len(rb.events)]
+        if !event.Timestamp.Before(since) {
+            recent = append(recent, event)
+        }
+    }
+    return newest(recent, limit), nil
+}
+
+// newest keeps the last 'limit' events (all of them when limit < 1).
+func newest(events []OrderEvent, limit int) []OrderEvent {
+    if limit > 0 && len(events) > limit {
+        return events[len(events)-limit:]
+    }
+    return events
+}
+
+// 3. File-Backed Log (optional)
+// Every event is one JSON line appended to a file, so the trail survives restarts.
+type FileEventLog struct {
+    path  string
+    mutex sync.Mutex
+}
+
+// Append writes the event as a single JSON line.
+func (fl *FileEventLog) Append(event OrderEvent) error {
+    line, err := json.Marshal(event)
+    if err != nil {
+        return fmt.Errorf("failed to encode order event: %w", err)
+    }
+
+    fl.mutex.Lock()
+    defer fl.mutex.Unlock()
+
+    file, err := os.OpenFile(fl.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+    if err != nil {
+        return fmt.Errorf("failed to open event log: %w", err)
+    }
+    defer file.Close()
+
+    _, err = file.Write(append(line, '\n'))
+    return err
+}
+
+// History scans the file and returns one order's events, oldest first.
+func (fl *FileEventLog) History(orderNo string) ([]OrderEvent, error) {
+    fl.mutex.Lock()
+    defer fl.mutex.Unlock()
+
+    history := []OrderEvent{}
+    file, err := os.Open(fl.path)
+    if os.IsNotExist(err) {
+        return history, nil // Nothing logged yet
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to open event log: %w", err)
+    }
+    defer file.Close()
+
+    scanner := bufio.NewScanner(file)
+    for scanner.Scan() {
+        var event OrderEvent
+        if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+            continue // Skip a corrupt line rather than losing the whole history
+        }
+        if event.OrderNo == orderNo {
+            history = append(history, event)
+        }
+    }
+    return history, scanner.Err()
+}
+
+// Since scans the file for recent events across all orders, oldest first.
+func (fl *FileEventLog) Since(since time.Time, limit int) ([]OrderEvent, error) {
+    fl.mutex.Lock()
+    defer fl.mutex.Unlock()
+
+    recent := []OrderEvent{}
+    file, err := os.Open(fl.path)
+    if os.IsNotExist(err) {
+        return recent, nil
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to open event log: %w", err)
+    }
+    defer file.Close()
+
+    scanner := bufio.NewScanner(file)
+    for scanner.Scan() {
+        var event OrderEvent
+        if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+            continue
+        }
+        if !event.Timestamp.Before(since) {
+            recent = append(recent, event)
+        }
+    }
+    return newest(recent, limit), scanner.Err()
+}
+
+// 4. Live Feed
+// NotifyingEventLog wraps another log and tells its listeners about every event
+// once it is stored (e.g. so the kitchen dashboard sees activity live).
+type NotifyingEventLog struct {
+    IEventLog
+    listeners []func(OrderEvent)
+    mutex     sync.RWMutex // Guards 'listeners'
+}
+
+// Append stores the event, then hands it to every listener.
+func (nl *NotifyingEventLog) Append(event OrderEvent) error {
+    if err := nl.IEventLog.Append(event); err != nil {
+        return err
+    }
+
+    nl.mutex.RLock()
+    listeners := nl.listeners
+    nl.mutex.RUnlock()
+    for _, listener := range listeners {
+        listener(event)
+    }
+    return nil
+}
+
+// Subscribe adds a listener for future events.
+func (nl *NotifyingEventLog) Subscribe(listener func(OrderEvent)) {
+    nl.mutex.Lock()
+    defer nl.mutex.Unlock()
+
+    nl.listeners = append(append([]func(OrderEvent){}, nl.listeners...), listener)
+}
+
+// GetNotifyingEventLog is the Constructor.
+func GetNotifyingEventLog(inner IEventLog) *NotifyingEventLog {
+    return &NotifyingEventLog{IEventLog: inner}
+}
+
+// GetEventLog is the Constructor. A file path selects the file-backed log;
+// otherwise we keep the last 'capacity' events in memory.
+func GetEventLog(filePath string, capacity int) IEventLog {
+    if filePath != "" {
+        return &FileEventLog{path: filePath}
+    }
+    if capacity <= 0 {
+        capacity = 1000
+    }
+    return &RingBufferEventLog{
+        events: make([]OrderEvent, capacity),
+    }
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+
+    "github.com/everestp/pizza-shop/constants"
+    "github.com/everestp/pizza-shop/logger"
+    "github.com/rabbitmq/amqp091-go"
+)
+
+// ErrUnknownEventType means a message's "type" tag has no registered decoder.
+var ErrUnknownEventType = errors.New("unknown event type")
+
+// EventType is one kind of event that may share the queue with orders (refunds, inventory...).
+// Decode turns the raw body into the type's own struct; Handle processes the result.
+type EventType struct {
+    Decode func(body []byte) (any, error)
+    Handle func(ctx context.Context, event any) error
+}
+
+// RegisterEventType plugs in a new event type under its "type" tag.
+// Orders are built in: a message with no "type" (or "type": "order") goes through the
+// order status handlers. Register types before consuming starts; the table is not locked.
+func (mp *MessageProcessor) RegisterEventType(tag string, eventType EventType) {
+    mp.eventTypes[tag] = eventType
+}
+
+// RegisterTypedEvent registers a type whose body decodes straight into T.
+func RegisterTypedEvent[T any](mp *MessageProcessor, tag string, handle func(ctx context.Context, event T) error) {
+    mp.RegisterEventType(tag, EventType{
+        Decode: func(body []byte) (any, error) {
+            var event T
+            err := json.Unmarshal(body, &event)
+            return event, err
+        },
+        Handle: func(ctx context.Context, event any) error {
+            return handle(ctx, event.(T))
+        },
+    })
+}
+
+// eventTypeOf reads the "type" tag; untagged events are orders.
+func eventTypeOf(event map[string]interface{}) string {
+    if tag, ok := event["type"].(string); ok && tag != "" {
+        return tag
+    }
+    return constants.EVENT_TYPE_ORDER
+}
+
+// processTypedEvent handles a message that isn't an order. An unknown tag can never
+// succeed, so by default it is nacked without requeue (dead-lettered, if configured).
+func (mp *MessageProcessor) processTypedEvent(ctx context.Context, msg amqp091.Delivery, tag string) error {
+    eventType, found := mp.eventTypes[tag]
+    if !found {
+        logger.Log(fmt.Sprintf("Rejected Event: no decoder registered for type %q", tag))
+        err := fmt.Errorf("%w: %q", ErrUnknownEventType, tag)
+        mp.settle(msg, err)
+        return err
+    }
+
+    event, err := eventType.Decode(msg.Body)
+    if err != nil {
+        logger.Log(fmt.Sprintf("Rejected Event: cannot decode %q event: %v", tag, err))
+        err = fmt.Errorf("%w: %q: %w", ErrUndecodableEvent, tag, err)
+        mp.settle(msg, err)
+        return err
+    }
+
+    handlerCtx, span := tracer.Start(ExtractTraceContext(ctx, msg.Headers), "handle "+tag)
+    defer span.End()
+    if err := eventType.Handle(handlerCtx, event); err != nil {
+        span.RecordError(err)
+        logger.Log(fmt.Sprintf("Processing Error (%s): %v", tag, err))
+        mp.settle(msg, err)
+        return err
+    }
+    mp.finish(msg)
+    return nil
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+    "context"
+    "errors"
+    "testing"
+)
+
+type refundEvent struct {
+    OrderNo string  `json:"order_no"`
+    Amount  float64 `json:"amount"`
+}
+
+type inventoryEvent struct {
+    Item  string `json:"item"`
+    Delta int    `json:"delta"`
+}
+
+func TestEventTypesDecodeAndDispatchToTheirOwnHandler(t *testing.T) {
+    tp := newTestProcessor(t)
+    var refunds []refundEvent
+    var stock []inventoryEvent
+    RegisterTypedEvent(tp.MessageProcessor, "refund", func(ctx context.Context, event refundEvent) error {
+        refunds = append(refunds, event)
+        return nil
+    })
+    RegisterTypedEvent(tp.MessageProcessor, "inventory", func(ctx context.Context, event inventoryEvent) error {
+        stock = append(stock, event)
+        return nil
+    })
+
+    if err := tp.deliver(t, "m1", []byte(`{"type":"refund","order_no":"A1","amount":12.5}`)); err != nil {
+        t.Fatalf("refund: %v", err)
+    }
+    if err := tp.deliver(t, "m2", []byte(`{"type":"inventory","item":"mozzarella","delta":-3}`)); err != nil {
+        t.Fatalf("inventory: %v", err)
+    }
+
+    if len(refunds) != 1 || refunds[0] != (refundEvent{OrderNo: "A1", Amount: 12.5}) {
+        t.Errorf("refunds: got %+v", refunds)
+    }
+    if len(stock) != 1 || stock[0] != (inventoryEvent{Item: "mozzarella", Delta: -3}) {
+        t.Errorf("inventory: got %+v", stock)
+    }
+    if tp.settled.acks != 2 {
+        t.Errorf("acked %d of the 2 events", tp.settled.acks)
+    }
+    if _, ok := tp.store.Get("A1"); ok {
+        t.Error("the refund went through the order handlers")
+    }
+}
+
+func TestUnknownEventTypeIsDeadLettered(t *testing.T) {
+    tp := newTestProcessor(t)
+
+    err := tp.deliver(t, "m1", []byte(`{"type":"loyalty","points":10}`))
+    if !errors.Is(err, ErrUnknownEventType) {
+        t.Fatalf("got %v, want ErrUnknownEventType", err)
+    }
+    if tp.settled.rejects != 1 || tp.settled.requeues != 0 || tp.settled.acks != 0 {
+        t.Errorf("got %+v, want one reject without requeue", tp.settled)
+    }
+}
+
+func TestUndecodableTypedEventIsRejected(t *testing.T) {
+    tp := newTestProcessor(t)
+    RegisterTypedEvent(tp.MessageProcessor, "refund", func(ctx context.Context, event refundEvent) error {
+        t.Error("the handler ran for a body that didn't decode")
+        return nil
+    })
+
+    err := tp.deliver(t, "m1", []byte(`{"type":"refund","amount":"twelve"}`))
+    if !errors.Is(err, ErrUndecodableEvent) {
+        t.Fatalf("got %v, want ErrUndecodableEvent", err)
+    }
+    if tp.settled.rejects != 1 || tp.settled.requeues != 0 {
+        t.Errorf("got %+v, want one reject without requeue", tp.settled)
+    }
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+    "errors"
+    "fmt"
+    "strings"
+
+    "github.com/everestp/pizza-shop/config"
+    "github.com/everestp/pizza-shop/logger"
+)
+
+// ErrMalformedMessage means a message body isn't valid JSON.
+var ErrMalformedMessage = errors.New("malformed message body")
+
+// ErrUndecodableEvent means a typed event's body doesn't decode into its struct.
+var ErrUndecodableEvent = errors.New("event cannot be decoded")
+
+// FailureAction is what happens to a message whose processing failed.
+type FailureAction string
+
+const (
+    ActionAck        FailureAction = "ack"         // Drop it: another attempt isn't worth it
+    ActionRequeue    FailureAction = "requeue"     // Nack with requeue: straight back on the queue
+    ActionRetry      FailureAction = "retry"       // Re-publish with the retry count bumped, dead-letter after MAX_RETRY_COUNT
+    ActionDeadLetter FailureAction = "dead-letter" // Nack without requeue: dropped, or dead-lettered if configured
+)
+
+// Failure classes, as named in NACK_POLICY.
+const (
+    FailureMalformed         = "malformed"          // Body isn't JSON
+    FailureUndecodable       = "undecodable"        // Typed event body doesn't fit its struct
+    FailureUnknownType       = "unknown_type"       // No decoder registered for the event's "type"
+    FailureUnknownStatus     = "unknown_status"     // "order_status" isn't in ORDER_STATUS_LABELS (nor one of ours)
+    FailureInvalidTransition = "invalid_transition" // The status can't follow the order's current one
+    FailureTimeout           = "timeout"            // The handler overran MESSAGE_PROCESSING_TIMEOUT_MS
+    FailureHandlerError      = "handler_error"      // Anything else a handler returned
+)
+
+// FailurePolicy decides, in one place, what happens to a message that failed:
+// Classify names the kind of failure and Actions maps each kind to an action.
+// NACK_POLICY overrides the defaults, e.g. "timeout=dead-letter,handler_error=requeue";
+// a class with no action falls back to "retry".
+type FailurePolicy struct {
+    // Classify names an error's failure class (default: ClassifyFailure).
+    // Replace it to tell apart errors of your own, then give their classes an action.
+    Classify func(err error) string
+    Actions  map[string]FailureAction
+}
+
+// Action returns what to do with a message that failed with 'err'.
+func (fp *FailurePolicy) Action(err error) FailureAction {
+    if action, ok := fp.Actions[fp.Classify(err)]; ok {
+        return action
+    }
+    return ActionRetry
+}
+
+// ClassifyFailure is the default classifier, by the errors the processor returns.
+func ClassifyFailure(err error) string {
+    switch {
+    case errors.Is(err, ErrMalformedMessage):
+        return FailureMalformed
+    case errors.Is(err, ErrUndecodableEvent):
+        return FailureUndecodable
+    case errors.Is(err, ErrUnknownEventType):
+        return FailureUnknownType
+    case errors.Is(err, ErrUnknownStatusLabel):
+        return FailureUnknownStatus
+    case errors.Is(err, ErrInvalidTransition):
+        return FailureInvalidTransition
+    case errors.Is(err, ErrProcessingTimeout):
+        return FailureTimeout
+    default:
+        return FailureHandlerError
+    }
+}
+
+// DefaultFailureActions is how failures are handled unless NACK_POLICY says otherwise.
+// requeueOnTimeout is PROCESSING_TIMEOUT_REQUEUE (default true).
+// A body that isn't JSON will never become JSON, so it is dead-lettered: requeueing it
+// would just redeliver it in a hot loop.
+func DefaultFailureActions(requeueOnTimeout bool) map[string]FailureAction {
+    timeout := ActionDeadLetter
+    if requeueOnTimeout {
+        timeout = ActionRequeue
+    }
+    return map[string]FailureAction{
+        FailureMalformed:         ActionDeadLetter,
+        FailureUndecodable:       ActionDeadLetter,
+        FailureUnknownType:       ActionDeadLetter,
+        FailureUnknownStatus:     ActionDeadLetter,
+        FailureInvalidTransition: ActionDeadLetter,
+        FailureTimeout:           timeout,
+        FailureHandlerError:      ActionRetry,
+    }
+}
+
+// ParseFailureActions applies NACK_POLICY rules ("class=action,...") on top of 'actions'.
+// Classes are free-form (a custom Classify may return its own); actions must be known.
+func ParseFailureActions(raw string, actions map[string]FailureAction) (map[string]FailureAction, error) {
+    parsed := make(map[string]FailureAction, len(actions))
+    for class, action := range actions {
+        parsed[class] = action
+    }
+    for _, rule := range strings.Split(raw, ",") {
+        rule = strings.TrimSpace(rule)
+        if rule == "" {
+            continue
+        }
+        class, action, found := strings.Cut(rule, "=")
+        if !found {
+            return nil, fmt.Errorf("invalid NACK_POLICY rule %q: expected class=action", rule)
+        }
+        switch name := FailureAction(strings.ToLower(strings.TrimSpace(action))); name {
+        case ActionAck, ActionRequeue, ActionRetry, ActionDeadLetter:
+            parsed[strings.ToLower(strings.TrimSpace(class))] = name
+        default:
+            return nil, fmt.Errorf("invalid NACK_POLICY action in %q: expected ack, requeue, retry or dead-letter", rule)
+        }
+    }
+    return parsed, nil
+}
+
+// newFailurePolicy reads NACK_POLICY on top of the defaults. A broken policy is
+// ignored as a whole, so a typo never half-applies.
+func newFailurePolicy(requeueOnTimeout bool) *FailurePolicy {
+    defaults := DefaultFailureActions(requeueOnTimeout)
+    actions, err := ParseFailureActions(config.GetEnvProperty("nack_policy"), defaults)
+    if err != nil {
+        logger.Log(fmt.Sprintf("CRITICAL: ignoring NACK_POLICY: %v", err))
+        actions = defaults
+    }
+    return GetFailurePolicy(actions)
+}
+
+// GetFailurePolicy is the Constructor, with the default classifier.
+func GetFailurePolicy(actions map[string]FailureAction) *FailurePolicy {
+    return &FailurePolicy{
+        Classify: ClassifyFailure,
+        Actions:  actions,
+    }
+}
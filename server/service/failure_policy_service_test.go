@@ -0,0 +1,128 @@
+package service
+
+import (
+    "errors"
+    "fmt"
+    "testing"
+
+    "github.com/everestp/pizza-shop/constants"
+    "github.com/rabbitmq/amqp091-go"
+)
+
+func TestMalformedBodyIsDeadLetteredByDefault(t *testing.T) {
+    tp := newTestProcessor(t)
+
+    err := tp.deliver(t, "junk-1", []byte("{not json"))
+    if !errors.Is(err, ErrMalformedMessage) {
+        t.Fatalf("got %v, want ErrMalformedMessage", err)
+    }
+    if tp.settled.rejects != 1 || tp.settled.requeues != 0 || tp.settled.acks != 0 {
+        t.Errorf("settled %+v, want one nack without requeue", tp.settled)
+    }
+}
+
+func TestDefaultFailureActions(t *testing.T) {
+    policy := GetFailurePolicy(DefaultFailureActions(true))
+
+    cases := map[error]FailureAction{
+        fmt.Errorf("%w: bad byte", ErrMalformedMessage):    ActionDeadLetter,
+        fmt.Errorf("%w: wrong shape", ErrUndecodableEvent): ActionDeadLetter,
+        ErrProcessingTimeout:                               ActionRequeue,
+        errors.New("oven broke"):                           ActionRetry,
+    }
+    for err, want := range cases {
+        if got := policy.Action(err); got != want {
+            t.Errorf("%v: got %q, want %q", err, got, want)
+        }
+    }
+    if got := GetFailurePolicy(DefaultFailureActions(false)).Action(ErrProcessingTimeout); got != ActionDeadLetter {
+        t.Errorf("timeout without PROCESSING_TIMEOUT_REQUEUE: got %q, want dead-letter", got)
+    }
+}
+
+func TestNackPolicyOverridesTheDefaults(t *testing.T) {
+    actions, err := ParseFailureActions("malformed=requeue, handler_error=ack", DefaultFailureActions(true))
+    if err != nil {
+        t.Fatalf("parse: %v", err)
+    }
+    if actions[FailureMalformed] != ActionRequeue || actions[FailureHandlerError] != ActionAck || actions[FailureUndecodable] != ActionDeadLetter {
+        t.Errorf("got %v", actions)
+    }
+
+    for _, raw := range []string{"malformed", "malformed=explode"} {
+        if _, err := ParseFailureActions(raw, DefaultFailureActions(true)); err == nil {
+            t.Errorf("%q: want an error", raw)
+        }
+    }
+}
+
+func TestEveryFailureHasAClass(t *testing.T) {
+    cases := map[error]string{
+        fmt.Errorf("%w: bad byte", ErrMalformedMessage):          FailureMalformed,
+        fmt.Errorf("%w: wrong shape", ErrUndecodableEvent):       FailureUndecodable,
+        fmt.Errorf("%w: %q", ErrUnknownEventType, "refund"):      FailureUnknownType,
+        fmt.Errorf("%w: %q", ErrUnknownStatusLabel, "en route"):  FailureUnknownStatus,
+        fmt.Errorf("order A1: %w", ErrInvalidTransition):         FailureInvalidTransition,
+        fmt.Errorf("%w: context deadline", ErrProcessingTimeout): FailureTimeout,
+        errors.New("oven broke"):                                 FailureHandlerError,
+    }
+    for err, want := range cases {
+        if got := ClassifyFailure(err); got != want {
+            t.Errorf("%v: got class %q, want %q", err, got, want)
+        }
+    }
+
+    // Every class has a default action; one nobody configured is retried.
+    defaults := DefaultFailureActions(true)
+    for _, class := range cases {
+        if _, ok := defaults[class]; !ok {
+            t.Errorf("no default action for %q", class)
+        }
+    }
+    custom := GetFailurePolicy(defaults)
+    custom.Classify = func(err error) string { return "oven" }
+    if got := custom.Action(errors.New("oven broke")); got != ActionRetry {
+        t.Errorf("unconfigured class: got %q, want retry", got)
+    }
+}
+
+func TestProcessorSettlesAsThePolicySays(t *testing.T) {
+    cases := []struct {
+        action                  FailureAction
+        acks, requeues, rejects int
+        republished             bool
+    }{
+        {action: ActionAck, acks: 1},
+        {action: ActionRequeue, requeues: 1},
+        {action: ActionDeadLetter, rejects: 1},
+        {action: ActionRetry, acks: 1, republished: true}, // The copy goes back with its count bumped
+    }
+    for _, tc := range cases {
+        t.Run(string(tc.action), func(t *testing.T) {
+            tp := newTestProcessor(t)
+            policy := GetFailurePolicy(map[string]FailureAction{"oven": tc.action})
+            policy.Classify = func(err error) string { return "oven" }
+            tp.SetFailurePolicy(policy)
+
+            msg := amqp091.Delivery{Acknowledger: tp.settled, RoutingKey: constants.KITCHEN_ORDER_QUEUE, Body: orderEvent(t, "A1", constants.ORDER_PREPARING)}
+            if got := tp.settle(msg, errors.New("oven broke")); got != tc.action {
+                t.Fatalf("got %q, want %q", got, tc.action)
+            }
+            if s := tp.settled; s.acks != tc.acks || s.requeues != tc.requeues || s.rejects != tc.rejects {
+                t.Errorf("settled %+v, want %d ack(s), %d requeue(s), %d reject(s)", s, tc.acks, tc.requeues, tc.rejects)
+            }
+            if republished := tp.published() != nil; republished != tc.republished {
+                t.Errorf("republished: got %v, want %v", republished, tc.republished)
+            }
+        })
+    }
+}
+
+func TestBrokenNackPolicyIsIgnoredAsAWhole(t *testing.T) {
+    withEnv(t, map[string]string{"NACK_POLICY": "timeout=ack,malformed=explode"})
+
+    policy := newFailurePolicy(true)
+    if got := policy.Action(ErrProcessingTimeout); got != ActionRequeue {
+        t.Errorf("timeout: got %q; the valid half of a broken policy must not apply", got)
+    }
+}
@@ -0,0 +1,298 @@
+package service
+
+import (
+    "context"
+    "errors"
+    "sync"
+    "testing"
+
+    "github.com/everestp/pizza-shop/config"
+    "github.com/rabbitmq/amqp091-go"
+)
+
+// fakeBroker stands in for RabbitMQ behind config.IRabbitMQConnection: it records what the
+// publisher and the consumer do, and lets a test push deliveries to the consumer.
+// Every GetChannel opens a new fakeChannel on it, like a real connection does.
+type fakeBroker struct {
+    mutex           sync.Mutex
+    declared        []string                         // Queues declared, in order
+    published       []fakePublish                    // Messages published, in order
+    exchanges       map[string]string                // Exchange name -> kind
+    consumers       map[string]chan amqp091.Delivery // Consumer tag -> its deliveries
+    consuming       chan string                      // Gets the queue name of every Consume
+    acked           []uint64                         // Delivery tags acked (a multiple ack counts once)
+    multiple        []bool                           // Whether each ack covered every tag up to it
+    nacked          []uint64
+    requeued        []bool
+    prefetch        int
+    channels        []*fakeChannel
+    declareChannels []*fakeChannel // The short-lived channels DeclareQueue used
+    failOpen        error          // When set, GetChannel fails with it
+    connected       bool
+    closes          int             // How many times the whole connection was closed
+    confirms        bool            // When set, Confirm works and the broker acks every publish (see withConfirms)
+    noRoute         map[string]bool // Routing keys no queue is bound to: mandatory publishes come back
+    calls           []string        // "declare <queue>" and "consume <queue>", in the order they happened
+}
+
+// fakePublish is one message as the publisher handed it over.
+type fakePublish struct {
+    Exchange   string
+    RoutingKey string
+    Mandatory  bool
+    Message    amqp091.Publishing
+}
+
+func newFakeBroker() *fakeBroker {
+    return &fakeBroker{
+        exchanges: make(map[string]string),
+        consumers: make(map[string]chan amqp091.Delivery),
+        consuming: make(chan string, 10),
+        connected: true,
+    }
+}
+
+func (fb *fakeBroker) GetChannel() (config.IAMQPChannel, error) {
+    fb.mutex.Lock()
+    defer fb.mutex.Unlock()
+
+    if fb.failOpen != nil {
+        return nil, fb.failOpen
+    }
+    channel := &fakeChannel{broker: fb}
+    fb.channels = append(fb.channels, channel)
+    return channel, nil
+}
+
+func (fb *fakeBroker) IsConnected() bool {
+    fb.mutex.Lock()
+    defer fb.mutex.Unlock()
+    return fb.connected
+}
+
+// DeclareQueue declares on a channel of its own and closes it, like config.RabbitMQConection does.
+// Those channels are kept apart in declareChannels, so channels[0] stays the first one a test opened.
+func (fb *fakeBroker) DeclareQueue(queueName string) error {
+    fb.mutex.Lock()
+    defer fb.mutex.Unlock()
+
+    if fb.failOpen != nil {
+        return fb.failOpen
+    }
+    channel := &fakeChannel{broker: fb, closed: true} // Opened, used and closed in one go
+    fb.declareChannels = append(fb.declareChannels, channel)
+    fb.declared = append(fb.declared, queueName)
+    fb.calls = append(fb.calls, "declare "+queueName)
+    return nil
+}
+
+func (fb *fakeBroker) InspectQueue(queueName string) (amqp091.Queue, error) {
+    return amqp091.Queue{Name: config.QueueName(queueName)}, nil
+}
+
+func (fb *fakeBroker) PurgeQueue(queueName string) (int, error) { return 0, nil }
+func (fb *fakeBroker) Close() {
+    fb.mutex.Lock()
+    defer fb.mutex.Unlock()
+    fb.closes++
+}
+
+// deliver sends a message to the consumer with this tag, as if the broker pushed it.
+func (fb *fakeBroker) deliver(consumerTag string, tag uint64, channel *fakeChannel, body []byte) {
+    fb.mutex.Lock()
+    deliveries := fb.consumers[consumerTag]
+    fb.mutex.Unlock()
+    deliveries <- amqp091.Delivery{Acknowledger: channel, DeliveryTag: tag, Body: body}
+}
+
+// snapshot returns copies of what was recorded so far.
+func (fb *fakeBroker) snapshot() (declared []string, published []fakePublish, acked []uint64, nacked []uint64) {
+    fb.mutex.Lock()
+    defer fb.mutex.Unlock()
+    return append([]string(nil), fb.declared...), append([]fakePublish(nil), fb.published...),
+        append([]uint64(nil), fb.acked...), append([]uint64(nil), fb.nacked...)
+}
+
+// fakeChannel is one channel on a fakeBroker; it satisfies config.IAMQPChannel.
+type fakeChannel struct {
+    broker   *fakeBroker
+    closed   bool
+    notify   []chan *amqp091.Error
+    consumes []string // Consumer tags on this channel
+    prefetch int      // The last Qos on this channel
+    returns  []chan amqp091.Return
+}
+
+var _ config.IAMQPChannel = (*fakeChannel)(nil)
+
+func (fc *fakeChannel) Ack(tag uint64, multiple bool) error {
+    fc.broker.mutex.Lock()
+    defer fc.broker.mutex.Unlock()
+    fc.broker.acked = append(fc.broker.acked, tag)
+    fc.broker.multiple = append(fc.broker.multiple, multiple)
+    return nil
+}
+
+func (fc *fakeChannel) Nack(tag uint64, multiple bool, requeue bool) error {
+    fc.broker.mutex.Lock()
+    defer fc.broker.mutex.Unlock()
+    fc.broker.nacked = append(fc.broker.nacked, tag)
+    fc.broker.requeued = append(fc.broker.requeued, requeue)
+    return nil
+}
+
+func (fc *fakeChannel) Reject(tag uint64, requeue bool) error { return fc.Nack(tag, false, requeue) }
+
+// PublishWithDeferredConfirmWithContext records the message. There are no confirms unless
+// the test turned them on with withConfirms. A mandatory message to a key in noRoute is
+// returned to the NotifyReturn listeners, as the broker does before it acks.
+func (fc *fakeChannel) PublishWithDeferredConfirmWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp091.Publishing) (*amqp091.DeferredConfirmation, error) {
+    fc.broker.mutex.Lock()
+    defer fc.broker.mutex.Unlock()
+
+    if fc.closed {
+        return nil, amqp091.ErrClosed
+    }
+    fc.broker.published = append(fc.broker.published, fakePublish{Exchange: exchange, RoutingKey: key, Mandatory: mandatory, Message: msg})
+    if mandatory && fc.broker.noRoute[key] {
+        for _, returns := range fc.returns {
+            returns <- amqp091.Return{ReplyCode: amqp091.NoRoute, ReplyText: "NO_ROUTE", Exchange: exchange, RoutingKey: key}
+        }
+    }
+    return nil, nil
+}
+
+func (fc *fakeChannel) Confirm(noWait bool) error {
+    fc.broker.mutex.Lock()
+    defer fc.broker.mutex.Unlock()
+    if !fc.broker.confirms {
+        return errors.New("the fake channel has no publisher confirms")
+    }
+    return nil
+}
+
+// withConfirms turns publisher confirms on for fb; the broker acks every publish.
+func withConfirms(t *testing.T, fb *fakeBroker) {
+    fb.mutex.Lock()
+    fb.confirms = true
+    fb.mutex.Unlock()
+
+    realWait := waitForConfirmation
+    waitForConfirmation = func(ctx context.Context, confirmation *amqp091.DeferredConfirmation) (bool, error) {
+        return true, nil
+    }
+    t.Cleanup(func() { waitForConfirmation = realWait })
+}
+
+func (fc *fakeChannel) NotifyReturn(returns chan amqp091.Return) chan amqp091.Return {
+    fc.broker.mutex.Lock()
+    defer fc.broker.mutex.Unlock()
+    fc.returns = append(fc.returns, returns)
+    return returns
+}
+
+func (fc *fakeChannel) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp091.Table) error {
+    fc.broker.mutex.Lock()
+    defer fc.broker.mutex.Unlock()
+    fc.broker.exchanges[name] = kind
+    return nil
+}
+
+func (fc *fakeChannel) Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp091.Table) (<-chan amqp091.Delivery, error) {
+    fc.broker.mutex.Lock()
+    deliveries := make(chan amqp091.Delivery)
+    fc.broker.consumers[consumer] = deliveries
+    fc.consumes = append(fc.consumes, consumer)
+    fc.broker.calls = append(fc.broker.calls, "consume "+queue)
+    fc.broker.mutex.Unlock()
+
+    fc.broker.consuming <- queue
+    return deliveries, nil
+}
+
+func (fc *fakeChannel) Qos(prefetchCount, prefetchSize int, global bool) error {
+    fc.broker.mutex.Lock()
+    defer fc.broker.mutex.Unlock()
+    fc.broker.prefetch = prefetchCount
+    fc.prefetch = prefetchCount
+    return nil
+}
+
+// Cancel ends one consumer's deliveries, like basic.cancel does.
+func (fc *fakeChannel) Cancel(consumer string, noWait bool) error {
+    fc.broker.mutex.Lock()
+    defer fc.broker.mutex.Unlock()
+
+    if deliveries, ok := fc.broker.consumers[consumer]; ok {
+        close(deliveries)
+        delete(fc.broker.consumers, consumer)
+    }
+    return nil
+}
+
+func (fc *fakeChannel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp091.Table) (amqp091.Queue, error) {
+    return amqp091.Queue{Name: name}, nil
+}
+
+func (fc *fakeChannel) QueueDeclarePassive(name string, durable, autoDelete, exclusive, noWait bool, args amqp091.Table) (amqp091.Queue, error) {
+    return amqp091.Queue{Name: name}, nil
+}
+
+func (fc *fakeChannel) QueuePurge(name string, noWait bool) (int, error) { return 0, nil }
+
+// NotifyClose registers a listener; like the real channel, an already closed one closes it right away.
+func (fc *fakeChannel) NotifyClose(closed chan *amqp091.Error) chan *amqp091.Error {
+    fc.broker.mutex.Lock()
+    defer fc.broker.mutex.Unlock()
+
+    if fc.closed {
+        close(closed)
+        return closed
+    }
+    fc.notify = append(fc.notify, closed)
+    return closed
+}
+
+// watched reports whether someone listens for the channel closing.
+func (fc *fakeChannel) watched() bool {
+    fc.broker.mutex.Lock()
+    defer fc.broker.mutex.Unlock()
+    return len(fc.notify) > 0
+}
+
+// Close closes the channel on purpose: listeners get a closed channel (no error),
+// and the channel's consumers stop.
+func (fc *fakeChannel) Close() error {
+    fc.closeWith(nil)
+    return nil
+}
+
+// closeWith closes the channel; a non-nil reason is what the broker says when IT closes
+// the channel (e.g. after a protocol error), and is sent to the listeners first.
+func (fc *fakeChannel) closeWith(reason *amqp091.Error) {
+    fc.broker.mutex.Lock()
+    defer fc.broker.mutex.Unlock()
+
+    if fc.closed {
+        return
+    }
+    fc.closed = true
+    for _, listener := range fc.notify {
+        if reason != nil {
+            listener <- reason
+        }
+        close(listener)
+    }
+    for _, consumer := range fc.consumes {
+        if deliveries, ok := fc.broker.consumers[consumer]; ok {
+            close(deliveries)
+            delete(fc.broker.consumers, consumer)
+        }
+    }
+}
+
+func (fc *fakeChannel) IsClosed() bool {
+    fc.broker.mutex.Lock()
+    defer fc.broker.mutex.Unlock()
+    return fc.closed
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+    "context"
+    "sync"
+    "time"
+
+    "github.com/everestp/pizza-shop/utils"
+)
+
+// completedTTL is how long we remember that an order step already ran.
+// Long enough to cover broker redeliveries, short enough to keep memory bounded.
+const completedTTL = 10 * time.Minute
+
+// IdempotencyGuard makes sure the same step of the same order (order_no + status)
+// is only ever processed once, even when RabbitMQ hands us a second copy.
+type IdempotencyGuard struct {
+    inFlight  map[string]chan struct{} // Steps currently being worked on; closed when they finish
+    completed map[string]time.Time     // Steps that finished, and when
+    order     []string                 // The same steps, oldest first
+    mutex     sync.Mutex
+}
+
+// Begin claims a step. It returns false when the step is already running or already done,
+// in which case the caller must NOT process it again.
+func (g *IdempotencyGuard) Begin(key string) bool {
+    g.mutex.Lock()
+    defer g.mutex.Unlock()
+
+    g.pruneExpired(utils.Clock.Now())
+    if _, running := g.inFlight[key]; running {
+        return false
+    }
+    if _, done := g.completed[key]; done {
+        return false
+    }
+    g.inFlight[key] = make(chan struct{})
+    return true
+}
+
+// WaitAndBegin is Begin for a step that may still be running elsewhere (e.g. the original
+// delivery, on a channel that died before it could ack). It waits for that run to end:
+// if it completed the step, it returns false; if it gave up, this caller claims the step.
+// It returns ctx's error if ctx ends first.
+func (g *IdempotencyGuard) WaitAndBegin(ctx context.Context, key string) (bool, error) {
+    for {
+        g.mutex.Lock()
+        if _, done := g.completed[key]; done {
+            g.mutex.Unlock()
+            return false, nil
+        }
+        finished, running := g.inFlight[key]
+        if !running {
+            g.inFlight[key] = make(chan struct{})
+            g.mutex.Unlock()
+            return true, nil
+        }
+        g.mutex.Unlock()
+
+        select {
+        case <-finished:
+        case <-ctx.Done():
+            return false, ctx.Err()
+        }
+    }
+}
+
+// Complete marks a claimed step as done for good.
+func (g *IdempotencyGuard) Complete(key string) {
+    g.mutex.Lock()
+    defer g.mutex.Unlock()
+
+    g.finishLocked(key)
+    if _, done := g.completed[key]; !done {
+        g.completed[key] = utils.Clock.Now()
+        g.order = append(g.order, key)
+    }
+}
+
+// Release gives up a claimed step (it failed), so a retry is allowed to run it.
+func (g *IdempotencyGuard) Release(key string) {
+    g.mutex.Lock()
+    defer g.mutex.Unlock()
+
+    g.finishLocked(key)
+}
+
+// finishLocked ends a run of the step and wakes whoever waits on it. Caller holds the lock.
+func (g *IdempotencyGuard) finishLocked(key string) {
+    if finished, running := g.inFlight[key]; running {
+        close(finished)
+        delete(g.inFlight, key)
+    }
+}
+
+// pruneExpired forgets completed steps older than the TTL. 'order' is oldest first, so it
+// stops at the first one still inside the TTL, like the MessageDeduper. Caller holds the lock.
+func (g *IdempotencyGuard) pruneExpired(now time.Time) {
+    for len(g.order) > 0 && now.Sub(g.completed[g.order[0]]) > completedTTL {
+        delete(g.completed, g.order[0])
+        g.order = g.order[1:]
+    }
+}
+
+// GetIdempotencyGuard is the Constructor.
+func GetIdempotencyGuard() *IdempotencyGuard {
+    return &IdempotencyGuard{
+        inFlight:  make(map[string]chan struct{}),
+        completed: make(map[string]time.Time),
+    }
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+    "context"
+    "testing"
+    "time"
+
+    "github.com/everestp/pizza-shop/utils"
+)
+
+func TestStepRunsOnceUntilReleased(t *testing.T) {
+    guard := GetIdempotencyGuard()
+
+    if !guard.Begin("A1:ordered") {
+        t.Fatal("the first claim was refused")
+    }
+    if guard.Begin("A1:ordered") {
+        t.Error("a running step was claimed twice")
+    }
+    guard.Release("A1:ordered")
+    if !guard.Begin("A1:ordered") {
+        t.Fatal("a released step can't be retried")
+    }
+    guard.Complete("A1:ordered")
+    if guard.Begin("A1:ordered") {
+        t.Error("a completed step was claimed again")
+    }
+    if !guard.Begin("A1:preparing") {
+        t.Error("the next step of the order was refused")
+    }
+}
+
+func TestCompletedStepIsForgottenAfterItsTTL(t *testing.T) {
+    clock := &manualClock{now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+    utils.Clock = clock
+    t.Cleanup(func() { utils.Clock = utils.RealClock{} })
+
+    guard := GetIdempotencyGuard()
+    guard.Begin("A1:ordered")
+    guard.Complete("A1:ordered")
+
+    clock.now = clock.now.Add(completedTTL - time.Second)
+    if guard.Begin("A1:ordered") {
+        t.Fatal("a step completed within the TTL was claimed again")
+    }
+    clock.now = clock.now.Add(2 * time.Second)
+    if !guard.Begin("A1:ordered") {
+        t.Error("a step completed longer than the TTL ago is still remembered")
+    }
+}
+
+func TestWaitAndBeginWaitsForTheRunningStep(t *testing.T) {
+    guard := GetIdempotencyGuard()
+    guard.Begin("A1:ordered")
+
+    claimed := make(chan bool, 1)
+    go func() {
+        ok, _ := guard.WaitAndBegin(context.Background(), "A1:ordered")
+        claimed <- ok
+    }()
+    time.Sleep(20 * time.Millisecond)
+    guard.Complete("A1:ordered")
+    if <-claimed {
+        t.Error("the waiter claimed a step that completed meanwhile")
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+    defer cancel()
+    guard.Begin("A2:ordered")
+    if _, err := guard.WaitAndBegin(ctx, "A2:ordered"); err != context.DeadlineExceeded {
+        t.Errorf("got %v, want the context's error", err)
+    }
+}
+
+func TestPruneForgetsOnlyExpiredSteps(t *testing.T) {
+    guard := GetIdempotencyGuard()
+    for _, key := range []string{"old-1", "old-2", "new"} {
+        guard.Begin(key)
+        guard.Complete(key)
+    }
+    start := time.Now()
+    guard.completed["old-1"] = start.Add(-2 * completedTTL)
+    guard.completed["old-2"] = start.Add(-2 * completedTTL)
+
+    guard.pruneExpired(start)
+    if _, ok := guard.completed["old-1"]; ok {
+        t.Error("an expired step is still remembered")
+    }
+    if len(guard.completed) != 1 || len(guard.order) != 1 || guard.order[0] != "new" {
+        t.Errorf("got %v / %v, want only the fresh step", guard.completed, guard.order)
+    }
+    if !guard.Begin("old-1") {
+        t.Error("an expired step can't run again")
+    }
+
+    guard.pruneExpired(start.Add(completedTTL + time.Minute))
+    if len(guard.completed) != 0 || len(guard.order) != 0 {
+        t.Errorf("got %v / %v, want everything forgotten", guard.completed, guard.order)
+    }
+}
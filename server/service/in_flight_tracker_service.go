@@ -0,0 +1,111 @@
+package service
+
+import (
+    "sort"
+    "sync"
+    "time"
+)
+
+// InFlightTracker counts the orders the kitchen is cooking right now (status PREPARING).
+// It is the kitchen's current load: reported on GET /admin/kitchen/load and used to
+// turn new orders away once KITCHEN_MAX_IN_FLIGHT orders are on the stove.
+type InFlightTracker struct {
+    orders map[string]inFlightEntry // Order number -> when it started cooking
+    nextId uint64
+    limit  int // Orders allowed at once (0 = unbounded)
+    mutex  sync.Mutex
+}
+
+// inFlightEntry is one order on the stove. 'id' tells a late finish of an abandoned
+// attempt apart from the retry that replaced it.
+type inFlightEntry struct {
+    id      uint64
+    started time.Time
+    stop    func() // Stops the cook (nil = can't be stopped)
+}
+
+// KitchenLoad is the body of GET /admin/kitchen/load.
+type KitchenLoad struct {
+    InFlight  int      `json:"in_flight"`
+    Limit     int      `json:"limit"` // 0 = unbounded
+    Saturated bool     `json:"saturated"`
+    Orders    []string `json:"orders"`
+}
+
+// Enter marks an order as cooking and returns the function that takes it off the stove.
+// Call the returned function on EVERY way out (usually with defer); calling it twice,
+// or after Leave already removed the order, is harmless.
+// 'stop' is called when someone else takes the order off the stove (see Leave).
+func (it *InFlightTracker) Enter(orderNo string, stop func()) func() {
+    it.mutex.Lock()
+    defer it.mutex.Unlock()
+
+    it.nextId++
+    id := it.nextId
+    it.orders[orderNo] = inFlightEntry{id: id, started: time.Now(), stop: stop}
+
+    return func() {
+        it.mutex.Lock()
+        defer it.mutex.Unlock()
+
+        if entry, ok := it.orders[orderNo]; ok && entry.id == id {
+            delete(it.orders, orderNo)
+        }
+    }
+}
+
+// Leave takes an order off the stove no matter who put it there (e.g. it was cancelled,
+// advanced by an admin, or its handler ran out of time and was abandoned), and stops its cook.
+func (it *InFlightTracker) Leave(orderNo string) {
+    it.mutex.Lock()
+    defer it.mutex.Unlock()
+
+    if entry, ok := it.orders[orderNo]; ok && entry.stop != nil {
+        entry.stop()
+    }
+    delete(it.orders, orderNo)
+}
+
+// Count returns how many orders are cooking.
+func (it *InFlightTracker) Count() int {
+    it.mutex.Lock()
+    defer it.mutex.Unlock()
+
+    return len(it.orders)
+}
+
+// Full reports whether the kitchen is at KITCHEN_MAX_IN_FLIGHT (never, when unbounded).
+func (it *InFlightTracker) Full() bool {
+    return it.limit > 0 && it.Count() >= it.limit
+}
+
+// Load returns a snapshot for the admin endpoint, oldest order first.
+func (it *InFlightTracker) Load() KitchenLoad {
+    it.mutex.Lock()
+    defer it.mutex.Unlock()
+
+    orders := make([]string, 0, len(it.orders))
+    for orderNo := range it.orders {
+        orders = append(orders, orderNo)
+    }
+    sort.Slice(orders, func(i, j int) bool {
+        return it.orders[orders[i]].started.Before(it.orders[orders[j]].started)
+    })
+    return KitchenLoad{
+        InFlight:  len(it.orders),
+        Limit:     it.limit,
+        Saturated: it.limit > 0 && len(it.orders) >= it.limit,
+        Orders:    orders,
+    }
+}
+
+// GetInFlightTracker is the Constructor. limit <= 0 means unbounded.
+func GetInFlightTracker(limit int) *InFlightTracker {
+    if limit < 0 {
+        limit = 0
+    }
+    return &InFlightTracker{
+        orders: make(map[string]inFlightEntry),
+        limit:  limit,
+    }
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+    "context"
+    "testing"
+    "time"
+
+    "github.com/everestp/pizza-shop/constants"
+    "github.com/everestp/pizza-shop/utils"
+    "github.com/rabbitmq/amqp091-go"
+)
+
+func TestInFlightEntryOutlivesALateFinishOfTheAttemptBefore(t *testing.T) {
+    tracker := GetInFlightTracker(2)
+
+    abandoned := tracker.Enter("A1", nil)
+    tracker.Leave("A1") // Timed out and taken off the stove
+    retry := tracker.Enter("A1", nil)
+    abandoned() // The first attempt finally returns
+    if tracker.Count() != 1 {
+        t.Fatalf("the late finish took the retry off the stove: %d in flight", tracker.Count())
+    }
+    tracker.Enter("A2", nil)
+    if !tracker.Full() {
+        t.Error("2 orders with a limit of 2 isn't full")
+    }
+    retry()
+    retry()
+    if tracker.Count() != 1 || tracker.Full() {
+        t.Errorf("got %d in flight, want just A2", tracker.Count())
+    }
+}
+
+// preparing runs the PREPARING step of order A1 (already in the store) with ctx.
+func (tp *testProcessor) preparing(t *testing.T, ctx context.Context) error {
+    t.Helper()
+
+    return tp.ProcessMessage(ctx, amqp091.Delivery{
+        Acknowledger: tp.settled,
+        MessageId:    "prep-A1",
+        RoutingKey:   constants.KITCHEN_ORDER_QUEUE,
+        Body:         orderEvent(t, "A1", constants.ORDER_PREPARING),
+    })
+}
+
+func TestInFlightCountReturnsToZeroOnEveryExit(t *testing.T) {
+    cases := []struct {
+        name   string
+        status string // A1's status in the store
+        real   bool   // Cook on the wall clock (1-6s) instead of instantly
+        stop   func(tp *testProcessor, cancel context.CancelFunc)
+    }{
+        {name: "cooked", status: constants.ORDER_PREPARING},
+        {name: "failed: the order can't become prepared", status: constants.ORDER_DELIVERED},
+        {name: "cancelled by the caller", status: constants.ORDER_PREPARING, real: true,
+            stop: func(tp *testProcessor, cancel context.CancelFunc) { cancel() }},
+        {name: "taken off the stove", status: constants.ORDER_PREPARING, real: true,
+            stop: func(tp *testProcessor, cancel context.CancelFunc) { tp.inFlight.Leave("A1") }},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            if !tc.real {
+                utils.Clock = instantClock{}
+                t.Cleanup(func() { utils.Clock = utils.RealClock{} })
+            }
+            tp := newTestProcessor(t)
+            tp.store.Save(Order{OrderNo: "A1", OwnerID: "alice", Status: tc.status})
+
+            ctx, cancel := context.WithCancel(context.Background())
+            defer cancel()
+            if tc.stop != nil {
+                go func() {
+                    for deadline := time.Now().Add(time.Second); tp.inFlight.Count() == 0 && time.Now().Before(deadline); {
+                        time.Sleep(time.Millisecond)
+                    }
+                    tc.stop(tp, cancel)
+                }()
+            }
+            done := make(chan struct{})
+            go func() {
+                defer close(done)
+                tp.preparing(t, ctx)
+            }()
+            select {
+            case <-done:
+            case <-time.After(time.Second):
+                t.Fatal("the cook didn't stop")
+            }
+            if n := tp.inFlight.Count(); n != 0 {
+                t.Errorf("%d order(s) still in flight", n)
+            }
+        })
+    }
+}
+
+func TestInFlightCountReturnsToZeroOnATimeout(t *testing.T) {
+    tp := newTestProcessor(t)
+    tp.store.Save(Order{OrderNo: "A1", OwnerID: "alice", Status: constants.ORDER_PREPARING})
+    ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+    defer cancel()
+
+    if err := tp.preparing(t, ctx); err == nil {
+        t.Fatal("a 1-6s cook finished within 20ms")
+    }
+    if n := tp.inFlight.Count(); n != 0 {
+        t.Errorf("%d order(s) still in flight after the timeout", n)
+    }
+}
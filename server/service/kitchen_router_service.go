@@ -0,0 +1,87 @@
+package service
+
+import (
+    "fmt"
+    "strings"
+    "sync"
+
+    "github.com/everestp/pizza-shop/constants"
+    "github.com/everestp/pizza-shop/logger"
+)
+
+// DefaultRegion is the pseudo-region name for the shared fallback kitchen queue.
+const DefaultRegion = "default"
+
+// RegionQueueName returns the queue a region's store cooks from, e.g. "kitchen.orders.north".
+func RegionQueueName(region string) string {
+    if region == "" || region == DefaultRegion {
+        return constants.KITCHEN_ORDER_QUEUE
+    }
+    return constants.KITCHEN_REGION_QUEUE_PREFIX + region
+}
+
+// KitchenQueueOf returns the queue an order event belongs to (set by the router on creation).
+// Events from before regions existed fall back to the shared kitchen queue.
+func KitchenQueueOf(event map[string]any) string {
+    if queue, ok := event["kitchen_queue"].(string); ok && queue != "" {
+        return queue
+    }
+    return constants.KITCHEN_ORDER_QUEUE
+}
+
+// KitchenRouter sends each order to the kitchen of its region/store.
+// Region queues are declared the first time an order is routed to them.
+type KitchenRouter struct {
+    regions   map[string]bool  // Regions that have their own kitchen (KITCHEN_REGIONS)
+    publisher IMessagePubliser // Used to declare region queues
+    declared  map[string]bool  // Region queues already declared by this instance
+    mutex     sync.Mutex
+}
+
+// QueueFor picks the queue for an order's region. Unknown (or missing) regions go to
+// the default kitchen queue, so no order is ever lost to a typo.
+func (kr *KitchenRouter) QueueFor(region string) (string, error) {
+    region = strings.ToLower(strings.TrimSpace(region))
+    if !kr.regions[region] {
+        if region != "" {
+            logger.Log(fmt.Sprintf("Unknown region %q, routing to the default kitchen", region))
+        }
+        return constants.KITCHEN_ORDER_QUEUE, nil
+    }
+
+    queueName := RegionQueueName(region)
+    kr.mutex.Lock()
+    defer kr.mutex.Unlock()
+
+    if !kr.declared[queueName] {
+        if err := kr.publisher.DeclareQueue(queueName); err != nil {
+            return "", fmt.Errorf("failed to declare kitchen queue %q: %w", queueName, err)
+        }
+        kr.declared[queueName] = true
+    }
+    return queueName, nil
+}
+
+// ParseRegions turns "north, South,east" into a clean list of lowercase names.
+func ParseRegions(raw string) []string {
+    regions := []string{}
+    for _, region := range strings.Split(raw, ",") {
+        if region = strings.ToLower(strings.TrimSpace(region)); region != "" {
+            regions = append(regions, region)
+        }
+    }
+    return regions
+}
+
+// GetKitchenRouter is the Constructor.
+func GetKitchenRouter(regions []string, publisher IMessagePubliser) *KitchenRouter {
+    known := make(map[string]bool)
+    for _, region := range regions {
+        known[region] = true
+    }
+    return &KitchenRouter{
+        regions:   known,
+        publisher: publisher,
+        declared:  make(map[string]bool),
+    }
+}
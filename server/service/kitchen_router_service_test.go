@@ -0,0 +1,39 @@
+package service
+
+import (
+    "testing"
+
+    "github.com/everestp/pizza-shop/constants"
+)
+
+func TestOrdersGoToTheirRegionsKitchen(t *testing.T) {
+    fb := newFakeBroker()
+    router := GetKitchenRouter(ParseRegions("north, South"), GetMessagePublisher(fb))
+
+    for region, want := range map[string]string{
+        "north":   constants.KITCHEN_REGION_QUEUE_PREFIX + "north",
+        " North ": constants.KITCHEN_REGION_QUEUE_PREFIX + "north",
+        "south":   constants.KITCHEN_REGION_QUEUE_PREFIX + "south",
+    } {
+        if queue, err := router.QueueFor(region); err != nil || queue != want {
+            t.Errorf("%q: got %q, %v; want %q", region, queue, err, want)
+        }
+    }
+    if declared, _, _, _ := fb.snapshot(); len(declared) != 2 {
+        t.Errorf("declared %v, want each region's queue once", declared)
+    }
+}
+
+func TestUnknownRegionFallsBackToTheDefaultKitchen(t *testing.T) {
+    fb := newFakeBroker()
+    router := GetKitchenRouter(ParseRegions("north"), GetMessagePublisher(fb))
+
+    for _, region := range []string{"", "west", DefaultRegion} {
+        if queue, err := router.QueueFor(region); err != nil || queue != constants.KITCHEN_ORDER_QUEUE {
+            t.Errorf("%q: got %q, %v; want the default kitchen queue", region, queue, err)
+        }
+    }
+    if declared, _, _, _ := fb.snapshot(); len(declared) != 0 {
+        t.Errorf("declared %v for the default kitchen, which main already declares", declared)
+    }
+}
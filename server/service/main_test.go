@@ -0,0 +1,29 @@
+package service
+
+import (
+    "os"
+    "testing"
+
+    "github.com/everestp/pizza-shop/config"
+)
+
+// TestMain pins PORT: the config reloads itself on every read while PORT is unset,
+// which would race with the goroutines the tests start.
+func TestMain(m *testing.M) {
+    if os.Getenv("PORT") == "" {
+        os.Setenv("PORT", "8080")
+    }
+    os.Exit(m.Run())
+}
+
+// withEnv sets env vars for one test and reloads the config with them.
+// The reload cleanup is registered before t.Setenv's, so it runs after the vars are restored.
+func withEnv(t *testing.T, vars map[string]string) {
+    t.Helper()
+
+    t.Cleanup(config.ConfigEnv)
+    for key, value := range vars {
+        t.Setenv(key, value)
+    }
+    config.ConfigEnv()
+}
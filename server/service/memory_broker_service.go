@@ -0,0 +1,293 @@
+package service
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "sync"
+    "time"
+
+    "github.com/everestp/pizza-shop/config"
+    "github.com/everestp/pizza-shop/logger"
+    "github.com/rabbitmq/amqp091-go"
+)
+
+// MemoryBroker is a tiny in-process stand-in for RabbitMQ, used for local demos
+// (MESSAGE_BROKER=memory). Each queue is a buffered Go channel; nothing survives a restart.
+//
+// Messages are handed to the processor as ordinary amqp091.Delivery values whose
+// Acknowledger points back at this broker, so the processor cannot tell the difference.
+type MemoryBroker struct {
+    queues   map[string]chan amqp091.Delivery
+    capacity int // Max messages waiting per queue before publishes are rejected
+    nextTag  uint64
+    mutex    sync.Mutex
+}
+
+// queue returns the channel behind a queue name, creating it on first use.
+// Names get QUEUE_NAME_PREFIX just like on RabbitMQ.
+func (mb *MemoryBroker) queue(queueName string) chan amqp091.Delivery {
+    queueName = config.QueueName(queueName)
+    mb.mutex.Lock()
+    defer mb.mutex.Unlock()
+
+    q, ok := mb.queues[queueName]
+    if !ok {
+        q = make(chan amqp091.Delivery, mb.capacity)
+        mb.queues[queueName] = q
+    }
+    return q
+}
+
+// enqueue adds a message without blocking; a full queue rejects it like reject-publish would.
+func (mb *MemoryBroker) enqueue(queueName, messageId string, body []byte, headers amqp091.Table, redelivered bool) error {
+    mb.mutex.Lock()
+    mb.nextTag++
+    tag := mb.nextTag
+    mb.mutex.Unlock()
+
+    delivery := amqp091.Delivery{
+        ContentType: "application/json",
+        MessageId:   messageId,
+        Headers:     headers,
+        Body:        body,
+        DeliveryTag: tag,
+        Redelivered: redelivered,
+        RoutingKey:  queueName,
+    }
+    delivery.Acknowledger = &memoryAcknowledger{broker: mb, queueName: queueName, messageId: messageId, body: body, headers: headers}
+
+    select {
+    case mb.queue(queueName) <- delivery:
+        return nil
+    default:
+        return fmt.Errorf("%w: queue %q is full", ErrPublishRejected, queueName)
+    }
+}
+
+// memoryAcknowledger implements amqp091.Acknowledger for one in-memory delivery.
+// Ack drops the message; Nack/Reject with requeue puts it back marked as redelivered.
+type memoryAcknowledger struct {
+    broker    *MemoryBroker
+    queueName string
+    messageId string
+    body      []byte
+    headers   amqp091.Table
+}
+
+func (ma *memoryAcknowledger) Ack(tag uint64, multiple bool) error {
+    return nil
+}
+
+func (ma *memoryAcknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+    if !requeue {
+        return nil
+    }
+    if err := ma.broker.enqueue(ma.queueName, ma.messageId, ma.body, ma.headers, true); err != nil {
+        logger.Log(fmt.Sprintf("Dropping requeued message: %v", err))
+        return err
+    }
+    return nil
+}
+
+func (ma *memoryAcknowledger) Reject(tag uint64, requeue bool) error {
+    return ma.Nack(tag, false, requeue)
+}
+
+// MemoryPublisher implements IMessagePubliser on top of a MemoryBroker.
+type MemoryPublisher struct {
+    broker *MemoryBroker
+}
+
+func (mp *MemoryPublisher) PublishEvent(queueName string, body any) error {
+    return mp.PublishEventCtx(context.Background(), queueName, body)
+}
+
+func (mp *MemoryPublisher) PublishEventCtx(ctx context.Context, queueName string, body any) error {
+    return mp.PublishEventWithOptions(PublishOptions{RoutingKey: queueName, Context: ctx}, body)
+}
+
+// PublishEventWithOptions has no real exchanges to route through: the routing key is
+// used as the queue name, which matches the default exchange's behavior. Headers are kept.
+func (mp *MemoryPublisher) PublishEventWithOptions(options PublishOptions, body any) error {
+    if options.Context != nil && options.Context.Err() != nil {
+        return fmt.Errorf("publish abandoned: %w", options.Context.Err())
+    }
+    data, err := json.Marshal(body)
+    if err != nil {
+        return fmt.Errorf("failed to marshal body: %w", err)
+    }
+    queueName := options.RoutingKey
+    if queueName == "" {
+        queueName = config.GetEnvProperty("rabbit_mq_default_queue")
+    }
+    if queueName == "" {
+        return ErrNoQueueName
+    }
+    if err := mp.broker.enqueue(queueName, messageIdOf(options), data, injectOptionsTrace(options), false); err != nil {
+        return err
+    }
+    logger.Log(fmt.Sprintf("Event published to in-memory queue %q: %v", queueName, body))
+    return nil
+}
+
+func (mp *MemoryPublisher) DeclareQueue(queueName string) error {
+    mp.broker.queue(queueName)
+    return nil
+}
+
+func (mp *MemoryPublisher) QueueDepth(queueName string) (int, error) {
+    return len(mp.broker.queue(queueName)), nil
+}
+
+// QueueStats reports the queue's backlog. In-memory queues are created on first use,
+// so there is no "not found", and consumers aren't tracked.
+func (mp *MemoryPublisher) QueueStats(queueName string) (QueueStats, error) {
+    return QueueStats{Name: queueName, Messages: len(mp.broker.queue(queueName))}, nil
+}
+
+func (mp *MemoryPublisher) Close() {}
+
+// MemoryConsumer implements IMessageConsumerService on top of a MemoryBroker.
+// It uses the same worker pool and panic recovery as the RabbitMQ consumer.
+type MemoryConsumer struct {
+    broker   *MemoryBroker
+    pool     *WorkerPool
+    maxLimit int
+    inFlight sync.WaitGroup
+    stopped  chan struct{}
+    stopOnce sync.Once
+    // processingTimeout is how long one message may take (0 = no limit).
+    processingTimeout time.Duration
+    // OnProcessError is called for every failed message (default: LogProcessError).
+    OnProcessError ProcessErrorHandler
+    // throughput counts processed messages and logs the rate now and then.
+    throughput *ThroughputTracker
+    // breaker pauses consuming after CONSUMER_BREAKER_THRESHOLD failures in a row.
+    breaker *ConsumerBreaker
+}
+
+func (mc *MemoryConsumer) DeclareQueue(queueName string) error {
+    mc.broker.queue(queueName)
+    return nil
+}
+
+// PurgeQueue empties the in-memory queue.
+func (mc *MemoryConsumer) PurgeQueue(queueName string) (int, error) {
+    q := mc.broker.queue(queueName)
+    purged := 0
+    for {
+        select {
+        case <-q:
+            purged++
+        default:
+            return purged, nil
+        }
+    }
+}
+
+// ConsumeEventAndProcess pulls messages off the in-memory queue until StopConsuming is called.
+func (mc *MemoryConsumer) ConsumeEventAndProcess(queueName string, processor IMessageProcessor) error {
+    logger.Log(fmt.Sprintf("Starting in-memory consumption from %q...", queueName))
+    q := mc.broker.queue(queueName)
+    mc.throughput.start(queueName, mc.stopped)
+
+    for {
+        // Paused by the breaker: leave the messages on the queue until the cooldown is over.
+        mc.breaker.Wait(mc.stopped)
+
+        select {
+        case <-mc.stopped:
+            return nil
+        case d := <-q:
+            mc.pool.Acquire()
+            mc.inFlight.Add(1)
+            go func(d amqp091.Delivery) {
+                defer mc.inFlight.Done()
+                defer mc.pool.Release()
+                defer recoverFromProcessingPanic(d, false)
+                ctx, cancel := processingContext(mc.processingTimeout)
+                defer cancel()
+                err := processor.ProcessMessage(ctx, d)
+                mc.throughput.Record()
+                if err != nil {
+                    mc.OnProcessError(d, err)
+                }
+                mc.breaker.Record(err)
+            }(d)
+        }
+    }
+}
+
+// StopConsuming stops taking new messages and waits for in-flight ones (or the deadline).
+func (mc *MemoryConsumer) StopConsuming(ctx context.Context) error {
+    mc.stopOnce.Do(func() { close(mc.stopped) })
+
+    drained := make(chan struct{})
+    go func() {
+        mc.inFlight.Wait()
+        close(drained)
+    }()
+
+    select {
+    case <-drained:
+        return nil
+    case <-ctx.Done():
+        return ctx.Err()
+    }
+}
+
+func (mc *MemoryConsumer) SetConcurrency(concurrency int) error {
+    if concurrency < 1 || concurrency > mc.maxLimit {
+        return fmt.Errorf("%w: must be between 1 and %d, got %d", ErrConcurrencyOutOfRange, mc.maxLimit, concurrency)
+    }
+    mc.pool.Resize(concurrency)
+    return nil
+}
+
+func (mc *MemoryConsumer) Concurrency() int {
+    return mc.pool.Limit()
+}
+
+// AutoAck is always false: the processor acks, and requeues go back onto the Go channel.
+func (mc *MemoryConsumer) AutoAck() bool {
+    return false
+}
+
+// Breaker reports the circuit breaker's state.
+func (mc *MemoryConsumer) Breaker() BreakerState {
+    return mc.breaker.State()
+}
+
+func (mc *MemoryConsumer) Close() {}
+
+// GetMemoryBroker is the Constructor. Publisher and consumer must share one broker.
+func GetMemoryBroker(capacity int) *MemoryBroker {
+    if capacity < 1 {
+        capacity = 1000
+    }
+    return &MemoryBroker{
+        queues:   make(map[string]chan amqp091.Delivery),
+        capacity: capacity,
+    }
+}
+
+// GetMemoryPublisher is the Constructor.
+func GetMemoryPublisher(broker *MemoryBroker) *MemoryPublisher {
+    return &MemoryPublisher{broker: broker}
+}
+
+// GetMemoryConsumer is the Constructor.
+func GetMemoryConsumer(broker *MemoryBroker) *MemoryConsumer {
+    return &MemoryConsumer{
+        broker:   broker,
+        pool:     GetWorkerPool(config.GetEnvPropertyAsInt("consumer_concurrency", 10)),
+        maxLimit: config.GetEnvPropertyAsInt("max_consumer_concurrency", 100),
+        stopped:  make(chan struct{}),
+
+        processingTimeout: time.Duration(config.GetEnvPropertyAsInt("message_processing_timeout", 60000)) * time.Millisecond,
+        OnProcessError:    LogProcessError,
+        throughput:        GetThroughputTracker(time.Duration(config.GetEnvPropertyAsInt("consumer_rate_log_interval", 60)) * time.Second),
+        breaker:           newConsumerBreaker(),
+    }
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+    "context"
+    "encoding/json"
+    "testing"
+    "time"
+
+    "github.com/everestp/pizza-shop/constants"
+    "github.com/everestp/pizza-shop/utils"
+)
+
+// instantClock is a fake clock on which every timer fires right away, so cooking takes no time.
+type instantClock struct {
+    utils.RealClock
+}
+
+func (instantClock) NewTimer(d time.Duration) *time.Timer { return time.NewTimer(0) }
+
+// customerSocket is an online customer: every frame they are sent arrives on 'frames'.
+type customerSocket struct {
+    frames chan []byte
+}
+
+func (cs *customerSocket) SendMessage(message []byte) error {
+    cs.frames <- message
+    return nil
+}
+func (cs *customerSocket) SendBinary(message []byte) error  { return cs.SendMessage(message) }
+func (cs *customerSocket) ReceivedMessage() ([]byte, error) { return nil, nil }
+func (cs *customerSocket) Ping() error                      { return nil }
+func (cs *customerSocket) Context() context.Context         { return context.Background() }
+func (cs *customerSocket) Close() error                     { return nil }
+func (cs *customerSocket) Metadata() ConnectionMetadata {
+    return ConnectionMetadata{ConnectedAt: time.Now()}
+}
+
+func TestOrderReachesDeliveredOnTheMemoryBroker(t *testing.T) {
+    utils.Clock = instantClock{}
+    t.Cleanup(func() { utils.Clock = utils.RealClock{} })
+
+    broker := GetMemoryBroker(10)
+    publisher := GetMemoryPublisher(broker)
+    consumer := GetMemoryConsumer(broker)
+    store := GetOrderStore()
+    alice := &customerSocket{frames: make(chan []byte, 10)}
+    online := func(clientId string) IWebSocketConnection {
+        if clientId == "alice" {
+            return alice
+        }
+        return nil
+    }
+    processor := GetMessageProcessorService(publisher, online, GetOrderStatusValidator(), store,
+        GetKitchenMetrics(), ProcessorOptions{AutoAck: consumer.AutoAck()})
+    exited := make(chan struct{})
+    go func() {
+        defer close(exited)
+        consumer.ConsumeEventAndProcess(constants.KITCHEN_ORDER_QUEUE, processor)
+    }()
+    t.Cleanup(func() {
+        consumer.StopConsuming(context.Background())
+        <-exited // Done with utils.Clock before it is put back
+    })
+
+    store.Save(Order{OrderNo: "A1", OwnerID: "alice", Status: constants.ORDER_ORDERED})
+    if err := publisher.PublishEvent(constants.KITCHEN_ORDER_QUEUE, map[string]any{
+        "order_no": "A1", "order_status": constants.ORDER_ORDERED, "customer_id": "alice",
+    }); err != nil {
+        t.Fatalf("publish: %v", err)
+    }
+
+    // The customer hears that the kitchen took it, then that it's ready.
+    for _, want := range []string{constants.ORDER_RECEIVED, constants.ORDER_PREPARED_SUCCESSFULLY} {
+        select {
+        case frame := <-alice.frames:
+            var update map[string]any
+            if err := json.Unmarshal(frame, &update); err != nil || update["message"] != want {
+                t.Fatalf("got %s, want %q", frame, want)
+            }
+        case <-time.After(time.Second):
+            t.Fatalf("no %q update arrived", want)
+        }
+    }
+    if order, _ := store.Get("A1"); order.Status != constants.ORDER_DELIVERED {
+        t.Errorf("status: got %q, want delivered", order.Status)
+    }
+    if depth, _ := publisher.QueueDepth(constants.KITCHEN_ORDER_QUEUE); depth != 0 {
+        t.Errorf("%d message(s) left on the queue", depth)
+    }
+}
@@ -1,7 +1,14 @@
 package service
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
 
 	"github.com/everestp/pizza-shop/config"
 	"github.com/everestp/pizza-shop/logger"
@@ -13,50 +20,157 @@ import (
 // which is another interface that tells this service HOW to handle the data.
 type IMessageConsumerService interface {
 	DeclareQueue(queueName string) error
+	PurgeQueue(queueName string) (int, error)
 	ConsumeEventAndProcess(queueName string, processor IMessageProcessor) error
+	StopConsuming(ctx context.Context) error
+	SetConcurrency(concurrency int) error
+	Concurrency() int
+	AutoAck() bool
+	// Breaker reports whether consuming is paused after repeated failures (for /health).
+	Breaker() BreakerState
+	Close()
+}
+
+// ErrConsumptionEnded is returned by ConsumeEventAndProcess when messages stop arriving
+// without StopConsuming having been called (the connection was lost, the channel could
+// not be reopened, or the broker cancelled the subscription, e.g. the queue was deleted).
+var ErrConsumptionEnded = errors.New("message consumption ended unexpectedly")
+
+// ErrConcurrencyOutOfRange is returned when asked for fewer than 1 or too many workers.
+var ErrConcurrencyOutOfRange = errors.New("concurrency out of range")
+
+// ProcessErrorHandler is called when the processor returns an error for a delivery.
+// Hook alerting, metrics or custom dead-lettering in here instead of editing the consumer.
+// It runs on the worker goroutine, after the processor has already acked/nacked the message.
+type ProcessErrorHandler func(delivery amqp091.Delivery, err error)
+
+// LogProcessError is the default ProcessErrorHandler: it just logs.
+func LogProcessError(delivery amqp091.Delivery, err error) {
+	logger.Log(fmt.Sprintf("Message processing failed: %v", err))
+}
+
+// consumerTag identifies our subscriptions on the broker so we can cancel them on shutdown.
+// Each queue gets its own tag: "pizza-shop-consumer:<queue>".
+const consumerTag = "pizza-shop-consumer"
+
+// subscription is one queue we consume from, remembered so it can be
+// re-subscribed when the channel has to be reopened.
+type subscription struct {
+	queue     string
+	tag       string
+	processor IMessageProcessor
 }
 
 type MessageConsumerService struct {
-	conf *config.RabbitMQConection
+	conf     config.IRabbitMQConnection
+	channel  config.IAMQPChannel // The channel our subscriptions live on (shared by every queue)
+	subs     []subscription      // One per queue we listen to (each with its own consumer tag)
+	acks     *AckBatcher         // Batches acks for 'channel' (nil = ack one by one)
+	ackBatch int                 // CONSUMER_ACK_BATCH_SIZE; 0 or 1 turns batching off
+	inFlight sync.WaitGroup      // Counts messages that are still being processed
+	mutex    sync.Mutex          // Guards 'channel', 'acks' and 'subs' between the consume loops and shutdown
+	stopped  chan struct{}       // Closed once StopConsuming has run
+	stopOnce sync.Once
+	dead     chan struct{}       // Closed once consumption has ended unexpectedly (see ErrConsumptionEnded)
+	deadErr  error
+	deadOnce sync.Once
+	pool     *WorkerPool         // Caps how many messages are processed at once
+	maxLimit int                 // Upper bound accepted by SetConcurrency
+	// autoAck trades delivery guarantees for throughput (CONSUMER_AUTO_ACK=true):
+	//   - false (default): we ack after processing; a crash means redelivery, nothing is lost.
+	//   - true: the broker forgets a message the moment it's sent to us; a crash or a
+	//     failed step loses that order, but there is no ack round-trip per message.
+	autoAck bool
+	// processingTimeout is how long one message may take (MESSAGE_PROCESSING_TIMEOUT_MS; 0 = no limit).
+	processingTimeout time.Duration
+	// OnProcessError is called for every failed message (default: LogProcessError).
+	// Set it before ConsumeEventAndProcess is called.
+	OnProcessError ProcessErrorHandler
+	// throughput counts processed messages and logs the rate now and then.
+	throughput *ThroughputTracker
+	// breaker pauses consuming after CONSUMER_BREAKER_THRESHOLD failures in a row.
+	breaker *ConsumerBreaker
 }
 
 // DeclareQueue ensures the queue exists before we start listening.
 // It's a safety step to avoid errors if the consumer starts before the publisher.
+// Like the publisher, it uses a short-lived channel of its own (never the consuming channel).
 func (mcs *MessageConsumerService) DeclareQueue(queueName string) error {
-	channel := mcs.conf.GetChannel()
-	if channel == nil {
-		return fmt.Errorf("message channel is nil, please retry")
-	}
-
-	_, err := channel.QueueDeclare(
-		queueName,
-		true,  // Durable: Queue survives RabbitMQ restart
-		false, // Auto-delete: No
-		false, // Exclusive: No
-		false, // No-wait: No
-		nil,
-	)
-	return err
+	return mcs.conf.DeclareQueue(queueName)
+}
+
+// PurgeQueue drops the queue's waiting messages (dev only, see PURGE_QUEUE_ON_START).
+func (mcs *MessageConsumerService) PurgeQueue(queueName string) (int, error) {
+	return mcs.conf.PurgeQueue(queueName)
 }
 
 // ConsumeEventAndProcess starts a long-running loop that waits for messages.
+// It can be called once per queue (e.g. one per region); all queues share one
+// channel, one prefetch budget and one worker pool.
+// The queue is declared first (idempotently), so consuming works whichever side starts first.
 func (mcs *MessageConsumerService) ConsumeEventAndProcess(queueName string, processor IMessageProcessor) error {
-	channel := mcs.conf.GetChannel()
-	if channel == nil {
-		return fmt.Errorf("message channel is nil, please retry")
+	// 1. Make sure there is something to listen to: Consume on a missing queue fails.
+	if err := mcs.DeclareQueue(queueName); err != nil {
+		return fmt.Errorf("failed to declare queue %q before consuming: %w", queueName, err)
 	}
 
-	logger.Log("Starting message consumption...")
+	sub := subscription{
+		queue:     queueName,
+		tag:       fmt.Sprintf("%s:%s", consumerTag, queueName),
+		processor: processor,
+	}
 
+	mcs.mutex.Lock()
+	channel, err := mcs.consumeChannelLocked()
+	if err == nil {
+		logger.Log(fmt.Sprintf("Starting message consumption from %q...", queueName))
+		err = mcs.subscribeLocked(channel, sub)
+	}
+	if err == nil {
+		mcs.subs = append(mcs.subs, sub)
+	}
+	mcs.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	mcs.throughput.start(queueName, mcs.stopped)
+
+	// 5. Block Until Shutdown
+	// This prevents the function from returning, keeping the consumer alive
+	// until StopConsuming is called, or until consuming can't go on (then the caller hears why).
+	select {
+	case <-mcs.stopped:
+		return nil
+	case <-mcs.dead:
+		return mcs.deadErr
+	}
+}
+
+// fail records why consumption ended and releases every ConsumeEventAndProcess call.
+// Only the first reason is kept; nothing happens once we are shutting down.
+func (mcs *MessageConsumerService) fail(err error) {
+	select {
+	case <-mcs.stopped:
+		return
+	default:
+	}
+	mcs.deadOnce.Do(func() {
+		mcs.deadErr = err
+		close(mcs.dead)
+	})
+}
+
+// subscribeLocked starts consuming one queue on 'channel'. Callers hold mcs.mutex.
+func (mcs *MessageConsumerService) subscribeLocked(channel config.IAMQPChannel, sub subscription) error {
 	// 2. Consume returns a Go Channel (msgs) where messages will arrive.
 	msgs, err := channel.Consume(
-		queueName, // The queue to listen to
-		"",        // Consumer tag (unique ID for this consumer instance)
-		false,     // Auto-Ack: Set to false so we manually acknowledge successful processing
-		false,     // Exclusive
-		false,     // No-local
-		false,     // No-wait
-		nil,       // Args
+		config.QueueName(sub.queue), // The queue to listen to (with QUEUE_NAME_PREFIX)
+		sub.tag,                     // Consumer tag (unique ID for this consumer instance)
+		mcs.autoAck,                 // Auto-Ack: false (default) means we manually acknowledge successful processing
+		false,                       // Exclusive
+		false,                       // No-local
+		false,                       // No-wait
+		nil,                         // Args
 	)
 	if err != nil {
 		return fmt.Errorf("failed to consume message: %w", err)
@@ -64,30 +178,353 @@ func (mcs *MessageConsumerService) ConsumeEventAndProcess(queueName string, proc
 
 	// 3. The Worker Loop
 	// We run this in a Goroutine so it doesn't block the rest of the app.
-	go func() {
-		for msg := range msgs {
-			// 4. Parallel Processing
-			// We start a NEW Goroutine for every single message.
-			// This allows the app to process multiple pizzas at the same time!
-			go func(d amqp091.Delivery) {
-				err := processor.ProcessMessage(d)
-				if err != nil {
-					logger.Log(fmt.Sprintf("Message processing failed: %v", err))
-					// In the future, you might want to msg.Nack() here to retry
-				}
-			}(msg)
+	// It ends when the channel closes; a reopened channel gets a fresh loop.
+	go mcs.deliver(msgs, channel, sub, mcs.acks)
+	return nil
+}
+
+// deliver hands every message from one subscription to the worker pool.
+// When the deliveries stop while the channel is still open and nobody asked for it
+// (no shutdown, no breaker pause), the broker cancelled us: consumption has ended.
+func (mcs *MessageConsumerService) deliver(msgs <-chan amqp091.Delivery, channel config.IAMQPChannel, sub subscription, acks *AckBatcher) {
+	defer func() {
+		if !channel.IsClosed() && !mcs.breaker.Paused() {
+			mcs.fail(fmt.Errorf("%w: the broker cancelled consumer %s of %q", ErrConsumptionEnded, sub.tag, sub.queue))
 		}
 	}()
+	processor := sub.processor
+
+	for msg := range msgs {
+		// While the breaker has us paused, messages already sent to us wait here.
+		mcs.breaker.Wait(mcs.stopped)
+
+		// 4. Parallel Processing
+		// We start a NEW Goroutine for every single message.
+		// This allows the app to process multiple pizzas at the same time!
+		// The WaitGroup lets shutdown wait for every pizza in the oven,
+		// and the pool makes the loop wait when every worker is busy.
+		mcs.pool.Acquire()
+		mcs.inFlight.Add(1)
+		// Batched acks: the processor's msg.Ack(false) now goes through the batcher.
+		if acks != nil {
+			msg.Acknowledger = acks
+		}
+		// If the channel dies while the message is processed, its ack is skipped (see liveAcknowledger).
+		msg.Acknowledger = liveAcknowledger{Acknowledger: msg.Acknowledger, channel: channel}
+		go func(d amqp091.Delivery) {
+			defer mcs.inFlight.Done()
+			defer mcs.pool.Release()
+			defer recoverFromProcessingPanic(d, mcs.autoAck)
+			ctx, cancel := processingContext(mcs.processingTimeout)
+			defer cancel()
+			err := processor.ProcessMessage(ctx, d)
+			mcs.throughput.Record()
+			if err != nil {
+				mcs.OnProcessError(d, err)
+			}
+			if mcs.breaker.Record(err) {
+				go mcs.pause()
+			}
+		}(msg)
+	}
+}
 
-	// 5. Block Forever
-	// This prevents the function from returning, keeping the consumer alive.
-	select {}
+// ErrChannelGone means an ack or nack was skipped because the delivery's channel has closed.
+var ErrChannelGone = errors.New("delivery channel is closed")
+
+// liveAcknowledger acks, nacks and rejects only while the delivery's channel is open.
+// Once it has closed (e.g. during a reconnect) the broker has already requeued every message
+// we hadn't acked, so there is nothing to settle: the redelivered copy is processed (or skipped
+// as a duplicate by the idempotency guard) on the new channel instead.
+type liveAcknowledger struct {
+	amqp091.Acknowledger
+	channel config.IAMQPChannel
+}
+
+func (la liveAcknowledger) Ack(tag uint64, multiple bool) error {
+	if la.channel.IsClosed() {
+		return la.skipped(tag, "ack")
+	}
+	return la.Acknowledger.Ack(tag, multiple)
+}
+
+func (la liveAcknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	if la.channel.IsClosed() {
+		return la.skipped(tag, "nack")
+	}
+	return la.Acknowledger.Nack(tag, multiple, requeue)
+}
+
+func (la liveAcknowledger) Reject(tag uint64, requeue bool) error {
+	if la.channel.IsClosed() {
+		return la.skipped(tag, "reject")
+	}
+	return la.Acknowledger.Reject(tag, requeue)
+}
+
+// skipped logs and reports an ack that had nowhere to go.
+func (la liveAcknowledger) skipped(tag uint64, action string) error {
+	logger.Log(fmt.Sprintf("Skipping %s of delivery %d: its channel is closed, the broker redelivers it", action, tag))
+	return ErrChannelGone
+}
+
+// consumeChannelLocked returns the shared consuming channel, opening it on first use.
+// Callers hold mcs.mutex.
+func (mcs *MessageConsumerService) consumeChannelLocked() (config.IAMQPChannel, error) {
+	if mcs.channel != nil && !mcs.channel.IsClosed() {
+		return mcs.channel, nil
+	}
+
+	channel, err := mcs.conf.GetChannel()
+	if err != nil {
+		return nil, err
+	}
+	// Prefetch: the broker only sends as many unacked messages as we have workers.
+	if err := applyPrefetch(channel, mcs.pool.Limit()); err != nil {
+		return nil, err
+	}
+	mcs.channel = channel
+	mcs.acks = nil
+	if mcs.ackBatch > 1 && !mcs.autoAck {
+		window := time.Duration(config.GetEnvPropertyAsInt("consumer_ack_batch_window", 100)) * time.Millisecond
+		mcs.acks = GetAckBatcher(channel, mcs.ackBatch, window)
+	}
+	go mcs.watchChannel(channel)
+	return channel, nil
+}
+
+// watchChannel waits for the consuming channel to close. When the broker closed just
+// the channel (e.g. after a protocol error) and the TCP connection is still up, only
+// the channel is reopened: prefetch is set again and every queue is re-subscribed.
+// Messages that were unacked on the old channel are redelivered by the broker.
+func (mcs *MessageConsumerService) watchChannel(channel config.IAMQPChannel) {
+	closed := <-channel.NotifyClose(make(chan *amqp091.Error, 1))
+
+	select {
+	case <-mcs.stopped:
+		return // We are shutting down; nothing to recover.
+	default:
+	}
+	if closed == nil {
+		return // Closed by us on purpose.
+	}
+	if !mcs.conf.IsConnected() {
+		logger.Log(fmt.Sprintf("CRITICAL: consumer connection lost (%v); not reopening the channel", closed))
+		mcs.fail(fmt.Errorf("%w: connection lost: %v", ErrConsumptionEnded, closed))
+		return
+	}
+
+	logger.Log(fmt.Sprintf("Consumer channel closed by the broker (%v); reopening it on the same connection", closed))
+	if err := mcs.reopenChannel(); err != nil {
+		logger.Log(fmt.Sprintf("CRITICAL: failed to reopen consumer channel: %v", err))
+		mcs.fail(fmt.Errorf("%w: failed to reopen the channel: %v", ErrConsumptionEnded, err))
+	}
+}
+
+// reopenChannel opens a fresh consuming channel and re-subscribes every queue on it.
+func (mcs *MessageConsumerService) reopenChannel() error {
+	mcs.mutex.Lock()
+	defer mcs.mutex.Unlock()
+
+	channel, err := mcs.consumeChannelLocked()
+	if err != nil {
+		return err
+	}
+	for _, sub := range mcs.subs {
+		if err := mcs.subscribeLocked(channel, sub); err != nil {
+			return fmt.Errorf("re-subscribing %q: %w", sub.queue, err)
+		}
+		logger.Log(fmt.Sprintf("Resumed message consumption from %q", sub.queue))
+	}
+	return nil
+}
+
+// pause cancels every subscription, so the broker stops sending us messages, waits
+// out the breaker's cooldown and then subscribes again on the same channel.
+// Messages still unacked keep waiting in the deliver loops until then.
+func (mcs *MessageConsumerService) pause() {
+	mcs.mutex.Lock()
+	channel := mcs.channel
+	subs := append([]subscription(nil), mcs.subs...)
+	mcs.mutex.Unlock()
+
+	if channel != nil && !channel.IsClosed() {
+		for _, sub := range subs {
+			if err := channel.Cancel(sub.tag, false); err != nil {
+				logger.Log(fmt.Sprintf("Failed to pause consumer %s: %v", sub.tag, err))
+			}
+		}
+	}
+
+	mcs.breaker.Wait(mcs.stopped)
+	select {
+	case <-mcs.stopped:
+		return // Shut down during the cooldown.
+	default:
+	}
+	if err := mcs.reopenChannel(); err != nil {
+		logger.Log(fmt.Sprintf("CRITICAL: failed to resume consuming after the cooldown: %v", err))
+	}
+}
+
+// Breaker reports the circuit breaker's state.
+func (mcs *MessageConsumerService) Breaker() BreakerState {
+	return mcs.breaker.State()
+}
+
+// SetConcurrency resizes the worker pool and the broker prefetch while consuming.
+func (mcs *MessageConsumerService) SetConcurrency(concurrency int) error {
+	if concurrency < 1 || concurrency > mcs.maxLimit {
+		return fmt.Errorf("%w: must be between 1 and %d, got %d", ErrConcurrencyOutOfRange, mcs.maxLimit, concurrency)
+	}
+
+	mcs.mutex.Lock()
+	defer mcs.mutex.Unlock()
+
+	if mcs.channel != nil && !mcs.channel.IsClosed() {
+		if err := applyPrefetch(mcs.channel, concurrency); err != nil {
+			return err
+		}
+	}
+	mcs.pool.Resize(concurrency)
+	logger.Log(fmt.Sprintf("Consumer concurrency set to %d", concurrency))
+	return nil
+}
+
+// AutoAck reports whether the broker acks for us, so the processor knows not to.
+func (mcs *MessageConsumerService) AutoAck() bool {
+	return mcs.autoAck
+}
+
+// Concurrency returns the current worker limit (which is also the prefetch count).
+func (mcs *MessageConsumerService) Concurrency() int {
+	return mcs.pool.Limit()
+}
+
+// processingContext gives one message its processing deadline (none when timeout is 0).
+func processingContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+// applyPrefetch issues basic.qos. We use the channel-wide ("global") form because
+// RabbitMQ applies it to the live consumer right away, while a per-consumer
+// prefetch only affects consumers created afterwards.
+func applyPrefetch(channel config.IAMQPChannel, prefetch int) error {
+	if err := channel.Qos(prefetch, 0, true); err != nil {
+		return fmt.Errorf("failed to set prefetch to %d: %w", prefetch, err)
+	}
+	return nil
+}
+
+// recoverFromProcessingPanic stops a panic in one message from taking down the whole app.
+// Without it the delivery would also never be acked or nacked and would sit "unacked"
+// on the broker until the connection closes.
+func recoverFromProcessingPanic(d amqp091.Delivery, autoAck bool) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	if autoAck {
+		// The broker already considers it delivered; there's nothing to nack.
+		logger.Log(fmt.Sprintf("CRITICAL: panic while processing order #%v (auto-ack, message lost): %v\n%s", orderNoFromBody(d.Body), r, debug.Stack()))
+		return
+	}
+
+	// A type error will panic the same way every time, so it must not be requeued.
+	// Anything else gets exactly one more chance.
+	_, isTypeError := r.(*runtime.TypeAssertionError)
+	requeue := !isTypeError && !d.Redelivered
+
+	logger.Log(fmt.Sprintf("CRITICAL: panic while processing order #%v: %v (requeue=%t)\n%s", orderNoFromBody(d.Body), r, requeue, debug.Stack()))
+	if err := d.Nack(false, requeue); err != nil {
+		logger.Log(fmt.Sprintf("Failed to nack panicked message: %v", err))
+	}
+}
+
+// orderNoFromBody best-effort extracts the order number for log context.
+func orderNoFromBody(body []byte) any {
+	var event struct {
+		OrderNo any `json:"order_no"`
+	}
+	if err := json.Unmarshal(body, &event); err != nil || event.OrderNo == nil {
+		return "unknown"
+	}
+	return event.OrderNo
+}
+
+// StopConsuming cancels the subscription so no new messages arrive, then waits for
+// the in-flight messages to finish (or for ctx to expire, whichever comes first).
+// Unprocessed messages stay unacked and RabbitMQ will redeliver them later.
+func (mcs *MessageConsumerService) StopConsuming(ctx context.Context) error {
+	// Closed first, so the subscriptions ending below aren't mistaken for a failure.
+	mcs.stopOnce.Do(func() { close(mcs.stopped) })
+
+	mcs.mutex.Lock()
+	channel := mcs.channel
+	subs := append([]subscription(nil), mcs.subs...)
+	mcs.mutex.Unlock()
+
+	if channel != nil && !channel.IsClosed() {
+		for _, sub := range subs {
+			if err := channel.Cancel(sub.tag, false); err != nil {
+				logger.Log(fmt.Sprintf("Failed to cancel consumer %s: %v", sub.tag, err))
+			}
+		}
+	}
+
+	// Wait for the workers in a separate goroutine so we can respect the deadline.
+	drained := make(chan struct{})
+	go func() {
+		mcs.inFlight.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		logger.Log("All in-flight messages processed")
+		mcs.flushAcks()
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("timed out waiting for in-flight messages: %w", ctx.Err())
+	}
+}
+
+// flushAcks sends any batched acks that are still waiting.
+func (mcs *MessageConsumerService) flushAcks() {
+	mcs.mutex.Lock()
+	acks := mcs.acks
+	mcs.mutex.Unlock()
+
+	if acks != nil {
+		acks.Flush()
+	}
+}
+
+// Close shuts down the consumer's RabbitMQ connection.
+func (mcs *MessageConsumerService) Close() {
+	mcs.flushAcks()
+	mcs.conf.Close()
 }
 
 // GetMessageConsumerService is the factory function to initialize the service.
-func GetMessageConsumerService() *MessageConsumerService {
-	rabbitMQConf := config.GetNewRabbitMQConnection()
+// 'rabbitMQConf' usually comes from the ConnectionManager, so consumers share one connection.
+func GetMessageConsumerService(rabbitMQConf config.IRabbitMQConnection) *MessageConsumerService {
 	return &MessageConsumerService{
-		conf: rabbitMQConf,
+		conf:     rabbitMQConf,
+		stopped:  make(chan struct{}),
+		dead:     make(chan struct{}),
+		pool:     GetWorkerPool(config.GetEnvPropertyAsInt("consumer_concurrency", 10)),
+		maxLimit: config.GetEnvPropertyAsInt("max_consumer_concurrency", 100),
+		autoAck:  config.GetFlags().AutoAck,
+		ackBatch: config.GetEnvPropertyAsInt("consumer_ack_batch_size", 0),
+
+		processingTimeout: time.Duration(config.GetEnvPropertyAsInt("message_processing_timeout", 60000)) * time.Millisecond,
+
+		OnProcessError: LogProcessError,
+		throughput:     GetThroughputTracker(time.Duration(config.GetEnvPropertyAsInt("consumer_rate_log_interval", 60)) * time.Second),
+		breaker:        newConsumerBreaker(),
 	}
 }
\ No newline at end of file
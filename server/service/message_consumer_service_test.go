@@ -0,0 +1,466 @@
+package service
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/everestp/pizza-shop/constants"
+    "github.com/everestp/pizza-shop/utils"
+    "github.com/rabbitmq/amqp091-go"
+)
+
+// ackingProcessor acks every message and reports its body.
+// A message whose body is panicOn makes it panic instead; one whose body is failOn
+// is nacked and returned as an error.
+type ackingProcessor struct {
+    processed chan string
+    panicOn   string
+    failOn    string
+}
+
+func (ap *ackingProcessor) ProcessMessage(ctx context.Context, message interface{}) error {
+    msg := message.(amqp091.Delivery)
+    if ap.panicOn != "" && string(msg.Body) == ap.panicOn {
+        var totals map[string]int
+        totals["boom"]++ // A nil-map write, like a real bug would do
+    }
+    if ap.failOn != "" && string(msg.Body) == ap.failOn {
+        msg.Nack(false, false)
+        return fmt.Errorf("could not process %q", msg.Body)
+    }
+    msg.Ack(false)
+    ap.processed <- string(msg.Body)
+    return nil
+}
+
+// consumerFixture is a consumer on a fakeBroker, consuming one queue in the background.
+type consumerFixture struct {
+    broker    *fakeBroker
+    consumer  *MessageConsumerService
+    processor *ackingProcessor
+    tag       string
+    done      chan error    // Gets what ConsumeEventAndProcess returned
+    exited    chan struct{} // Closed once ConsumeEventAndProcess has returned
+}
+
+func startConsumer(t *testing.T, queueName string) *consumerFixture {
+    t.Helper()
+    return startConsumerWith(t, queueName, nil)
+}
+
+// startConsumerWith is startConsumer, with 'configure' run on the consumer before it starts.
+func startConsumerWith(t *testing.T, queueName string, configure func(*consumerFixture)) *consumerFixture {
+    t.Helper()
+
+    f := &consumerFixture{
+        broker:    newFakeBroker(),
+        processor: &ackingProcessor{processed: make(chan string, 10)},
+        tag:       fmt.Sprintf("%s:%s", consumerTag, queueName),
+        done:      make(chan error, 1),
+        exited:    make(chan struct{}),
+    }
+    f.consumer = GetMessageConsumerService(f.broker)
+    if configure != nil {
+        configure(f)
+    }
+    go func() {
+        defer close(f.exited)
+        f.done <- f.consumer.ConsumeEventAndProcess(queueName, f.processor)
+    }()
+    f.subscribed(t)
+    // Nothing of this consumer may outlive the test (later tests swap utils.Clock).
+    t.Cleanup(func() {
+        f.consumer.StopConsuming(context.Background())
+        select {
+        case <-f.exited:
+        case <-time.After(time.Second):
+            t.Error("ConsumeEventAndProcess didn't return after StopConsuming")
+        }
+    })
+    return f
+}
+
+// subscribed waits for the consumer to (re)subscribe and returns the channel it is on.
+func (f *consumerFixture) subscribed(t *testing.T) *fakeChannel {
+    t.Helper()
+
+    select {
+    case <-f.broker.consuming:
+    case <-time.After(time.Second):
+        t.Fatal("the consumer never subscribed")
+    }
+    f.broker.mutex.Lock()
+    defer f.broker.mutex.Unlock()
+    return f.broker.channels[len(f.broker.channels)-1]
+}
+
+func (f *consumerFixture) expectProcessed(t *testing.T, body string) {
+    t.Helper()
+
+    select {
+    case got := <-f.processor.processed:
+        if got != body {
+            t.Fatalf("processed %q, want %q", got, body)
+        }
+    case <-time.After(time.Second):
+        t.Fatalf("%q was never processed", body)
+    }
+}
+
+// waitUntil polls 'condition' for up to a second.
+func waitUntil(t *testing.T, condition func() bool) {
+    t.Helper()
+
+    deadline := time.Now().Add(time.Second)
+    for !condition() {
+        if time.Now().After(deadline) {
+            t.Fatal("condition not met within a second")
+        }
+        time.Sleep(5 * time.Millisecond)
+    }
+}
+
+func TestConsumerProcessesAndAcksEachDelivery(t *testing.T) {
+    f := startConsumer(t, "kitchen")
+    channel := f.broker.channels[0]
+
+    f.broker.deliver(f.tag, 1, channel, []byte("first"))
+    f.expectProcessed(t, "first")
+    f.broker.deliver(f.tag, 2, channel, []byte("second"))
+    f.expectProcessed(t, "second")
+
+    if err := f.consumer.StopConsuming(context.Background()); err != nil {
+        t.Fatalf("stop: %v", err)
+    }
+    if err := <-f.done; err != nil {
+        t.Errorf("ConsumeEventAndProcess returned %v after a clean stop", err)
+    }
+    declared, _, acked, nacked := f.broker.snapshot()
+    if len(declared) != 1 || declared[0] != "kitchen" {
+        t.Errorf("declared %v, want the queue before consuming", declared)
+    }
+    if len(acked) != 2 || acked[0] != 1 || acked[1] != 2 || len(nacked) != 0 {
+        t.Errorf("acked %v, nacked %v", acked, nacked)
+    }
+    if f.broker.prefetch != f.consumer.Concurrency() {
+        t.Errorf("prefetch %d, want the worker limit %d", f.broker.prefetch, f.consumer.Concurrency())
+    }
+}
+
+func TestConsumerDeclaresTheQueueBeforeConsumingIt(t *testing.T) {
+    f := startConsumer(t, "kitchen")
+
+    f.broker.mutex.Lock()
+    calls := append([]string(nil), f.broker.calls...)
+    f.broker.mutex.Unlock()
+    if len(calls) != 2 || calls[0] != "declare kitchen" || calls[1] != "consume kitchen" {
+        t.Errorf("got %v, want the declare and then the consume", calls)
+    }
+}
+
+func TestQueueThatCannotBeDeclaredIsNotConsumed(t *testing.T) {
+    fb := newFakeBroker()
+    fb.failOpen = errors.New("ACCESS_REFUSED")
+    consumer := GetMessageConsumerService(fb)
+
+    err := consumer.ConsumeEventAndProcess("kitchen", &ackingProcessor{processed: make(chan string, 1)})
+    if err == nil || !strings.Contains(err.Error(), `failed to declare queue "kitchen" before consuming`) {
+        t.Fatalf("got %v, want the declare error", err)
+    }
+    if len(fb.calls) != 0 {
+        t.Errorf("got %v, want nothing consumed", fb.calls)
+    }
+}
+
+func TestConsumerReportsABrokerCancel(t *testing.T) {
+    f := startConsumer(t, "kitchen")
+
+    f.broker.channels[0].Cancel(f.tag, false) // The broker cancelled us: the queue was deleted
+    select {
+    case err := <-f.done:
+        if !errors.Is(err, ErrConsumptionEnded) {
+            t.Errorf("got %v, want ErrConsumptionEnded", err)
+        }
+    case <-time.After(time.Second):
+        t.Fatal("ConsumeEventAndProcess kept running after the broker cancelled it")
+    }
+}
+
+func TestConsumerSaysWhyConsumptionEnded(t *testing.T) {
+    cases := []struct {
+        name  string
+        cause func(f *consumerFixture)
+        want  string
+    }{
+        {name: "broker cancel", cause: func(f *consumerFixture) {
+            f.broker.channels[0].Cancel(f.tag, false)
+        }, want: `the broker cancelled consumer ` + consumerTag + `:kitchen of "kitchen"`},
+        {name: "connection lost", cause: func(f *consumerFixture) {
+            f.broker.mutex.Lock()
+            f.broker.connected = false
+            f.broker.mutex.Unlock()
+            f.broker.channels[0].closeWith(&amqp091.Error{Code: 320, Reason: "CONNECTION_FORCED"})
+        }, want: "connection lost"},
+        {name: "channel can't be reopened", cause: func(f *consumerFixture) {
+            f.broker.mutex.Lock()
+            f.broker.failOpen = errors.New("channel limit reached")
+            f.broker.mutex.Unlock()
+            f.broker.channels[0].closeWith(&amqp091.Error{Code: 406, Reason: "PRECONDITION_FAILED"})
+        }, want: "failed to reopen the channel"},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            f := startConsumer(t, "kitchen")
+            waitUntil(t, f.broker.channels[0].watched)
+
+            tc.cause(f)
+            select {
+            case err := <-f.done:
+                if !errors.Is(err, ErrConsumptionEnded) || !strings.Contains(err.Error(), tc.want) {
+                    t.Errorf("got %v, want ErrConsumptionEnded saying %q", err, tc.want)
+                }
+            case <-time.After(time.Second):
+                t.Fatal("ConsumeEventAndProcess never returned")
+            }
+        })
+    }
+}
+
+func TestConsumerReopensAChannelTheBrokerClosed(t *testing.T) {
+    f := startConsumer(t, "kitchen")
+    waitUntil(t, f.broker.channels[0].watched)
+
+    f.broker.channels[0].closeWith(&amqp091.Error{Code: 406, Reason: "PRECONDITION_FAILED"})
+    channel := f.subscribed(t)
+    if channel == f.broker.channels[0] || channel.IsClosed() {
+        t.Fatal("the consumer didn't move to a new channel")
+    }
+
+    f.broker.deliver(f.tag, 1, channel, []byte("after the reopen"))
+    f.expectProcessed(t, "after the reopen")
+
+    // Only the channel was replaced: same connection, prefetch reissued, one new channel.
+    f.broker.mutex.Lock()
+    defer f.broker.mutex.Unlock()
+    if f.broker.closes != 0 || !f.broker.connected {
+        t.Errorf("the connection was torn down (%d close(s)) for a channel-only close", f.broker.closes)
+    }
+    if channel.prefetch == 0 || channel.prefetch != f.broker.channels[0].prefetch {
+        t.Errorf("prefetch on the new channel: got %d, want %d", channel.prefetch, f.broker.channels[0].prefetch)
+    }
+    if len(f.broker.channels) != 2 {
+        t.Errorf("opened %d channel(s), want the first and one replacement", len(f.broker.channels))
+    }
+}
+
+func TestAckOnAClosedChannelIsSkipped(t *testing.T) {
+    f := startConsumer(t, "kitchen")
+    f.broker.mutex.Lock()
+    f.broker.connected = false // The whole connection is going away: no reopen
+    f.broker.mutex.Unlock()
+    channel := f.broker.channels[0]
+
+    acker := liveAcknowledger{Acknowledger: channel, channel: channel}
+    channel.Close()
+    if err := acker.Ack(1, false); !errors.Is(err, ErrChannelGone) {
+        t.Errorf("got %v, want ErrChannelGone", err)
+    }
+    if _, _, acked, _ := f.broker.snapshot(); len(acked) != 0 {
+        t.Errorf("acked %v on a closed channel", acked)
+    }
+}
+
+func TestPanickingMessageIsNackedAndTheConsumerCarriesOn(t *testing.T) {
+    f := startConsumer(t, "kitchen")
+    channel := f.broker.channels[0]
+    f.processor.panicOn = "panic"
+
+    f.broker.deliver(f.tag, 1, channel, []byte("panic"))
+    f.broker.deliver(f.tag, 2, channel, []byte("next"))
+    f.expectProcessed(t, "next")
+
+    waitUntil(t, func() bool {
+        _, _, _, nacked := f.broker.snapshot()
+        return len(nacked) == 1
+    })
+    f.broker.mutex.Lock()
+    defer f.broker.mutex.Unlock()
+    if f.broker.nacked[0] != 1 || !f.broker.requeued[0] {
+        t.Errorf("nacked %v (requeue %v), want message 1 requeued once", f.broker.nacked, f.broker.requeued)
+    }
+}
+
+func TestPanicRecoverySettlesByKind(t *testing.T) {
+    cases := []struct {
+        name         string
+        redelivered  bool
+        autoAck      bool
+        panics       func()
+        wantRequeue  int
+        wantRejected int
+    }{
+        {name: "first panic gets another chance", panics: func() { panic("bug") }, wantRequeue: 1},
+        {name: "second panic is dropped", redelivered: true, panics: func() { panic("bug") }, wantRejected: 1},
+        {name: "type error is never requeued", panics: func() {
+            var message interface{} = "not a delivery"
+            _ = message.(amqp091.Delivery)
+        }, wantRejected: 1},
+        {name: "auto-ack has nothing to nack", autoAck: true, panics: func() { panic("bug") }},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            settled := &settlements{}
+            delivery := amqp091.Delivery{Acknowledger: settled, Redelivered: tc.redelivered, Body: []byte(`{"order_no":"A1"}`)}
+
+            func() {
+                defer recoverFromProcessingPanic(delivery, tc.autoAck)
+                tc.panics()
+            }()
+            if settled.requeues != tc.wantRequeue || settled.rejects != tc.wantRejected || settled.acks != 0 {
+                t.Errorf("settled %+v, want %d requeued and %d rejected", settled, tc.wantRequeue, tc.wantRejected)
+            }
+        })
+    }
+}
+
+func TestSetConcurrencyIsBoundedAndReissuesPrefetch(t *testing.T) {
+    f := startConsumer(t, "kitchen")
+    before := f.consumer.Concurrency()
+
+    for _, concurrency := range []int{0, -1, f.consumer.maxLimit + 1} {
+        if err := f.consumer.SetConcurrency(concurrency); !errors.Is(err, ErrConcurrencyOutOfRange) {
+            t.Errorf("%d: got %v, want ErrConcurrencyOutOfRange", concurrency, err)
+        }
+    }
+    if got := f.consumer.Concurrency(); got != before {
+        t.Fatalf("a refused value changed the limit to %d", got)
+    }
+
+    if err := f.consumer.SetConcurrency(3); err != nil {
+        t.Fatalf("set 3: %v", err)
+    }
+    f.broker.mutex.Lock()
+    prefetch := f.broker.prefetch
+    f.broker.mutex.Unlock()
+    if f.consumer.Concurrency() != 3 || prefetch != 3 {
+        t.Errorf("got %d workers and prefetch %d, want 3 and 3", f.consumer.Concurrency(), prefetch)
+    }
+}
+
+func TestFailedMessagesGoToOnProcessError(t *testing.T) {
+    type failure struct {
+        delivery amqp091.Delivery
+        err      error
+    }
+    failures := make(chan failure, 1)
+    f := startConsumerWith(t, "kitchen", func(f *consumerFixture) {
+        f.processor.failOn = "burnt"
+        f.consumer.OnProcessError = func(delivery amqp091.Delivery, err error) {
+            failures <- failure{delivery: delivery, err: err}
+        }
+    })
+    channel := f.broker.channels[0]
+
+    f.broker.deliver(f.tag, 1, channel, []byte("burnt"))
+    select {
+    case got := <-failures:
+        if got.delivery.DeliveryTag != 1 || string(got.delivery.Body) != "burnt" || got.err == nil {
+            t.Errorf("got delivery %d %q with %v, want the failing delivery and its error", got.delivery.DeliveryTag, got.delivery.Body, got.err)
+        }
+    case <-time.After(time.Second):
+        t.Fatal("OnProcessError was never called")
+    }
+
+    f.broker.deliver(f.tag, 2, channel, []byte("margherita"))
+    f.expectProcessed(t, "margherita")
+    select {
+    case got := <-failures:
+        t.Errorf("OnProcessError was called for a processed message: %v", got.err)
+    default:
+    }
+}
+
+// gatedClock holds up cooking: a cook timer (a second or more) is only started once the
+// test closes 'release', and 'cooking' gets a signal when one is waiting for it.
+type gatedClock struct {
+    utils.RealClock
+    cooking chan struct{}
+    release chan struct{}
+}
+
+func (gc *gatedClock) NewTimer(d time.Duration) *time.Timer {
+    if d >= time.Second {
+        gc.cooking <- struct{}{}
+        <-gc.release
+    }
+    return time.NewTimer(0)
+}
+
+func TestReconnectMidCookingHasNoDoubleSideEffects(t *testing.T) {
+    clock := &gatedClock{cooking: make(chan struct{}, 1), release: make(chan struct{})}
+    utils.Clock = clock
+    tp := newTestProcessor(t)
+    tp.store.Save(Order{OrderNo: "A1", OwnerID: "alice", Status: constants.ORDER_PREPARING})
+    fb := newFakeBroker()
+    consumer := GetMessageConsumerService(fb)
+    exited := make(chan struct{})
+    go func() {
+        defer close(exited)
+        consumer.ConsumeEventAndProcess("kitchen", tp.MessageProcessor)
+    }()
+    released := false
+    t.Cleanup(func() {
+        if !released {
+            close(clock.release)
+        }
+        consumer.StopConsuming(context.Background())
+        <-exited // Done with utils.Clock before it is put back
+        utils.Clock = utils.RealClock{}
+    })
+    tag := fmt.Sprintf("%s:kitchen", consumerTag)
+    <-fb.consuming
+    waitUntil(t, fb.channels[0].watched)
+    body := orderEvent(t, "A1", constants.ORDER_PREPARING)
+
+    // The original is in the oven when the channel dies and the consumer reconnects.
+    fb.deliver(tag, 1, fb.channels[0], body)
+    <-clock.cooking
+    fb.channels[0].closeWith(&amqp091.Error{Code: 320, Reason: "CONNECTION_FORCED"})
+    select {
+    case <-fb.consuming:
+    case <-time.After(time.Second):
+        t.Fatal("the consumer never reconnected")
+    }
+
+    // The broker redelivers what the dead channel never acked, while the original still cooks.
+    fb.mutex.Lock()
+    deliveries, reopened := fb.consumers[tag], fb.channels[len(fb.channels)-1]
+    fb.mutex.Unlock()
+    deliveries <- amqp091.Delivery{Acknowledger: reopened, DeliveryTag: 2, Redelivered: true, Body: body}
+    close(clock.release)
+    released = true
+
+    // The redelivered copy is acked on the new channel once the original finishes, so the
+    // order reaches PREPARED once; the original's ack on the dead channel is skipped.
+    waitUntil(t, func() bool {
+        _, _, acked, _ := fb.snapshot()
+        return len(acked) == 1
+    })
+    time.Sleep(20 * time.Millisecond) // Room for a second, wrong, settle
+    if _, _, acked, nacked := fb.snapshot(); len(acked) != 1 || acked[0] != 2 || len(nacked) != 0 {
+        t.Errorf("acked %v, nacked %v; want only the redelivered copy (tag 2) acked", acked, nacked)
+    }
+    if order, _ := tp.store.Get("A1"); order.Status != constants.ORDER_PREPARED {
+        t.Errorf("status: got %q, want prepared", order.Status)
+    }
+    if tp.published() == nil {
+        t.Fatal("the cooked order was never published on")
+    }
+    if again := tp.published(); again != nil {
+        t.Errorf("the step ran twice: it was published again as %s", again.Body)
+    }
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+    "fmt"
+    "sync"
+    "time"
+
+    "github.com/everestp/pizza-shop/config"
+    "github.com/everestp/pizza-shop/utils"
+)
+
+// MessageDeduper remembers the AMQP message IDs of messages we finished, so a second copy
+// of the same message (a publisher retry after a lost confirm, a redelivery after the ack
+// got lost, the same order step published again) is acked without being processed again.
+// Order steps are published with StepMessageId, so publishing one twice gives the same ID. It works on the transport level,
+// before the body is even read; the IdempotencyGuard still catches repeated order steps
+// that arrive as DIFFERENT messages.
+// IDs are kept for MESSAGE_DEDUP_WINDOW_SECONDS (default 300, 0 = off), and at most
+// MESSAGE_DEDUP_MAX_IDS of them (default 10000; the oldest go first).
+// Messages without an ID (e.g. from an older publisher) are never treated as copies.
+type MessageDeduper struct {
+    window time.Duration
+    maxIds int
+    seen   map[string]time.Time // Message ID -> when it was finished
+    order  []string             // The same IDs, oldest first
+    mutex  sync.Mutex
+}
+
+// StepMessageId is the message ID of one step of an order: "<order_no>:<order_status>".
+// A step that is published again (a retried request, a re-sent event) keeps its ID, so the
+// consumer skips it once the first copy was processed. Events without an order number get "".
+func StepMessageId(event map[string]interface{}) string {
+    orderNo := event["order_no"]
+    if orderNo == nil || orderNo == "" {
+        return ""
+    }
+    return fmt.Sprintf("%v:%v", orderNo, event["order_status"])
+}
+
+// Seen reports whether a message with this ID was already finished within the window.
+func (md *MessageDeduper) Seen(messageId string) bool {
+    if md == nil || messageId == "" {
+        return false
+    }
+
+    md.mutex.Lock()
+    defer md.mutex.Unlock()
+
+    md.pruneExpired(utils.Clock.Now())
+    _, seen := md.seen[messageId]
+    return seen
+}
+
+// Remember records that the message with this ID was finished for good.
+// Only call it once the message won't come back on purpose: a failed message that is
+// requeued keeps its ID, and must not be mistaken for a copy.
+func (md *MessageDeduper) Remember(messageId string) {
+    if md == nil || messageId == "" {
+        return
+    }
+
+    md.mutex.Lock()
+    defer md.mutex.Unlock()
+
+    now := utils.Clock.Now()
+    md.pruneExpired(now)
+    if _, seen := md.seen[messageId]; seen {
+        return
+    }
+    md.seen[messageId] = now
+    md.order = append(md.order, messageId)
+    for len(md.order) > md.maxIds {
+        delete(md.seen, md.order[0])
+        md.order = md.order[1:]
+    }
+}
+
+// pruneExpired forgets IDs older than the window. 'order' is oldest first, so it stops
+// at the first one still inside it. Caller holds the lock.
+func (md *MessageDeduper) pruneExpired(now time.Time) {
+    for len(md.order) > 0 && now.Sub(md.seen[md.order[0]]) > md.window {
+        delete(md.seen, md.order[0])
+        md.order = md.order[1:]
+    }
+}
+
+// newMessageDeduper reads MESSAGE_DEDUP_WINDOW_SECONDS and MESSAGE_DEDUP_MAX_IDS.
+func newMessageDeduper() *MessageDeduper {
+    return GetMessageDeduper(time.Duration(config.GetEnvPropertyAsInt("message_dedup_window", 300))*time.Second,
+        config.GetEnvPropertyAsInt("message_dedup_max_ids", 10000))
+}
+
+// GetMessageDeduper is the Constructor. A window or size below 1 turns de-duplication off (nil).
+func GetMessageDeduper(window time.Duration, maxIds int) *MessageDeduper {
+    if window <= 0 || maxIds < 1 {
+        return nil
+    }
+    return &MessageDeduper{
+        window: window,
+        maxIds: maxIds,
+        seen:   make(map[string]time.Time),
+    }
+}
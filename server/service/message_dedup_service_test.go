@@ -0,0 +1,75 @@
+package service
+
+import (
+    "testing"
+    "time"
+
+    "github.com/everestp/pizza-shop/constants"
+    "github.com/everestp/pizza-shop/utils"
+)
+
+func TestSameMessageIdTwiceIsProcessedOnce(t *testing.T) {
+    tp := newTestProcessor(t)
+    tp.store.Save(Order{OrderNo: "A1", OwnerID: "alice", Status: constants.ORDER_ORDERED})
+    body := orderEvent(t, "A1", constants.ORDER_ORDERED)
+
+    if err := tp.deliver(t, "A1:ordered", body); err != nil {
+        t.Fatalf("first copy: %v", err)
+    }
+    if next := tp.published(); next == nil || next.MessageId != "A1:"+constants.ORDER_PREPARING {
+        t.Fatalf("first copy: got %v, want the next step published as A1:%s", next, constants.ORDER_PREPARING)
+    }
+
+    if err := tp.deliver(t, "A1:ordered", body); err != nil {
+        t.Fatalf("second copy: %v", err)
+    }
+    if next := tp.published(); next != nil {
+        t.Errorf("the second copy was processed again: it published %s", next.Body)
+    }
+    if tp.settled.acks != 2 || tp.settled.requeues+tp.settled.rejects != 0 {
+        t.Errorf("settled %+v, want both copies acked", tp.settled)
+    }
+}
+
+func TestMessagesWithoutIdAreNeverCopies(t *testing.T) {
+    deduper := GetMessageDeduper(time.Minute, 10)
+    deduper.Remember("")
+    if deduper.Seen("") {
+        t.Error("an empty ID was taken for a copy")
+    }
+}
+
+func TestDeduperForgetsAfterTheWindowAndBeyondMaxIds(t *testing.T) {
+    clock := &manualClock{now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+    utils.Clock = clock
+    t.Cleanup(func() { utils.Clock = utils.RealClock{} })
+
+    deduper := GetMessageDeduper(time.Minute, 2)
+    for _, id := range []string{"a", "b", "c"} {
+        deduper.Remember(id)
+    }
+    if deduper.Seen("a") || !deduper.Seen("b") || !deduper.Seen("c") {
+        t.Error("want only the 2 newest IDs kept")
+    }
+
+    clock.now = clock.now.Add(61 * time.Second)
+    if deduper.Seen("c") {
+        t.Error("an ID outside the window is still remembered")
+    }
+}
+
+func TestStepMessageId(t *testing.T) {
+    placed := map[string]interface{}{"order_no": "A1", "order_status": constants.ORDER_ORDERED}
+    again := map[string]interface{}{"order_no": "A1", "order_status": constants.ORDER_ORDERED, "correlation_id": "other"}
+    cooking := map[string]interface{}{"order_no": "A1", "order_status": constants.ORDER_PREPARING}
+
+    if StepMessageId(placed) != "A1:"+constants.ORDER_ORDERED || StepMessageId(placed) != StepMessageId(again) {
+        t.Errorf("the same step got %q and %q", StepMessageId(placed), StepMessageId(again))
+    }
+    if StepMessageId(placed) == StepMessageId(cooking) {
+        t.Error("different steps share an ID")
+    }
+    if id := StepMessageId(map[string]interface{}{"order_status": constants.ORDER_ORDERED}); id != "" {
+        t.Errorf("an event without an order number got %q", id)
+    }
+}
@@ -1,11 +1,14 @@
 package service
 
 import (
+    "context"
     "encoding/json"
+    "errors"
     "fmt"
     "sync"
     "time"
 
+    "github.com/everestp/pizza-shop/config"
     "github.com/everestp/pizza-shop/constants"
     "github.com/everestp/pizza-shop/logger"
     "github.com/everestp/pizza-shop/utils"
@@ -14,132 +17,698 @@ import (
 
 // IMessageProcessor is the "Contract." 
 // Any struct that wants to process messages must have the ProcessMessage method.
+// ctx carries the message's processing deadline (MESSAGE_PROCESSING_TIMEOUT_MS).
 type IMessageProcessor interface {
-    ProcessMessage(message interface{}) error
+    ProcessMessage(ctx context.Context, message interface{}) error
 }
 
+// ErrProcessingTimeout means a handler was still running when the message's deadline passed.
+var ErrProcessingTimeout = errors.New("message processing timed out")
+
 // MessageProcessor is the "Brain" of the operation.
 // It connects RabbitMQ (the messenger) to WebSockets (the live update for users).
 type MessageProcessor struct {
-    publisher  IMessagePubliser                 // To send events back to RabbitMQ
-    connection *map[string]IWebSocketConnection // List of users currently online via WebSockets
-    mutex      sync.RWMutex                     // The "Lock" to prevent crashes when multiple people use the map
+    publisher  IMessagePubliser                            // To send events back to RabbitMQ
+    connection func(clientId string) IWebSocketConnection  // Finds a user's live socket (nil when offline)
+    validator  IOrderStatusValidator                       // Guards against illegal status jumps (e.g. ORDERED -> DELIVERED)
+    store      IOrderStore                                 // Remembers every order's owner and current status
+    batcher    *BroadcastBatcher                           // Optional: coalesces bursts of updates per client
+    metrics    *KitchenMetrics                             // Counters for the live stats dashboard
+    guard      *IdempotencyGuard                           // Stops the same order step from running twice
+    eventLog   IEventLog                                   // Audit trail of every status change
+    pending    *PendingNotificationStore                   // Holds messages for customers who are offline
+    autoAck    bool                                        // True when the consumer lets the broker ack for us
+    handlers   map[string]StatusHandler                    // Which function handles which "order_status"
+    eventTypes map[string]EventType                        // Decoders/handlers for non-order events, by "type"
+    maxRetries int                                         // Failed attempts allowed before a message is dead-lettered
+    watchers   func(orderNo string) []IWebSocketConnection // Sockets following a single order (tracking pages)
+    webhook    *OrderWebhook                               // Optional: tells an external kitchen system about accepted orders
+    // failures decides whether a failed message is acked, requeued, retried or dead-lettered
+    // (NACK_POLICY; a timeout follows PROCESSING_TIMEOUT_REQUEUE unless the policy says otherwise).
+    failures *FailurePolicy
+    // orderLocks serializes messages of the same order (PER_ORDER_CONCURRENCY, default 1; 0 = off).
+    orderLocks *OrderLocks
+    // inFlight counts the orders being cooked right now (the kitchen's load).
+    inFlight *InFlightTracker
+    // labels translates a POS's status labels to ours on the way in, and back for the webhook.
+    labels *StatusLabels
+    // following says whether a customer's socket wants an order's updates (nil = always).
+    following func(clientId string, orderNo string) bool
+    // dedup acks second copies of a message (same AMQP message ID) without processing them.
+    dedup *MessageDeduper
+}
+
+// StatusHandler handles one order status. It may change the event and publish it onward.
+// ctx carries the message's trace; pass it on when publishing so the trace continues.
+type StatusHandler func(ctx context.Context, event map[string]interface{}) error
+
+// RegisterHandler plugs in the handler for a status, replacing any existing one.
+// Adding a new status to the pizza flow is one call here instead of editing a switch.
+// Register handlers before consuming starts; the table is not locked.
+func (mp *MessageProcessor) RegisterHandler(status string, handler StatusHandler) {
+    mp.handlers[status] = handler
+}
+
+// SetFailurePolicy replaces how failed messages are settled (e.g. with a custom Classify).
+// Set it before consuming starts; it is not locked.
+func (mp *MessageProcessor) SetFailurePolicy(policy *FailurePolicy) {
+    mp.failures = policy
+}
+
+// SetStatusLabels turns on status translation (ORDER_STATUS_LABELS). Set it before consuming starts.
+func (mp *MessageProcessor) SetStatusLabels(labels *StatusLabels) {
+    mp.labels = labels
+}
+
+// SetSubscriptions makes order updates respect what each customer's socket follows
+// (subscribe/unsubscribe). Set it before consuming starts.
+func (mp *MessageProcessor) SetSubscriptions(following func(clientId string, orderNo string) bool) {
+    mp.following = following
 }
 
 // ProcessMessage is the entry point for every message coming from the queue.
-func (mp *MessageProcessor) ProcessMessage(message interface{}) error {
-    // 1. Convert the generic message into a RabbitMQ 'Delivery' object
-    msg := message.(amqp091.Delivery)
+func (mp *MessageProcessor) ProcessMessage(ctx context.Context, message interface{}) error {
+    // 1. Convert the generic message into a RabbitMQ 'Delivery' object.
+    // The comma-ok form returns an error instead of panicking on anything else.
+    msg, ok := message.(amqp091.Delivery)
+    if !ok {
+        return fmt.Errorf("unsupported message type %T: expected amqp091.Delivery", message)
+    }
+
+    // A copy of a message we already finished (same message ID) is acked and dropped unread.
+    if mp.dedup.Seen(msg.MessageId) {
+        logger.Log(fmt.Sprintf("Duplicate Message: %s was already processed, acking the copy", msg.MessageId))
+        mp.ack(msg)
+        return nil
+    }
     
     var event map[string]interface{}
     var err error
 
     // 2. Parse JSON: Convert the message bytes into a Go map (key-value pairs)
     if err = json.Unmarshal(msg.Body, &event); err != nil {
-        logger.Log(fmt.Sprintf("JSON Error: Cannot read message body: %v", err))
-        // Nack(false, true) means: "I failed, put this back in the queue to try again."
-        msg.Nack(false, true) 
+        err = fmt.Errorf("%w: %w", ErrMalformedMessage, err)
+        // By default Nack(false, false): it can't be read, so another try won't help; it's dead-lettered.
+        action := mp.settle(msg, err)
+        logger.Log(fmt.Sprintf("JSON Error: Cannot read message body: %v (%s)", err, action))
         return err
     }
 
-    logger.Log(fmt.Sprintf("Step 1: Received message for processing: %v", event))
+    logger.Sampled(fmt.Sprintf("Step 1: Received message for processing: %v", event))
+
+    // Other event types (refunds, inventory...) share the queue; each decodes into its own struct.
+    if tag := eventTypeOf(event); tag != constants.EVENT_TYPE_ORDER {
+        return mp.processTypedEvent(ctx, msg, tag)
+    }
 
-    // 3. State Machine: Decide what to do based on the "order_status"
+    // From here on the event speaks our statuses, whatever labels its sender uses.
+    if label, ok := event["order_status"].(string); ok {
+        status, err := mp.labels.Inbound(label)
+        if err != nil {
+            logger.Log(fmt.Sprintf("Rejected Event: order #%v: %v", event["order_no"], err))
+            mp.settle(msg, err)
+            return err
+        }
+        event["order_status"] = status
+    }
+
+    // Messages of the same order wait for each other; other orders carry on in parallel.
+    if mp.orderLocks != nil {
+        unlock := mp.orderLocks.Lock(fmt.Sprint(event["order_no"]))
+        defer unlock()
+    }
+
+    // 3. Duplicate Check: A redelivered copy (e.g. after a reconnect, or picked up by a
+    // second instance) must not cook the same pizza twice. The step key is order + status.
+    stepKey := fmt.Sprintf("%v:%v", event["order_no"], event["order_status"])
+    if msg.Redelivered {
+        logger.Log(fmt.Sprintf("Redelivered: message for step %s was delivered before", stepKey))
+    }
+    claimed := mp.guard.Begin(stepKey)
+    if !claimed && msg.Redelivered {
+        // After a reconnect the broker redelivers what the old channel never acked, possibly
+        // while the original is still running. Only skip this copy if the original finished.
+        var err error
+        if claimed, err = mp.guard.WaitAndBegin(ctx, stepKey); err != nil {
+            mp.nack(msg, true)
+            return fmt.Errorf("waiting for the original delivery of step %s: %w", stepKey, err)
+        }
+    }
+    if !claimed {
+        logger.Log(fmt.Sprintf("Duplicate Skipped: step %s is already done or in progress", stepKey))
+        mp.finish(msg)
+        return nil
+    }
+    // If a handler panics, free the step so the requeued copy isn't mistaken for a duplicate.
+    defer func() {
+        if r := recover(); r != nil {
+            mp.guard.Release(stepKey)
+            panic(r)
+        }
+    }()
+
+    // 4. State Machine: Look up the handler registered for this "order_status"
     if val, ok := event["order_status"]; ok {
-        switch val {
-        case constants.ORDER_ORDERED:
-            // Flow: Customer ordered -> Send to Kitchen
-            err = mp.handleOrderOrdered(event)
-            
-        case constants.ORDER_PREPARING:
-            // Flow: Kitchen is cooking -> Simulate time and move to Prepared
-            err = mp.handleOrderPreparing(event)
-            
-        case constants.ORDER_PREPARED:
-            // Flow: Pizza is ready -> Notify the user via WebSocket
-            err = mp.handleOrderPrepared(event)
-            
-        default:
+        status, _ := val.(string)
+        if handler, found := mp.handlers[status]; found {
+            // Tracing: continue the publisher's trace and give each handler its own span.
+            handlerCtx, span := tracer.Start(ExtractTraceContext(ctx, msg.Headers), "handle "+status)
+            handlerCtx = withRetryCount(handlerCtx, RetryCount(msg.Headers))
+            if msg.Redelivered || RetryCount(msg.Headers) > 0 {
+                handlerCtx = context.WithValue(handlerCtx, repeatKey{}, true)
+            }
+            err = runWithDeadline(handlerCtx, handler, event)
+            if err != nil {
+                span.RecordError(err)
+            }
+            span.End()
+        } else {
             logger.Log("Unknown Status: Skipping processing.")
         }
 
-        // 4. If any of the logic above fails, Nack the message so we don't lose it
+        // A handler that overran the deadline may still be running, but we stop waiting for it.
+        if errors.Is(err, ErrProcessingTimeout) {
+            mp.guard.Release(stepKey)
+            if status == constants.ORDER_PREPARING {
+                mp.inFlight.Leave(fmt.Sprint(event["order_no"])) // The abandoned cook no longer counts
+            }
+            action := mp.settle(msg, err)
+            logger.Log(fmt.Sprintf("Timeout: order #%v step %s ran out of time (%s)", event["order_no"], status, action))
+            return err
+        }
+
+        // 5. An illegal transition will never succeed, however often we retry it.
+        // By default it is nacked WITHOUT requeue so the broker drops it (or dead-letters it, if configured).
+        if errors.Is(err, ErrInvalidTransition) {
+            logger.Log(fmt.Sprintf("Rejected Event: %v", err))
+            mp.guard.Complete(stepKey)
+            mp.settle(msg, err)
+            return err
+        }
+
+        // 6. If any of the logic above fails, retry the message so we don't lose it.
+        // Releasing the step lets the retried copy run it again.
         if err != nil {
             logger.Log(fmt.Sprintf("Processing Error: %v", err))
-            msg.Nack(false, true)
+            mp.guard.Release(stepKey)
+            mp.settle(msg, err)
             return err
         }
     }
 
-    // 5. Success! Tell RabbitMQ to delete the message from the queue
-    msg.Ack(false)
+    // 7. Success! Tell RabbitMQ to delete the message from the queue
+    mp.guard.Complete(stepKey)
+    mp.finish(msg)
     return nil
 }
 
+// settle acks, requeues, retries or dead-letters a failed message, as the failure policy says.
+func (mp *MessageProcessor) settle(msg amqp091.Delivery, err error) FailureAction {
+    action := mp.failures.Action(err)
+    switch action {
+    case ActionAck:
+        mp.ack(msg)
+    case ActionRequeue:
+        mp.nack(msg, true)
+    case ActionDeadLetter:
+        mp.nack(msg, false)
+    default:
+        mp.retryOrDeadLetter(msg)
+    }
+    return action
+}
+
+// retryOrDeadLetter gives a failed message another go, at most MAX_RETRY_COUNT times.
+// A plain Nack-requeue can't change headers, so the retry is a re-publish of the same
+// body with "x-retry-count" bumped, followed by an ack of the original. Once the count
+// is used up the message is nacked without requeue, which dead-letters it (if configured).
+func (mp *MessageProcessor) retryOrDeadLetter(msg amqp091.Delivery) {
+    if mp.autoAck {
+        return // The broker already forgot it; nothing left to retry
+    }
+    retries := RetryCount(msg.Headers) + 1
+    if retries > mp.maxRetries {
+        logger.Log(fmt.Sprintf("Giving up on order #%v after %d retries, dead-lettering it", orderNoFromBody(msg.Body), mp.maxRetries))
+        mp.nack(msg, false)
+        return
+    }
+
+    headers := amqp091.Table{}
+    for key, value := range msg.Headers {
+        headers[key] = value
+    }
+    headers[RetryCountHeader] = int64(retries)
+    // The retry keeps the message ID: the original was never remembered, so it isn't taken for a copy.
+    err := mp.publisher.PublishEventWithOptions(PublishOptions{
+        Exchange:   msg.Exchange,
+        RoutingKey: msg.RoutingKey,
+        Headers:    headers,
+        MessageId:  msg.MessageId,
+    }, json.RawMessage(msg.Body))
+    if err != nil {
+        // Can't re-publish: fall back to a plain requeue so the message isn't lost.
+        logger.Log(fmt.Sprintf("Retry re-publish failed, requeueing instead: %v", err))
+        mp.nack(msg, true)
+        return
+    }
+    logger.Log(fmt.Sprintf("Retrying order #%v (retry %d of %d)", orderNoFromBody(msg.Body), retries, mp.maxRetries))
+    mp.ack(msg)
+}
+
+// runWithDeadline runs the handler, but returns ErrProcessingTimeout as soon as ctx's
+// deadline passes (a blocked handler can't hold the message forever). The handler
+// keeps ctx, so its publishes are abandoned once the deadline has passed.
+func runWithDeadline(ctx context.Context, handler StatusHandler, event map[string]interface{}) error {
+    if _, ok := ctx.Deadline(); !ok {
+        return handler(ctx, event)
+    }
+
+    type outcome struct {
+        err      error
+        panicked interface{}
+    }
+    done := make(chan outcome, 1) // Buffered: a late handler must still be able to finish
+    go func() {
+        defer func() {
+            if r := recover(); r != nil {
+                done <- outcome{panicked: r}
+            }
+        }()
+        done <- outcome{err: handler(ctx, event)}
+    }()
+
+    select {
+    case result := <-done:
+        // Re-raise on the consumer's goroutine, where the panic recovery lives.
+        if result.panicked != nil {
+            panic(result.panicked)
+        }
+        return result.err
+    case <-ctx.Done():
+        return fmt.Errorf("%w: %v", ErrProcessingTimeout, ctx.Err())
+    }
+}
+
+// retryCountKey stores the incoming message's retry count in the handler's context.
+type retryCountKey struct{}
+
+func withRetryCount(ctx context.Context, retries int) context.Context {
+    return context.WithValue(ctx, retryCountKey{}, retries)
+}
+
+// repeatKey marks the handler's context when its message was redelivered or is a retried copy.
+type repeatKey struct{}
+
+// isRepeat reports whether the step being handled may have run (part of the way) before.
+func isRepeat(ctx context.Context) bool {
+    repeat, _ := ctx.Value(repeatKey{}).(bool)
+    return repeat
+}
+
+// publishNext sends the event on to the order's kitchen queue, keeping the trace
+// and the retry count of the message that produced it.
+func (mp *MessageProcessor) publishNext(ctx context.Context, event map[string]interface{}) error {
+    options := PublishOptions{RoutingKey: KitchenQueueOf(event), Context: ctx, MessageId: StepMessageId(event)}
+    if retries, _ := ctx.Value(retryCountKey{}).(int); retries > 0 {
+        options.Headers = amqp091.Table{RetryCountHeader: int64(retries)}
+    }
+    return mp.publisher.PublishEventWithOptions(options, event)
+}
+
+// ack: Confirms a message, unless the broker already did (auto-ack mode)
+func (mp *MessageProcessor) ack(msg amqp091.Delivery) {
+    if !mp.autoAck {
+        msg.Ack(false)
+    }
+}
+
+// finish: Acks a message that was handled for good and remembers its ID, so copies of it are skipped.
+// Failed messages are settled with ack/nack instead: their retries must still be processed.
+func (mp *MessageProcessor) finish(msg amqp091.Delivery) {
+    mp.dedup.Remember(msg.MessageId)
+    mp.ack(msg)
+}
+
+// nack: Rejects a message, unless the broker already considers it delivered (auto-ack mode)
+func (mp *MessageProcessor) nack(msg amqp091.Delivery, requeue bool) {
+    if !mp.autoAck {
+        msg.Nack(false, requeue)
+    }
+}
+
 // handleOrderOrdered: Moves the order from "Customer" to "Kitchen"
-func (mp *MessageProcessor) handleOrderOrdered(event map[string]interface{}) error {
-    logger.Log("Action: Accepting order and sending to Kitchen queue.")
-    
-    // Set the new status
-    event["order_status"] = constants.ORDER_PREPARING
+func (mp *MessageProcessor) handleOrderOrdered(ctx context.Context, event map[string]interface{}) error {
+    logger.Sampled("Action: Accepting order and sending to Kitchen queue.")
+
+    // Set the new status (only if the lifecycle allows it)
+    if err := mp.advanceStatus(ctx, event, constants.ORDER_PREPARING); err != nil {
+        return err
+    }
+
+    // Tell the customer right away that the kitchen has the order, instead of only at the end.
+    // An offline customer gets it on reconnect (if pending notifications are kept); a failed
+    // push is only logged, since the order itself is fine.
+    accepted := map[string]interface{}{
+        "message": constants.ORDER_RECEIVED,
+        "order":   event,
+    }
+    if err := mp.notifyOrder(event, accepted); err != nil {
+        logger.Log(fmt.Sprintf("Failed to tell customer [%s] order #%v was accepted: %v", ownerOf(event), event["order_no"], err))
+    }
     
-    // Publish the updated event back to RabbitMQ
-    err := mp.publisher.PublishEvent(constants.KITCHEN_ORDER_QUEUE, event)
+    // Publish the updated event back to RabbitMQ (to the order's own region kitchen)
+    err := mp.publishNext(ctx, event)
     if err != nil {
         mp.sendErrorToUser(err, event)
+        return err
     }
-    return err
+
+    // External kitchen systems hear about the order once the kitchen really has it, in the
+    // background; it never blocks the queue.
+    if mp.webhook != nil {
+        mp.webhook.Notify(mp.labels.OutboundEvent(event))
+    }
+    return nil
 }
 
 // handleOrderPreparing: Represents the "Chef" actually making the pizza
-func (mp *MessageProcessor) handleOrderPreparing(event map[string]interface{}) error {
-    logger.Log(fmt.Sprintf("Action: Chef started preparing order #%v", event["order_no"]))
+func (mp *MessageProcessor) handleOrderPreparing(ctx context.Context, event map[string]interface{}) error {
+    logger.Sampled(fmt.Sprintf("Action: Chef started preparing order #%v", event["order_no"]))
+    // On the stove until we return, however we return (done, failed, panicked).
+    // Taking the order off the stove from elsewhere (cancelled, advanced by an admin) stops the cook.
+    cookCtx, stopCooking := context.WithCancel(ctx)
+    defer stopCooking()
+    defer mp.inFlight.Enter(fmt.Sprint(event["order_no"]), stopCooking)()
     
     // 1. Simulate the "Cooking Time" (1 to 6 seconds)
-    time.Sleep(utils.GenerateRandomDuration(1, 6))
+    // A split order cooks each item at its own station; the order waits for the slowest one.
+    // Stops early when the processing context ends (timeout, shutdown): the order is NOT
+    // marked prepared, and whatever items were already ready stay ready for the retry.
+    cookStart := utils.Clock.Now()
+    split, err := mp.cookItems(cookCtx, event)
+    if err == nil && !split {
+        err = utils.SleepContext(cookCtx, utils.GenerateRandomDuration(6, 1))
+    }
+    if err != nil && ctx.Err() == nil {
+        // Stopped from outside: the order already moved on, so this step has nothing left to do.
+        logger.Log(fmt.Sprintf("Order #%v was taken off the stove, the chef stops cooking it", event["order_no"]))
+        return nil
+    }
+    if err != nil {
+        return fmt.Errorf("cooking order #%v stopped: %w", event["order_no"], err)
+    }
+    // Cancelled (or delivered by hand) without the chef noticing: nothing went wrong, nothing left to do.
+    if mp.store != nil {
+        if order, ok := mp.store.Get(fmt.Sprint(event["order_no"])); ok && order.IsFinished() {
+            logger.Log(fmt.Sprintf("Order #%v was %s while it cooked, the chef drops it", event["order_no"], order.Status))
+            return nil
+        }
+    }
+    mp.metrics.RecordCookTime(utils.Clock.Since(cookStart))
     
-    // 2. Set new status
-    event["order_status"] = constants.ORDER_PREPARED
+    // 2. Set new status (only if the lifecycle allows it)
+    if err := mp.advanceStatus(ctx, event, constants.ORDER_PREPARED); err != nil {
+        return err
+    }
     
     // 3. Publish the update back to RabbitMQ
-    err := mp.publisher.PublishEvent(constants.KITCHEN_ORDER_QUEUE, event)
+    err = mp.publishNext(ctx, event)
     if err != nil {
         mp.sendErrorToUser(err, event)
     }
     return err
 }
 
+// cookItems: Cooks a multi-item order item by item, in parallel, telling the customer as each
+// one is ready. Items already ready (from an earlier, interrupted attempt) are skipped.
+// Returns false when the order has fewer than two items, i.e. there is nothing to split.
+// Once ctx is done every station stops without marking its item, and ctx's error is returned.
+func (mp *MessageProcessor) cookItems(ctx context.Context, event map[string]interface{}) (bool, error) {
+    if mp.store == nil {
+        return false, nil
+    }
+    orderNo := fmt.Sprint(event["order_no"])
+    order, ok := mp.store.Get(orderNo)
+    if !ok || len(order.Items) < 2 {
+        return false, nil
+    }
+
+    var stations sync.WaitGroup
+    for index, item := range order.Items {
+        if item.Status == constants.ORDER_ITEM_DONE {
+            continue
+        }
+        stations.Add(1)
+        go func(index int) {
+            defer stations.Done()
+            if utils.SleepContext(ctx, utils.GenerateRandomDuration(6, 1)) != nil {
+                return
+            }
+
+            updated, ok := mp.store.MarkItemReady(orderNo, index)
+            if !ok {
+                return
+            }
+            logger.Log(fmt.Sprintf("Order #%s: %s is ready (%d/%d)", orderNo, updated.Items[index].Name, updated.ReadyItems(), len(updated.Items)))
+            progress := map[string]interface{}{
+                "message":     constants.ORDER_ITEM_READY,
+                "order_no":    orderNo,
+                "item":        updated.Items[index],
+                "ready_items": updated.ReadyItems(),
+                "total_items": len(updated.Items),
+            }
+            if notes, ok := event["notes"]; ok {
+                progress["notes"] = notes
+            }
+            mp.notifyOrder(event, progress)
+        }(index)
+    }
+    stations.Wait()
+    return true, ctx.Err()
+}
+
 // handleOrderPrepared: Final step. Sends a "Your Pizza is Ready" alert to the UI
-func (mp *MessageProcessor) handleOrderPrepared(event map[string]interface{}) error {
-    logger.Log(fmt.Sprintf("Action: Order #%v is ready! Notifying customer.", event["order_no"]))
+func (mp *MessageProcessor) handleOrderPrepared(ctx context.Context, event map[string]interface{}) error {
+    logger.Sampled(fmt.Sprintf("Action: Order #%v is ready! Notifying customer.", event["order_no"]))
     
-    event["order_status"] = constants.ORDER_DELIVERED
+    if err := mp.advanceStatus(ctx, event, constants.ORDER_DELIVERED); err != nil {
+        return err
+    }
     
     // Prepare the JSON data for the WebSocket
+    message := readyMessage(event)
+
+    // SLA: how long from "order placed" to "ready"?
+    if timeToReady, ok := timeSinceCreated(event); ok {
+        logger.Log(fmt.Sprintf("Order #%v was ready %v after it was placed", event["order_no"], timeToReady))
+        mp.metrics.RecordTimeToReady(timeToReady)
+        event["time_to_ready_ms"] = timeToReady.Milliseconds()
+        message["time_to_ready_ms"] = timeToReady.Milliseconds()
+    }
+    
+    // The one update a customer must not miss: ask for a delivery receipt if their socket can.
+    return mp.notifyOrderWithReceipt(event, message)
+}
+
+// handleOrderDelivered: An admin advanced a prepared order straight to delivered, so the
+// ready step above never ran for it. The store already says delivered; just tell the customer.
+func (mp *MessageProcessor) handleOrderDelivered(ctx context.Context, event map[string]interface{}) error {
+    logger.Sampled(fmt.Sprintf("Action: Order #%v was marked delivered. Notifying customer.", event["order_no"]))
+
+    return mp.notifyOrderWithReceipt(event, readyMessage(event))
+}
+
+// readyMessage is the "your pizza is ready" update for the customer.
+func readyMessage(event map[string]interface{}) map[string]interface{} {
     message := map[string]interface{}{
         "message": constants.ORDER_PREPARED_SUCCESSFULLY,
         "order":   event,
     }
-    
-    return mp.broadcastToWebSocket(message)
+    // Priced orders tell the customer how much to have ready at pickup.
+    if total, ok := event["total"]; ok {
+        message["amount_due"] = total
+    }
+    // Echo the special instructions so the customer sees they were followed.
+    if notes, ok := event["notes"]; ok {
+        message["notes"] = notes
+    }
+    return message
+}
+
+// handleOrderCancelled: The HTTP handler already marked the order cancelled; just tell the customer
+func (mp *MessageProcessor) handleOrderCancelled(ctx context.Context, event map[string]interface{}) error {
+    logger.Sampled(fmt.Sprintf("Action: Order #%v was cancelled. Notifying customer.", event["order_no"]))
+    mp.inFlight.Leave(fmt.Sprint(event["order_no"])) // Stop counting it even if the chef hasn't noticed yet
+
+    message := map[string]interface{}{
+        "message": constants.ORDER_CANCELLED,
+        "order":   event,
+    }
+    return mp.notifyOrder(event, message)
+}
+
+// advanceStatus: Moves the event to the next status after asking the validator.
+// The store is the source of truth when it knows the order, so a cancelled order
+// can't be pushed forward by an event that was already in the queue.
+// A retried or redelivered step whose status change already went through (say the
+// publish after it failed) finds the store at 'next': it carries on from there.
+// A first delivery that finds the order moved on (e.g. by an admin) is still rejected.
+func (mp *MessageProcessor) advanceStatus(ctx context.Context, event map[string]interface{}, next string) error {
+    current, _ := event["order_status"].(string)
+    orderNo := fmt.Sprint(event["order_no"])
+    if mp.store != nil {
+        if order, ok := mp.store.Get(orderNo); ok {
+            if isRepeat(ctx) && order.Status == next && current != next && checkTransition(mp.validator, current, next) == nil {
+                event["order_status"] = next
+                return nil
+            }
+            current = order.Status
+        }
+    }
+
+    if err := checkTransition(mp.validator, current, next); err != nil {
+        return err
+    }
+    event["order_status"] = next
+    if mp.store != nil {
+        mp.store.UpdateStatus(orderNo, next)
+    }
+    mp.recordEvent(event)
+    return nil
+}
+
+// recordEvent: Appends the event's current status to the audit trail
+func (mp *MessageProcessor) recordEvent(event map[string]interface{}) {
+    if mp.eventLog == nil {
+        return
+    }
+    correlationId, _ := event["correlation_id"].(string)
+    status, _ := event["order_status"].(string)
+    err := mp.eventLog.Append(OrderEvent{
+        OrderNo:       fmt.Sprint(event["order_no"]),
+        Status:        status,
+        CorrelationID: correlationId,
+        Timestamp:     utils.Clock.Now(),
+    })
+    if err != nil {
+        logger.Log(fmt.Sprintf("Failed to record order event: %v", err))
+    }
+}
+
+// timeSinceCreated: Reads the "created_at" timestamp the order handler stamped on the event
+func timeSinceCreated(event map[string]interface{}) (time.Duration, bool) {
+    raw, _ := event["created_at"].(string)
+    createdAt, err := time.Parse(time.RFC3339Nano, raw)
+    if err != nil {
+        return 0, false
+    }
+    return utils.Clock.Since(createdAt), true
+}
+
+// ownerOf: Reads the customer ID the order handler stamped on the event
+func ownerOf(event map[string]interface{}) string {
+    owner, _ := event["customer_id"].(string)
+    return owner
 }
 
 // broadcastToWebSocket: A helper to send messages to the Frontend safely
-func (mp *MessageProcessor) broadcastToWebSocket(data interface{}) error {
-    bytes, _ := json.Marshal(data)
+func (mp *MessageProcessor) broadcastToWebSocket(clientId string, data interface{}) error {
+    bytes, err := MarshalWebSocketMessage(data)
+    if err != nil {
+        logger.Log(fmt.Sprintf("Failed to encode update for [%s]: %v", clientId, err))
+        return err
+    }
+    return mp.sendFrame(clientId, bytes)
+}
+
+// sendFrame: Hands an encoded frame to the batcher (when on) or straight to the client
+func (mp *MessageProcessor) sendFrame(clientId string, bytes []byte) error {
+    // With batching on, the batcher decides when the frame actually goes out.
+    if mp.batcher != nil {
+        mp.batcher.Enqueue(clientId, bytes)
+        return nil
+    }
+    return mp.sendToClient(clientId, bytes)
+}
+
+// notifyOrder: Tells the owner, and any tracking page open on this one order
+// An update that can't be encoded is never sent (not even half of it); the error is
+// returned so the message counts as failed instead of delivered.
+func (mp *MessageProcessor) notifyOrder(event map[string]interface{}, data interface{}) error {
+    bytes, err := MarshalWebSocketMessage(data)
+    if err != nil {
+        logger.Log(fmt.Sprintf("Failed to encode update for order #%v (customer [%s]), nothing was sent: %v", event["order_no"], ownerOf(event), err))
+        return fmt.Errorf("failed to encode update for order #%v: %w", event["order_no"], err)
+    }
+
+    if mp.follows(event) {
+        err = mp.sendFrame(ownerOf(event), bytes)
+    }
+    mp.notifyWatchers(event, bytes)
+    return err
+}
+
+// follows: Whether the owner's socket wants this order's updates (it may have unsubscribed).
+// Tracking pages follow their one order no matter what.
+func (mp *MessageProcessor) follows(event map[string]interface{}) bool {
+    return mp.following == nil || mp.following(ownerOf(event), fmt.Sprint(event["order_no"]))
+}
+
+// notifyOrderWithReceipt: notifyOrder, but a customer socket that speaks delivery receipts
+// (WS_DELIVERY_RECEIPTS) gets the update with a "message_id" to ack, and again if it doesn't.
+// It skips the batcher, so the receipt clock starts when the frame really goes out.
+func (mp *MessageProcessor) notifyOrderWithReceipt(event map[string]interface{}, data map[string]interface{}) error {
+    var socket IReceiptConnection
+    if mp.connection != nil {
+        socket, _ = mp.connection(ownerOf(event)).(IReceiptConnection)
+    }
+    if socket == nil || !mp.follows(event) {
+        return mp.notifyOrder(event, data) // Offline (kept for later), no receipts or unsubscribed: as usual
+    }
+
+    messageId := utils.RandomId()
+    data["message_id"] = messageId
+    bytes, err := MarshalWebSocketMessage(data)
+    if err != nil {
+        logger.Log(fmt.Sprintf("Failed to encode update for order #%v (customer [%s]), nothing was sent: %v", event["order_no"], ownerOf(event), err))
+        return fmt.Errorf("failed to encode update for order #%v: %w", event["order_no"], err)
+    }
+
+    err = socket.SendWithReceipt(messageId, bytes)
+    mp.notifyWatchers(event, bytes)
+    return err
+}
+
+// notifyWatchers: Sends an encoded update to every tracking page open on the order
+func (mp *MessageProcessor) notifyWatchers(event map[string]interface{}, bytes []byte) {
+    if mp.watchers == nil {
+        return
+    }
 
+    watchers := mp.watchers(fmt.Sprint(event["order_no"]))
+    for _, socket := range watchers {
+        if sendErr := socket.SendMessage(bytes); sendErr != nil {
+            logger.Log(fmt.Sprintf("Failed to update tracking page for order #%v: %v", event["order_no"], sendErr))
+        }
+    }
+}
+
+// sendToClient: Writes one frame to the client's socket, if they're online
+func (mp *MessageProcessor) sendToClient(clientId string, bytes []byte) error {
     if mp.connection != nil {
-        // LOCKING: Because many messages might finish at once, we use a Mutex.
-        // This stops the app from crashing due to "concurrent map access."
-        mp.mutex.Lock()
-        defer mp.mutex.Unlock()
-
-        // In this demo, we use the key "pizza" to find the user.
-        socket := (*mp.connection)["pizza"]
-        if socket != nil {
+        // The lookup takes the WebSocket handler's own lock (the one that guards the
+        // "Address Book" while users come and go); the write itself happens outside it.
+        // Only the customer who placed the order gets its updates.
+        if socket := mp.connection(clientId); socket != nil {
             return socket.SendMessage(bytes)
         }
     }
+
+    // Customer is offline: keep the message so they get it when they reconnect.
+    if mp.pending != nil {
+        logger.Log(fmt.Sprintf("Customer [%s] is offline, keeping notification for later", clientId))
+        mp.pending.Add(clientId, bytes)
+    }
     return nil
 }
 
@@ -151,13 +720,55 @@ func (mp *MessageProcessor) sendErrorToUser(err error, event map[string]interfac
         "message": constants.ORDER_CANCELLED,
         "error":   err.Error(),
     }
-    mp.broadcastToWebSocket(errMsg)
+    mp.broadcastToWebSocket(ownerOf(event), errMsg)
+}
+
+// ProcessorOptions are the MessageProcessor's optional collaborators.
+// Leave a field unset to go without it: an interface set to a nil pointer is not nil.
+type ProcessorOptions struct {
+    EventLog IEventLog                                   // Audit trail of every status change
+    Pending  *PendingNotificationStore                   // Keeps updates for offline customers until they reconnect
+    AutoAck  bool                                        // True when the consumer lets the broker ack for us
+    Watchers func(orderNo string) []IWebSocketConnection // Tracking pages following a single order
+    Webhook  *OrderWebhook                               // Tells an external kitchen system about accepted orders
+    InFlight *InFlightTracker                            // Shared with the HTTP handlers; default: an unlimited one of our own
 }
 
 // GetMessageProcessorService: The "Constructor" to initialize this service
-func GetMessageProcessorService(publisher IMessagePubliser, connection *map[string]IWebSocketConnection) *MessageProcessor {
-    return &MessageProcessor{
-        publisher:  publisher,
-        connection: connection,
+func GetMessageProcessorService(publisher IMessagePubliser, connection func(clientId string) IWebSocketConnection, validator IOrderStatusValidator, store IOrderStore, metrics *KitchenMetrics, options ProcessorOptions) *MessageProcessor {
+    if options.InFlight == nil {
+        options.InFlight = GetInFlightTracker(0)
+    }
+    mp := &MessageProcessor{
+        publisher:        publisher,
+        connection:       connection,
+        validator:        validator,
+        store:            store,
+        metrics:          metrics,
+        guard:            GetIdempotencyGuard(),
+        eventLog:         options.EventLog,
+        pending:          options.Pending,
+        autoAck:          options.AutoAck,
+        handlers:         make(map[string]StatusHandler),
+        eventTypes:       make(map[string]EventType),
+        maxRetries:       config.GetEnvPropertyAsInt("max_retry_count", 3),
+        failures:         newFailurePolicy(config.GetEnvPropertyAsBool("processing_timeout_requeue", true)),
+        orderLocks:       GetOrderLocks(config.GetEnvPropertyAsInt("per_order_concurrency", 1)),
+        watchers:         options.Watchers,
+        webhook:          options.Webhook,
+        inFlight:         options.InFlight,
+        dedup:            newMessageDeduper(),
     }
+
+    // The built-in pizza flow.
+    mp.RegisterHandler(constants.ORDER_ORDERED, mp.handleOrderOrdered)            // Customer ordered -> Send to Kitchen
+    mp.RegisterHandler(constants.ORDER_PREPARING, mp.handleOrderPreparing)        // Kitchen is cooking -> Simulate time and move to Prepared
+    mp.RegisterHandler(constants.ORDER_PREPARED, mp.handleOrderPrepared)          // Pizza is ready -> Notify the user via WebSocket
+    mp.RegisterHandler(constants.ORDER_DELIVERED, mp.handleOrderDelivered)        // Advanced by an admin -> Notify the user the same way
+    mp.RegisterHandler(constants.ORDER_STATUS_CANCELLED, mp.handleOrderCancelled) // Customer cancelled -> Tell them it's done
+
+    // WS_BATCH_WINDOW_MS > 0 turns on coalescing (e.g. 50); 0 sends every update immediately.
+    window := time.Duration(config.GetEnvPropertyAsInt("ws_batch_window", 0)) * time.Millisecond
+    mp.batcher = GetBroadcastBatcher(window, mp.sendToClient)
+    return mp
 }
\ No newline at end of file
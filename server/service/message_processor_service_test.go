@@ -0,0 +1,681 @@
+package service
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "testing"
+    "time"
+
+    "github.com/everestp/pizza-shop/constants"
+    "github.com/everestp/pizza-shop/utils"
+    "github.com/rabbitmq/amqp091-go"
+)
+
+// settlements counts how the processor settled test deliveries.
+type settlements struct {
+    acks, requeues, rejects int
+    mutex                   sync.Mutex
+}
+
+func (s *settlements) Ack(tag uint64, multiple bool) error {
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+    s.acks++
+    return nil
+}
+
+func (s *settlements) Nack(tag uint64, multiple bool, requeue bool) error {
+    return s.Reject(tag, requeue)
+}
+
+func (s *settlements) Reject(tag uint64, requeue bool) error {
+    s.mutex.Lock()
+    defer s.mutex.Unlock()
+    if requeue {
+        s.requeues++
+    } else {
+        s.rejects++
+    }
+    return nil
+}
+
+// testProcessor is a MessageProcessor on the in-memory broker, plus what the tests look at.
+type testProcessor struct {
+    *MessageProcessor
+    broker  *MemoryBroker
+    store   *OrderStore
+    settled *settlements
+}
+
+func newTestProcessor(t *testing.T) *testProcessor {
+    t.Helper()
+
+    broker := GetMemoryBroker(100)
+    store := GetOrderStore()
+    processor := GetMessageProcessorService(GetMemoryPublisher(broker), nil, GetOrderStatusValidator(), store,
+        GetKitchenMetrics(), ProcessorOptions{})
+    return &testProcessor{MessageProcessor: processor, broker: broker, store: store, settled: &settlements{}}
+}
+
+// deliver runs one message with this ID and body through the processor.
+func (tp *testProcessor) deliver(t *testing.T, messageId string, body []byte) error {
+    t.Helper()
+
+    return tp.ProcessMessage(context.Background(), amqp091.Delivery{
+        Acknowledger: tp.settled,
+        MessageId:    messageId,
+        RoutingKey:   constants.KITCHEN_ORDER_QUEUE,
+        Body:         body,
+    })
+}
+
+// orderEvent is the body of one step of alice's order.
+func orderEvent(t *testing.T, orderNo, status string) []byte {
+    t.Helper()
+
+    body, err := json.Marshal(map[string]any{"order_no": orderNo, "order_status": status, "customer_id": "alice"})
+    if err != nil {
+        t.Fatalf("marshal event: %v", err)
+    }
+    return body
+}
+
+// published takes the next message the processor queued for the kitchen (nil if there is none).
+func (tp *testProcessor) published() *amqp091.Delivery {
+    return take(tp.broker, constants.KITCHEN_ORDER_QUEUE)
+}
+
+// redeliver runs a copy of an earlier message, flagged the way the broker flags a redelivery.
+func (tp *testProcessor) redeliver(t *testing.T, body []byte) error {
+    t.Helper()
+
+    return tp.ProcessMessage(context.Background(), amqp091.Delivery{
+        Acknowledger: tp.settled,
+        Redelivered:  true,
+        RoutingKey:   constants.KITCHEN_ORDER_QUEUE,
+        Body:         body,
+    })
+}
+
+func TestRedeliveredCopyIsProcessedOnce(t *testing.T) {
+    tp := newTestProcessor(t)
+    tp.store.Save(Order{OrderNo: "A1", OwnerID: "alice", Status: constants.ORDER_ORDERED})
+    body := orderEvent(t, "A1", constants.ORDER_ORDERED)
+
+    if err := tp.deliver(t, "", body); err != nil {
+        t.Fatalf("original: %v", err)
+    }
+    if tp.published() == nil {
+        t.Fatal("the original did not publish the next step")
+    }
+    if err := tp.redeliver(t, body); err != nil {
+        t.Fatalf("redelivered copy: %v", err)
+    }
+    if next := tp.published(); next != nil {
+        t.Errorf("the redelivered copy was processed again: it published %s", next.Body)
+    }
+    if tp.settled.acks != 2 {
+        t.Errorf("settled %+v, want both copies acked", tp.settled)
+    }
+}
+
+func TestRedeliveredCopyWaitsForTheOriginalStillRunning(t *testing.T) {
+    tp := newTestProcessor(t)
+    started, release := make(chan struct{}), make(chan struct{})
+    var runs int32
+    tp.RegisterHandler(constants.ORDER_ORDERED, func(ctx context.Context, event map[string]interface{}) error {
+        if atomic.AddInt32(&runs, 1) == 1 {
+            close(started)
+            <-release
+        }
+        return nil
+    })
+    body := orderEvent(t, "A1", constants.ORDER_ORDERED)
+
+    original := make(chan error, 1)
+    go func() { original <- tp.deliver(t, "", body) }()
+    <-started
+
+    copied := make(chan error, 1)
+    go func() { copied <- tp.redeliver(t, body) }()
+    select {
+    case err := <-copied:
+        t.Fatalf("the copy was settled (%v) while the original was still running", err)
+    case <-time.After(50 * time.Millisecond):
+    }
+
+    close(release)
+    if err := <-original; err != nil {
+        t.Fatalf("original: %v", err)
+    }
+    if err := <-copied; err != nil {
+        t.Fatalf("redelivered copy: %v", err)
+    }
+    if n := atomic.LoadInt32(&runs); n != 1 {
+        t.Errorf("the step ran %d times, want once", n)
+    }
+}
+
+func TestNonDeliveryIsAnErrorNotAPanic(t *testing.T) {
+    tp := newTestProcessor(t)
+
+    for _, message := range []interface{}{"a string", &amqp091.Delivery{}, nil} {
+        err := tp.ProcessMessage(context.Background(), message)
+        if err == nil || !strings.Contains(err.Error(), "unsupported message type") {
+            t.Errorf("%T: got %v, want an unsupported type error", message, err)
+        }
+    }
+}
+
+func TestAutoAckProcessorNeverSettles(t *testing.T) {
+    cases := []struct {
+        name string
+        body func(t *testing.T) []byte
+    }{
+        {name: "processed", body: func(t *testing.T) []byte { return orderEvent(t, "A1", constants.ORDER_ORDERED) }},
+        {name: "malformed", body: func(t *testing.T) []byte { return []byte("{not json") }},
+        {name: "illegal transition", body: func(t *testing.T) []byte { return orderEvent(t, "A1", constants.ORDER_PREPARED) }},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            for _, autoAck := range []bool{true, false} {
+                tp := newTestProcessor(t)
+                tp.autoAck = autoAck
+                tp.store.Save(Order{OrderNo: "A1", OwnerID: "alice", Status: constants.ORDER_ORDERED})
+
+                tp.deliver(t, "", tc.body(t))
+                settled := tp.settled.acks + tp.settled.requeues + tp.settled.rejects
+                if autoAck && settled != 0 {
+                    t.Errorf("auto-ack: settled %+v, want nothing (the broker already acked)", tp.settled)
+                }
+                if !autoAck && settled != 1 {
+                    t.Errorf("manual ack: settled %+v, want exactly once", tp.settled)
+                }
+            }
+        })
+    }
+}
+
+func TestRegisteredHandlerRunsForItsStatus(t *testing.T) {
+    tp := newTestProcessor(t)
+    var seen []string
+    tp.RegisterHandler("boxed", func(ctx context.Context, event map[string]interface{}) error {
+        seen = append(seen, fmt.Sprint(event["order_no"]))
+        return nil
+    })
+
+    if err := tp.deliver(t, "", orderEvent(t, "A1", "boxed")); err != nil {
+        t.Fatalf("boxed: %v", err)
+    }
+    if len(seen) != 1 || seen[0] != "A1" {
+        t.Errorf("the custom handler saw %v, want A1 once", seen)
+    }
+
+    // The built-in statuses still go to their own handlers.
+    tp.store.Save(Order{OrderNo: "A2", OwnerID: "alice", Status: constants.ORDER_ORDERED})
+    if err := tp.deliver(t, "", orderEvent(t, "A2", constants.ORDER_ORDERED)); err != nil {
+        t.Fatalf("ordered: %v", err)
+    }
+    if len(seen) != 1 || tp.published() == nil {
+        t.Errorf("ordered: the custom handler ran (%v) or the built-in one didn't", seen)
+    }
+}
+
+func TestUnknownStatusIsAckedAndSkipped(t *testing.T) {
+    tp := newTestProcessor(t)
+
+    if err := tp.deliver(t, "", orderEvent(t, "A1", "teleported")); err != nil {
+        t.Fatalf("got %v, want the unknown status skipped", err)
+    }
+    if tp.settled.acks != 1 || tp.published() != nil {
+        t.Errorf("settled %+v; want it acked and nothing published", tp.settled)
+    }
+}
+
+// manualClock is a fake clock that only moves when the test says so.
+type manualClock struct {
+    utils.RealClock
+    now time.Time
+}
+
+func (mc *manualClock) Now() time.Time                  { return mc.now }
+func (mc *manualClock) Since(t time.Time) time.Duration { return mc.now.Sub(t) }
+
+func TestTimeToReadyIsMeasuredOnTheClock(t *testing.T) {
+    clock := &manualClock{now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+    utils.Clock = clock
+    t.Cleanup(func() { utils.Clock = utils.RealClock{} })
+
+    tp := newTestProcessor(t)
+    pending := GetPendingNotificationStore(time.Hour)
+    tp.pending = pending // Alice is offline, so the ready notification is kept where we can read it
+    tp.store.Save(Order{OrderNo: "A1", OwnerID: "alice", Status: constants.ORDER_PREPARED})
+    body, _ := json.Marshal(map[string]any{
+        "order_no":     "A1",
+        "order_status": constants.ORDER_PREPARED,
+        "customer_id":  "alice",
+        "created_at":   clock.now.Format(time.RFC3339Nano),
+    })
+
+    clock.now = clock.now.Add(90 * time.Second) // The kitchen took a minute and a half
+    if err := tp.deliver(t, "", body); err != nil {
+        t.Fatalf("process: %v", err)
+    }
+
+    if got := tp.metrics.AverageTimeToReady(); got != 90*time.Second {
+        t.Errorf("metrics: got %v, want 1m30s", got)
+    }
+    missed := pending.Drain("alice")
+    if len(missed) != 1 {
+        t.Fatalf("got %d notification(s), want the ready one", len(missed))
+    }
+    var frame map[string]any
+    json.Unmarshal(missed[0], &frame)
+    if frame["time_to_ready_ms"] != float64(90_000) {
+        t.Errorf("notification: got time_to_ready_ms %v, want 90000", frame["time_to_ready_ms"])
+    }
+}
+
+func TestRetryCountGrowsPerFailureUntilDeadLettered(t *testing.T) {
+    tp := newTestProcessor(t)
+    tp.maxRetries = 2
+    tp.RegisterHandler(constants.ORDER_ORDERED, func(ctx context.Context, event map[string]interface{}) error {
+        return errors.New("oven offline")
+    })
+
+    delivery := amqp091.Delivery{Acknowledger: tp.settled, RoutingKey: constants.KITCHEN_ORDER_QUEUE, Body: orderEvent(t, "A1", constants.ORDER_ORDERED)}
+    for want := 1; want <= 2; want++ {
+        tp.ProcessMessage(context.Background(), delivery)
+        retried := tp.published()
+        if retried == nil || RetryCount(retried.Headers) != want {
+            t.Fatalf("failure %d: got %+v, want a copy with %s=%d", want, retried, RetryCountHeader, want)
+        }
+        delivery = *retried
+        delivery.Acknowledger = tp.settled
+    }
+
+    tp.ProcessMessage(context.Background(), delivery) // The third failure is one too many
+    if retried := tp.published(); retried != nil {
+        t.Errorf("retried past the max: %+v", retried.Headers)
+    }
+    if tp.settled.acks != 2 || tp.settled.rejects != 1 || tp.settled.requeues != 0 {
+        t.Errorf("settled %+v, want 2 retried copies acked and the last one dead-lettered", tp.settled)
+    }
+}
+
+func TestRetryCountSurvivesIntoTheNextStep(t *testing.T) {
+    tp := newTestProcessor(t)
+    tp.store.Save(Order{OrderNo: "A1", OwnerID: "alice", Status: constants.ORDER_ORDERED})
+
+    err := tp.ProcessMessage(context.Background(), amqp091.Delivery{
+        Acknowledger: tp.settled,
+        Headers:      amqp091.Table{RetryCountHeader: int64(2)},
+        Body:         orderEvent(t, "A1", constants.ORDER_ORDERED),
+    })
+    if err != nil {
+        t.Fatalf("process: %v", err)
+    }
+    if next := tp.published(); next == nil || RetryCount(next.Headers) != 2 {
+        t.Errorf("got %+v, want the next step to keep %s=2", next, RetryCountHeader)
+    }
+}
+
+// flakyPublisher fails its first 'failures' publishes, then publishes normally.
+type flakyPublisher struct {
+    *MemoryPublisher
+    failures int
+}
+
+func (fp *flakyPublisher) PublishEventWithOptions(options PublishOptions, body any) error {
+    if fp.failures > 0 {
+        fp.failures--
+        return errors.New("broker unreachable")
+    }
+    return fp.MemoryPublisher.PublishEventWithOptions(options, body)
+}
+
+func TestStepWhosePublishFailedGoesThroughOnRetry(t *testing.T) {
+    tp := newTestProcessor(t)
+    tp.publisher = &flakyPublisher{MemoryPublisher: GetMemoryPublisher(tp.broker), failures: 1}
+    tp.store.Save(Order{OrderNo: "A1", OwnerID: "alice", Status: constants.ORDER_ORDERED})
+
+    tp.ProcessMessage(context.Background(), amqp091.Delivery{Acknowledger: tp.settled, RoutingKey: constants.KITCHEN_ORDER_QUEUE, Body: orderEvent(t, "A1", constants.ORDER_ORDERED)})
+    retried := tp.published()
+    if retried == nil || RetryCount(retried.Headers) != 1 {
+        t.Fatalf("got %+v, want the failed step sent back for a retry", retried)
+    }
+
+    // The store already says PREPARING; the retry must still hand the order to the chef.
+    retried.Acknowledger = tp.settled
+    if err := tp.ProcessMessage(context.Background(), *retried); err != nil {
+        t.Fatalf("retry: %v", err)
+    }
+    next := tp.published()
+    if next == nil {
+        t.Fatal("the retry did not publish the next step")
+    }
+    var event map[string]any
+    json.Unmarshal(next.Body, &event)
+    if event["order_status"] != constants.ORDER_PREPARING {
+        t.Errorf("published %s, want the order on its way to the chef", next.Body)
+    }
+    if tp.settled.acks != 2 || tp.settled.rejects != 0 {
+        t.Errorf("settled %+v, want both attempts acked and nothing dead-lettered", tp.settled)
+    }
+}
+
+func TestFirstDeliveryOfAStepAlreadyTakenIsStillRejected(t *testing.T) {
+    tp := newTestProcessor(t)
+    // An admin moved the order on while its prepared event was still queued.
+    tp.store.Save(Order{OrderNo: "A1", OwnerID: "alice", Status: constants.ORDER_DELIVERED})
+
+    if err := tp.deliver(t, "", orderEvent(t, "A1", constants.ORDER_PREPARED)); !errors.Is(err, ErrInvalidTransition) {
+        t.Errorf("got %v, want the stale step rejected as an invalid transition", err)
+    }
+}
+
+func TestSplitOrderReportsEachItemThenThePreparedOrder(t *testing.T) {
+    utils.Clock = instantClock{}
+    t.Cleanup(func() { utils.Clock = utils.RealClock{} })
+    tp := newTestProcessor(t)
+    alice := &customerSocket{frames: make(chan []byte, 10)}
+    tp.connection = func(clientId string) IWebSocketConnection { return alice }
+    tp.store.Save(Order{OrderNo: "A1", OwnerID: "alice", Status: constants.ORDER_PREPARING, Items: NewItemStates([]OrderItem{
+        {Name: "margherita", Quantity: 1},
+        {Name: "garlic bread", Quantity: 2},
+    })})
+
+    if err := tp.deliver(t, "", orderEvent(t, "A1", constants.ORDER_PREPARING)); err != nil {
+        t.Fatalf("preparing: %v", err)
+    }
+
+    // One progress update per item, counting up; the order is PREPARED only after the last.
+    for want := 1; want <= 2; want++ {
+        var progress map[string]any
+        select {
+        case frame := <-alice.frames:
+            json.Unmarshal(frame, &progress)
+        default:
+            t.Fatalf("no progress update for item %d", want)
+        }
+        if progress["message"] != constants.ORDER_ITEM_READY || progress["ready_items"] != float64(want) || progress["total_items"] != float64(2) {
+            t.Fatalf("update %d: got %v", want, progress)
+        }
+    }
+    order, _ := tp.store.Get("A1")
+    if order.Status != constants.ORDER_PREPARED || order.ReadyItems() != 2 {
+        t.Fatalf("got %q with %d ready item(s), want prepared with both", order.Status, order.ReadyItems())
+    }
+
+    // The prepared step then tells the customer the whole order is ready.
+    next := tp.published()
+    if next == nil {
+        t.Fatal("nothing was published after the last item")
+    }
+    if err := tp.deliver(t, "", next.Body); err != nil {
+        t.Fatalf("prepared: %v", err)
+    }
+    var final map[string]any
+    select {
+    case frame := <-alice.frames:
+        json.Unmarshal(frame, &final)
+    default:
+        t.Fatal("no final update")
+    }
+    if final["message"] != constants.ORDER_PREPARED_SUCCESSFULLY {
+        t.Errorf("final update: got %v", final)
+    }
+}
+
+func TestUnencodableUpdateIsNotSent(t *testing.T) {
+    tp := newTestProcessor(t)
+    alice := &customerSocket{frames: make(chan []byte, 1)}
+    tp.connection = func(clientId string) IWebSocketConnection { return alice }
+
+    if err := tp.broadcastToWebSocket("alice", map[string]any{"message": "ready", "oven": make(chan int)}); err == nil {
+        t.Error("an update that can't be encoded was reported as sent")
+    }
+    select {
+    case frame := <-alice.frames:
+        t.Errorf("sent %q", frame)
+    default:
+    }
+}
+
+func TestUnencodableOrderUpdateFailsForOwnerAndTrackingPages(t *testing.T) {
+    tp := newTestProcessor(t)
+    alice := &customerSocket{frames: make(chan []byte, 1)}
+    page := &customerSocket{frames: make(chan []byte, 1)}
+    tp.connection = func(clientId string) IWebSocketConnection { return alice }
+    tp.watchers = func(orderNo string) []IWebSocketConnection { return []IWebSocketConnection{page} }
+    event := map[string]interface{}{"order_no": "A1", "customer_id": "alice"}
+
+    err := tp.notifyOrder(event, map[string]any{"message": "ready", "oven": make(chan int)})
+    var unsupported *json.UnsupportedTypeError
+    if !errors.As(err, &unsupported) || !strings.Contains(err.Error(), "A1") {
+        t.Errorf("got %v, want the encode error for order A1", err)
+    }
+    for name, socket := range map[string]*customerSocket{"owner": alice, "tracking page": page} {
+        select {
+        case frame := <-socket.frames:
+            t.Errorf("the %s got %q", name, frame)
+        default:
+        }
+    }
+}
+
+func TestMessagePastItsDeadlineIsNackedAsATimeout(t *testing.T) {
+    for _, requeue := range []bool{true, false} {
+        t.Run(fmt.Sprintf("requeue=%v", requeue), func(t *testing.T) {
+            withEnv(t, map[string]string{"PROCESSING_TIMEOUT_REQUEUE": fmt.Sprint(requeue)})
+            tp := newTestProcessor(t)
+            stuck := make(chan struct{})
+            t.Cleanup(func() { close(stuck) })
+            tp.RegisterHandler(constants.ORDER_ORDERED, func(ctx context.Context, event map[string]interface{}) error {
+                <-stuck // A hung cook or a publish that never returns
+                return nil
+            })
+            ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+            defer cancel()
+
+            start := time.Now()
+            err := tp.ProcessMessage(ctx, amqp091.Delivery{Acknowledger: tp.settled, Body: orderEvent(t, "A1", constants.ORDER_ORDERED)})
+            if !errors.Is(err, ErrProcessingTimeout) {
+                t.Fatalf("got %v, want ErrProcessingTimeout", err)
+            }
+            if took := time.Since(start); took > time.Second {
+                t.Errorf("gave up after %v, want at the 20ms deadline", took)
+            }
+            if requeue && tp.settled.requeues != 1 || !requeue && tp.settled.rejects != 1 || tp.settled.acks != 0 {
+                t.Errorf("settled %+v, want one nack with requeue=%v", tp.settled, requeue)
+            }
+        })
+    }
+}
+
+func TestOrderedOrderIsAcceptedRightAway(t *testing.T) {
+    tp := newTestProcessor(t)
+    alice := &customerSocket{frames: make(chan []byte, 10)}
+    tp.connection = func(clientId string) IWebSocketConnection {
+        if clientId == "alice" {
+            return alice
+        }
+        return nil
+    }
+    tp.store.Save(Order{OrderNo: "A1", OwnerID: "alice", Status: constants.ORDER_ORDERED})
+
+    if err := tp.deliver(t, "", orderEvent(t, "A1", constants.ORDER_ORDERED)); err != nil {
+        t.Fatalf("process: %v", err)
+    }
+    select {
+    case frame := <-alice.frames:
+        var update struct {
+            Message string         `json:"message"`
+            Order   map[string]any `json:"order"`
+        }
+        if err := json.Unmarshal(frame, &update); err != nil || update.Message != constants.ORDER_RECEIVED || update.Order["order_no"] != "A1" {
+            t.Errorf("got %s, want the accepted event for A1", frame)
+        }
+    default:
+        t.Fatal("alice heard nothing when the kitchen took the order")
+    }
+    if tp.published() == nil {
+        t.Error("the order did not go on to the kitchen")
+    }
+}
+
+func TestAcceptedEventForAnOfflineCustomer(t *testing.T) {
+    for _, keep := range []bool{true, false} {
+        t.Run(fmt.Sprintf("pending notifications kept=%v", keep), func(t *testing.T) {
+            var pending *PendingNotificationStore
+            if keep {
+                pending = GetPendingNotificationStore(time.Minute)
+            }
+            broker := GetMemoryBroker(10)
+            store := GetOrderStore()
+            store.Save(Order{OrderNo: "A1", OwnerID: "alice", Status: constants.ORDER_ORDERED})
+            offline := func(clientId string) IWebSocketConnection { return nil }
+            processor := GetMessageProcessorService(GetMemoryPublisher(broker), offline, GetOrderStatusValidator(), store,
+                GetKitchenMetrics(), ProcessorOptions{Pending: pending})
+
+            err := processor.ProcessMessage(context.Background(), amqp091.Delivery{
+                Acknowledger: &settlements{},
+                Body:         orderEvent(t, "A1", constants.ORDER_ORDERED),
+            })
+            if err != nil {
+                t.Fatalf("an offline customer failed the order: %v", err)
+            }
+            if take(broker, constants.KITCHEN_ORDER_QUEUE) == nil {
+                t.Error("the order did not go on to the kitchen")
+            }
+            if !keep {
+                return
+            }
+            missed := pending.Drain("alice")
+            var frame map[string]any
+            if len(missed) != 1 || json.Unmarshal(missed[0], &frame) != nil || frame["message"] != constants.ORDER_RECEIVED {
+                t.Errorf("kept %q, want the accepted event", missed)
+            }
+        })
+    }
+}
+
+// stationClock is a fake clock for stations that all start cooking at once: every timer
+// fires right away, and the clock reads as if it had waited for the longest one so far.
+type stationClock struct {
+    utils.RealClock
+    start  time.Time
+    mutex  sync.Mutex
+    timers []time.Duration
+}
+
+func (sc *stationClock) Now() time.Time {
+    sc.mutex.Lock()
+    defer sc.mutex.Unlock()
+
+    longest := time.Duration(0)
+    for _, d := range sc.timers {
+        longest = max(longest, d)
+    }
+    return sc.start.Add(longest)
+}
+
+func (sc *stationClock) Since(t time.Time) time.Duration { return sc.Now().Sub(t) }
+
+func (sc *stationClock) NewTimer(d time.Duration) *time.Timer {
+    sc.mutex.Lock()
+    defer sc.mutex.Unlock()
+
+    sc.timers = append(sc.timers, d)
+    return time.NewTimer(0)
+}
+
+func TestCookStepOfAnOrderCancelledMeanwhileIsAcked(t *testing.T) {
+    clock := &gatedClock{cooking: make(chan struct{}, 1), release: make(chan struct{})}
+    utils.Clock = clock
+    t.Cleanup(func() { utils.Clock = utils.RealClock{} })
+    tp := newTestProcessor(t)
+    tp.store.Save(Order{OrderNo: "A1", OwnerID: "alice", Status: constants.ORDER_PREPARING})
+
+    result := make(chan error, 1)
+    go func() { result <- tp.deliver(t, "", orderEvent(t, "A1", constants.ORDER_PREPARING)) }()
+    <-clock.cooking
+    tp.store.UpdateStatus("A1", constants.ORDER_STATUS_CANCELLED) // The customer cancels; this chef doesn't hear of it
+    close(clock.release)
+
+    if err := <-result; err != nil {
+        t.Fatalf("a cancelled order's cook step failed: %v", err)
+    }
+    if tp.settled.acks != 1 || tp.settled.rejects != 0 {
+        t.Errorf("settled %+v, want the step acked, not dead-lettered", tp.settled)
+    }
+    if next := tp.published(); next != nil {
+        t.Errorf("published %s for a cancelled order", next.Body)
+    }
+    if order, _ := tp.store.Get("A1"); order.Status != constants.ORDER_STATUS_CANCELLED {
+        t.Errorf("status %q, want the order to stay cancelled", order.Status)
+    }
+}
+
+func TestSplitOrderTakesAsLongAsItsSlowestItem(t *testing.T) {
+    clock := &stationClock{start: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+    utils.Clock = clock
+    t.Cleanup(func() { utils.Clock = utils.RealClock{} })
+    tp := newTestProcessor(t)
+    tp.store.Save(Order{OrderNo: "A1", OwnerID: "alice", Status: constants.ORDER_PREPARING, Items: NewItemStates([]OrderItem{
+        {Name: "margherita", Quantity: 1},
+        {Name: "garlic bread", Quantity: 2},
+        {Name: "tiramisu", Quantity: 1},
+    })})
+
+    if err := tp.deliver(t, "", orderEvent(t, "A1", constants.ORDER_PREPARING)); err != nil {
+        t.Fatalf("preparing: %v", err)
+    }
+
+    clock.mutex.Lock()
+    timers := append([]time.Duration(nil), clock.timers...)
+    clock.mutex.Unlock()
+    if len(timers) != 3 {
+        t.Fatalf("cooked with %d timer(s), want one per item", len(timers))
+    }
+    slowest := max(timers[0], timers[1], timers[2])
+    if got := tp.metrics.AverageCookTime(); got != slowest {
+        t.Errorf("cook time: got %v, want the slowest item's %v (items took %v)", got, slowest, timers)
+    }
+}
+
+func TestCancelledContextStopsEveryStation(t *testing.T) {
+    tp := newTestProcessor(t)
+    tp.store.Save(Order{OrderNo: "A1", OwnerID: "alice", Status: constants.ORDER_PREPARING, Items: NewItemStates([]OrderItem{
+        {Name: "margherita", Quantity: 1},
+        {Name: "garlic bread", Quantity: 2},
+    })})
+
+    ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+    defer cancel()
+    start := time.Now()
+    err := tp.ProcessMessage(ctx, amqp091.Delivery{
+        Acknowledger: tp.settled,
+        RoutingKey:   constants.KITCHEN_ORDER_QUEUE,
+        Body:         orderEvent(t, "A1", constants.ORDER_PREPARING),
+    })
+    if waited := time.Since(start); waited > 900*time.Millisecond {
+        t.Fatalf("cooking went on for %v after the context ended (each item takes 1s or more)", waited)
+    }
+    if !errors.Is(err, ErrProcessingTimeout) {
+        t.Errorf("got %v, want ErrProcessingTimeout", err)
+    }
+
+    order, _ := tp.store.Get("A1")
+    if order.Status != constants.ORDER_PREPARING || order.ReadyItems() != 0 {
+        t.Errorf("got %q with %d ready item(s), want still preparing with none", order.Status, order.ReadyItems())
+    }
+    if next := tp.published(); next != nil {
+        t.Errorf("an aborted order went on to %s", next.Body)
+    }
+}
@@ -3,49 +3,114 @@ package service
 import (
     "context"
     "encoding/json"
+    "errors"
     "fmt"
+    "sync"
     "time"
 
     "github.com/everestp/pizza-shop/config"
     "github.com/everestp/pizza-shop/logger"
+    "github.com/everestp/pizza-shop/utils"
     "github.com/rabbitmq/amqp091-go"
 )
 
 // 1. The Interface (The "Contract")
 // Use this for dependency injection and testing. Any struct that has 
-// these two methods "implements" this interface.
+// these methods "implements" this interface.
 type IMessagePubliser interface {
     PublishEvent(queueName string, body any) error
+    PublishEventCtx(ctx context.Context, queueName string, body any) error
+    PublishEventWithOptions(options PublishOptions, body any) error
     DeclareQueue(queueName string) error
+    QueueDepth(queueName string) (int, error)
+    QueueStats(queueName string) (QueueStats, error)
+    Close()
+}
+
+// QueueStats is a snapshot of one queue, as reported by the broker.
+type QueueStats struct {
+    Name      string `json:"name"`
+    Messages  int    `json:"messages"`  // Ready messages waiting to be delivered
+    Consumers int    `json:"consumers"` // Consumers currently subscribed
+}
+
+// PublishOptions says where a message goes.
+// The zero Exchange is RabbitMQ's default exchange, where the routing key IS the queue name
+// (that's what PublishEvent does). A named exchange routes by key to whatever is bound to it,
+// which is the basis for topic routing of different order event types.
+type PublishOptions struct {
+    Exchange     string          // Exchange name; "" = default exchange
+    ExchangeType string          // "direct", "fanout", "topic" (default: PUBLISH_EXCHANGE_TYPE or "topic")
+    RoutingKey   string          // Queue name on the default exchange, e.g. "order.prepared" on a topic exchange
+    Headers      amqp091.Table   // Optional AMQP headers, e.g. the retry count
+    Context      context.Context // Optional: bounds the publish; its trace is continued by the consumer
+    MessageId    string          // Optional: the AMQP message ID (default: a new random one); copies share it, see StepMessageId
+}
+
+// ErrPublishRejected means the broker refused the message (e.g. a full queue with reject-publish).
+var ErrPublishRejected = errors.New("message rejected by broker")
+
+// ErrUnroutable means a mandatory publish matched no queue and the broker sent it back
+// (PUBLISH_MANDATORY=true). Without the flag such a message is silently dropped.
+var ErrUnroutable = errors.New("message could not be routed to any queue")
+
+// ErrNoQueueName means neither the caller nor RABBIT_MQ_DEFAULT_QUEUE said where the message goes.
+// On the default exchange an empty routing key matches no queue, so the message would be silently dropped.
+var ErrNoQueueName = errors.New("no queue name given and RABBIT_MQ_DEFAULT_QUEUE is not set")
+
+// waitForConfirmation waits for the broker's ack or nack of one publish.
+// It is a variable so tests on a fake channel can answer for the broker.
+var waitForConfirmation = func(ctx context.Context, confirmation *amqp091.DeferredConfirmation) (bool, error) {
+    return confirmation.WaitContext(ctx)
 }
 
 // 2. The Struct
 // It holds a reference to the RabbitMQ connection configuration.
 type MessagePublisher struct {
-    conf *config.RabbitMQConection
+    conf      config.IRabbitMQConnection
+    exchanges map[string]bool // Exchanges already declared by this publisher
+    queues    map[string]bool // Queues already declared by this publisher (see ensureQueue)
+    mutex     sync.Mutex      // Guards 'exchanges' and 'queues'
+    mandatory bool            // PUBLISH_MANDATORY: have the broker return messages no queue accepts
 }
 
 // DeclareQueue ensures a queue exists before we try to send messages to it.
+// It opens, uses and closes its own channel, so it works no matter what state
+// PublishEvent left its (always closed after use) channels in.
+// The settings check and the x-arguments live in the config package.
 func (mp *MessagePublisher) DeclareQueue(queueName string) error {
-    channel := mp.conf.GetChannel()
-    if channel == nil {
-        return fmt.Errorf("message channel is nil, please retry")
-    }
-    // Note: We aren't closing the channel here because GetChannel() 
-    // management is handled by the config package.
-    _, err := channel.QueueDeclare(
-        queueName,
-        true,  // Durable
-        false, // Auto-delete
-        false, // Exclusive
-        false, // No-wait
-        nil,   // Args
-    )
-    return err
+    if err := mp.conf.DeclareQueue(queueName); err != nil {
+        return err
+    }
+    mp.mutex.Lock()
+    mp.queues[queueName] = true
+    mp.mutex.Unlock()
+    return nil
 }
 
-// PublishEvent converts any Go object to JSON and sends it to RabbitMQ.
+// PublishEvent converts any Go object to JSON and sends it straight to a queue.
+// Kept for callers without a context of their own; see PublishEventCtx.
 func (mp *MessagePublisher) PublishEvent(queueName string, body any) error {
+    return mp.PublishEventCtx(context.Background(), queueName, body)
+}
+
+// PublishEventCtx is PublishEvent bound to the caller's context: when the caller
+// gives up (client disconnected, request timed out) the publish is abandoned too.
+func (mp *MessagePublisher) PublishEventCtx(ctx context.Context, queueName string, body any) error {
+    // Defaulting: Use the env variable if no queue name is provided.
+    if queueName == "" {
+        queueName = config.GetEnvProperty("rabbit_mq_default_queue")
+    }
+    return mp.PublishEventWithOptions(PublishOptions{RoutingKey: queueName, Context: ctx}, body)
+}
+
+// PublishEventWithOptions converts any Go object to JSON and sends it to an exchange with a routing key.
+func (mp *MessagePublisher) PublishEventWithOptions(options PublishOptions, body any) error {
+    // Guard: the default exchange routes by queue name, and "" is nobody's queue.
+    if options.Exchange == "" && options.RoutingKey == "" {
+        return ErrNoQueueName
+    }
+
     // A. Marshalling: Convert Go Struct -> JSON Bytes
     data, err := json.Marshal(body)
     if err != nil {
@@ -54,49 +119,227 @@ func (mp *MessagePublisher) PublishEvent(queueName string, body any) error {
 
     // B. Context with Timeout: Ensures the request doesn't hang forever 
     // if the RabbitMQ server is slow or unresponsive.
-    ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+    // A caller's context (e.g. the HTTP request's deadline) can cut it shorter.
+    parent := options.Context
+    if parent == nil {
+        parent = context.Background()
+    }
+    ctx, cancel := context.WithTimeout(parent, 15*time.Second)
     defer cancel()
 
-    // C. Defaulting: Use the env variable if no queue name is provided.
-    if queueName == "" {
-        queueName = config.GetEnvProperty("rabbit_mq_default_queue")
+    // On the default exchange a message for a queue that doesn't exist is dropped,
+    // so the first publish to each queue declares it.
+    if options.Exchange == "" {
+        mp.ensureQueue(options.RoutingKey)
+    }
+
+    // C. Channel Management
+    // The channel is closed when we return (sent or not) to free resources.
+    channel, err := mp.conf.GetChannel()
+    if err != nil {
+        mp.forgetDeclared()
+        return fmt.Errorf("RabbitMQ channel is unavailable: %w", err)
+    }
+    defer channel.Close()
+
+    // A named exchange must exist before we publish to it.
+    if options.Exchange != "" {
+        if err := mp.declareExchange(channel, options); err != nil {
+            return err
+        }
     }
 
-    // D. Channel Management
-    channel := mp.conf.GetChannel()
-    if channel == nil || channel.IsClosed() {
-        panic("RabbitMQ channel is unavailable")
+    // Publisher confirms: when a full kitchen queue rejects new orders, the
+    // ONLY way to find out is to wait for the broker's ack/nack of our message.
+    // Mandatory publishes wait too: the broker sends an unroutable message back
+    // BEFORE it acks it, so once the ack is in we know whether it was returned.
+    queueName := options.RoutingKey
+    routingKey := options.RoutingKey
+    if options.Exchange == "" {
+        routingKey = config.QueueName(routingKey) // The default exchange routes by (prefixed) queue name
+    }
+    waitForConfirm := mp.mandatory || (options.Exchange == "" && config.QueueArguments(queueName) != nil && config.KitchenQueueOverflow() == "reject-publish")
+    var returns chan amqp091.Return
+    if mp.mandatory {
+        returns = channel.NotifyReturn(make(chan amqp091.Return, 1))
+    }
+    if waitForConfirm {
+        if err := channel.Confirm(false); err != nil {
+            return fmt.Errorf("failed to enable publisher confirms: %w", err)
+        }
     }
 
-    // E. The Actual Publish
-    err = channel.PublishWithContext(ctx,
-        "",         // Exchange: Empty string means "Direct" to the queue name
-        queueName,  // Routing Key: In this case, our queue name
-        false,      // Mandatory
-        false,      // Immediate
+    // D. The Actual Publish
+    // The amqp client doesn't look at ctx while publishing, so check it ourselves first.
+    if err := ctx.Err(); err != nil {
+        return fmt.Errorf("publish abandoned: %w", err)
+    }
+    confirmation, err := channel.PublishWithDeferredConfirmWithContext(ctx,
+        options.Exchange,   // Exchange: Empty string means "Direct" to the queue name
+        routingKey,         // Routing Key: the queue name on the default exchange
+        mp.mandatory,       // Mandatory: send it back if no queue matches (PUBLISH_MANDATORY)
+        false,              // Immediate
         amqp091.Publishing{
             ContentType:  "application/json",
+            MessageId:    messageIdOf(options),
+            Headers:      injectOptionsTrace(options),
             Body:         data,
             DeliveryMode: amqp091.Persistent, // Message survives RabbitMQ restart
         },
     )
 
     if err != nil {
+        mp.forgetDeclared() // The channel (or the connection under it) broke: declare again next time
         return err
     }
 
-    logger.Log(fmt.Sprintf("Event published successfully: %v", body))
+    // E. Confirmation: a nack means the broker refused the message (queue full).
+    if waitForConfirm {
+        acked, err := waitForConfirmation(ctx, confirmation)
+        if err != nil {
+            return fmt.Errorf("failed waiting for publish confirmation: %w", err)
+        }
+        if !acked {
+            return fmt.Errorf("%w: queue %q is full", ErrPublishRejected, queueName)
+        }
+    }
+
+    // F. Returned: a mandatory message that matched no queue came back to us.
+    select {
+    case returned := <-returns:
+        if options.Exchange == "" {
+            mp.forgetQueue(queueName) // Someone deleted it since we declared it
+        }
+        return fmt.Errorf("%w: exchange %q, routing key %q (%d %s)", ErrUnroutable,
+            options.Exchange, options.RoutingKey, returned.ReplyCode, returned.ReplyText)
+    default:
+    }
+
+    logger.Sampled(fmt.Sprintf("Event published successfully: %v", body))
+    return nil
+}
+
+// messageIdOf gives every published message an ID, which the consumer uses to spot copies of it.
+// Without a MessageId only the transport's own copies share it; see StepMessageId.
+func messageIdOf(options PublishOptions) string {
+    if options.MessageId != "" {
+        return options.MessageId
+    }
+    return utils.RandomId()
+}
+
+// injectOptionsTrace adds the caller's trace context (if any) to the outgoing headers.
+func injectOptionsTrace(options PublishOptions) amqp091.Table {
+    if options.Context == nil {
+        return options.Headers
+    }
+    headers := amqp091.Table{}
+    for key, value := range options.Headers {
+        headers[key] = value
+    }
+    return InjectTraceContext(options.Context, headers)
+}
+
+// ensureQueue declares a queue the first time we publish to it, then remembers it did.
+// Declaring is idempotent, so two publishers racing on a new queue is harmless.
+// A failed declare (e.g. the queue exists with other settings) is only logged, once: the
+// publish goes ahead, and if the broker is really in trouble the publish fails too,
+// which clears the cache so we try again.
+func (mp *MessagePublisher) ensureQueue(queueName string) {
+    mp.mutex.Lock()
+    declared := mp.queues[queueName]
+    mp.mutex.Unlock()
+    if declared {
+        return
+    }
+
+    if err := mp.conf.DeclareQueue(queueName); err != nil {
+        logger.Log(fmt.Sprintf("WARNING: could not declare queue %q before publishing: %v", queueName, err))
+    }
+    mp.mutex.Lock()
+    mp.queues[queueName] = true
+    mp.mutex.Unlock()
+}
+
+// forgetQueue makes the next publish to this queue declare it again.
+func (mp *MessagePublisher) forgetQueue(queueName string) {
+    mp.mutex.Lock()
+    defer mp.mutex.Unlock()
+
+    delete(mp.queues, queueName)
+}
+
+// forgetDeclared drops everything we remember declaring. After a channel or connection
+// failure the broker may have restarted, and what we declared may be gone with it.
+func (mp *MessagePublisher) forgetDeclared() {
+    mp.mutex.Lock()
+    defer mp.mutex.Unlock()
+
+    mp.exchanges = make(map[string]bool)
+    mp.queues = make(map[string]bool)
+}
+
+// declareExchange declares a named exchange the first time we publish to it.
+func (mp *MessagePublisher) declareExchange(channel config.IAMQPChannel, options PublishOptions) error {
+    mp.mutex.Lock()
+    defer mp.mutex.Unlock()
 
-    // F. Cleanup: Close the channel after the message is sent to free resources.
-    channel.Close()
+    if mp.exchanges[options.Exchange] {
+        return nil
+    }
+    kind := options.ExchangeType
+    if kind == "" {
+        kind = config.GetEnvProperty("publish_exchange_type")
+    }
+    if kind == "" {
+        kind = amqp091.ExchangeTopic
+    }
+    err := channel.ExchangeDeclare(
+        options.Exchange,
+        kind,
+        true,  // Durable
+        false, // Auto-delete
+        false, // Internal
+        false, // No-wait
+        nil,   // Args
+    )
+    if err != nil {
+        return fmt.Errorf("failed to declare exchange %q (%s): %w", options.Exchange, kind, err)
+    }
+    mp.exchanges[options.Exchange] = true
     return nil
 }
 
+// QueueDepth returns how many messages are currently waiting in a queue.
+func (mp *MessagePublisher) QueueDepth(queueName string) (int, error) {
+    queue, err := mp.conf.InspectQueue(queueName)
+    if err != nil {
+        return 0, err
+    }
+    return queue.Messages, nil
+}
+
+// QueueStats looks the queue up without creating it (config.ErrQueueNotFound if it doesn't exist).
+func (mp *MessagePublisher) QueueStats(queueName string) (QueueStats, error) {
+    queue, err := mp.conf.InspectQueue(queueName)
+    if err != nil {
+        return QueueStats{}, err
+    }
+    return QueueStats{Name: queue.Name, Messages: queue.Messages, Consumers: queue.Consumers}, nil
+}
+
+// Close shuts down the publisher's RabbitMQ connection.
+func (mp *MessagePublisher) Close() {
+    mp.conf.Close()
+}
+
 // GetMessagePublisher is a Factory function. 
-// It creates the publisher and starts the RabbitMQ connection.
-func GetMessagePublisher() *MessagePublisher {
-    rabbitMQConf := config.GetNewRabbitMQConnection()
+// It creates the publisher on a RabbitMQ connection (usually from the ConnectionManager).
+func GetMessagePublisher(rabbitMQConf config.IRabbitMQConnection) *MessagePublisher {
     return &MessagePublisher{
-        conf: rabbitMQConf,
+        conf:      rabbitMQConf,
+        exchanges: make(map[string]bool),
+        queues:    make(map[string]bool),
+        mandatory: config.GetEnvPropertyAsBool("publish_mandatory", false),
     }
 }
\ No newline at end of file
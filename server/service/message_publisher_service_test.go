@@ -0,0 +1,317 @@
+package service
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "slices"
+    "strings"
+    "sync"
+    "testing"
+
+    "github.com/everestp/pizza-shop/constants"
+    "github.com/rabbitmq/amqp091-go"
+)
+
+func TestPublisherSendsPersistentJSONToTheQueue(t *testing.T) {
+    withEnv(t, map[string]string{"QUEUE_NAME_PREFIX": "staging."})
+    fb := newFakeBroker()
+    publisher := GetMessagePublisher(fb)
+
+    event := map[string]any{"order_no": "A1", "order_status": constants.ORDER_ORDERED}
+    if err := publisher.PublishEventWithOptions(PublishOptions{RoutingKey: constants.KITCHEN_ORDER_QUEUE, MessageId: "A1:ordered"}, event); err != nil {
+        t.Fatalf("publish: %v", err)
+    }
+
+    declared, published, _, _ := fb.snapshot()
+    if len(declared) != 1 || declared[0] != constants.KITCHEN_ORDER_QUEUE {
+        t.Errorf("declared %v, want the kitchen queue once", declared)
+    }
+    if len(published) != 1 {
+        t.Fatalf("published %d message(s), want 1", len(published))
+    }
+    sent := published[0]
+    if sent.Exchange != "" || sent.RoutingKey != "staging."+constants.KITCHEN_ORDER_QUEUE {
+        t.Errorf("sent to exchange %q, key %q; want the prefixed queue on the default exchange", sent.Exchange, sent.RoutingKey)
+    }
+    if sent.Message.ContentType != "application/json" || sent.Message.DeliveryMode != amqp091.Persistent || sent.Message.MessageId != "A1:ordered" {
+        t.Errorf("got %+v", sent.Message)
+    }
+    var body map[string]any
+    if err := json.Unmarshal(sent.Message.Body, &body); err != nil || body["order_no"] != "A1" {
+        t.Errorf("body %q: %v", sent.Message.Body, err)
+    }
+    if !fb.channels[0].IsClosed() {
+        t.Error("the publish channel was left open")
+    }
+}
+
+func TestPublisherDeclaresEachQueueOnceUntilTheChannelFails(t *testing.T) {
+    fb := newFakeBroker()
+    publisher := GetMessagePublisher(fb)
+    publish := func() error {
+        return publisher.PublishEvent(constants.KITCHEN_ORDER_QUEUE, map[string]any{"order_no": "A1"})
+    }
+
+    publish()
+    publish()
+    if declared, _, _, _ := fb.snapshot(); len(declared) != 1 {
+        t.Fatalf("declared %v, want once for two publishes", declared)
+    }
+
+    fb.failOpen = errors.New("connection reset")
+    if err := publish(); err == nil {
+        t.Fatal("a publish without a channel succeeded")
+    }
+    fb.failOpen = nil
+    publish()
+    if declared, published, _, _ := fb.snapshot(); len(declared) != 2 || len(published) != 3 {
+        t.Errorf("declared %v and published %d; want the queue declared again after the failure", declared, len(published))
+    }
+}
+
+func TestPublisherDeclaresNamedExchanges(t *testing.T) {
+    fb := newFakeBroker()
+    publisher := GetMessagePublisher(fb)
+
+    for i := 0; i < 2; i++ {
+        if err := publisher.PublishEventWithOptions(PublishOptions{Exchange: "orders", RoutingKey: "order.prepared"}, map[string]any{"order_no": "A1"}); err != nil {
+            t.Fatalf("publish: %v", err)
+        }
+    }
+    declared, published, _, _ := fb.snapshot()
+    if len(declared) != 0 {
+        t.Errorf("declared queues %v for an exchange publish", declared)
+    }
+    if fb.exchanges["orders"] != amqp091.ExchangeTopic || len(published) != 2 || published[1].RoutingKey != "order.prepared" {
+        t.Errorf("exchanges %v, published %+v", fb.exchanges, published)
+    }
+}
+
+func TestRejectPublishQueueWaitsForTheBrokersAnswer(t *testing.T) {
+    withEnv(t, map[string]string{"KITCHEN_QUEUE_MAX_LENGTH": "10", "KITCHEN_QUEUE_OVERFLOW": "reject-publish"})
+    fb := newFakeBroker()
+    publisher := GetMessagePublisher(fb)
+
+    // The fake broker has no confirms, so it can't say whether the queue took the message:
+    // the publisher must refuse to fire and forget instead of reporting success.
+    err := publisher.PublishEvent(constants.KITCHEN_ORDER_QUEUE, map[string]any{"order_no": "A1"})
+    if err == nil || !strings.Contains(err.Error(), "publisher confirms") {
+        t.Fatalf("got %v, want the missing confirms reported", err)
+    }
+    if _, published, _, _ := fb.snapshot(); len(published) != 0 {
+        t.Errorf("published %d message(s) without a way to learn of a rejection", len(published))
+    }
+
+    // Other queues aren't bounded and don't pay for confirms.
+    if err := publisher.PublishEvent("notifications", map[string]any{"order_no": "A1"}); err != nil {
+        t.Errorf("unbounded queue: %v", err)
+    }
+}
+
+func TestFullMemoryQueueRejectsThePublish(t *testing.T) {
+    publisher := GetMemoryPublisher(GetMemoryBroker(1))
+
+    if err := publisher.PublishEvent(constants.KITCHEN_ORDER_QUEUE, map[string]any{"order_no": "A1"}); err != nil {
+        t.Fatalf("first: %v", err)
+    }
+    if err := publisher.PublishEvent(constants.KITCHEN_ORDER_QUEUE, map[string]any{"order_no": "A2"}); !errors.Is(err, ErrPublishRejected) {
+        t.Errorf("got %v, want ErrPublishRejected", err)
+    }
+}
+
+func TestExchangeTypeComesFromTheOptionsThenTheEnv(t *testing.T) {
+    withEnv(t, map[string]string{"PUBLISH_EXCHANGE_TYPE": amqp091.ExchangeFanout})
+    fb := newFakeBroker()
+    publisher := GetMessagePublisher(fb)
+
+    publisher.PublishEventWithOptions(PublishOptions{Exchange: "alerts", RoutingKey: "any"}, map[string]any{})
+    publisher.PublishEventWithOptions(PublishOptions{Exchange: "receipts", ExchangeType: amqp091.ExchangeDirect, RoutingKey: "alice"}, map[string]any{})
+
+    _, published, _, _ := fb.snapshot()
+    if fb.exchanges["alerts"] != amqp091.ExchangeFanout || fb.exchanges["receipts"] != amqp091.ExchangeDirect {
+        t.Errorf("declared %v, want alerts from PUBLISH_EXCHANGE_TYPE and receipts from the options", fb.exchanges)
+    }
+    if len(published) != 2 || published[1].Exchange != "receipts" || published[1].RoutingKey != "alice" {
+        t.Errorf("published %+v, want the routing key unchanged (no queue prefix) on a named exchange", published)
+    }
+}
+
+func TestDeclareQueueDoesNotDependOnThePublishChannel(t *testing.T) {
+    fb := newFakeBroker()
+    publisher := GetMessagePublisher(fb)
+
+    // The publish closes its channel when it's done...
+    if err := publisher.PublishEventWithOptions(PublishOptions{Exchange: "orders", RoutingKey: "order.prepared"}, map[string]any{"order_no": "A1"}); err != nil {
+        t.Fatalf("publish: %v", err)
+    }
+    // ...and the broker may close another one under a failed publish.
+    channel, _ := fb.GetChannel()
+    channel.(*fakeChannel).closeWith(&amqp091.Error{Code: amqp091.ChannelError, Reason: "PRECONDITION_FAILED"})
+
+    publishChannels := len(fb.channels)
+    if err := publisher.DeclareQueue(constants.KITCHEN_ORDER_QUEUE); err != nil {
+        t.Fatalf("declare after the publish channels closed: %v", err)
+    }
+    if len(fb.channels) != publishChannels || len(fb.declareChannels) != 1 {
+        t.Fatalf("the declare used %d channel(s) of its own, want 1", len(fb.declareChannels))
+    }
+    if own := fb.declareChannels[0]; !own.IsClosed() {
+        t.Error("the declare left its channel open")
+    }
+    if declared, _, _, _ := fb.snapshot(); len(declared) != 1 || declared[0] != constants.KITCHEN_ORDER_QUEUE {
+        t.Errorf("declared %v, want the kitchen queue", declared)
+    }
+}
+
+func TestCancelledCallerAbortsThePublish(t *testing.T) {
+    fb := newFakeBroker()
+    memory := GetMemoryBroker(10)
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel() // The client went away before the publish
+
+    for name, publisher := range map[string]IMessagePubliser{"rabbitmq": GetMessagePublisher(fb), "memory": GetMemoryPublisher(memory)} {
+        err := publisher.PublishEventCtx(ctx, constants.KITCHEN_ORDER_QUEUE, map[string]any{"order_no": "A1"})
+        if !errors.Is(err, context.Canceled) {
+            t.Errorf("%s: got %v, want context.Canceled", name, err)
+        }
+    }
+    if _, published, _, _ := fb.snapshot(); len(published) != 0 {
+        t.Errorf("published %d message(s) for a cancelled caller", len(published))
+    }
+    if msg := take(memory, constants.KITCHEN_ORDER_QUEUE); msg != nil {
+        t.Errorf("the memory broker got %s for a cancelled caller", msg.Body)
+    }
+}
+
+func TestPublishWithoutAnyQueueNameIsRefused(t *testing.T) {
+    withEnv(t, map[string]string{"RABBIT_MQ_DEFAULT_QUEUE": ""})
+    fb := newFakeBroker()
+    memory := GetMemoryBroker(10)
+
+    for name, publisher := range map[string]IMessagePubliser{"rabbitmq": GetMessagePublisher(fb), "memory": GetMemoryPublisher(memory)} {
+        err := publisher.PublishEvent("", map[string]any{"order_no": "A1"})
+        if !errors.Is(err, ErrNoQueueName) || !strings.Contains(err.Error(), "RABBIT_MQ_DEFAULT_QUEUE") {
+            t.Errorf("%s: got %v, want ErrNoQueueName naming the env var", name, err)
+        }
+    }
+    if _, published, _, _ := fb.snapshot(); len(published) != 0 {
+        t.Errorf("published %d message(s) with no queue name", len(published))
+    }
+    if msg := take(memory, ""); msg != nil {
+        t.Errorf("the memory broker queued %s under an empty name", msg.Body)
+    }
+}
+
+func TestUnroutableMandatoryPublishIsAnError(t *testing.T) {
+    withEnv(t, map[string]string{"PUBLISH_MANDATORY": "true"})
+    fb := newFakeBroker()
+    withConfirms(t, fb)
+    fb.noRoute = map[string]bool{"kitchen.orders.mars": true}
+    publisher := GetMessagePublisher(fb)
+
+    if err := publisher.PublishEvent(constants.KITCHEN_ORDER_QUEUE, map[string]any{"order_no": "A1"}); err != nil {
+        t.Fatalf("routed publish: %v", err)
+    }
+    err := publisher.PublishEventWithOptions(PublishOptions{Exchange: "orders", RoutingKey: "kitchen.orders.mars"}, map[string]any{"order_no": "A2"})
+    if !errors.Is(err, ErrUnroutable) {
+        t.Fatalf("got %v, want ErrUnroutable", err)
+    }
+    if !strings.Contains(err.Error(), "312 NO_ROUTE") {
+        t.Errorf("got %q, want the broker's reply in the error", err)
+    }
+    if _, published, _, _ := fb.snapshot(); len(published) != 2 || !published[0].Mandatory || !published[1].Mandatory {
+        t.Errorf("published %+v, want both sent as mandatory", published)
+    }
+}
+
+func TestPublishIsNotMandatoryByDefault(t *testing.T) {
+    fb := newFakeBroker()
+    fb.noRoute = map[string]bool{"kitchen.orders.mars": true}
+    publisher := GetMessagePublisher(fb)
+
+    // Without PUBLISH_MANDATORY the broker drops what it can't route, and we never hear of it.
+    if err := publisher.PublishEventWithOptions(PublishOptions{Exchange: "orders", RoutingKey: "kitchen.orders.mars"}, map[string]any{"order_no": "A1"}); err != nil {
+        t.Fatalf("got %v", err)
+    }
+    if _, published, _, _ := fb.snapshot(); len(published) != 1 || published[0].Mandatory {
+        t.Errorf("published %+v, want one non-mandatory message", published)
+    }
+}
+
+func TestDeletedQueueIsDeclaredAgainAfterTheReturn(t *testing.T) {
+    withEnv(t, map[string]string{"PUBLISH_MANDATORY": "true"})
+    fb := newFakeBroker()
+    withConfirms(t, fb)
+    publisher := GetMessagePublisher(fb)
+    publish := func() error {
+        return publisher.PublishEvent(constants.KITCHEN_ORDER_QUEUE, map[string]any{"order_no": "A1"})
+    }
+
+    if err := publish(); err != nil {
+        t.Fatalf("first publish: %v", err)
+    }
+    // Someone deletes the kitchen queue behind our back: the broker returns the next message.
+    fb.mutex.Lock()
+    fb.noRoute = map[string]bool{constants.KITCHEN_ORDER_QUEUE: true}
+    fb.mutex.Unlock()
+    if err := publish(); !errors.Is(err, ErrUnroutable) {
+        t.Fatalf("got %v, want ErrUnroutable", err)
+    }
+    fb.mutex.Lock()
+    fb.noRoute = nil
+    fb.mutex.Unlock()
+    if err := publish(); err != nil {
+        t.Fatalf("publish after the return: %v", err)
+    }
+    if declared, _, _, _ := fb.snapshot(); len(declared) != 2 {
+        t.Errorf("declared %v, want the queue declared again after it came back unroutable", declared)
+    }
+}
+
+func TestPublishesToANamedExchangeDeclareNoQueue(t *testing.T) {
+    fb := newFakeBroker()
+    publisher := GetMessagePublisher(fb)
+
+    if err := publisher.PublishEventWithOptions(PublishOptions{Exchange: "orders", RoutingKey: "kitchen.orders.north"}, map[string]any{"order_no": "A1"}); err != nil {
+        t.Fatalf("publish: %v", err)
+    }
+    if declared, _, _, _ := fb.snapshot(); len(declared) != 0 {
+        t.Errorf("declared %v; the exchange's bindings decide where it goes", declared)
+    }
+}
+
+func TestConcurrentFirstPublishesDeclareEachQueue(t *testing.T) {
+    fb := newFakeBroker()
+    publisher := GetMessagePublisher(fb)
+    queues := []string{"kitchen", "kitchen.north", "kitchen.south"}
+
+    var publishers sync.WaitGroup
+    for i := 0; i < 30; i++ {
+        publishers.Add(1)
+        go func(queueName string) {
+            defer publishers.Done()
+            if err := publisher.PublishEvent(queueName, map[string]any{"order_no": "A1"}); err != nil {
+                t.Errorf("publish to %s: %v", queueName, err)
+            }
+        }(queues[i%len(queues)])
+    }
+    publishers.Wait()
+
+    // Racing first publishes may both declare (it's idempotent); after that nobody does.
+    declared, _, _, _ := fb.snapshot()
+    for _, queueName := range queues {
+        if err := publisher.PublishEvent(queueName, map[string]any{"order_no": "A2"}); err != nil {
+            t.Fatalf("publish to %s: %v", queueName, err)
+        }
+    }
+    again, _, _, _ := fb.snapshot()
+    if len(again) != len(declared) {
+        t.Errorf("declared %v after every queue was already declared", again[len(declared):])
+    }
+    for _, queueName := range queues {
+        if !slices.Contains(declared, queueName) {
+            t.Errorf("%s was never declared (declared %v)", queueName, declared)
+        }
+    }
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+    "sync"
+    "time"
+
+    "github.com/everestp/pizza-shop/utils"
+)
+
+// KitchenMetrics keeps cheap, in-memory counters about how the kitchen is doing.
+// It feeds the live stats dashboard.
+type KitchenMetrics struct {
+    mutex      sync.Mutex
+    orderTimes []time.Time   // When each order in the last minute was placed
+    cookTotal  time.Duration // Sum of all cook times
+    cookCount  int64         // Number of pizzas cooked
+    readyTotal time.Duration // Sum of order-placed -> ready times
+    readyCount int64         // Number of orders that reached ready
+}
+
+// RecordOrder notes that a new order was placed just now.
+func (km *KitchenMetrics) RecordOrder() {
+    km.mutex.Lock()
+    defer km.mutex.Unlock()
+
+    now := utils.Clock.Now()
+    km.orderTimes = append(km.pruneOlderThanAMinute(now), now)
+}
+
+// RecordCookTime adds one finished pizza's cook time to the average.
+func (km *KitchenMetrics) RecordCookTime(duration time.Duration) {
+    km.mutex.Lock()
+    defer km.mutex.Unlock()
+
+    km.cookTotal += duration
+    km.cookCount++
+}
+
+// RecordTimeToReady adds one order's end-to-end latency (placed -> ready) to the average.
+func (km *KitchenMetrics) RecordTimeToReady(duration time.Duration) {
+    km.mutex.Lock()
+    defer km.mutex.Unlock()
+
+    km.readyTotal += duration
+    km.readyCount++
+}
+
+// AverageTimeToReady returns the mean end-to-end latency so far.
+func (km *KitchenMetrics) AverageTimeToReady() time.Duration {
+    km.mutex.Lock()
+    defer km.mutex.Unlock()
+
+    if km.readyCount == 0 {
+        return 0
+    }
+    return km.readyTotal / time.Duration(km.readyCount)
+}
+
+// OrdersPerMinute returns how many orders arrived during the last 60 seconds.
+func (km *KitchenMetrics) OrdersPerMinute() int {
+    km.mutex.Lock()
+    defer km.mutex.Unlock()
+
+    km.orderTimes = km.pruneOlderThanAMinute(utils.Clock.Now())
+    return len(km.orderTimes)
+}
+
+// AverageCookTime returns the mean cook time so far (zero before the first pizza).
+func (km *KitchenMetrics) AverageCookTime() time.Duration {
+    km.mutex.Lock()
+    defer km.mutex.Unlock()
+
+    if km.cookCount == 0 {
+        return 0
+    }
+    return km.cookTotal / time.Duration(km.cookCount)
+}
+
+// pruneOlderThanAMinute drops timestamps that fell out of the window. Caller holds the lock.
+func (km *KitchenMetrics) pruneOlderThanAMinute(now time.Time) []time.Time {
+    cutoff := now.Add(-time.Minute)
+    i := 0
+    for i < len(km.orderTimes) && km.orderTimes[i].Before(cutoff) {
+        i++
+    }
+    return km.orderTimes[i:]
+}
+
+// GetKitchenMetrics is the Constructor.
+func GetKitchenMetrics() *KitchenMetrics {
+    return &KitchenMetrics{}
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+    "fmt"
+
+    "github.com/everestp/pizza-shop/logger"
+    "github.com/prometheus/client_golang/prometheus"
+)
+
+// OrderGauges exposes the kitchen's live load to Prometheus: how many orders are in
+// each status right now, and how many messages wait in each kitchen queue.
+// The values are read from the order store and the broker at scrape time, so they
+// always match the store (no counters to keep in sync as orders change status).
+type OrderGauges struct {
+    store     IOrderStore
+    publisher IMessagePubliser
+    queues    []string // Kitchen queues whose backlog is reported
+
+    ordersDesc  *prometheus.Desc
+    backlogDesc *prometheus.Desc
+}
+
+// Describe implements prometheus.Collector.
+func (og *OrderGauges) Describe(ch chan<- *prometheus.Desc) {
+    ch <- og.ordersDesc
+    ch <- og.backlogDesc
+}
+
+// Collect implements prometheus.Collector. It may run concurrently with order
+// updates: store.All() hands back copies taken under the store's lock.
+func (og *OrderGauges) Collect(ch chan<- prometheus.Metric) {
+    counts := map[string]int{}
+    for _, order := range og.store.All() {
+        counts[order.Status]++
+    }
+    for status, count := range counts {
+        ch <- prometheus.MustNewConstMetric(og.ordersDesc, prometheus.GaugeValue, float64(count), status)
+    }
+
+    for _, queue := range og.queues {
+        depth, err := og.publisher.QueueDepth(queue)
+        if err != nil {
+            logger.Log(fmt.Sprintf("Metrics: failed to read depth of %q: %v", queue, err))
+            continue
+        }
+        ch <- prometheus.MustNewConstMetric(og.backlogDesc, prometheus.GaugeValue, float64(depth), queue)
+    }
+}
+
+// GetOrderGauges is the Constructor. Register the result with a prometheus.Registry.
+func GetOrderGauges(store IOrderStore, publisher IMessagePubliser, queues []string) *OrderGauges {
+    return &OrderGauges{
+        store:     store,
+        publisher: publisher,
+        queues:    queues,
+        ordersDesc: prometheus.NewDesc("pizza_shop_orders",
+            "Orders currently in each status.", []string{"status"}, nil),
+        backlogDesc: prometheus.NewDesc("pizza_shop_queue_messages",
+            "Messages waiting in a kitchen queue.", []string{"queue"}, nil),
+    }
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+    "fmt"
+    "sync"
+    "testing"
+
+    "github.com/everestp/pizza-shop/constants"
+    "github.com/prometheus/client_golang/prometheus"
+)
+
+// scrape gathers the registry into "name{label}" -> value.
+func scrape(t *testing.T, registry *prometheus.Registry) map[string]float64 {
+    t.Helper()
+    families, err := registry.Gather()
+    if err != nil {
+        t.Fatalf("gather: %v", err)
+    }
+    values := map[string]float64{}
+    for _, family := range families {
+        for _, metric := range family.GetMetric() {
+            values[family.GetName()+"{"+metric.GetLabel()[0].GetValue()+"}"] = metric.GetGauge().GetValue()
+        }
+    }
+    return values
+}
+
+func TestOrderGaugesMatchTheStore(t *testing.T) {
+    store := GetOrderStore()
+    broker := GetMemoryBroker(10)
+    publisher := GetMemoryPublisher(broker)
+    registry := prometheus.NewRegistry()
+    registry.MustRegister(GetOrderGauges(store, publisher, []string{constants.KITCHEN_ORDER_QUEUE}))
+
+    for _, orderNo := range []string{"A1", "A2", "A3"} {
+        store.Save(Order{OrderNo: orderNo, Status: constants.ORDER_ORDERED})
+        if err := publisher.PublishEvent(constants.KITCHEN_ORDER_QUEUE, map[string]any{"order_no": orderNo}); err != nil {
+            t.Fatalf("publish: %v", err)
+        }
+    }
+    store.UpdateStatus("A1", constants.ORDER_PREPARING)
+    store.UpdateStatus("A2", constants.ORDER_PREPARING)
+    store.UpdateStatus("A2", constants.ORDER_PREPARED)
+
+    want := map[string]float64{
+        "pizza_shop_orders{" + constants.ORDER_ORDERED + "}":               1,
+        "pizza_shop_orders{" + constants.ORDER_PREPARING + "}":             1,
+        "pizza_shop_orders{" + constants.ORDER_PREPARED + "}":              1,
+        "pizza_shop_queue_messages{" + constants.KITCHEN_ORDER_QUEUE + "}": 3,
+    }
+    got := scrape(t, registry)
+    if len(got) != len(want) {
+        t.Errorf("got %v, want %v", got, want)
+    }
+    for key, value := range want {
+        if got[key] != value {
+            t.Errorf("%s: got %v, want %v", key, got[key], value)
+        }
+    }
+
+    // The last order moves on: the next scrape follows the store, with no stale status left.
+    store.UpdateStatus("A3", constants.ORDER_PREPARING)
+    got = scrape(t, registry)
+    if _, ok := got["pizza_shop_orders{"+constants.ORDER_ORDERED+"}"]; ok {
+        t.Errorf("the emptied status is still reported: %v", got)
+    }
+    if got["pizza_shop_orders{"+constants.ORDER_PREPARING+"}"] != 2 {
+        t.Errorf("preparing: got %v, want 2", got["pizza_shop_orders{"+constants.ORDER_PREPARING+"}"])
+    }
+}
+
+func TestOrderGaugesScrapeWhileOrdersChange(t *testing.T) {
+    store := GetOrderStore()
+    registry := prometheus.NewRegistry()
+    registry.MustRegister(GetOrderGauges(store, GetMemoryPublisher(GetMemoryBroker(10)), nil))
+
+    const orders = 50
+    var wg sync.WaitGroup
+    wg.Add(1)
+    go func() {
+        defer wg.Done()
+        for i := 0; i < orders; i++ {
+            orderNo := fmt.Sprintf("A%d", i)
+            store.Save(Order{OrderNo: orderNo, Status: constants.ORDER_ORDERED})
+            store.UpdateStatus(orderNo, constants.ORDER_PREPARING)
+            store.UpdateStatus(orderNo, constants.ORDER_PREPARED)
+        }
+    }()
+    for i := 0; i < 20; i++ {
+        scrape(t, registry)
+    }
+    wg.Wait()
+
+    if got := scrape(t, registry)["pizza_shop_orders{"+constants.ORDER_PREPARED+"}"]; got != orders {
+        t.Errorf("prepared: got %v, want %d", got, orders)
+    }
+}
@@ -0,0 +1,56 @@
+package service
+
+import "sync"
+
+// OrderLocks limits how many messages for the SAME order are processed at once.
+// With a limit of 1, a quick "modify" and "cancel" for one order run one after
+// the other instead of racing on the order store, while different orders still
+// cook in parallel. Entries exist only while someone holds or waits for them.
+type OrderLocks struct {
+    limit   int
+    entries map[string]*orderLockEntry
+    mutex   sync.Mutex // Guards 'entries'
+}
+
+type orderLockEntry struct {
+    slots chan struct{} // One token per message allowed to run for this order
+    refs  int           // Holders + waiters; the entry is dropped at 0
+}
+
+// Lock waits for a slot for orderNo and returns the function that gives it back.
+func (ol *OrderLocks) Lock(orderNo string) (unlock func()) {
+    ol.mutex.Lock()
+    entry, ok := ol.entries[orderNo]
+    if !ok {
+        entry = &orderLockEntry{slots: make(chan struct{}, ol.limit)}
+        ol.entries[orderNo] = entry
+    }
+    entry.refs++
+    ol.mutex.Unlock()
+
+    entry.slots <- struct{}{}
+
+    var once sync.Once
+    return func() {
+        once.Do(func() {
+            <-entry.slots
+            ol.mutex.Lock()
+            entry.refs--
+            if entry.refs == 0 {
+                delete(ol.entries, orderNo)
+            }
+            ol.mutex.Unlock()
+        })
+    }
+}
+
+// GetOrderLocks is the Constructor. A limit below 1 turns the limit off (returns nil).
+func GetOrderLocks(limit int) *OrderLocks {
+    if limit < 1 {
+        return nil
+    }
+    return &OrderLocks{
+        limit:   limit,
+        entries: make(map[string]*orderLockEntry),
+    }
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+    "sync"
+    "testing"
+    "time"
+)
+
+func TestOrderLocksSerializeTheSameOrder(t *testing.T) {
+    locks := GetOrderLocks(1)
+
+    // Every update reads the order's state, takes a moment, then writes it back;
+    // without the lock, interleaved updates would lose each other's writes.
+    var mutex sync.Mutex
+    state := map[string]int{}
+    running := map[string]int{}
+    overlapped := map[string]bool{}
+
+    update := func(orderNo string) {
+        unlock := locks.Lock(orderNo)
+        defer unlock()
+
+        mutex.Lock()
+        running[orderNo]++
+        if running[orderNo] > 1 {
+            overlapped[orderNo] = true
+        }
+        seen := state[orderNo]
+        mutex.Unlock()
+
+        time.Sleep(time.Millisecond)
+
+        mutex.Lock()
+        state[orderNo] = seen + 1
+        running[orderNo]--
+        mutex.Unlock()
+    }
+
+    var wg sync.WaitGroup
+    for i := 0; i < 20; i++ {
+        for _, orderNo := range []string{"A-1", "B-2"} {
+            wg.Add(1)
+            go func(orderNo string) {
+                defer wg.Done()
+                update(orderNo)
+            }(orderNo)
+        }
+    }
+    wg.Wait()
+
+    for _, orderNo := range []string{"A-1", "B-2"} {
+        if overlapped[orderNo] {
+            t.Errorf("two updates of %s ran at the same time", orderNo)
+        }
+        if state[orderNo] != 20 {
+            t.Errorf("%s ended at %d after 20 updates", orderNo, state[orderNo])
+        }
+    }
+    if len(locks.entries) != 0 {
+        t.Errorf("%d lock entries left after every update finished", len(locks.entries))
+    }
+}
+
+func TestOrderLocksLetOtherOrdersRun(t *testing.T) {
+    locks := GetOrderLocks(1)
+    unlock := locks.Lock("A-1")
+    defer unlock()
+
+    done := make(chan struct{})
+    go func() {
+        locks.Lock("B-2")()
+        close(done)
+    }()
+    select {
+    case <-done:
+    case <-time.After(time.Second):
+        t.Fatal("a second order waited on the first order's lock")
+    }
+}
+
+func TestOrderLocksUnlockIsIdempotent(t *testing.T) {
+    locks := GetOrderLocks(1)
+    unlock := locks.Lock("A-1")
+    unlock()
+    unlock()
+
+    done := make(chan struct{})
+    go func() {
+        locks.Lock("A-1")()
+        close(done)
+    }()
+    select {
+    case <-done:
+    case <-time.After(time.Second):
+        t.Fatal("the order stayed locked after its unlock")
+    }
+    if len(locks.entries) != 0 {
+        t.Errorf("%d lock entries left", len(locks.entries))
+    }
+}
+
+func TestOrderLocksOff(t *testing.T) {
+    if locks := GetOrderLocks(0); locks != nil {
+        t.Errorf("a limit of 0 should turn the locks off, got %+v", locks)
+    }
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+    "errors"
+    "fmt"
+    "strings"
+    "unicode"
+    "unicode/utf8"
+)
+
+// ErrInvalidNotes is returned when an order's special instructions can't be accepted.
+var ErrInvalidNotes = errors.New("invalid order notes")
+
+// SanitizeNotes turns the raw "notes" value (e.g. "extra crispy, no onions") into
+// something safe to show on a kitchen screen: line breaks and tabs become spaces,
+// other control characters are dropped, runs of spaces collapse and the ends are trimmed.
+// Notes longer than maxLength characters (after cleaning) are rejected, not cut.
+func SanitizeNotes(raw any, maxLength int) (string, error) {
+    text, ok := raw.(string)
+    if !ok {
+        return "", fmt.Errorf("%w: notes must be text", ErrInvalidNotes)
+    }
+
+    cleaned := strings.Map(func(r rune) rune {
+        switch {
+        case r == '\n' || r == '\r' || r == '\t':
+            return ' '
+        case unicode.IsControl(r) || r == utf8.RuneError:
+            return -1 // Drop it
+        }
+        return r
+    }, text)
+    cleaned = strings.Join(strings.Fields(cleaned), " ")
+
+    if length := utf8.RuneCountInString(cleaned); length > maxLength {
+        return "", fmt.Errorf("%w: notes are %d characters long, the limit is %d", ErrInvalidNotes, length, maxLength)
+    }
+    return cleaned, nil
+}
@@ -0,0 +1,37 @@
+package service
+
+import (
+    "errors"
+    "testing"
+)
+
+func TestSanitizeNotes(t *testing.T) {
+    cases := []struct {
+        name    string
+        raw     any
+        want    string
+        invalid bool
+    }{
+        {name: "plain", raw: "extra crispy, no onions", want: "extra crispy, no onions"},
+        {name: "line breaks and tabs become spaces", raw: "extra crispy\r\n\tno onions", want: "extra crispy no onions"},
+        {name: "control characters are dropped", raw: "no\x00 on\x1bions\x07", want: "no onions"},
+        {name: "spaces collapse and ends are trimmed", raw: "   extra    cheese  ", want: "extra cheese"},
+        {name: "the limit counts characters, not bytes", raw: "crème brûlée, très chaud", want: "crème brûlée, très chaud"}, // 24 characters, 28 bytes
+        {name: "too long", raw: "extra cheese, extra olives", invalid: true},
+        {name: "not text", raw: 42, invalid: true},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            got, err := SanitizeNotes(tc.raw, 24)
+            if tc.invalid {
+                if !errors.Is(err, ErrInvalidNotes) {
+                    t.Errorf("got %q, %v; want ErrInvalidNotes", got, err)
+                }
+                return
+            }
+            if err != nil || got != tc.want {
+                t.Errorf("got %q, %v; want %q", got, err, tc.want)
+            }
+        })
+    }
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+    "crypto/rand"
+    "fmt"
+    "os"
+    "strconv"
+    "strings"
+    "sync"
+
+    "github.com/everestp/pizza-shop/logger"
+)
+
+// IOrderNumberGenerator hands out the numbers of orders that arrive without one.
+// ORDER_NUMBER_STRATEGY picks the implementation: "uuid" (default) or "sequential".
+type IOrderNumberGenerator interface {
+    Next() string
+}
+
+// UUIDOrderNumberGenerator returns random (version 4) UUIDs. No coordination needed,
+// so it is safe across any number of instances.
+type UUIDOrderNumberGenerator struct{}
+
+func (UUIDOrderNumberGenerator) Next() string {
+    var b [16]byte
+    if _, err := rand.Read(b[:]); err != nil {
+        panic(fmt.Sprintf("crypto/rand failed: %v", err))
+    }
+    b[6] = (b[6] & 0x0f) | 0x40 // Version 4
+    b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 variant
+    return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// SequentialOrderNumberGenerator returns readable numbers like "ORD-000123".
+// The counter is guarded by a mutex, so concurrent orders never share a number.
+// With a state file the last number is saved after every order and read back
+// on startup, so numbering carries on after a restart instead of starting over.
+// It only suits a single instance: two instances would count independently.
+type SequentialOrderNumberGenerator struct {
+    prefix    string
+    stateFile string // Optional: where the last number is kept
+    last      uint64
+    mutex     sync.Mutex
+}
+
+func (sg *SequentialOrderNumberGenerator) Next() string {
+    sg.mutex.Lock()
+    defer sg.mutex.Unlock()
+
+    sg.last++
+    if sg.stateFile != "" {
+        if err := sg.save(); err != nil {
+            logger.Log(fmt.Sprintf("Failed to save order number state to %s: %v", sg.stateFile, err))
+        }
+    }
+    return fmt.Sprintf("%s%06d", sg.prefix, sg.last)
+}
+
+// save writes the counter to a temp file and renames it over the state file,
+// so a crash mid-write never leaves a half-written number behind.
+func (sg *SequentialOrderNumberGenerator) save() error {
+    tmp := sg.stateFile + ".tmp"
+    if err := os.WriteFile(tmp, []byte(strconv.FormatUint(sg.last, 10)), 0o644); err != nil {
+        return err
+    }
+    return os.Rename(tmp, sg.stateFile)
+}
+
+// load reads the last number handed out before the restart. A missing file means we start at 1.
+func (sg *SequentialOrderNumberGenerator) load() error {
+    data, err := os.ReadFile(sg.stateFile)
+    if os.IsNotExist(err) {
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+    last, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+    if err != nil {
+        return fmt.Errorf("invalid order number state in %s: %w", sg.stateFile, err)
+    }
+    sg.last = last
+    return nil
+}
+
+// GetOrderNumberGenerator is the Constructor. Unknown strategies fall back to UUIDs.
+func GetOrderNumberGenerator(strategy string, prefix string, stateFile string) (IOrderNumberGenerator, error) {
+    switch strings.ToLower(strategy) {
+    case "", "uuid":
+        return UUIDOrderNumberGenerator{}, nil
+    case "sequential":
+        sg := &SequentialOrderNumberGenerator{prefix: prefix, stateFile: stateFile}
+        if stateFile != "" {
+            if err := sg.load(); err != nil {
+                return nil, err
+            }
+        }
+        return sg, nil
+    default:
+        logger.Log(fmt.Sprintf("Unknown ORDER_NUMBER_STRATEGY %q, using uuid", strategy))
+        return UUIDOrderNumberGenerator{}, nil
+    }
+}
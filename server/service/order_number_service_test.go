@@ -0,0 +1,80 @@
+package service
+
+import (
+    "path/filepath"
+    "regexp"
+    "sync"
+    "testing"
+)
+
+// generateConcurrently asks 'workers' goroutines for 'each' numbers apiece.
+func generateConcurrently(generator IOrderNumberGenerator, workers, each int) []string {
+    numbers := make(chan string, workers*each)
+    var wg sync.WaitGroup
+    for w := 0; w < workers; w++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for i := 0; i < each; i++ {
+                numbers <- generator.Next()
+            }
+        }()
+    }
+    wg.Wait()
+    close(numbers)
+
+    var all []string
+    for number := range numbers {
+        all = append(all, number)
+    }
+    return all
+}
+
+func TestOrderNumbersAreUniqueUnderConcurrency(t *testing.T) {
+    for _, strategy := range []string{"uuid", "sequential"} {
+        t.Run(strategy, func(t *testing.T) {
+            generator, err := GetOrderNumberGenerator(strategy, "ORD-", "")
+            if err != nil {
+                t.Fatal(err)
+            }
+
+            seen := make(map[string]bool)
+            for _, number := range generateConcurrently(generator, 20, 50) {
+                if seen[number] {
+                    t.Fatalf("%s was handed out twice", number)
+                }
+                seen[number] = true
+            }
+            if len(seen) != 1000 {
+                t.Errorf("got %d distinct numbers, want 1000", len(seen))
+            }
+        })
+    }
+}
+
+func TestSequentialOrderNumbersAreFormattedAndCarryOn(t *testing.T) {
+    stateFile := filepath.Join(t.TempDir(), "order-number")
+    first, err := GetOrderNumberGenerator("sequential", "ORD-", stateFile)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if got := []string{first.Next(), first.Next()}; got[0] != "ORD-000001" || got[1] != "ORD-000002" {
+        t.Fatalf("got %v, want ORD-000001 then ORD-000002", got)
+    }
+
+    // A restart picks up where the last instance left off.
+    restarted, err := GetOrderNumberGenerator("sequential", "ORD-", stateFile)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if got := restarted.Next(); got != "ORD-000003" {
+        t.Errorf("after the restart got %s, want ORD-000003", got)
+    }
+}
+
+func TestUUIDOrderNumbersAreVersion4(t *testing.T) {
+    uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+    if got := (UUIDOrderNumberGenerator{}).Next(); !uuid.MatchString(got) {
+        t.Errorf("uuid strategy: %q is not a version 4 UUID", got)
+    }
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+    "errors"
+    "fmt"
+    "sort"
+    "time"
+
+    "github.com/everestp/pizza-shop/constants"
+)
+
+// ErrInvalidPriority is returned when an order's priority isn't a whole number from 0 to MAX_ORDER_PRIORITY.
+var ErrInvalidPriority = errors.New("invalid order priority")
+
+// QueuedOrder is one line of the kitchen's pending queue (GET /orders/queue and the stats dashboard).
+type QueuedOrder struct {
+    Position  int       `json:"position"` // 1 = the next order to cook
+    OrderNo   string    `json:"order_no"`
+    Priority  int       `json:"priority"`
+    Status    string    `json:"order_status"`
+    CreatedAt time.Time `json:"created_at"`
+}
+
+// ParsePriority reads the raw "priority" value: 0 (normal, the default) up to
+// constants.MAX_ORDER_PRIORITY, higher goes first.
+func ParsePriority(raw any) (int, error) {
+    var priority int
+    switch value := raw.(type) {
+    case nil:
+        return 0, nil
+    case float64: // How encoding/json decodes every number
+        priority = int(value)
+        if float64(priority) != value {
+            return 0, fmt.Errorf("%w: %v is not a whole number", ErrInvalidPriority, value)
+        }
+    case int:
+        priority = value
+    default:
+        return 0, fmt.Errorf("%w: priority must be a number", ErrInvalidPriority)
+    }
+
+    if priority < 0 || priority > constants.MAX_ORDER_PRIORITY {
+        return 0, fmt.Errorf("%w: must be between 0 and %d", ErrInvalidPriority, constants.MAX_ORDER_PRIORITY)
+    }
+    return priority, nil
+}
+
+// IsPending reports whether the order is still waiting for a chef (not cooking yet).
+func (o Order) IsPending() bool {
+    return o.Status == constants.ORDER_ORDERED || o.Status == constants.ORDER_ACCEPTED
+}
+
+// IsFinished reports whether the order is done with the kitchen for good (delivered or cancelled).
+func (o Order) IsFinished() bool {
+    return o.Status == constants.ORDER_DELIVERED || o.Status == constants.ORDER_STATUS_CANCELLED
+}
+
+// SortByPriority puts orders in the order the kitchen should take them:
+// highest priority first, then first come first served (order number breaks exact ties).
+func SortByPriority(orders []Order) {
+    sort.SliceStable(orders, func(i, j int) bool {
+        if orders[i].Priority != orders[j].Priority {
+            return orders[i].Priority > orders[j].Priority
+        }
+        if !orders[i].CreatedAt.Equal(orders[j].CreatedAt) {
+            return orders[i].CreatedAt.Before(orders[j].CreatedAt)
+        }
+        return orders[i].OrderNo < orders[j].OrderNo
+    })
+}
+
+// QueueOf numbers already sorted pending orders, keeping at most 'limit' (0 = all).
+func QueueOf(orders []Order, limit int) []QueuedOrder {
+    if limit > 0 && len(orders) > limit {
+        orders = orders[:limit]
+    }
+    queue := make([]QueuedOrder, 0, len(orders))
+    for index, order := range orders {
+        queue = append(queue, QueuedOrder{
+            Position:  index + 1,
+            OrderNo:   order.OrderNo,
+            Priority:  order.Priority,
+            Status:    order.Status,
+            CreatedAt: order.CreatedAt,
+        })
+    }
+    return queue
+}
+
+// QueueOfOwner is QueueOf for one customer: only their orders, each keeping its place
+// in the whole queue, so they see how many orders are ahead without seeing whose.
+func QueueOfOwner(orders []Order, ownerId string) []QueuedOrder {
+    queue := make([]QueuedOrder, 0)
+    for index, entry := range QueueOf(orders, 0) {
+        if orders[index].OwnerID == ownerId {
+            queue = append(queue, entry)
+        }
+    }
+    return queue
+}
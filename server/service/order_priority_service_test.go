@@ -0,0 +1,80 @@
+package service
+
+import (
+    "testing"
+    "time"
+
+    "github.com/everestp/pizza-shop/constants"
+)
+
+func TestPendingQueueIsPriorityThenFIFO(t *testing.T) {
+    store := GetOrderStore()
+    start := time.Now()
+    for _, order := range []Order{
+        {OrderNo: "normal-late", Priority: 0, CreatedAt: start.Add(3 * time.Second)},
+        {OrderNo: "rush-late", Priority: 5, CreatedAt: start.Add(2 * time.Second)},
+        {OrderNo: "normal-early", Priority: 0, CreatedAt: start},
+        {OrderNo: "rush-early", Priority: 5, CreatedAt: start.Add(time.Second)},
+        {OrderNo: "cooking", Priority: 9, CreatedAt: start, Status: constants.ORDER_PREPARING},
+    } {
+        if order.Status == "" {
+            order.Status = constants.ORDER_ORDERED
+        }
+        store.Save(order)
+    }
+
+    queue := QueueOf(store.Pending(), 0)
+    want := []string{"rush-early", "rush-late", "normal-early", "normal-late"}
+    if len(queue) != len(want) {
+        t.Fatalf("got %d queued orders, want %d: %+v", len(queue), len(want), queue)
+    }
+    for index, orderNo := range want {
+        if queue[index].OrderNo != orderNo || queue[index].Position != index+1 {
+            t.Errorf("position %d: got %s (#%d), want %s", index+1, queue[index].OrderNo, queue[index].Position, orderNo)
+        }
+    }
+
+    if limited := QueueOf(store.Pending(), 2); len(limited) != 2 || limited[1].OrderNo != "rush-late" {
+        t.Errorf("limit 2: got %+v", limited)
+    }
+}
+
+func TestQueueOfOwnerKeepsQueuePositions(t *testing.T) {
+    start := time.Now()
+    orders := []Order{
+        {OrderNo: "B1", OwnerID: "bob", CreatedAt: start},
+        {OrderNo: "A1", OwnerID: "alice", CreatedAt: start.Add(time.Second)},
+        {OrderNo: "B2", OwnerID: "bob", CreatedAt: start.Add(2 * time.Second)},
+        {OrderNo: "A2", OwnerID: "alice", CreatedAt: start.Add(3 * time.Second)},
+    }
+
+    queue := QueueOfOwner(orders, "alice")
+    if len(queue) != 2 || queue[0].OrderNo != "A1" || queue[0].Position != 2 || queue[1].OrderNo != "A2" || queue[1].Position != 4 {
+        t.Errorf("got %+v, want A1 at 2 and A2 at 4", queue)
+    }
+    if queue := QueueOfOwner(orders, "carol"); len(queue) != 0 {
+        t.Errorf("someone without orders: got %+v", queue)
+    }
+}
+
+func TestParsePriority(t *testing.T) {
+    cases := []struct {
+        raw     any
+        want    int
+        wantErr bool
+    }{
+        {raw: nil, want: 0},
+        {raw: float64(3), want: 3},
+        {raw: float64(constants.MAX_ORDER_PRIORITY), want: constants.MAX_ORDER_PRIORITY},
+        {raw: float64(1.5), wantErr: true},
+        {raw: float64(-1), wantErr: true},
+        {raw: float64(constants.MAX_ORDER_PRIORITY + 1), wantErr: true},
+        {raw: "high", wantErr: true},
+    }
+    for _, tc := range cases {
+        got, err := ParsePriority(tc.raw)
+        if (err != nil) != tc.wantErr || (!tc.wantErr && got != tc.want) {
+            t.Errorf("ParsePriority(%v) = %d, %v; want %d (error %v)", tc.raw, got, err, tc.want, tc.wantErr)
+        }
+    }
+}
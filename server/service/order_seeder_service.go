@@ -0,0 +1,95 @@
+package service
+
+import (
+    "context"
+    "fmt"
+    "math/rand"
+    "sync"
+    "time"
+
+    "github.com/everestp/pizza-shop/logger"
+    "github.com/everestp/pizza-shop/utils"
+)
+
+// seedMenu is what the synthetic customers order from.
+var seedMenu = []OrderItem{
+    {Name: "Margherita", Price: 9.50},
+    {Name: "Pepperoni", Price: 11.00},
+    {Name: "Hawaiian", Price: 10.50},
+    {Name: "Veggie Supreme", Price: 10.00},
+    {Name: "BBQ Chicken", Price: 12.00},
+    {Name: "Quattro Formaggi", Price: 12.50},
+    {Name: "Garlic Bread", Price: 4.00},
+}
+
+// OrderSeeder generates synthetic orders for demos and load tests, so the
+// dashboard lights up without a frontend. Orders go through 'place', the same
+// path a real customer's order takes.
+type OrderSeeder struct {
+    place    func(payload map[string]any) error // Places one order (e.g. OrderHandler.PlaceOrder)
+    interval time.Duration                      // Time between two orders (1 / rate)
+    ctx      context.Context                    // Cancelled on shutdown; stops any running seed
+    running  sync.WaitGroup
+}
+
+// RandomOrder builds a realistic order: 1-3 different menu items, 1-3 of each.
+func RandomOrder() map[string]any {
+    picks := rand.Perm(len(seedMenu))[:rand.Intn(3)+1]
+    items := make([]any, 0, len(picks))
+    for _, index := range picks {
+        items = append(items, map[string]any{
+            "name":     seedMenu[index].Name,
+            "price":    seedMenu[index].Price,
+            "quantity": rand.Intn(3) + 1,
+        })
+    }
+    return map[string]any{"items": items}
+}
+
+// Seed places 'count' orders, one every interval, and returns how many were placed.
+// It stops early when the app shuts down.
+func (sd *OrderSeeder) Seed(count int) int {
+    placed := 0
+    for i := 0; i < count; i++ {
+        if sd.ctx.Err() != nil {
+            logger.Log(fmt.Sprintf("Seeding stopped by shutdown after %d order(s)", placed))
+            return placed
+        }
+        if i > 0 {
+            utils.Clock.Sleep(sd.interval)
+        }
+        if err := sd.place(RandomOrder()); err != nil {
+            logger.Log(fmt.Sprintf("Failed to place seed order: %v", err))
+            continue
+        }
+        placed++
+    }
+    logger.Log(fmt.Sprintf("Seeded %d synthetic order(s)", placed))
+    return placed
+}
+
+// Start seeds in the background and returns right away.
+func (sd *OrderSeeder) Start(count int) {
+    sd.running.Add(1)
+    go func() {
+        defer sd.running.Done()
+        sd.Seed(count)
+    }()
+}
+
+// Wait blocks until every background seed has finished (used during shutdown).
+func (sd *OrderSeeder) Wait() {
+    sd.running.Wait()
+}
+
+// GetOrderSeeder is the Constructor. 'ratePerSecond' defaults to 2 orders a second.
+func GetOrderSeeder(ctx context.Context, ratePerSecond float64, place func(payload map[string]any) error) *OrderSeeder {
+    if ratePerSecond <= 0 {
+        ratePerSecond = 2
+    }
+    return &OrderSeeder{
+        place:    place,
+        interval: time.Duration(float64(time.Second) / ratePerSecond),
+        ctx:      ctx,
+    }
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+    "context"
+    "testing"
+    "time"
+
+    "github.com/everestp/pizza-shop/utils"
+)
+
+// sleepingClock is a fake clock where Sleep moves time forward instantly.
+type sleepingClock struct {
+    utils.RealClock
+    now time.Time
+}
+
+func (sc *sleepingClock) Now() time.Time        { return sc.now }
+func (sc *sleepingClock) Sleep(d time.Duration) { sc.now = sc.now.Add(d) }
+
+func TestSeederPlacesNOrdersAtTheConfiguredRate(t *testing.T) {
+    clock := &sleepingClock{now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+    utils.Clock = clock
+    t.Cleanup(func() { utils.Clock = utils.RealClock{} })
+
+    start := clock.now
+    var placedAt []time.Duration
+    seeder := GetOrderSeeder(context.Background(), 4, func(payload map[string]any) error {
+        placedAt = append(placedAt, clock.now.Sub(start))
+        return nil
+    })
+
+    if placed := seeder.Seed(5); placed != 5 {
+        t.Fatalf("placed %d, want 5", placed)
+    }
+    for i, at := range placedAt {
+        if want := time.Duration(i) * 250 * time.Millisecond; at != want {
+            t.Errorf("order %d placed at %v, want %v (4 a second)", i, at, want)
+        }
+    }
+}
+
+func TestSeederStopsOnShutdown(t *testing.T) {
+    utils.Clock = &sleepingClock{}
+    t.Cleanup(func() { utils.Clock = utils.RealClock{} })
+
+    ctx, shutdown := context.WithCancel(context.Background())
+    placed := 0
+    seeder := GetOrderSeeder(ctx, 100, func(payload map[string]any) error {
+        if placed++; placed == 2 {
+            shutdown()
+        }
+        return nil
+    })
+
+    seeder.Start(50)
+    seeder.Wait()
+    if placed != 2 {
+        t.Errorf("placed %d order(s), want the seed to stop right after the shutdown", placed)
+    }
+}
+
+func TestRandomOrdersLookReal(t *testing.T) {
+    for i := 0; i < 50; i++ {
+        items := RandomOrder()["items"].([]any)
+        if len(items) < 1 || len(items) > 3 {
+            t.Fatalf("got %d items, want 1 to 3", len(items))
+        }
+        seen := map[any]bool{}
+        for _, raw := range items {
+            item := raw.(map[string]any)
+            if quantity := item["quantity"].(int); quantity < 1 || quantity > 3 || item["price"].(float64) <= 0 || seen[item["name"]] {
+                t.Fatalf("unrealistic item %v in %v", item, items)
+            }
+            seen[item["name"]] = true
+        }
+    }
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+    "errors"
+    "fmt"
+
+    "github.com/everestp/pizza-shop/constants"
+)
+
+// ErrInvalidTransition is returned when an event tries to jump to a status
+// the order is not allowed to reach from where it is now.
+var ErrInvalidTransition = errors.New("invalid order status transition")
+
+// 1. The Interface
+// Anything that can decide "is this status change allowed?" can be plugged
+// into the processor (e.g. a stricter validator for a specific store).
+type IOrderStatusValidator interface {
+    CanTransition(from string, to string) bool
+}
+
+// 2. The Transition Table
+// Each status lists the ONLY statuses it may move to next.
+// DELIVERED and CANCELLED are terminal: nothing comes after them.
+// An order can be cancelled until the pizza is out of the oven.
+var defaultTransitions = map[string][]string{
+    constants.ORDER_ORDERED:          {constants.ORDER_ACCEPTED, constants.ORDER_PREPARING, constants.ORDER_STATUS_CANCELLED},
+    constants.ORDER_ACCEPTED:         {constants.ORDER_PREPARING, constants.ORDER_STATUS_CANCELLED},
+    constants.ORDER_PREPARING:        {constants.ORDER_PREPARED, constants.ORDER_STATUS_CANCELLED},
+    constants.ORDER_PREPARED:         {constants.ORDER_DELIVERED},
+    constants.ORDER_DELIVERED:        {},
+    constants.ORDER_STATUS_CANCELLED: {},
+}
+
+// happyPath is where an order goes next when nothing goes wrong (used to advance it by hand).
+var happyPath = map[string]string{
+    constants.ORDER_ORDERED:   constants.ORDER_PREPARING,
+    constants.ORDER_ACCEPTED:  constants.ORDER_PREPARING,
+    constants.ORDER_PREPARING: constants.ORDER_PREPARED,
+    constants.ORDER_PREPARED:  constants.ORDER_DELIVERED,
+}
+
+// NextStatus returns the status that normally follows 'current';
+// false for terminal statuses (delivered, cancelled) and unknown ones.
+func NextStatus(current string) (string, bool) {
+    next, ok := happyPath[current]
+    return next, ok
+}
+
+// OrderStatusValidator checks transitions against a table like the one above.
+type OrderStatusValidator struct {
+    transitions map[string][]string
+}
+
+// CanTransition reports whether an order in status 'from' may move to status 'to'.
+// Unknown 'from' statuses are never allowed to move anywhere.
+func (v *OrderStatusValidator) CanTransition(from string, to string) bool {
+    allowed, ok := v.transitions[from]
+    if !ok {
+        return false
+    }
+    for _, status := range allowed {
+        if status == to {
+            return true
+        }
+    }
+    return false
+}
+
+// checkTransition wraps CanTransition into an error the processor can return.
+func checkTransition(validator IOrderStatusValidator, from string, to string) error {
+    if validator != nil && !validator.CanTransition(from, to) {
+        return fmt.Errorf("%w: %q -> %q", ErrInvalidTransition, from, to)
+    }
+    return nil
+}
+
+// GetOrderStatusValidator is the Constructor for the default pizza lifecycle.
+func GetOrderStatusValidator() *OrderStatusValidator {
+    return &OrderStatusValidator{
+        transitions: defaultTransitions,
+    }
+}
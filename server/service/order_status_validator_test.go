@@ -0,0 +1,73 @@
+package service
+
+import (
+    "errors"
+    "testing"
+
+    "github.com/everestp/pizza-shop/constants"
+)
+
+func TestFullLifecycleIsLegal(t *testing.T) {
+    validator := GetOrderStatusValidator()
+    path := []string{constants.ORDER_ORDERED, constants.ORDER_ACCEPTED, constants.ORDER_PREPARING, constants.ORDER_PREPARED, constants.ORDER_DELIVERED}
+
+    for i := 1; i < len(path); i++ {
+        if !validator.CanTransition(path[i-1], path[i]) {
+            t.Errorf("%s -> %s was refused", path[i-1], path[i])
+        }
+    }
+    // Accepting is optional.
+    if !validator.CanTransition(constants.ORDER_ORDERED, constants.ORDER_PREPARING) {
+        t.Error("ordered -> preparing was refused")
+    }
+}
+
+func TestIllegalTransitionsAreRejected(t *testing.T) {
+    validator := GetOrderStatusValidator()
+    cases := []struct{ from, to string }{
+        {constants.ORDER_PREPARING, constants.ORDER_ORDERED},         // Backwards
+        {constants.ORDER_ORDERED, constants.ORDER_DELIVERED},         // Skipping the kitchen
+        {constants.ORDER_PREPARED, constants.ORDER_STATUS_CANCELLED}, // Already out of the oven
+        {constants.ORDER_DELIVERED, constants.ORDER_PREPARING},       // Terminal
+        {constants.ORDER_STATUS_CANCELLED, constants.ORDER_PREPARING},
+        {"teleported", constants.ORDER_DELIVERED}, // Unknown status
+    }
+    for _, tc := range cases {
+        if validator.CanTransition(tc.from, tc.to) {
+            t.Errorf("%s -> %s was allowed", tc.from, tc.to)
+        }
+        if err := checkTransition(validator, tc.from, tc.to); !errors.Is(err, ErrInvalidTransition) {
+            t.Errorf("%s -> %s: got %v, want ErrInvalidTransition", tc.from, tc.to, err)
+        }
+    }
+}
+
+func TestNextStatus(t *testing.T) {
+    if next, ok := NextStatus(constants.ORDER_PREPARING); !ok || next != constants.ORDER_PREPARED {
+        t.Errorf("after preparing: got %q, %v", next, ok)
+    }
+    for _, terminal := range []string{constants.ORDER_DELIVERED, constants.ORDER_STATUS_CANCELLED, "teleported"} {
+        if next, ok := NextStatus(terminal); ok {
+            t.Errorf("after %s: got %q, want nothing", terminal, next)
+        }
+    }
+}
+
+func TestProcessorRejectsAnEventForACancelledOrder(t *testing.T) {
+    tp := newTestProcessor(t)
+    tp.store.Save(Order{OrderNo: "A1", OwnerID: "alice", Status: constants.ORDER_STATUS_CANCELLED})
+
+    err := tp.deliver(t, "", orderEvent(t, "A1", constants.ORDER_ORDERED))
+    if !errors.Is(err, ErrInvalidTransition) {
+        t.Fatalf("got %v, want ErrInvalidTransition", err)
+    }
+    if tp.settled.rejects != 1 || tp.settled.requeues != 0 {
+        t.Errorf("settled %+v, want a nack without requeue", tp.settled)
+    }
+    if order, _ := tp.store.Get("A1"); order.Status != constants.ORDER_STATUS_CANCELLED {
+        t.Errorf("status: got %q, want it to stay cancelled", order.Status)
+    }
+    if next := tp.published(); next != nil {
+        t.Errorf("the cancelled order moved on: %s", next.Body)
+    }
+}
@@ -0,0 +1,221 @@
+package service
+
+import (
+    "sync"
+    "time"
+
+    "github.com/everestp/pizza-shop/constants"
+    "github.com/everestp/pizza-shop/utils"
+)
+
+// Order is what we remember about a single pizza order.
+type Order struct {
+    OrderNo   string         `json:"order_no"`
+    OwnerID   string         `json:"owner_id"`
+    Status    string         `json:"order_status"`
+    Payload   map[string]any `json:"payload"`
+    CreatedAt time.Time      `json:"created_at"`
+    UpdatedAt time.Time      `json:"updated_at"`
+    // When the order entered each status it has been in (used for SLA checks).
+    StatusEnteredAt map[string]time.Time `json:"status_entered_at"`
+    // Items cook independently (a large order is split across stations);
+    // the order is PREPARED only once every item is ready.
+    Items []ItemState `json:"items,omitempty"`
+    // Tags like "delivery" or "promo" (allowed list: ORDER_TAGS), for filtering.
+    Tags []string `json:"tags,omitempty"`
+    // 0 (normal) to MAX_ORDER_PRIORITY; higher-priority orders go to the front of the pending queue.
+    Priority int `json:"priority"`
+}
+
+// ItemState is one line of the order and how far along it is.
+type ItemState struct {
+    Name     string `json:"name"`
+    Quantity int    `json:"quantity"`
+    Status   string `json:"status"` // "pending" or "ready"
+}
+
+// NewItemStates turns priced line items into pending items.
+func NewItemStates(items []OrderItem) []ItemState {
+    states := make([]ItemState, 0, len(items))
+    for _, item := range items {
+        states = append(states, ItemState{Name: item.Name, Quantity: item.Quantity, Status: constants.ORDER_ITEM_PENDING})
+    }
+    return states
+}
+
+// copyOrder returns a copy that shares no maps with the stored order.
+func copyOrder(order *Order) Order {
+    copied := *order
+    copied.StatusEnteredAt = make(map[string]time.Time, len(order.StatusEnteredAt))
+    for status, at := range order.StatusEnteredAt {
+        copied.StatusEnteredAt[status] = at
+    }
+    copied.Items = append([]ItemState(nil), order.Items...)
+    copied.Tags = append([]string(nil), order.Tags...)
+    return copied
+}
+
+// 1. The Interface
+// Keeps the handlers and processor independent of where orders are stored
+// (memory today, a database tomorrow).
+type IOrderStore interface {
+    Save(order Order)
+    Create(order Order) bool
+    Get(orderNo string) (Order, bool)
+    UpdateStatus(orderNo string, status string) (Order, bool)
+    MarkItemReady(orderNo string, index int) (Order, bool)
+    All() []Order
+    Pending() []Order
+    EvictFinished(createdBefore time.Time) []string
+}
+
+// 2. In-Memory Implementation
+// A map guarded by an RWMutex: many readers at once, one writer at a time.
+type OrderStore struct {
+    orders map[string]*Order
+    mutex  sync.RWMutex
+}
+
+// Save stores (or replaces) an order.
+func (st *OrderStore) Save(order Order) {
+    st.mutex.Lock()
+    defer st.mutex.Unlock()
+
+    st.saveLocked(order)
+}
+
+// Create stores a new order. It returns false, and changes nothing, when the order
+// number is already taken: an existing order (and its owner) is never replaced.
+func (st *OrderStore) Create(order Order) bool {
+    st.mutex.Lock()
+    defer st.mutex.Unlock()
+
+    if _, taken := st.orders[order.OrderNo]; taken {
+        return false
+    }
+    st.saveLocked(order)
+    return true
+}
+
+// saveLocked stamps the timestamps and stores a copy of the order. Caller holds the lock.
+func (st *OrderStore) saveLocked(order Order) {
+    now := utils.Clock.Now()
+    if order.CreatedAt.IsZero() {
+        order.CreatedAt = now
+    }
+    order.UpdatedAt = now
+    stored := copyOrder(&order)
+    if _, ok := stored.StatusEnteredAt[stored.Status]; !ok {
+        stored.StatusEnteredAt[stored.Status] = now
+    }
+    st.orders[order.OrderNo] = &stored
+}
+
+// Get returns a copy of the order so callers can't change it behind our back.
+func (st *OrderStore) Get(orderNo string) (Order, bool) {
+    st.mutex.RLock()
+    defer st.mutex.RUnlock()
+
+    order, ok := st.orders[orderNo]
+    if !ok {
+        return Order{}, false
+    }
+    return copyOrder(order), true
+}
+
+// UpdateStatus changes the status of a known order and returns the updated copy.
+func (st *OrderStore) UpdateStatus(orderNo string, status string) (Order, bool) {
+    st.mutex.Lock()
+    defer st.mutex.Unlock()
+
+    order, ok := st.orders[orderNo]
+    if !ok {
+        return Order{}, false
+    }
+    now := utils.Clock.Now()
+    order.Status = status
+    order.UpdatedAt = now
+    order.StatusEnteredAt[status] = now
+    return copyOrder(order), true
+}
+
+// MarkItemReady marks one item of an order ready and returns the updated copy.
+func (st *OrderStore) MarkItemReady(orderNo string, index int) (Order, bool) {
+    st.mutex.Lock()
+    defer st.mutex.Unlock()
+
+    order, ok := st.orders[orderNo]
+    if !ok || index < 0 || index >= len(order.Items) {
+        return Order{}, false
+    }
+    order.Items[index].Status = constants.ORDER_ITEM_DONE
+    order.UpdatedAt = utils.Clock.Now()
+    return copyOrder(order), true
+}
+
+// ReadyItems counts how many of the order's items are ready.
+func (o Order) ReadyItems() int {
+    ready := 0
+    for _, item := range o.Items {
+        if item.Status == constants.ORDER_ITEM_DONE {
+            ready++
+        }
+    }
+    return ready
+}
+
+// All returns a copy of every order (used by background checks like the SLA monitor).
+func (st *OrderStore) All() []Order {
+    st.mutex.RLock()
+    defer st.mutex.RUnlock()
+
+    orders := make([]Order, 0, len(st.orders))
+    for _, order := range st.orders {
+        orders = append(orders, copyOrder(order))
+    }
+    return orders
+}
+
+// Pending returns a copy of every order not yet on the stove, in the order the kitchen
+// should take them (see SortByPriority).
+func (st *OrderStore) Pending() []Order {
+    st.mutex.RLock()
+    orders := []Order{}
+    for _, order := range st.orders {
+        if order.IsPending() {
+            orders = append(orders, copyOrder(order))
+        }
+    }
+    st.mutex.RUnlock()
+
+    SortByPriority(orders)
+    return orders
+}
+
+// EvictFinished removes every delivered or cancelled order created before the cutoff
+// and returns their numbers. Orders still moving through the kitchen are never removed.
+// It holds the write lock, so a lookup sees the order either fully there or gone.
+func (st *OrderStore) EvictFinished(createdBefore time.Time) []string {
+    st.mutex.Lock()
+    defer st.mutex.Unlock()
+
+    evicted := []string{}
+    for orderNo, order := range st.orders {
+        if !order.IsFinished() {
+            continue
+        }
+        if !order.CreatedAt.Before(createdBefore) {
+            continue
+        }
+        delete(st.orders, orderNo)
+        evicted = append(evicted, orderNo)
+    }
+    return evicted
+}
+
+// GetOrderStore is the Constructor.
+func GetOrderStore() *OrderStore {
+    return &OrderStore{
+        orders: make(map[string]*Order),
+    }
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+    "context"
+    "fmt"
+    "time"
+
+    "github.com/everestp/pizza-shop/logger"
+    "github.com/everestp/pizza-shop/utils"
+)
+
+// OrderSweeper keeps the in-memory store bounded: finished orders older than
+// maxAge are dropped on every tick.
+type OrderSweeper struct {
+    store    IOrderStore
+    maxAge   time.Duration // How old a delivered/cancelled order may get before it is evicted
+    interval time.Duration // How often we sweep
+}
+
+// Start sweeps on every tick until ctx is cancelled.
+func (sw *OrderSweeper) Start(ctx context.Context) {
+    if sw.maxAge <= 0 || sw.interval <= 0 {
+        return
+    }
+    ticker := time.NewTicker(sw.interval)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+            sw.Sweep()
+        }
+    }
+}
+
+// Sweep evicts the finished orders created more than maxAge ago and returns their numbers.
+func (sw *OrderSweeper) Sweep() []string {
+    evicted := sw.store.EvictFinished(utils.Clock.Now().Add(-sw.maxAge))
+    if len(evicted) > 0 {
+        logger.Log(fmt.Sprintf("Order sweeper: evicted %d finished orders older than %s", len(evicted), sw.maxAge))
+    }
+    return evicted
+}
+
+// GetOrderSweeper is the Constructor. A maxAge of 0 keeps every order forever.
+func GetOrderSweeper(store IOrderStore, maxAge time.Duration, interval time.Duration) *OrderSweeper {
+    return &OrderSweeper{
+        store:    store,
+        maxAge:   maxAge,
+        interval: interval,
+    }
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+    "context"
+    "fmt"
+    "sort"
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/everestp/pizza-shop/constants"
+)
+
+func TestSweepEvictsOnlyOldFinishedOrders(t *testing.T) {
+    store := GetOrderStore()
+    old := time.Now().Add(-time.Hour)
+    store.Save(Order{OrderNo: "delivered-old", Status: constants.ORDER_DELIVERED, CreatedAt: old})
+    store.Save(Order{OrderNo: "cancelled-old", Status: constants.ORDER_STATUS_CANCELLED, CreatedAt: old})
+    store.Save(Order{OrderNo: "preparing-old", Status: constants.ORDER_PREPARING, CreatedAt: old})
+    store.Save(Order{OrderNo: "delivered-new", Status: constants.ORDER_DELIVERED})
+
+    evicted := GetOrderSweeper(store, time.Minute, time.Minute).Sweep()
+    sort.Strings(evicted)
+    if fmt.Sprint(evicted) != "[cancelled-old delivered-old]" {
+        t.Errorf("evicted %v, want the two old finished orders", evicted)
+    }
+    for _, orderNo := range []string{"preparing-old", "delivered-new"} {
+        if _, ok := store.Get(orderNo); !ok {
+            t.Errorf("%s was evicted", orderNo)
+        }
+    }
+}
+
+func TestSweeperEvictsOnceTheTTLHasPassed(t *testing.T) {
+    store := GetOrderStore()
+    store.Save(Order{OrderNo: "A1", Status: constants.ORDER_DELIVERED})
+    store.Save(Order{OrderNo: "A2", Status: constants.ORDER_PREPARING})
+
+    ctx, cancel := context.WithCancel(context.Background())
+    done := make(chan struct{})
+    go func() {
+        defer close(done)
+        GetOrderSweeper(store, 100*time.Millisecond, 5*time.Millisecond).Start(ctx)
+    }()
+    t.Cleanup(func() {
+        cancel()
+        <-done
+    })
+
+    // Lookups keep running while the sweeper evicts.
+    var wg sync.WaitGroup
+    stop := make(chan struct{})
+    wg.Add(1)
+    go func() {
+        defer wg.Done()
+        for {
+            select {
+            case <-stop:
+                return
+            default:
+                store.Get("A1")
+                store.All()
+            }
+        }
+    }()
+
+    if _, ok := store.Get("A1"); !ok {
+        t.Fatal("the delivered order was evicted before its TTL")
+    }
+    deadline := time.Now().Add(time.Second)
+    for {
+        if _, ok := store.Get("A1"); !ok {
+            break
+        }
+        if time.Now().After(deadline) {
+            t.Fatal("the delivered order is still there a second after its TTL")
+        }
+        time.Sleep(5 * time.Millisecond)
+    }
+    close(stop)
+    wg.Wait()
+
+    if _, ok := store.Get("A2"); !ok {
+        t.Error("the order still cooking was evicted")
+    }
+}
+
+func TestSweeperIsOffWithoutAMaxAge(t *testing.T) {
+    store := GetOrderStore()
+    store.Save(Order{OrderNo: "A1", Status: constants.ORDER_DELIVERED, CreatedAt: time.Now().Add(-time.Hour)})
+
+    done := make(chan struct{})
+    go func() {
+        defer close(done)
+        GetOrderSweeper(store, 0, time.Millisecond).Start(context.Background())
+    }()
+    select {
+    case <-done:
+    case <-time.After(time.Second):
+        t.Fatal("a sweeper with no max age kept running")
+    }
+    if _, ok := store.Get("A1"); !ok {
+        t.Error("the order was evicted with eviction off")
+    }
+}
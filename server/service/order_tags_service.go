@@ -0,0 +1,64 @@
+package service
+
+import (
+    "errors"
+    "fmt"
+    "strings"
+)
+
+// ErrInvalidTags is returned when an order's tags aren't a list of allowed tags.
+var ErrInvalidTags = errors.New("invalid order tags")
+
+// ParseTagAllowlist reads ORDER_TAGS, e.g. "delivery,dine-in,promo".
+func ParseTagAllowlist(raw string) map[string]bool {
+    allowed := make(map[string]bool)
+    for _, tag := range strings.Split(raw, ",") {
+        if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" {
+            allowed[tag] = true
+        }
+    }
+    return allowed
+}
+
+// ValidateTags checks the raw "tags" value (e.g. ["delivery", "promo"]) against the allowlist.
+// Tags are lower-cased and trimmed, duplicates are dropped and the order is kept.
+// Any tag not on the list rejects the whole order, so a typo never goes unnoticed.
+func ValidateTags(raw any, allowed map[string]bool) ([]string, error) {
+    list, ok := raw.([]any)
+    if !ok {
+        return nil, fmt.Errorf("%w: tags must be a list of text", ErrInvalidTags)
+    }
+
+    tags := make([]string, 0, len(list))
+    seen := make(map[string]bool, len(list))
+    for _, item := range list {
+        text, ok := item.(string)
+        if !ok {
+            return nil, fmt.Errorf("%w: tags must be a list of text", ErrInvalidTags)
+        }
+        tag := strings.ToLower(strings.TrimSpace(text))
+        if !allowed[tag] {
+            return nil, fmt.Errorf("%w: %q is not one of the allowed tags", ErrInvalidTags, text)
+        }
+        if !seen[tag] {
+            seen[tag] = true
+            tags = append(tags, tag)
+        }
+    }
+    return tags, nil
+}
+
+// HasTag reports whether the order was tagged with 'tag'.
+func (o Order) HasTag(tag string) bool {
+    return HasTag(o.Tags, tag)
+}
+
+// HasTag reports whether 'tag' is one of 'tags' (e.g. an SLA escalation's).
+func HasTag(tags []string, tag string) bool {
+    for _, t := range tags {
+        if t == tag {
+            return true
+        }
+    }
+    return false
+}
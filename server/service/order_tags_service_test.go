@@ -0,0 +1,38 @@
+package service
+
+import (
+    "errors"
+    "fmt"
+    "testing"
+)
+
+func TestValidateTags(t *testing.T) {
+    allowed := ParseTagAllowlist(" delivery, Dine-In ,promo,")
+
+    cases := []struct {
+        name string
+        raw  any
+        want []string // nil = rejected
+    }{
+        {name: "allowed", raw: []any{"delivery", "promo"}, want: []string{"delivery", "promo"}},
+        {name: "cleaned up and deduplicated", raw: []any{" Delivery", "delivery", "DINE-IN"}, want: []string{"delivery", "dine-in"}},
+        {name: "empty list", raw: []any{}, want: []string{}},
+        {name: "unknown tag", raw: []any{"delivery", "vip"}},
+        {name: "not a list", raw: "delivery"},
+        {name: "not text", raw: []any{"delivery", 7}},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            tags, err := ValidateTags(tc.raw, allowed)
+            if tc.want == nil {
+                if !errors.Is(err, ErrInvalidTags) {
+                    t.Errorf("got %v, %v; want ErrInvalidTags", tags, err)
+                }
+                return
+            }
+            if err != nil || fmt.Sprint(tags) != fmt.Sprint(tc.want) {
+                t.Errorf("got %v, %v; want %v", tags, err, tc.want)
+            }
+        })
+    }
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+    "bytes"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "sync"
+    "time"
+
+    "github.com/everestp/pizza-shop/logger"
+    "github.com/everestp/pizza-shop/utils"
+)
+
+// WebhookSignatureHeader carries "sha256=<hex HMAC of the body>" so the receiver
+// can check the call really came from us.
+const WebhookSignatureHeader = "X-Pizza-Signature"
+
+// OrderWebhook pushes accepted orders to an external kitchen system (e.g. a POS)
+// that would rather receive an HTTP call than consume from RabbitMQ.
+// Calls run in the background with a timeout and a few retries: a slow or broken
+// webhook is logged, it never holds up the order flow.
+type OrderWebhook struct {
+    url         string
+    secret      []byte        // HMAC key for the signature header
+    client      *http.Client  // Has the per-attempt timeout
+    maxAttempts int           // Attempts per order before giving up
+    backoff     time.Duration // Wait before the 2nd attempt; doubles after that
+    inFlight    sync.WaitGroup
+}
+
+// Notify sends the order in the background.
+// The body is encoded right away, so the caller may keep changing the event.
+func (ow *OrderWebhook) Notify(event map[string]interface{}) {
+    body, err := json.Marshal(map[string]interface{}{
+        "event": "order.accepted",
+        "order": event,
+    })
+    if err != nil {
+        logger.Log(fmt.Sprintf("Webhook: failed to encode order #%v: %v", event["order_no"], err))
+        return
+    }
+
+    orderNo := fmt.Sprint(event["order_no"])
+    ow.inFlight.Add(1)
+    go func() {
+        defer ow.inFlight.Done()
+        ow.deliver(orderNo, body)
+    }()
+}
+
+// deliver tries the webhook up to maxAttempts times.
+func (ow *OrderWebhook) deliver(orderNo string, body []byte) {
+    wait := ow.backoff
+    for attempt := 1; attempt <= ow.maxAttempts; attempt++ {
+        err := ow.post(body)
+        if err == nil {
+            logger.Log(fmt.Sprintf("Webhook: order #%s delivered", orderNo))
+            return
+        }
+        logger.Log(fmt.Sprintf("Webhook: attempt %d/%d for order #%s failed: %v", attempt, ow.maxAttempts, orderNo, err))
+        if attempt < ow.maxAttempts {
+            utils.Clock.Sleep(wait)
+            wait *= 2
+        }
+    }
+}
+
+// post makes one signed call. Any 2xx counts as delivered.
+func (ow *OrderWebhook) post(body []byte) error {
+    request, err := http.NewRequest(http.MethodPost, ow.url, bytes.NewReader(body))
+    if err != nil {
+        return err
+    }
+    request.Header.Set("Content-Type", "application/json")
+    request.Header.Set(WebhookSignatureHeader, "sha256="+SignWebhookBody(ow.secret, body))
+
+    response, err := ow.client.Do(request)
+    if err != nil {
+        return err
+    }
+    defer response.Body.Close()
+
+    if response.StatusCode < 200 || response.StatusCode > 299 {
+        return fmt.Errorf("unexpected status %d", response.StatusCode)
+    }
+    return nil
+}
+
+// Wait blocks until every background delivery is done (used during shutdown).
+func (ow *OrderWebhook) Wait() {
+    ow.inFlight.Wait()
+}
+
+// SignWebhookBody returns the hex HMAC-SHA256 of the body; receivers compute the same to verify.
+func SignWebhookBody(secret []byte, body []byte) string {
+    mac := hmac.New(sha256.New, secret)
+    mac.Write(body)
+    return hex.EncodeToString(mac.Sum(nil))
+}
+
+// GetOrderWebhook is the Constructor. An empty URL means no webhook (nil).
+func GetOrderWebhook(url string, secret string, timeout time.Duration, maxAttempts int) *OrderWebhook {
+    if url == "" {
+        return nil
+    }
+    if maxAttempts < 1 {
+        maxAttempts = 1
+    }
+    return &OrderWebhook{
+        url:         url,
+        secret:      []byte(secret),
+        client:      &http.Client{Timeout: timeout},
+        maxAttempts: maxAttempts,
+        backoff:     time.Second,
+    }
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+    "context"
+    "encoding/json"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "sync/atomic"
+    "testing"
+    "time"
+
+    "github.com/everestp/pizza-shop/constants"
+)
+
+// webhookCall is one request the stub kitchen system received.
+type webhookCall struct {
+    signature string
+    body      []byte
+}
+
+// stubKitchenSystem answers every webhook call with this status and hands the calls to the test.
+func stubKitchenSystem(t *testing.T, status int) (url string, calls chan webhookCall, attempts *int32) {
+    t.Helper()
+
+    calls = make(chan webhookCall, 10)
+    attempts = new(int32)
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        atomic.AddInt32(attempts, 1)
+        body, _ := io.ReadAll(r.Body)
+        calls <- webhookCall{signature: r.Header.Get(WebhookSignatureHeader), body: body}
+        w.WriteHeader(status)
+    }))
+    t.Cleanup(server.Close)
+    return server.URL, calls, attempts
+}
+
+func TestAcceptedOrderIsPushedSignedToTheWebhook(t *testing.T) {
+    url, calls, _ := stubKitchenSystem(t, http.StatusNoContent)
+    tp := newTestProcessor(t)
+    tp.webhook = GetOrderWebhook(url, "s3cret", time.Second, 1)
+    tp.store.Save(Order{OrderNo: "A1", OwnerID: "alice", Status: constants.ORDER_ORDERED})
+
+    if err := tp.deliver(t, "", orderEvent(t, "A1", constants.ORDER_ORDERED)); err != nil {
+        t.Fatalf("process: %v", err)
+    }
+    tp.webhook.Wait()
+
+    select {
+    case call := <-calls:
+        if want := "sha256=" + SignWebhookBody([]byte("s3cret"), call.body); call.signature != want {
+            t.Errorf("signature %q, want %q", call.signature, want)
+        }
+        var payload struct {
+            Event string         `json:"event"`
+            Order map[string]any `json:"order"`
+        }
+        if err := json.Unmarshal(call.body, &payload); err != nil {
+            t.Fatalf("payload %q: %v", call.body, err)
+        }
+        if payload.Event != "order.accepted" || payload.Order["order_no"] != "A1" {
+            t.Errorf("got %s", call.body)
+        }
+    default:
+        t.Fatal("the webhook was never called")
+    }
+}
+
+func TestFailingWebhookDoesNotHoldUpTheOrder(t *testing.T) {
+    url, _, attempts := stubKitchenSystem(t, http.StatusInternalServerError)
+    tp := newTestProcessor(t)
+    tp.webhook = GetOrderWebhook(url, "s3cret", time.Second, 3)
+    tp.webhook.backoff = time.Millisecond
+    tp.store.Save(Order{OrderNo: "A1", OwnerID: "alice", Status: constants.ORDER_ORDERED})
+
+    if err := tp.deliver(t, "", orderEvent(t, "A1", constants.ORDER_ORDERED)); err != nil {
+        t.Fatalf("process: %v", err)
+    }
+    if tp.published() == nil || tp.settled.acks != 1 {
+        t.Fatalf("the order didn't move on to the kitchen (%d ack(s))", tp.settled.acks)
+    }
+
+    tp.webhook.Wait()
+    if got := atomic.LoadInt32(attempts); got != 3 {
+        t.Errorf("the webhook was tried %d time(s), want 3", got)
+    }
+}
+
+func TestWebhookOnlyHearsAboutOrdersTheKitchenTookOn(t *testing.T) {
+    url, _, attempts := stubKitchenSystem(t, http.StatusNoContent)
+    tp := newTestProcessor(t)
+    tp.webhook = GetOrderWebhook(url, "s3cret", time.Second, 1)
+    tp.publisher = &flakyPublisher{MemoryPublisher: GetMemoryPublisher(tp.broker), failures: 1}
+    tp.store.Save(Order{OrderNo: "A1", OwnerID: "alice", Status: constants.ORDER_ORDERED})
+    tp.store.Save(Order{OrderNo: "C1", OwnerID: "alice", Status: constants.ORDER_STATUS_CANCELLED})
+
+    // Cancelled before the kitchen got to it: the transition is rejected.
+    tp.deliver(t, "", orderEvent(t, "C1", constants.ORDER_ORDERED))
+    // The publish fails once and the retry goes through: one call, not one per attempt.
+    tp.deliver(t, "", orderEvent(t, "A1", constants.ORDER_ORDERED))
+    retried := tp.published()
+    if retried == nil {
+        t.Fatal("the failed step was not sent back for a retry")
+    }
+    retried.Acknowledger = tp.settled
+    if err := tp.ProcessMessage(context.Background(), *retried); err != nil {
+        t.Fatalf("retry: %v", err)
+    }
+
+    tp.webhook.Wait()
+    if got := atomic.LoadInt32(attempts); got != 1 {
+        t.Errorf("the webhook was called %d time(s), want once, for A1 going through", got)
+    }
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+    "sync"
+    "time"
+)
+
+// maxPendingPerCustomer keeps one long-offline customer from growing the store forever.
+const maxPendingPerCustomer = 50
+
+// pendingNotification is a message that couldn't be delivered because the customer was offline.
+type pendingNotification struct {
+    message  []byte
+    storedAt time.Time
+}
+
+// PendingNotificationStore holds "your pizza is ready" style messages for customers
+// who weren't connected, and hands them over as soon as they come back.
+type PendingNotificationStore struct {
+    pending map[string][]pendingNotification // Keyed by customer ID, oldest first
+    ttl     time.Duration                    // After this long, a notification is stale and dropped
+    mutex   sync.Mutex
+}
+
+// Add keeps a message for an offline customer.
+func (ps *PendingNotificationStore) Add(clientId string, message []byte) {
+    ps.mutex.Lock()
+    defer ps.mutex.Unlock()
+
+    queue := append(ps.fresh(clientId, time.Now()), pendingNotification{message: message, storedAt: time.Now()})
+    if len(queue) > maxPendingPerCustomer {
+        queue = queue[len(queue)-maxPendingPerCustomer:]
+    }
+    ps.pending[clientId] = queue
+}
+
+// Drain returns (and forgets) every message still fresh for a customer, oldest first.
+func (ps *PendingNotificationStore) Drain(clientId string) [][]byte {
+    ps.mutex.Lock()
+    defer ps.mutex.Unlock()
+
+    queue := ps.fresh(clientId, time.Now())
+    delete(ps.pending, clientId)
+
+    messages := make([][]byte, 0, len(queue))
+    for _, notification := range queue {
+        messages = append(messages, notification.message)
+    }
+    return messages
+}
+
+// fresh returns the customer's notifications that haven't expired yet. Caller holds the lock.
+func (ps *PendingNotificationStore) fresh(clientId string, now time.Time) []pendingNotification {
+    queue := ps.pending[clientId]
+    i := 0
+    for i < len(queue) && now.Sub(queue[i].storedAt) > ps.ttl {
+        i++
+    }
+    return queue[i:]
+}
+
+// GetPendingNotificationStore is the Constructor.
+func GetPendingNotificationStore(ttl time.Duration) *PendingNotificationStore {
+    return &PendingNotificationStore{
+        pending: make(map[string][]pendingNotification),
+        ttl:     ttl,
+    }
+}
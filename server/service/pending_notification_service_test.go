@@ -0,0 +1,64 @@
+package service
+
+import (
+    "context"
+    "encoding/json"
+    "testing"
+    "time"
+
+    "github.com/everestp/pizza-shop/constants"
+    "github.com/rabbitmq/amqp091-go"
+)
+
+func TestReadyNotificationIsKeptForAnOfflineCustomer(t *testing.T) {
+    pending := GetPendingNotificationStore(time.Minute)
+    store := GetOrderStore()
+    store.Save(Order{OrderNo: "A1", OwnerID: "alice", Status: constants.ORDER_PREPARED})
+    offline := func(clientId string) IWebSocketConnection { return nil }
+    processor := GetMessageProcessorService(GetMemoryPublisher(GetMemoryBroker(10)), offline, GetOrderStatusValidator(), store,
+        GetKitchenMetrics(), ProcessorOptions{Pending: pending})
+
+    err := processor.ProcessMessage(context.Background(), amqp091.Delivery{
+        Acknowledger: &settlements{},
+        Body:         orderEvent(t, "A1", constants.ORDER_PREPARED),
+    })
+    if err != nil {
+        t.Fatalf("process: %v", err)
+    }
+
+    missed := pending.Drain("alice")
+    if len(missed) != 1 {
+        t.Fatalf("kept %d notification(s), want the ready one", len(missed))
+    }
+    var frame map[string]any
+    if err := json.Unmarshal(missed[0], &frame); err != nil || frame["message"] != constants.ORDER_PREPARED_SUCCESSFULLY {
+        t.Errorf("kept %q, want the ready notification", missed[0])
+    }
+}
+
+func TestStaleNotificationsAreDropped(t *testing.T) {
+    pending := GetPendingNotificationStore(30 * time.Millisecond)
+    pending.Add("alice", []byte("stale"))
+    time.Sleep(40 * time.Millisecond)
+    pending.Add("alice", []byte("fresh"))
+
+    missed := pending.Drain("alice")
+    if len(missed) != 1 || string(missed[0]) != "fresh" {
+        t.Errorf("got %q, want only the fresh notification", missed)
+    }
+    if again := pending.Drain("alice"); len(again) != 0 {
+        t.Errorf("a second drain got %q, want nothing", again)
+    }
+}
+
+func TestOneOfflineCustomerCannotGrowTheStoreForever(t *testing.T) {
+    pending := GetPendingNotificationStore(time.Minute)
+    for i := 0; i < maxPendingPerCustomer+5; i++ {
+        pending.Add("alice", []byte{byte(i)})
+    }
+
+    missed := pending.Drain("alice")
+    if len(missed) != maxPendingPerCustomer || missed[0][0] != 5 {
+        t.Errorf("kept %d, starting at %d; want the newest %d", len(missed), missed[0][0], maxPendingPerCustomer)
+    }
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "math"
+)
+
+// ErrInvalidItems is returned when the order's line items can't be priced.
+var ErrInvalidItems = errors.New("invalid order items")
+
+// OrderItem is one line on the receipt (e.g. 2 x Margherita @ 9.50).
+type OrderItem struct {
+    Name     string  `json:"name"`
+    Price    float64 `json:"price"`
+    Quantity int     `json:"quantity"`
+}
+
+// OrderTotals is what the customer owes.
+type OrderTotals struct {
+    Subtotal float64 `json:"subtotal"`
+    Tax      float64 `json:"tax"`
+    Total    float64 `json:"total"`
+}
+
+// ParseOrderItems converts the raw "items" value from the JSON payload into typed items.
+// Everything must be non-negative: nobody gets paid to order a pizza.
+func ParseOrderItems(raw any) ([]OrderItem, error) {
+    // Round-trip through JSON: the payload is a generic map, this gives us typed fields.
+    bytes, err := json.Marshal(raw)
+    if err != nil {
+        return nil, fmt.Errorf("%w: %v", ErrInvalidItems, err)
+    }
+
+    var items []OrderItem
+    if err := json.Unmarshal(bytes, &items); err != nil {
+        return nil, fmt.Errorf("%w: items must be a list of {name, price, quantity}", ErrInvalidItems)
+    }
+
+    for i, item := range items {
+        if item.Price < 0 {
+            return nil, fmt.Errorf("%w: item %d has a negative price", ErrInvalidItems, i)
+        }
+        if item.Quantity < 0 {
+            return nil, fmt.Errorf("%w: item %d has a negative quantity", ErrInvalidItems, i)
+        }
+    }
+    return items, nil
+}
+
+// PriceOrder adds up the items and applies the tax rate (e.g. 0.13 for 13%).
+// Amounts are rounded to cents.
+func PriceOrder(items []OrderItem, taxRate float64) OrderTotals {
+    subtotal := 0.0
+    for _, item := range items {
+        subtotal += item.Price * float64(item.Quantity)
+    }
+    subtotal = roundToCents(subtotal)
+    tax := roundToCents(subtotal * taxRate)
+
+    return OrderTotals{
+        Subtotal: subtotal,
+        Tax:      tax,
+        Total:    roundToCents(subtotal + tax),
+    }
+}
+
+// roundToCents avoids totals like 19.000000000000004.
+func roundToCents(amount float64) float64 {
+    return math.Round(amount*100) / 100
+}
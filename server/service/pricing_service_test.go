@@ -0,0 +1,46 @@
+package service
+
+import (
+    "errors"
+    "testing"
+)
+
+func TestPriceOrder(t *testing.T) {
+    cases := []struct {
+        name    string
+        items   []OrderItem
+        taxRate float64
+        want    OrderTotals
+    }{
+        {name: "no tax", items: []OrderItem{{Price: 10, Quantity: 2}}, want: OrderTotals{Subtotal: 20, Total: 20}},
+        {name: "13% tax", items: []OrderItem{{Price: 9.5, Quantity: 2}, {Price: 3, Quantity: 1}}, taxRate: 0.13,
+            want: OrderTotals{Subtotal: 22, Tax: 2.86, Total: 24.86}},
+        {name: "rounded to cents", items: []OrderItem{{Price: 0.1, Quantity: 3}}, taxRate: 0.07,
+            want: OrderTotals{Subtotal: 0.3, Tax: 0.02, Total: 0.32}},
+        {name: "nothing ordered", want: OrderTotals{}},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            if got := PriceOrder(tc.items, tc.taxRate); got != tc.want {
+                t.Errorf("got %+v, want %+v", got, tc.want)
+            }
+        })
+    }
+}
+
+func TestParseOrderItemsRejectsNegativeAmounts(t *testing.T) {
+    for name, raw := range map[string]any{
+        "negative price":    []map[string]any{{"name": "margherita", "price": -1, "quantity": 1}},
+        "negative quantity": []map[string]any{{"name": "margherita", "price": 10, "quantity": -2}},
+        "not a list":        "margherita",
+    } {
+        if _, err := ParseOrderItems(raw); !errors.Is(err, ErrInvalidItems) {
+            t.Errorf("%s: got %v, want ErrInvalidItems", name, err)
+        }
+    }
+
+    items, err := ParseOrderItems([]map[string]any{{"name": "margherita", "price": 9.5, "quantity": 2}})
+    if err != nil || len(items) != 1 || items[0] != (OrderItem{Name: "margherita", Price: 9.5, Quantity: 2}) {
+        t.Errorf("got %+v, %v", items, err)
+    }
+}
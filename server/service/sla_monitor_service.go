@@ -0,0 +1,130 @@
+package service
+
+import (
+    "context"
+    "fmt"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/everestp/pizza-shop/logger"
+    "github.com/everestp/pizza-shop/utils"
+)
+
+// SLAEscalation is raised once per order and status when the order sits in
+// that status for longer than its configured limit.
+type SLAEscalation struct {
+    Type      string    `json:"type"` // Always "sla_breach"
+    OrderNo   string    `json:"order_no"`
+    OwnerID   string    `json:"customer_id"`
+    Status    string    `json:"order_status"`
+    LimitMs   int64     `json:"limit_ms"`
+    ElapsedMs int64     `json:"elapsed_ms"`
+    Timestamp time.Time `json:"timestamp"`
+    Tags      []string  `json:"tags,omitempty"`
+}
+
+// ParseSLAs reads ORDER_SLAS, e.g. "ordered=30s,preparing=10m".
+// Statuses without an entry have no limit.
+func ParseSLAs(raw string) (map[string]time.Duration, error) {
+    slas := make(map[string]time.Duration)
+    for _, rule := range strings.Split(raw, ",") {
+        rule = strings.TrimSpace(rule)
+        if rule == "" {
+            continue
+        }
+        status, limit, found := strings.Cut(rule, "=")
+        if !found {
+            return nil, fmt.Errorf("invalid SLA rule %q: expected status=duration", rule)
+        }
+        duration, err := time.ParseDuration(strings.TrimSpace(limit))
+        if err != nil || duration <= 0 {
+            return nil, fmt.Errorf("invalid SLA duration in %q", rule)
+        }
+        slas[strings.ToLower(strings.TrimSpace(status))] = duration
+    }
+    return slas, nil
+}
+
+// SLAMonitor periodically scans the order store for orders stuck in a status.
+type SLAMonitor struct {
+    store     IOrderStore
+    slas      map[string]time.Duration // Max time allowed in each status
+    notify    func(SLAEscalation)      // Where escalations go (e.g. the admin alert sockets)
+    interval  time.Duration            // How often we scan
+    escalated map[string]bool          // "order_no:status" already escalated, so we alert once
+    mutex     sync.Mutex               // Guards 'escalated'
+}
+
+// Start scans on every tick until ctx is cancelled.
+func (sm *SLAMonitor) Start(ctx context.Context) {
+    if len(sm.slas) == 0 {
+        return
+    }
+    ticker := time.NewTicker(sm.interval)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+            sm.Check()
+        }
+    }
+}
+
+// Check escalates every order that has overstayed its current status and returns the escalations.
+func (sm *SLAMonitor) Check() []SLAEscalation {
+    now := utils.Clock.Now()
+    escalations := []SLAEscalation{}
+
+    sm.mutex.Lock()
+    for _, order := range sm.store.All() {
+        limit, ok := sm.slas[order.Status]
+        if !ok {
+            continue
+        }
+        enteredAt, ok := order.StatusEnteredAt[order.Status]
+        if !ok {
+            continue
+        }
+        elapsed := now.Sub(enteredAt)
+        key := order.OrderNo + ":" + order.Status
+        if elapsed <= limit || sm.escalated[key] {
+            continue
+        }
+        sm.escalated[key] = true
+        escalations = append(escalations, SLAEscalation{
+            Type:      "sla_breach",
+            OrderNo:   order.OrderNo,
+            OwnerID:   order.OwnerID,
+            Status:    order.Status,
+            LimitMs:   limit.Milliseconds(),
+            ElapsedMs: elapsed.Milliseconds(),
+            Timestamp: now,
+            Tags:      order.Tags,
+        })
+    }
+    sm.mutex.Unlock()
+
+    for _, escalation := range escalations {
+        logger.Log(fmt.Sprintf("SLA BREACH: order #%s has been %q for %dms (limit %dms)",
+            escalation.OrderNo, escalation.Status, escalation.ElapsedMs, escalation.LimitMs))
+        if sm.notify != nil {
+            sm.notify(escalation)
+        }
+    }
+    return escalations
+}
+
+// GetSLAMonitor is the Constructor.
+func GetSLAMonitor(store IOrderStore, slas map[string]time.Duration, interval time.Duration, notify func(SLAEscalation)) *SLAMonitor {
+    return &SLAMonitor{
+        store:     store,
+        slas:      slas,
+        notify:    notify,
+        interval:  interval,
+        escalated: make(map[string]bool),
+    }
+}
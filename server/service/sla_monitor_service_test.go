@@ -0,0 +1,75 @@
+package service
+
+import (
+    "context"
+    "testing"
+    "time"
+
+    "github.com/everestp/pizza-shop/constants"
+)
+
+func TestStuckOrderIsEscalatedOnce(t *testing.T) {
+    store := GetOrderStore()
+    escalations := make(chan SLAEscalation, 10)
+    slas := map[string]time.Duration{constants.ORDER_ORDERED: 30 * time.Millisecond, constants.ORDER_PREPARING: time.Hour}
+    monitor := GetSLAMonitor(store, slas, 5*time.Millisecond, func(e SLAEscalation) { escalations <- e })
+
+    store.Save(Order{OrderNo: "STUCK", OwnerID: "alice", Status: constants.ORDER_ORDERED})
+    store.Save(Order{OrderNo: "MOVING", OwnerID: "bob", Status: constants.ORDER_ORDERED})
+    store.UpdateStatus("MOVING", constants.ORDER_PREPARING) // Well within its SLA
+
+    // The monitor reads utils.Clock: it must be gone before a later test swaps the clock.
+    ctx, cancel := context.WithCancel(context.Background())
+    stopped := make(chan struct{})
+    go func() {
+        defer close(stopped)
+        monitor.Start(ctx)
+    }()
+    t.Cleanup(func() {
+        cancel()
+        <-stopped
+    })
+
+    select {
+    case escalation := <-escalations:
+        if escalation.OrderNo != "STUCK" || escalation.Status != constants.ORDER_ORDERED || escalation.ElapsedMs < 30 || escalation.LimitMs != 30 {
+            t.Errorf("got %+v, want STUCK escalated for its ordered SLA", escalation)
+        }
+    case <-time.After(time.Second):
+        t.Fatal("the stuck order was never escalated")
+    }
+
+    // Many more scans go by: neither a second alert for STUCK nor any for MOVING.
+    select {
+    case escalation := <-escalations:
+        t.Errorf("unexpected escalation %+v", escalation)
+    case <-time.After(60 * time.Millisecond):
+    }
+}
+
+func TestNoSLAsMeansNoMonitor(t *testing.T) {
+    monitor := GetSLAMonitor(GetOrderStore(), map[string]time.Duration{}, time.Millisecond, nil)
+
+    done := make(chan struct{})
+    go func() {
+        monitor.Start(context.Background()) // Must return at once: there is nothing to watch
+        close(done)
+    }()
+    select {
+    case <-done:
+    case <-time.After(time.Second):
+        t.Fatal("the monitor kept running without any SLA")
+    }
+}
+
+func TestParseSLAs(t *testing.T) {
+    slas, err := ParseSLAs(" Ordered=30s, preparing=10m ,")
+    if err != nil || slas[constants.ORDER_ORDERED] != 30*time.Second || slas[constants.ORDER_PREPARING] != 10*time.Minute || len(slas) != 2 {
+        t.Errorf("got %v, %v", slas, err)
+    }
+    for _, raw := range []string{"ordered", "ordered=soon", "ordered=-1s"} {
+        if _, err := ParseSLAs(raw); err == nil {
+            t.Errorf("%q: got no error", raw)
+        }
+    }
+}
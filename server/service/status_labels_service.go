@@ -0,0 +1,94 @@
+package service
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "strings"
+)
+
+// ErrUnknownStatusLabel means an incoming event's "order_status" is neither one of
+// ORDER_STATUS_LABELS' external labels nor one of our own statuses.
+var ErrUnknownStatusLabel = errors.New("unknown order status label")
+
+// StatusLabels translates between our order statuses and the labels an existing POS uses.
+// ORDER_STATUS_LABELS maps ours to theirs as a JSON object, e.g.
+// {"ordered":"NEW","preparing":"IN_KITCHEN","delivered":"COMPLETED"}.
+// Events coming off the queue are translated to our statuses before anything looks at them;
+// the order webhook translates them back. Everything in between (and the customer app)
+// only ever sees our own statuses. Without a mapping, nothing is translated.
+type StatusLabels struct {
+    inbound  map[string]string // Their label -> our status
+    outbound map[string]string // Our status -> their label
+}
+
+// Inbound returns our status for an incoming label. Our own statuses pass through
+// (we consume the events we publish), anything else is ErrUnknownStatusLabel.
+func (sl *StatusLabels) Inbound(label string) (string, error) {
+    if sl == nil || len(sl.inbound) == 0 {
+        return label, nil
+    }
+    if status, ok := sl.inbound[label]; ok {
+        return status, nil
+    }
+    if _, ok := defaultTransitions[label]; ok {
+        return label, nil
+    }
+    return "", fmt.Errorf("%w: %q", ErrUnknownStatusLabel, label)
+}
+
+// Outbound returns the external label for one of our statuses (itself when it isn't mapped).
+func (sl *StatusLabels) Outbound(status string) string {
+    if sl == nil {
+        return status
+    }
+    if label, ok := sl.outbound[status]; ok {
+        return label
+    }
+    return status
+}
+
+// OutboundEvent returns a copy of the event with its "order_status" translated for the outside.
+func (sl *StatusLabels) OutboundEvent(event map[string]interface{}) map[string]interface{} {
+    status, ok := event["order_status"].(string)
+    if !ok || sl.Outbound(status) == status {
+        return event
+    }
+    translated := make(map[string]interface{}, len(event))
+    for key, value := range event {
+        translated[key] = value
+    }
+    translated["order_status"] = sl.Outbound(status)
+    return translated
+}
+
+// ParseStatusLabels reads ORDER_STATUS_LABELS. Every key must be one of our statuses,
+// and every label non-empty and used once, so both directions are unambiguous.
+func ParseStatusLabels(raw string) (*StatusLabels, error) {
+    labels := &StatusLabels{
+        inbound:  make(map[string]string),
+        outbound: make(map[string]string),
+    }
+    if strings.TrimSpace(raw) == "" {
+        return labels, nil
+    }
+
+    var mapping map[string]string
+    if err := json.Unmarshal([]byte(raw), &mapping); err != nil {
+        return nil, fmt.Errorf("ORDER_STATUS_LABELS must be a JSON object of status to label: %w", err)
+    }
+    for status, label := range mapping {
+        if _, ok := defaultTransitions[status]; !ok {
+            return nil, fmt.Errorf("ORDER_STATUS_LABELS: %q is not an order status", status)
+        }
+        if label == "" {
+            return nil, fmt.Errorf("ORDER_STATUS_LABELS: %q has an empty label", status)
+        }
+        if other, taken := labels.inbound[label]; taken {
+            return nil, fmt.Errorf("ORDER_STATUS_LABELS: %q is the label of both %q and %q", label, other, status)
+        }
+        labels.inbound[label] = status
+        labels.outbound[status] = label
+    }
+    return labels, nil
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+    "encoding/json"
+    "errors"
+    "strings"
+    "testing"
+
+    "github.com/everestp/pizza-shop/constants"
+)
+
+const posLabels = `{"ordered":"NEW","preparing":"IN_KITCHEN","delivered":"COMPLETED"}`
+
+// mustParseLabels parses ORDER_STATUS_LABELS, failing the test if it is broken.
+func mustParseLabels(t *testing.T, raw string) *StatusLabels {
+    t.Helper()
+
+    labels, err := ParseStatusLabels(raw)
+    if err != nil {
+        t.Fatalf("parse %q: %v", raw, err)
+    }
+    return labels
+}
+
+func TestStatusLabelsTranslateBothWays(t *testing.T) {
+    labels, err := ParseStatusLabels(posLabels)
+    if err != nil {
+        t.Fatalf("parse: %v", err)
+    }
+
+    inbound := map[string]string{
+        "NEW":                     constants.ORDER_ORDERED,
+        "IN_KITCHEN":              constants.ORDER_PREPARING,
+        "COMPLETED":               constants.ORDER_DELIVERED,
+        constants.ORDER_PREPARED:  constants.ORDER_PREPARED, // One of ours, from our own publishes
+        constants.ORDER_PREPARING: constants.ORDER_PREPARING,
+    }
+    for label, want := range inbound {
+        if got, err := labels.Inbound(label); err != nil || got != want {
+            t.Errorf("inbound %q: got %q, %v; want %q", label, got, err, want)
+        }
+    }
+    if _, err := labels.Inbound("EN_ROUTE"); !errors.Is(err, ErrUnknownStatusLabel) || !strings.Contains(err.Error(), "EN_ROUTE") {
+        t.Errorf("unmapped label: got %v, want ErrUnknownStatusLabel naming it", err)
+    }
+
+    outbound := map[string]string{
+        constants.ORDER_ORDERED:   "NEW",
+        constants.ORDER_DELIVERED: "COMPLETED",
+        constants.ORDER_PREPARED:  constants.ORDER_PREPARED, // Not mapped: sent as ours
+    }
+    for status, want := range outbound {
+        if got := labels.Outbound(status); got != want {
+            t.Errorf("outbound %q: got %q, want %q", status, got, want)
+        }
+    }
+}
+
+func TestNoLabelsTranslateNothing(t *testing.T) {
+    for name, labels := range map[string]*StatusLabels{"unset": nil, "empty": mustParseLabels(t, "")} {
+        if got, err := labels.Inbound("EN_ROUTE"); err != nil || got != "EN_ROUTE" {
+            t.Errorf("%s: inbound got %q, %v; want it untouched", name, got, err)
+        }
+        if got := labels.Outbound(constants.ORDER_ORDERED); got != constants.ORDER_ORDERED {
+            t.Errorf("%s: outbound got %q", name, got)
+        }
+    }
+}
+
+func TestBrokenStatusLabelsAreRefused(t *testing.T) {
+    cases := map[string]string{
+        "not json":         `ordered=NEW`,
+        "unknown status":   `{"baking":"IN_OVEN"}`,
+        "empty label":      `{"ordered":""}`,
+        "label used twice": `{"ordered":"NEW","preparing":"NEW"}`,
+    }
+    for name, raw := range cases {
+        if _, err := ParseStatusLabels(raw); err == nil || !strings.Contains(err.Error(), "ORDER_STATUS_LABELS") {
+            t.Errorf("%s: got %v, want an ORDER_STATUS_LABELS error", name, err)
+        }
+    }
+}
+
+func TestOutboundEventIsACopy(t *testing.T) {
+    labels := mustParseLabels(t, posLabels)
+    event := map[string]interface{}{"order_no": "A1", "order_status": constants.ORDER_DELIVERED}
+
+    translated := labels.OutboundEvent(event)
+    if translated["order_status"] != "COMPLETED" || translated["order_no"] != "A1" {
+        t.Errorf("got %v", translated)
+    }
+    if event["order_status"] != constants.ORDER_DELIVERED {
+        t.Errorf("the original event was changed to %v", event["order_status"])
+    }
+}
+
+func TestProcessorSpeaksOurStatusesInside(t *testing.T) {
+    tp := newTestProcessor(t)
+    tp.SetStatusLabels(mustParseLabels(t, posLabels))
+    tp.store.Save(Order{OrderNo: "A1", OwnerID: "alice", Status: constants.ORDER_ORDERED})
+
+    // The POS's "NEW" is our "ordered": the kitchen takes it and moves it on.
+    if err := tp.deliver(t, "", orderEvent(t, "A1", "NEW")); err != nil {
+        t.Fatalf("process NEW: %v", err)
+    }
+    next := tp.published()
+    var event map[string]any
+    if next == nil || json.Unmarshal(next.Body, &event) != nil || event["order_status"] != constants.ORDER_PREPARING {
+        t.Fatalf("published %v, want the order moved on to preparing", event)
+    }
+
+    // A label nobody mapped is rejected, not guessed at.
+    err := tp.deliver(t, "", orderEvent(t, "A1", "EN_ROUTE"))
+    if !errors.Is(err, ErrUnknownStatusLabel) {
+        t.Fatalf("got %v, want ErrUnknownStatusLabel", err)
+    }
+    if tp.settled.rejects != 1 {
+        t.Errorf("settled %+v, want the unmapped label dead-lettered", tp.settled)
+    }
+}
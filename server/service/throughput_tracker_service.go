@@ -0,0 +1,82 @@
+package service
+
+import (
+    "fmt"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    "github.com/everestp/pizza-shop/logger"
+    "github.com/everestp/pizza-shop/utils"
+)
+
+// ThroughputTracker counts processed messages and logs the rate every 'interval'
+// (CONSUMER_RATE_LOG_INTERVAL seconds, default 60; 0 = count but never log).
+// It is a cheap pulse for when there is no metrics stack to look at.
+type ThroughputTracker struct {
+    processed   atomic.Int64 // Messages processed since the window started
+    windowStart atomic.Int64 // Unix nanos (from utils.Clock) when the current window started
+    interval    time.Duration
+    startOnce   sync.Once
+}
+
+// ThroughputReport is the rate over one finished window.
+type ThroughputReport struct {
+    Processed int64
+    Window    time.Duration
+    PerSecond float64
+    PerMinute float64
+}
+
+// Record counts one processed message. Safe to call from every worker at once.
+func (tt *ThroughputTracker) Record() {
+    tt.processed.Add(1)
+}
+
+// Report returns the rate since the last report and starts a new window.
+// A message recorded while it runs is counted in one window or the other, never lost.
+func (tt *ThroughputTracker) Report() ThroughputReport {
+    now := utils.Clock.Now()
+    started := time.Unix(0, tt.windowStart.Swap(now.UnixNano()))
+    processed := tt.processed.Swap(0)
+
+    report := ThroughputReport{Processed: processed, Window: now.Sub(started)}
+    if seconds := report.Window.Seconds(); seconds > 0 {
+        report.PerSecond = float64(processed) / seconds
+        report.PerMinute = report.PerSecond * 60
+    }
+    return report
+}
+
+// start begins logging for 'label' until 'stop' is closed. Only the first call does anything,
+// so a consumer can call it from every ConsumeEventAndProcess.
+func (tt *ThroughputTracker) start(label string, stop <-chan struct{}) {
+    if tt.interval <= 0 {
+        return
+    }
+    tt.startOnce.Do(func() {
+        tt.Report() // Start the first window now
+        go func() {
+            ticker := time.NewTicker(tt.interval)
+            defer ticker.Stop()
+
+            for {
+                select {
+                case <-stop:
+                    return
+                case <-ticker.C:
+                    report := tt.Report()
+                    logger.Log(fmt.Sprintf("Throughput [%s]: %d messages in %v (%.2f/s, %.1f/min)",
+                        label, report.Processed, report.Window.Round(time.Second), report.PerSecond, report.PerMinute))
+                }
+            }
+        }()
+    })
+}
+
+// GetThroughputTracker is the Constructor.
+func GetThroughputTracker(interval time.Duration) *ThroughputTracker {
+    tt := &ThroughputTracker{interval: interval}
+    tt.windowStart.Store(utils.Clock.Now().UnixNano())
+    return tt
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+    "math"
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/everestp/pizza-shop/utils"
+)
+
+func TestThroughputIsMeasuredOnTheClock(t *testing.T) {
+    clock := &manualClock{now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+    utils.Clock = clock
+    t.Cleanup(func() { utils.Clock = utils.RealClock{} })
+
+    tracker := GetThroughputTracker(0)
+    var wg sync.WaitGroup
+    for worker := 0; worker < 6; worker++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for i := 0; i < 50; i++ {
+                tracker.Record()
+            }
+        }()
+    }
+    wg.Wait()
+    clock.now = clock.now.Add(30 * time.Second)
+
+    report := tracker.Report()
+    if report.Processed != 300 || report.Window != 30*time.Second {
+        t.Fatalf("got %d messages in %v, want 300 in 30s", report.Processed, report.Window)
+    }
+    if math.Abs(report.PerSecond-10) > 0.01 || math.Abs(report.PerMinute-600) > 0.1 {
+        t.Errorf("got %.2f/s and %.1f/min, want 10/s and 600/min", report.PerSecond, report.PerMinute)
+    }
+
+    // The report started a new window: only what came after it counts.
+    for i := 0; i < 5; i++ {
+        tracker.Record()
+    }
+    clock.now = clock.now.Add(10 * time.Second)
+    report = tracker.Report()
+    if report.Processed != 5 || report.Window != 10*time.Second || math.Abs(report.PerSecond-0.5) > 0.01 {
+        t.Errorf("second window: got %+v, want 5 messages in 10s", report)
+    }
+}
+
+func TestThroughputOfAnEmptyWindowIsZero(t *testing.T) {
+    clock := &manualClock{now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+    utils.Clock = clock
+    t.Cleanup(func() { utils.Clock = utils.RealClock{} })
+
+    tracker := GetThroughputTracker(0)
+    if report := tracker.Report(); report.Processed != 0 || report.PerSecond != 0 {
+        t.Errorf("got %+v for a window with no time and no messages", report)
+    }
+}
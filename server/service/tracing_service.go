@@ -0,0 +1,82 @@
+package service
+
+import (
+    "context"
+    "fmt"
+
+    "github.com/everestp/pizza-shop/logger"
+    "github.com/rabbitmq/amqp091-go"
+    "go.opentelemetry.io/otel"
+    "go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+    "go.opentelemetry.io/otel/propagation"
+    sdktrace "go.opentelemetry.io/otel/sdk/trace"
+    "go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates our spans. Until InitTracing installs a provider it is a no-op,
+// so tracing costs nothing when no exporter is configured.
+var tracer = otel.Tracer("github.com/everestp/pizza-shop")
+
+// StartSpan starts a span for code outside the service package (e.g. HTTP handlers).
+func StartSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+    return tracer.Start(ctx, name)
+}
+
+// InitTracing installs the tracer provider picked by OTEL_TRACES_EXPORTER.
+// "stdout" prints finished spans as JSON; anything else (or unset) keeps tracing off.
+// The returned function flushes pending spans on shutdown.
+func InitTracing(exporter string) func(ctx context.Context) error {
+    // W3C traceparent headers travel with every message, even with tracing off,
+    // so an upstream trace is never dropped by this service.
+    otel.SetTextMapPropagator(propagation.TraceContext{})
+
+    if exporter != "stdout" {
+        return func(ctx context.Context) error { return nil }
+    }
+    spanExporter, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+    if err != nil {
+        logger.Log(fmt.Sprintf("Tracing disabled, failed to create exporter: %v", err))
+        return func(ctx context.Context) error { return nil }
+    }
+    provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(spanExporter))
+    otel.SetTracerProvider(provider)
+    logger.Log("Tracing enabled (stdout exporter)")
+    return provider.Shutdown
+}
+
+// amqpHeaderCarrier lets the propagator read and write AMQP message headers.
+type amqpHeaderCarrier amqp091.Table
+
+func (c amqpHeaderCarrier) Get(key string) string {
+    value, _ := c[key].(string)
+    return value
+}
+
+func (c amqpHeaderCarrier) Set(key string, value string) {
+    c[key] = value
+}
+
+func (c amqpHeaderCarrier) Keys() []string {
+    keys := make([]string, 0, len(c))
+    for key := range c {
+        keys = append(keys, key)
+    }
+    return keys
+}
+
+// InjectTraceContext writes the trace in ctx into the headers of an outgoing message.
+func InjectTraceContext(ctx context.Context, headers amqp091.Table) amqp091.Table {
+    if headers == nil {
+        headers = amqp091.Table{}
+    }
+    otel.GetTextMapPropagator().Inject(ctx, amqpHeaderCarrier(headers))
+    return headers
+}
+
+// ExtractTraceContext continues the trace found in a delivery's headers (if any).
+func ExtractTraceContext(ctx context.Context, headers amqp091.Table) context.Context {
+    if headers == nil {
+        return ctx
+    }
+    return otel.GetTextMapPropagator().Extract(ctx, amqpHeaderCarrier(headers))
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+    "context"
+    "sync"
+    "testing"
+
+    "github.com/everestp/pizza-shop/constants"
+    "go.opentelemetry.io/otel"
+    sdktrace "go.opentelemetry.io/otel/sdk/trace"
+    "go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var (
+    recordedSpans     = tracetest.NewInMemoryExporter()
+    installSpanRecord sync.Once
+)
+
+// recordSpans sends every finished span to an in-memory exporter and empties it.
+// The global provider is installed only once per process: package tracers
+// (like 'tracer') keep delegating to the first one.
+func recordSpans() *tracetest.InMemoryExporter {
+    installSpanRecord.Do(func() {
+        InitTracing("") // Only the propagator: no exporter configured
+        otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(recordedSpans)))
+    })
+    recordedSpans.Reset()
+    return recordedSpans
+}
+
+func TestTraceContinuesFromPublishToProcessing(t *testing.T) {
+    spans := recordSpans()
+
+    tp := newTestProcessor(t)
+    tp.store.Save(Order{OrderNo: "A1", OwnerID: "alice", Status: constants.ORDER_ORDERED})
+    publisher := GetMemoryPublisher(tp.broker)
+
+    ctx, root := StartSpan(context.Background(), "create order")
+    err := publisher.PublishEventWithOptions(PublishOptions{RoutingKey: constants.KITCHEN_ORDER_QUEUE, Context: ctx},
+        map[string]any{"order_no": "A1", "order_status": constants.ORDER_ORDERED, "customer_id": "alice"})
+    root.End()
+    if err != nil {
+        t.Fatalf("publish: %v", err)
+    }
+
+    delivery := tp.published()
+    if delivery == nil || delivery.Headers["traceparent"] == nil {
+        t.Fatalf("got %+v, want the trace in the message headers", delivery)
+    }
+    delivery.Acknowledger = tp.settled
+    if err := tp.ProcessMessage(context.Background(), *delivery); err != nil {
+        t.Fatalf("process: %v", err)
+    }
+
+    var handled *tracetest.SpanStub
+    for _, span := range spans.GetSpans() {
+        if span.Name == "handle "+constants.ORDER_ORDERED {
+            handled = &span
+        }
+    }
+    if handled == nil {
+        t.Fatalf("no handler span among %d span(s)", len(spans.GetSpans()))
+    }
+    rootContext := root.SpanContext()
+    if handled.SpanContext.TraceID() != rootContext.TraceID() || handled.Parent.SpanID() != rootContext.SpanID() {
+        t.Errorf("the handler span is not a child of the publisher's span")
+    }
+
+    // The next step carries the same trace onward.
+    next := tp.published()
+    if next == nil {
+        t.Fatal("the next step was not published")
+    }
+    continued := ExtractTraceContext(context.Background(), next.Headers)
+    if _, span := StartSpan(continued, "next"); span.SpanContext().TraceID() != rootContext.TraceID() {
+        t.Error("the next step's message lost the trace")
+    }
+}
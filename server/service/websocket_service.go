@@ -1,36 +1,117 @@
 package service
 
 import (
+    "context"
+    "encoding/binary"
+    "encoding/json"
     "sync"
+    "time"
 
+    "github.com/everestp/pizza-shop/config"
     "github.com/gorilla/websocket"
 )
 
+// MarshalWebSocketMessage encodes one frame for the browser.
+// WS_PRETTY_JSON=true indents it for reading in dev tools; production stays compact.
+func MarshalWebSocketMessage(data any) ([]byte, error) {
+    if config.GetEnvPropertyAsBool("ws_pretty_json", false) {
+        return json.MarshalIndent(data, "", "  ")
+    }
+    return json.Marshal(data)
+}
+
 // 1. The Interface (Abstraction)
 // This allows you to swap the 'gorilla/websocket' library for another 
 // one in the future without changing your business logic.
 type IWebSocketConnection interface {
+    // SendMessage sends a frame of the connection's default type (text unless SetBinary was called).
     SendMessage(message []byte) error
+    // SendBinary always sends a binary frame (e.g. msgpack-encoded dashboard updates).
+    SendBinary(message []byte) error
     ReceivedMessage() ([]byte, error)
     Close() error
+    // Ping sends a ping control frame; an error means the client can no longer be written to.
+    Ping() error
+    // Context is cancelled when the connection closes (or its parent, e.g. shutdown, is cancelled).
+    // Every goroutine working for this connection should stop when it is done.
+    Context() context.Context
+    // Metadata says who is on the other end (for logs and the admin connections list).
+    Metadata() ConnectionMetadata
+}
+
+// CloseWith closes the connection with this close code and reason when it can send them
+// (see WebSocketConnection.CloseWith), and with a plain Close otherwise.
+func CloseWith(connection IWebSocketConnection, code int, reason string) error {
+    if closer, ok := connection.(interface{ CloseWith(code int, reason string) error }); ok {
+        return closer.CloseWith(code, reason)
+    }
+    return connection.Close()
+}
+
+// ConnectionMetadata is captured from the HTTP request that opened the socket.
+type ConnectionMetadata struct {
+    ConnectedAt time.Time `json:"connected_at"`
+    RemoteAddr  string    `json:"remote_addr"`
+    UserAgent   string    `json:"user_agent"`
 }
 
 // 2. The Wrapper Struct
 // We wrap the raw *websocket.Conn to add extra safety (Mutex).
+// Every frame we send goes through write(), so the framing settings apply to all of them
+// (welcome, updates, replies, errors), for clients behind proxies that need it:
+//   - WS_FRAME_TYPE: "text" (default) or "binary" frames.
+//   - WS_LENGTH_PREFIX=true: each payload starts with its length as a 4-byte big-endian
+//     number. Such frames always go out binary, since the prefix isn't valid text.
 type WebSocketConnection struct {
-    conn  *websocket.Conn
-    mutex sync.Mutex // Vital for thread-safety
+    conn         *websocket.Conn
+    mutex        sync.Mutex         // Vital for thread-safety
+    writeTimeout time.Duration      // A stalled client can't block a writer for longer than this
+    ctx          context.Context    // Shared cancellation signal for this connection's goroutines
+    cancel       context.CancelFunc // Called by Close
+    metadata     ConnectionMetadata // When and from where the client connected
+    closeOnce    sync.Once          // Close may be called by the handler, the reaper and shutdown
+    closeErr     error
+    messageType  int                // What SendMessage sends: websocket.TextMessage (default) or BinaryMessage
+    lengthPrefix bool               // WS_LENGTH_PREFIX: prefix every payload with its length
 }
 
 // SendMessage sends data from the SERVER to the CLIENT (Browser).
 func (ws *WebSocketConnection) SendMessage(message []byte) error {
+    return ws.write(ws.messageType, message)
+}
+
+// SendBinary sends data as a binary frame, whatever the connection's default is.
+func (ws *WebSocketConnection) SendBinary(message []byte) error {
+    return ws.write(websocket.BinaryMessage, message)
+}
+
+// SetBinary makes SendMessage send binary frames (true) or text frames (false, the default
+// unless WS_FRAME_TYPE=binary).
+// Set it before the connection is shared; it is not guarded by the mutex.
+func (ws *WebSocketConnection) SetBinary(binary bool) {
+    ws.messageType = websocket.TextMessage
+    if binary {
+        ws.messageType = websocket.BinaryMessage
+    }
+}
+
+// write sends one frame of the given type, framed as configured.
+func (ws *WebSocketConnection) write(messageType int, message []byte) error {
+    if ws.lengthPrefix {
+        framed := make([]byte, 4, 4+len(message))
+        binary.BigEndian.PutUint32(framed, uint32(len(message)))
+        message = append(framed, message...)
+        messageType = websocket.BinaryMessage
+    }
+
     // WebSockets in Go are not safe for concurrent writes.
     // The Mutex ensures that if two processes try to send a message 
     // at the exact same time, they wait in line instead of crashing.
     ws.mutex.Lock()
     defer ws.mutex.Unlock()
     
-    return ws.conn.WriteMessage(websocket.TextMessage, message)
+    ws.conn.SetWriteDeadline(time.Now().Add(ws.writeTimeout))
+    return ws.conn.WriteMessage(messageType, message)
 }
 
 // ReceivedMessage listens for data coming from the CLIENT to the SERVER.
@@ -44,14 +125,89 @@ func (ws *WebSocketConnection) ReceivedMessage() ([]byte, error) {
     return msg, err
 }
 
-// Close cleanly terminates the connection.
+// Close cleanly terminates the connection with a plain "normal closure" frame.
+// Callers that know why the connection ends (e.g. shutdown) say so with CloseWith.
 func (ws *WebSocketConnection) Close() error {
-    return ws.conn.Close()
+    return ws.CloseWith(websocket.CloseNormalClosure, "")
+}
+
+// CloseWith cleanly terminates the connection.
+// It first sends a close frame with this code and reason, so the browser knows why
+// (instead of seeing an abrupt network error), then closes the socket.
+// Only the first call does anything; later calls return the same result.
+func (ws *WebSocketConnection) CloseWith(code int, reason string) error {
+    ws.closeOnce.Do(func() {
+        ws.cancel()
+
+        ws.mutex.Lock()
+        frame := websocket.FormatCloseMessage(code, reason)
+        ws.conn.WriteControl(websocket.CloseMessage, frame, time.Now().Add(time.Second))
+        ws.mutex.Unlock()
+
+        ws.closeErr = ws.conn.Close()
+    })
+    return ws.closeErr
+}
+
+// Ping sends an empty ping frame, giving up after the write timeout.
+// WriteControl may run alongside other writes, so no lock is needed.
+func (ws *WebSocketConnection) Ping() error {
+    return ws.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(ws.writeTimeout))
+}
+
+// Context returns the connection's context.
+func (ws *WebSocketConnection) Context() context.Context {
+    return ws.ctx
+}
+
+// Metadata returns when and from where the client connected.
+func (ws *WebSocketConnection) Metadata() ConnectionMetadata {
+    return ws.metadata
+}
+
+// keepAlive pings the client every 'interval' until the connection's context ends,
+// so idle proxies don't drop the socket and dead clients are noticed.
+func (ws *WebSocketConnection) keepAlive(interval time.Duration) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-ws.ctx.Done():
+            return
+        case <-ticker.C:
+            if err := ws.Ping(); err != nil {
+                ws.cancel()
+                return
+            }
+        }
+    }
 }
 
 // NewWebSocketConnection is the constructor.
-func NewWebSocketConnection(conn *websocket.Conn) *WebSocketConnection {
-    return &WebSocketConnection{
-        conn: conn,
+// The connection's context is derived from 'parent', so cancelling the parent
+// (e.g. on shutdown) winds down this connection's goroutines too.
+func NewWebSocketConnection(parent context.Context, conn *websocket.Conn, metadata ConnectionMetadata) *WebSocketConnection {
+    ctx, cancel := context.WithCancel(parent)
+    ws := &WebSocketConnection{
+        conn:         conn,
+        metadata:     metadata,
+        writeTimeout: time.Duration(config.GetEnvPropertyAsInt("ws_write_timeout", 5000)) * time.Millisecond,
+        ctx:          ctx,
+        cancel:       cancel,
+        messageType:  websocket.TextMessage,
+        lengthPrefix: config.GetEnvPropertyAsBool("ws_length_prefix", false),
+    }
+    ws.SetBinary(config.GetEnvProperty("ws_frame_type") == "binary")
+
+    // Frames above WS_MAX_FRAME_BYTES (default 32 KiB) fail the read with websocket.ErrReadLimit,
+    // after gorilla has sent a "message too big" close frame, so one client can't exhaust memory.
+    conn.SetReadLimit(int64(config.GetEnvPropertyAsInt("ws_max_frame_bytes", 32*1024)))
+
+    // A blocked ReadMessage doesn't watch the context; an expired deadline makes it return.
+    context.AfterFunc(ctx, func() { conn.SetReadDeadline(time.Now()) })
+    if interval := config.GetEnvPropertyAsInt("ws_ping_interval", 0); interval > 0 {
+        go ws.keepAlive(time.Duration(interval) * time.Second)
     }
+    return ws
 }
\ No newline at end of file
@@ -0,0 +1,275 @@
+package service
+
+import (
+    "context"
+    "net/http"
+    "net/http/httptest"
+    "runtime"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/gorilla/websocket"
+)
+
+// dialSocket connects to a server that upgrades and then just holds the socket open.
+func dialSocket(t *testing.T) *websocket.Conn {
+    t.Helper()
+    return dialRecordingSocket(t, nil)
+}
+
+// receivedFrame is one frame the test server read off the socket.
+type receivedFrame struct {
+    messageType int
+    data        string
+}
+
+// dialRecordingSocket is dialSocket, but the server passes every frame it reads to 'frames' (if not nil).
+func dialRecordingSocket(t *testing.T, frames chan<- receivedFrame) *websocket.Conn {
+    t.Helper()
+
+    upgrader := websocket.Upgrader{}
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        conn, err := upgrader.Upgrade(w, r, nil)
+        if err != nil {
+            return
+        }
+        defer conn.Close()
+        for {
+            messageType, data, err := conn.ReadMessage()
+            if err != nil {
+                return
+            }
+            if frames != nil {
+                frames <- receivedFrame{messageType: messageType, data: string(data)}
+            }
+        }
+    }))
+    t.Cleanup(server.Close)
+
+    conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+    if err != nil {
+        t.Fatalf("dial: %v", err)
+    }
+    return conn
+}
+
+// startReading blocks in ReceivedMessage in the background, like the handler's read loop.
+func startReading(ws *WebSocketConnection) <-chan error {
+    done := make(chan error, 1)
+    go func() {
+        for {
+            if _, err := ws.ReceivedMessage(); err != nil {
+                done <- err
+                return
+            }
+        }
+    }()
+    return done
+}
+
+func TestClosingTheConnectionStopsAllItsGoroutines(t *testing.T) {
+    withEnv(t, map[string]string{"WS_PING_INTERVAL": "1"}) // Also run the keep-alive goroutine
+    conn := dialSocket(t)
+    before := runtime.NumGoroutine()
+
+    ws := NewWebSocketConnection(context.Background(), conn, ConnectionMetadata{})
+    reading := startReading(ws)
+    ws.Close()
+
+    select {
+    case <-ws.Context().Done():
+    default:
+        t.Fatal("Close didn't cancel the connection's context")
+    }
+    select {
+    case <-reading:
+    case <-time.After(time.Second):
+        t.Fatal("the blocked read didn't return after Close")
+    }
+    deadline := time.Now().Add(time.Second)
+    for runtime.NumGoroutine() > before {
+        if time.Now().After(deadline) {
+            t.Fatalf("%d goroutine(s) before, %d after Close", before, runtime.NumGoroutine())
+        }
+        time.Sleep(5 * time.Millisecond)
+    }
+}
+
+func TestCancelledParentEndsTheConnection(t *testing.T) {
+    conn := dialSocket(t)
+    t.Cleanup(func() { conn.Close() })
+    parent, shutdown := context.WithCancel(context.Background())
+
+    ws := NewWebSocketConnection(parent, conn, ConnectionMetadata{})
+    reading := startReading(ws)
+    shutdown()
+
+    select {
+    case <-reading:
+    case <-time.After(time.Second):
+        t.Fatal("the blocked read didn't return after the parent context was cancelled")
+    }
+    if ws.Context().Err() == nil {
+        t.Error("the connection's context outlived its parent")
+    }
+}
+
+func TestWebSocketMessagesArePrettyOnlyWhenAskedFor(t *testing.T) {
+    update := map[string]any{"message": "ready", "order_no": "A1"}
+    cases := []struct {
+        pretty string
+        want   string
+    }{
+        {pretty: "", want: `{"message":"ready","order_no":"A1"}`},
+        {pretty: "true", want: "{\n  \"message\": \"ready\",\n  \"order_no\": \"A1\"\n}"},
+    }
+    for _, tc := range cases {
+        t.Run("WS_PRETTY_JSON="+tc.pretty, func(t *testing.T) {
+            withEnv(t, map[string]string{"WS_PRETTY_JSON": tc.pretty})
+
+            frame, err := MarshalWebSocketMessage(update)
+            if err != nil || string(frame) != tc.want {
+                t.Errorf("got %q (%v), want %q", frame, err, tc.want)
+            }
+        })
+    }
+}
+
+func TestPingFailsOnceTheConnectionIsClosed(t *testing.T) {
+    ws := NewWebSocketConnection(context.Background(), dialSocket(t), ConnectionMetadata{})
+
+    if err := ws.Ping(); err != nil {
+        t.Fatalf("ping on a live socket: %v", err)
+    }
+    first := ws.Close()
+    // The reaper and the handler may both close it: the second call is a no-op.
+    if second := ws.Close(); second != first {
+        t.Errorf("second Close: got %v, want the first result %v", second, first)
+    }
+    if err := ws.Ping(); err == nil {
+        t.Error("ping on a closed socket succeeded")
+    }
+}
+
+func TestFramesGoOutWithTheRightOpcode(t *testing.T) {
+    cases := []struct {
+        name      string
+        frameType string
+        send      func(ws *WebSocketConnection) error
+        want      int
+    }{
+        {name: "text by default", send: func(ws *WebSocketConnection) error { return ws.SendMessage([]byte("hello")) }, want: websocket.TextMessage},
+        {name: "binary on request", send: func(ws *WebSocketConnection) error { return ws.SendBinary([]byte("hello")) }, want: websocket.BinaryMessage},
+        {name: "binary connection", frameType: "binary", send: func(ws *WebSocketConnection) error { return ws.SendMessage([]byte("hello")) }, want: websocket.BinaryMessage},
+        {name: "binary even on a text connection", frameType: "text", send: func(ws *WebSocketConnection) error { return ws.SendBinary([]byte("hello")) }, want: websocket.BinaryMessage},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            withEnv(t, map[string]string{"WS_FRAME_TYPE": tc.frameType})
+            frames := make(chan receivedFrame, 1)
+            ws := NewWebSocketConnection(context.Background(), dialRecordingSocket(t, frames), ConnectionMetadata{})
+            t.Cleanup(func() { ws.Close() })
+
+            if err := tc.send(ws); err != nil {
+                t.Fatalf("send: %v", err)
+            }
+            select {
+            case frame := <-frames:
+                if frame.messageType != tc.want || frame.data != "hello" {
+                    t.Errorf("got type %d %q, want type %d \"hello\"", frame.messageType, frame.data, tc.want)
+                }
+            case <-time.After(time.Second):
+                t.Fatal("the server never got the frame")
+            }
+        })
+    }
+}
+
+func TestSetBinarySwitchesTheDefaultBack(t *testing.T) {
+    frames := make(chan receivedFrame, 2)
+    ws := NewWebSocketConnection(context.Background(), dialRecordingSocket(t, frames), ConnectionMetadata{})
+    t.Cleanup(func() { ws.Close() })
+
+    ws.SetBinary(true)
+    ws.SendMessage([]byte("binary"))
+    ws.SetBinary(false)
+    ws.SendMessage([]byte("text"))
+
+    want := []receivedFrame{{websocket.BinaryMessage, "binary"}, {websocket.TextMessage, "text"}}
+    for _, w := range want {
+        select {
+        case frame := <-frames:
+            if frame != w {
+                t.Errorf("got %+v, want %+v", frame, w)
+            }
+        case <-time.After(time.Second):
+            t.Fatalf("the server never got %q", w.data)
+        }
+    }
+}
+
+// dialClosingSocket is dialSocket, but the server reports the close frame it gets on 'closes'.
+func dialClosingSocket(t *testing.T, closes chan<- *websocket.CloseError) *websocket.Conn {
+    t.Helper()
+
+    upgrader := websocket.Upgrader{}
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        conn, err := upgrader.Upgrade(w, r, nil)
+        if err != nil {
+            return
+        }
+        defer conn.Close()
+        for {
+            if _, _, err := conn.ReadMessage(); err != nil {
+                closeErr, _ := err.(*websocket.CloseError)
+                closes <- closeErr
+                return
+            }
+        }
+    }))
+    t.Cleanup(server.Close)
+
+    conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+    if err != nil {
+        t.Fatalf("dial: %v", err)
+    }
+    return conn
+}
+
+func TestCloseFrameSaysWhyTheConnectionEnds(t *testing.T) {
+    cases := []struct {
+        name     string
+        close    func(connection IWebSocketConnection) error
+        code     int
+        reason   string
+        buffered bool
+    }{
+        {name: "plain close", close: func(c IWebSocketConnection) error { return c.Close() }, code: websocket.CloseNormalClosure},
+        {name: "shutdown", close: func(c IWebSocketConnection) error {
+            return CloseWith(c, websocket.CloseGoingAway, "server shutting down")
+        }, code: websocket.CloseGoingAway, reason: "server shutting down"},
+        {name: "through the send queue", buffered: true, close: func(c IWebSocketConnection) error {
+            return CloseWith(c, websocket.CloseNormalClosure, "disconnected by an admin")
+        }, code: websocket.CloseNormalClosure, reason: "disconnected by an admin"},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            closes := make(chan *websocket.CloseError, 1)
+            var connection IWebSocketConnection = NewWebSocketConnection(context.Background(), dialClosingSocket(t, closes), ConnectionMetadata{})
+            if tc.buffered {
+                connection = NewBufferedConnection(connection, time.Second, 4)
+            }
+            tc.close(connection)
+
+            select {
+            case got := <-closes:
+                if got == nil || got.Code != tc.code || got.Text != tc.reason {
+                    t.Errorf("got close frame %v, want %d %q", got, tc.code, tc.reason)
+                }
+            case <-time.After(time.Second):
+                t.Fatal("the client never got a close frame")
+            }
+        })
+    }
+}
@@ -0,0 +1,58 @@
+package service
+
+import "sync"
+
+// WorkerPool limits how many messages are processed at the same time.
+// Think of it as the number of chefs in the kitchen: it can be changed
+// while the kitchen is open, and Acquire waits until a chef is free.
+type WorkerPool struct {
+    limit  int // How many workers are allowed right now
+    active int // How many are busy
+    mutex  sync.Mutex
+    cond   *sync.Cond // Wakes up waiters when a worker frees up or the limit grows
+}
+
+// Acquire blocks until a worker slot is free, then takes it.
+func (wp *WorkerPool) Acquire() {
+    wp.mutex.Lock()
+    defer wp.mutex.Unlock()
+
+    for wp.active >= wp.limit {
+        wp.cond.Wait()
+    }
+    wp.active++
+}
+
+// Release hands a slot back.
+func (wp *WorkerPool) Release() {
+    wp.mutex.Lock()
+    defer wp.mutex.Unlock()
+
+    wp.active--
+    wp.cond.Broadcast()
+}
+
+// Resize changes the limit. Shrinking never interrupts busy workers; it only
+// stops new ones from starting until enough of them have finished.
+func (wp *WorkerPool) Resize(limit int) {
+    wp.mutex.Lock()
+    defer wp.mutex.Unlock()
+
+    wp.limit = limit
+    wp.cond.Broadcast()
+}
+
+// Limit returns the current limit.
+func (wp *WorkerPool) Limit() int {
+    wp.mutex.Lock()
+    defer wp.mutex.Unlock()
+
+    return wp.limit
+}
+
+// GetWorkerPool is the Constructor.
+func GetWorkerPool(limit int) *WorkerPool {
+    wp := &WorkerPool{limit: limit}
+    wp.cond = sync.NewCond(&wp.mutex)
+    return wp
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+    "sync"
+    "testing"
+    "time"
+)
+
+func TestGrowingThePoolWakesWaitingWorkers(t *testing.T) {
+    pool := GetWorkerPool(1)
+    pool.Acquire()
+
+    acquired := make(chan struct{})
+    go func() {
+        pool.Acquire()
+        close(acquired)
+    }()
+    select {
+    case <-acquired:
+        t.Fatal("a second worker started past a limit of 1")
+    case <-time.After(20 * time.Millisecond):
+    }
+
+    pool.Resize(2)
+    select {
+    case <-acquired:
+    case <-time.After(time.Second):
+        t.Fatal("growing the pool didn't let the waiting worker start")
+    }
+}
+
+func TestPoolNeverRunsMoreThanItsLimitWhileResized(t *testing.T) {
+    pool := GetWorkerPool(4)
+    var mutex sync.Mutex
+    active, overLimit := 0, false
+
+    var workers sync.WaitGroup
+    for i := 0; i < 50; i++ {
+        workers.Add(1)
+        go func() {
+            defer workers.Done()
+            pool.Acquire()
+            defer pool.Release()
+
+            mutex.Lock()
+            active++
+            if active > 4 {
+                overLimit = true
+            }
+            mutex.Unlock()
+            time.Sleep(time.Millisecond)
+            mutex.Lock()
+            active--
+            mutex.Unlock()
+        }()
+    }
+    // Shrink and grow while the workers run; the limit never goes above 4.
+    for _, limit := range []int{1, 3, 2, 4} {
+        pool.Resize(limit)
+        time.Sleep(2 * time.Millisecond)
+    }
+    workers.Wait()
+
+    if overLimit {
+        t.Error("more than 4 workers ran at once")
+    }
+    if pool.Limit() != 4 {
+        t.Errorf("limit: got %d, want 4", pool.Limit())
+    }
+}
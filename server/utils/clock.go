@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"context"
+	"time"
+)
+
+// IClock is everything the app needs to know about time.
+// Code calls utils.Clock instead of the time package directly, so a fake
+// clock can be swapped in to make timing (cook time, latency, rates) predictable.
+type IClock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	Sleep(d time.Duration)
+	// NewTimer starts a timer that fires once, after d on this clock.
+	NewTimer(d time.Duration) *time.Timer
+}
+
+// RealClock is the wall clock.
+type RealClock struct{}
+
+func (RealClock) Now() time.Time                       { return time.Now() }
+func (RealClock) Since(t time.Time) time.Duration      { return time.Since(t) }
+func (RealClock) Sleep(d time.Duration)                { time.Sleep(d) }
+func (RealClock) NewTimer(d time.Duration) *time.Timer { return time.NewTimer(d) }
+
+// Clock is the clock used across the app.
+var Clock IClock = RealClock{}
+
+// SleepContext sleeps on Clock for d, but gives up as soon as ctx is done and returns its error.
+// The timer is stopped either way, so a cancelled sleep leaves nothing running behind it.
+func SleepContext(ctx context.Context, d time.Duration) error {
+	timer := Clock.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
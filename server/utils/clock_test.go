@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// fastClock is a fake clock on which every timer fires right away.
+type fastClock struct {
+	RealClock
+	timers int
+}
+
+func (fc *fastClock) NewTimer(d time.Duration) *time.Timer {
+	fc.timers++
+	return time.NewTimer(0)
+}
+
+func TestSleepContextSleepsOnTheClock(t *testing.T) {
+	clock := &fastClock{}
+	Clock = clock
+	t.Cleanup(func() { Clock = RealClock{} })
+
+	start := time.Now()
+	if err := SleepContext(context.Background(), time.Hour); err != nil {
+		t.Fatalf("got %v", err)
+	}
+	if clock.timers != 1 || time.Since(start) > time.Second {
+		t.Errorf("the fake clock wasn't used: %d timer(s), took %v", clock.timers, time.Since(start))
+	}
+}
+
+func TestSleepContextStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	before := runtime.NumGoroutine()
+
+	done := make(chan error, 1)
+	go func() { done <- SleepContext(ctx, time.Hour) }()
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("got %v, want context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("SleepContext kept sleeping after the cancel")
+	}
+
+	// Nothing is left sleeping behind the cancelled call.
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("%d goroutine(s) before, %d after the cancelled sleep", before, after)
+	}
+}
@@ -1,6 +1,8 @@
 package utils
 
 import (
+	cryptorand "crypto/rand"
+	"encoding/hex"
 	"math/rand"
 	"time"
 )
@@ -11,7 +13,17 @@ func GenerateRandomDuration(max ,min int) time.Duration{
 		panic("Invalid range of time")
 
 	}
-	rand.Seed(time.Now().UnixNano())
-	radomSec :=rand.Intn(max-min+1) * int(time.Second)
-	return time.Duration(radomSec) *time.Second
-}
\ No newline at end of file
+	// rand is auto-seeded since Go 1.20; the result is min..max whole seconds.
+	randomSec := rand.Intn(max-min+1) + min
+	return time.Duration(randomSec) * time.Second
+}
+
+// RandomId returns a random 16-character hex ID, e.g. for request and correlation IDs.
+func RandomId() string {
+	buf := make([]byte, 8)
+	if _, err := cryptorand.Read(buf); err != nil {
+		// Extremely unlikely; fall back to the clock so we never return an empty ID.
+		return hex.EncodeToString([]byte(time.Now().Format("150405.000000")))
+	}
+	return hex.EncodeToString(buf)
+}